@@ -2,13 +2,17 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v4"
 )
 
 // EventHandler handles signaling events
@@ -24,14 +28,118 @@ type EventHandler interface {
 	OnDisconnected()
 }
 
+// AppStatusHandler can optionally be implemented by an EventHandler to be
+// told when other apps go online or offline
+type AppStatusHandler interface {
+	OnAppStatus(payload AppStatusPayload)
+}
+
+// DisconnectHandler can optionally be implemented by an EventHandler to be
+// told why the connection closed. If implemented, OnDisconnectedWithReason
+// is called instead of OnDisconnected, with the code and reason of the
+// close frame: the server's, or the one sent by CloseWithReason if the
+// server did not answer. A connection lost without a close frame reports
+// websocket.CloseAbnormalClosure (1006) and the read error as the reason.
+type DisconnectHandler interface {
+	OnDisconnectedWithReason(code int, reason string)
+}
+
+// AppIDChangeHandler can optionally be implemented by an EventHandler to be
+// told when a re-registration, e.g. after a reconnect, assigns a different
+// app ID than the previous registration
+type AppIDChangeHandler interface {
+	OnAppIDChanged(previousAppID, appID string)
+}
+
+// CustomMessageHandler can optionally be implemented by an EventHandler to
+// receive messages of types the client does not handle itself, e.g. ones a
+// deployment has added to the server (see SignalingClient.SendCustom). The
+// payload is passed through undecoded.
+type CustomMessageHandler interface {
+	OnCustomMessage(msgType string, payload json.RawMessage)
+}
+
 // ClientConfig configuration for SignalingClient
 type ClientConfig struct {
 	ServerURL    string        // WebSocket URL (e.g., wss://example.com/ws/app)
 	APIKey       string        // API key for authentication
 	AppName      string        // Application name
 	Capabilities []string      // App capabilities (e.g., ["print", "scrape"])
-	Handler      EventHandler  // Event handler
+	Handler      EventHandler  // Event handler (or use SetHandler)
 	PingInterval time.Duration // Ping interval (default: 30s)
+
+	// Token is a bearer token (e.g. a JWT) for authentication. When set, it
+	// is sent as an "Authorization: Bearer" header on the WebSocket handshake
+	// and in the auth message, and the API key is no longer put in the URL
+	// query string. If both are set, both are sent in the auth message and
+	// the server decides which to use (API key first for apps).
+	Token string
+
+	// Header is sent with the WebSocket handshake (e.g. Origin or custom auth headers)
+	Header http.Header
+	// TLSConfig is used for wss:// connections (e.g. client certificates)
+	TLSConfig *tls.Config
+	// HandshakeTimeout limits the WebSocket handshake (default: 45s)
+	HandshakeTimeout time.Duration
+	// Subprotocols are the WebSocket subprotocols to request
+	Subprotocols []string
+
+	// AppPingInterval enables application-level ping messages sent at this
+	// interval, independent of WebSocket control frames (default: disabled)
+	AppPingInterval time.Duration
+	// AppPongTimeout is how long to wait for a pong after a ping before the
+	// connection is treated as dead and closed (default: AppPingInterval)
+	AppPongTimeout time.Duration
+
+	// ICEServers are the STUN/TURN servers for peers created with
+	// SignalingClient.NewPeerConnection. PeerConfig.ICEServers takes
+	// precedence when set (default: Google's public STUN server)
+	ICEServers []webrtc.ICEServer
+
+	// CloseTimeout is how long Close waits for the server to answer the
+	// close frame before dropping the connection (default: no wait)
+	CloseTimeout time.Duration
+
+	// QueueUntilAuthenticated makes offers, answers, ICE candidates and app
+	// registrations sent before auth_ok wait and go out, in order, once it
+	// arrives, instead of failing with ErrNotAuthenticated. Queued messages
+	// are dropped if the connection closes first.
+	QueueUntilAuthenticated bool
+
+	// DisableAutoRegister stops the client from sending app_register after
+	// each auth_ok, e.g. for browser-type clients or apps that compute their
+	// capabilities later. Call RegisterApp or RegisterAppWithCapabilities
+	// once authenticated instead, again after each reconnect.
+	DisableAutoRegister bool
+}
+
+// ErrNotAuthenticated is returned when sending a signaling message that
+// requires authentication before the server has answered with auth_ok
+var ErrNotAuthenticated = errors.New("not authenticated")
+
+// ErrAuthFailed is returned by ConnectAndAuthenticate when the server
+// answers with auth_error
+var ErrAuthFailed = errors.New("authentication failed")
+
+// isBuiltinType reports whether msgType is one of the MsgType constants
+func isBuiltinType(msgType string) bool {
+	switch msgType {
+	case MsgTypeAuth, MsgTypeAuthOK, MsgTypeAuthError,
+		MsgTypeAppRegister, MsgTypeAppRegistered, MsgTypeAppStatus, MsgTypeGetApps, MsgTypeAppsList,
+		MsgTypeOffer, MsgTypeAnswer, MsgTypeICE,
+		MsgTypePing, MsgTypePong, MsgTypeError:
+		return true
+	}
+	return false
+}
+
+// requiresAuth reports whether the server ignores msgType before auth_ok
+func requiresAuth(msgType string) bool {
+	switch msgType {
+	case MsgTypeOffer, MsgTypeAnswer, MsgTypeICE, MsgTypeAppRegister:
+		return true
+	}
+	return false
 }
 
 // SignalingClient manages WebSocket connection to signaling server
@@ -44,6 +152,15 @@ type SignalingClient struct {
 	ctx             context.Context
 	cancel          context.CancelFunc
 	done            chan struct{}
+	readDone        chan struct{}
+	lastPong        time.Time
+	queued          [][]byte      // Messages waiting for auth_ok (QueueUntilAuthenticated)
+	authDone        chan struct{} // Closed when auth_ok or auth_error arrives
+	authErr         error         // Set before authDone is closed
+	appID           string        // From the last app_registered, kept across reconnects
+	appRegistered   bool          // app_registered arrived on the current connection
+	closeCode       int           // Sent by the last CloseWithReason
+	closeReason     string
 }
 
 // NewSignalingClient creates a new SignalingClient
@@ -51,12 +168,28 @@ func NewSignalingClient(config ClientConfig) *SignalingClient {
 	if config.PingInterval == 0 {
 		config.PingInterval = 30 * time.Second
 	}
+	if config.AppPingInterval > 0 && config.AppPongTimeout == 0 {
+		config.AppPongTimeout = config.AppPingInterval
+	}
 	return &SignalingClient{
 		config: config,
 		done:   make(chan struct{}),
 	}
 }
 
+// SetHandler sets the event handler after construction, so a handler that
+// needs a reference to the client can be wired to it. It must be called
+// before Connect; changing the handler of a connected client is an error.
+func (c *SignalingClient) SetHandler(handler EventHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isConnected {
+		return fmt.Errorf("cannot set handler while connected")
+	}
+	c.config.Handler = handler
+	return nil
+}
+
 // Connect establishes WebSocket connection and authenticates
 func (c *SignalingClient) Connect(ctx context.Context) error {
 	c.mu.Lock()
@@ -66,19 +199,29 @@ func (c *SignalingClient) Connect(ctx context.Context) error {
 	}
 
 	c.ctx, c.cancel = context.WithCancel(ctx)
+	// The pumps use this connection's context; a reconnect replaces c.ctx
+	connCtx := c.ctx
 	c.mu.Unlock()
 
-	// Build URL with API key
+	// Build URL, with the API key in the query string unless a token is used
 	u, err := url.Parse(c.config.ServerURL)
 	if err != nil {
 		return fmt.Errorf("invalid server URL: %w", err)
 	}
-	q := u.Query()
-	q.Set("apiKey", c.config.APIKey)
-	u.RawQuery = q.Encode()
+	header := c.config.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if c.config.Token != "" {
+		header.Set("Authorization", "Bearer "+c.config.Token)
+	} else {
+		q := u.Query()
+		q.Set("apiKey", c.config.APIKey)
+		u.RawQuery = q.Encode()
+	}
 
 	// Connect WebSocket
-	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, u.String(), nil)
+	conn, _, err := c.dialer().DialContext(connCtx, u.String(), header)
 	if err != nil {
 		return fmt.Errorf("websocket dial failed: %w", err)
 	}
@@ -86,6 +229,11 @@ func (c *SignalingClient) Connect(ctx context.Context) error {
 	c.mu.Lock()
 	c.conn = conn
 	c.isConnected = true
+	c.lastPong = time.Now()
+	c.readDone = make(chan struct{})
+	c.authDone = make(chan struct{})
+	c.authErr = nil
+	c.appRegistered = false
 	c.mu.Unlock()
 
 	if c.config.Handler != nil {
@@ -93,8 +241,11 @@ func (c *SignalingClient) Connect(ctx context.Context) error {
 	}
 
 	// Start message handler
-	go c.readPump()
-	go c.pingPump()
+	go c.readPump(connCtx)
+	go c.pingPump(connCtx)
+	if c.config.AppPingInterval > 0 {
+		go c.appPingPump(connCtx)
+	}
 
 	// Send auth message
 	if err := c.sendAuth(); err != nil {
@@ -105,32 +256,123 @@ func (c *SignalingClient) Connect(ctx context.Context) error {
 	return nil
 }
 
-// Close disconnects from the server
-func (c *SignalingClient) Close() error {
+// ConnectAndAuthenticate connects like Connect, then waits for the server
+// to answer the auth message. It returns nil once auth_ok has arrived and
+// OnAuthenticated has been called, an error wrapping ErrAuthFailed on
+// auth_error, or ctx.Err() if ctx is done first. The client is closed on
+// failure. As with Connect, ctx also bounds the lifetime of the connection.
+func (c *SignalingClient) ConnectAndAuthenticate(ctx context.Context) error {
+	if err := c.Connect(ctx); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	authDone := c.authDone
+	readDone := c.readDone
+	c.mu.RUnlock()
+	if authDone == nil || readDone == nil {
+		return fmt.Errorf("connection closed before authentication")
+	}
+
+	select {
+	case <-authDone:
+		c.mu.RLock()
+		err := c.authErr
+		c.mu.RUnlock()
+		if err != nil {
+			c.Close()
+			return err
+		}
+		return nil
+	case <-readDone:
+		return fmt.Errorf("connection closed before authentication")
+	case <-ctx.Done():
+		c.Close()
+		return ctx.Err()
+	}
+}
+
+// finishAuth records the server's answer to the auth message and wakes
+// ConnectAndAuthenticate. Only the first answer per connection counts.
+func (c *SignalingClient) finishAuth(err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.authDone == nil {
+		return
+	}
+	select {
+	case <-c.authDone:
+	default:
+		c.authErr = err
+		close(c.authDone)
+	}
+}
+
+// dialer returns a WebSocket dialer with the configured dial options applied.
+// Unset options keep the websocket.DefaultDialer values.
+func (c *SignalingClient) dialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	if c.config.TLSConfig != nil {
+		d.TLSClientConfig = c.config.TLSConfig
+	}
+	if c.config.HandshakeTimeout > 0 {
+		d.HandshakeTimeout = c.config.HandshakeTimeout
+	}
+	if len(c.config.Subprotocols) > 0 {
+		d.Subprotocols = c.config.Subprotocols
+	}
+	return &d
+}
 
+// Close disconnects from the server with a normal closure
+func (c *SignalingClient) Close() error {
+	return c.CloseWithReason(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithReason disconnects from the server, sending code and reason in
+// the close frame so the server can tell a clean shutdown from a crash.
+// If CloseTimeout is set, it waits up to that long for the server's close
+// frame before closing the connection.
+func (c *SignalingClient) CloseWithReason(code int, reason string) error {
+	c.mu.Lock()
 	if !c.isConnected {
+		c.mu.Unlock()
 		return nil
 	}
 
 	c.isConnected = false
 	c.isAuthenticated = false
+	c.queued = nil
+	c.closeCode = code
+	c.closeReason = reason
 
 	if c.cancel != nil {
 		c.cancel()
 	}
 
-	if c.conn != nil {
+	conn := c.conn
+	readDone := c.readDone
+	c.conn = nil
+	if conn != nil {
 		// Send close message
-		c.conn.WriteMessage(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		err := c.conn.Close()
-		c.conn = nil
-		return err
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason))
 	}
+	c.mu.Unlock()
 
-	return nil
+	if conn == nil {
+		return nil
+	}
+
+	// The read loop returns once the server's close frame arrives
+	if c.config.CloseTimeout > 0 && readDone != nil {
+		select {
+		case <-readDone:
+		case <-time.After(c.config.CloseTimeout):
+		}
+	}
+
+	return conn.Close()
 }
 
 // IsConnected returns connection status
@@ -140,33 +382,90 @@ func (c *SignalingClient) IsConnected() bool {
 	return c.isConnected && c.isAuthenticated
 }
 
+// AppID returns the app ID assigned by the last app_registered message, or
+// "" if the app has never been registered. It is kept across disconnects;
+// the client re-registers after each auth_ok, and the new registration
+// replaces it (see AppIDChangeHandler).
+func (c *SignalingClient) AppID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.appID
+}
+
+// IsAppRegistered reports whether the server has confirmed the app's
+// registration on the current connection
+func (c *SignalingClient) IsAppRegistered() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isConnected && c.appRegistered
+}
+
 // SendAnswer sends WebRTC answer SDP
 func (c *SignalingClient) SendAnswer(sdp string, requestID string) error {
 	payload := AnswerPayload{SDP: sdp}
 	return c.sendMessage(MsgTypeAnswer, payload, requestID)
 }
 
+// SendOffer sends a WebRTC offer SDP to the app with the given ID
+func (c *SignalingClient) SendOffer(sdp string, targetAppID string) error {
+	payload := OfferPayload{SDP: sdp, TargetAppID: targetAppID}
+	return c.sendMessage(MsgTypeOffer, payload, "")
+}
+
 // SendICE sends ICE candidate
 func (c *SignalingClient) SendICE(candidate json.RawMessage) error {
 	payload := ICEPayload{Candidate: candidate}
 	return c.sendMessage(MsgTypeICE, payload, "")
 }
 
+// SendEndOfCandidates tells the remote peer that no more ICE candidates
+// will follow, by sending an empty candidate
+func (c *SignalingClient) SendEndOfCandidates() error {
+	return c.SendICE(json.RawMessage(`{"candidate":""}`))
+}
+
+// SendCustom sends a message of a type the library does not define, e.g.
+// one a deployment has added to the server, with payload marshaled to JSON.
+// Replies of such types reach a handler implementing CustomMessageHandler.
+// msgType must not be empty or one of the MsgType constants, which have
+// their own methods. Like offers, custom messages are only sent once
+// authenticated (see ClientConfig.QueueUntilAuthenticated).
+func (c *SignalingClient) SendCustom(msgType string, payload interface{}, requestID string) error {
+	if msgType == "" {
+		return fmt.Errorf("custom message type is empty")
+	}
+	if isBuiltinType(msgType) {
+		return fmt.Errorf("%s is a built-in message type", msgType)
+	}
+	return c.sendMessageAuth(msgType, payload, requestID, true)
+}
+
 func (c *SignalingClient) sendAuth() error {
-	payload := AuthPayload{APIKey: c.config.APIKey}
+	payload := AuthPayload{APIKey: c.config.APIKey, Token: c.config.Token}
 	return c.sendMessage(MsgTypeAuth, payload, "")
 }
 
 // RegisterApp registers the app with name and capabilities
 func (c *SignalingClient) RegisterApp() error {
+	return c.RegisterAppWithCapabilities(c.config.Capabilities)
+}
+
+// RegisterAppWithCapabilities registers the app with its configured name and
+// the given capabilities instead of ClientConfig.Capabilities
+func (c *SignalingClient) RegisterAppWithCapabilities(capabilities []string) error {
 	payload := AppRegisterPayload{
 		Name:         c.config.AppName,
-		Capabilities: c.config.Capabilities,
+		Capabilities: capabilities,
 	}
 	return c.sendMessage(MsgTypeAppRegister, payload, "")
 }
 
 func (c *SignalingClient) sendMessage(msgType string, payload interface{}, requestID string) error {
+	return c.sendMessageAuth(msgType, payload, requestID, requiresAuth(msgType))
+}
+
+// sendMessageAuth sends a message, holding it back until auth_ok if needsAuth
+func (c *SignalingClient) sendMessageAuth(msgType string, payload interface{}, requestID string, needsAuth bool) error {
 	c.mu.RLock()
 	conn := c.conn
 	c.mu.RUnlock()
@@ -196,37 +495,84 @@ func (c *SignalingClient) sendMessage(msgType string, payload interface{}, reque
 	if c.conn == nil {
 		return fmt.Errorf("connection closed")
 	}
+	if needsAuth && !c.isAuthenticated {
+		if c.config.QueueUntilAuthenticated {
+			c.queued = append(c.queued, msgJSON)
+			return nil
+		}
+		return fmt.Errorf("cannot send %s: %w", msgType, ErrNotAuthenticated)
+	}
 	return c.conn.WriteMessage(websocket.TextMessage, msgJSON)
 }
 
-func (c *SignalingClient) readPump() {
+// setAuthenticated marks the client authenticated and sends the messages
+// queued until then. The lock is held so later sends cannot overtake them.
+func (c *SignalingClient) setAuthenticated() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.isAuthenticated = true
+
+	queued := c.queued
+	c.queued = nil
+	for _, msgJSON := range queued {
+		if c.conn == nil {
+			return fmt.Errorf("connection closed")
+		}
+		if err := c.conn.WriteMessage(websocket.TextMessage, msgJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SignalingClient) readPump(ctx context.Context) {
+	c.mu.RLock()
+	conn := c.conn
+	readDone := c.readDone
+	c.mu.RUnlock()
+
+	closeCode := websocket.CloseAbnormalClosure
+	closeReason := ""
+
 	defer func() {
 		c.mu.Lock()
-		c.isConnected = false
-		c.isAuthenticated = false
+		// After Close, Connect may already have opened a new connection
+		// whose state must not be reset
+		if c.conn == nil || c.conn == conn {
+			c.isConnected = false
+			c.isAuthenticated = false
+			c.appRegistered = false
+			c.queued = nil
+		}
 		c.mu.Unlock()
-		if c.config.Handler != nil {
+		if h, ok := c.config.Handler.(DisconnectHandler); ok {
+			h.OnDisconnectedWithReason(closeCode, closeReason)
+		} else if c.config.Handler != nil {
 			c.config.Handler.OnDisconnected()
 		}
+		close(readDone)
 	}()
 
-	for {
-		select {
-		case <-c.ctx.Done():
-			return
-		default:
-		}
-
-		c.mu.RLock()
-		conn := c.conn
-		c.mu.RUnlock()
-		if conn == nil {
-			return
-		}
+	if conn == nil {
+		return
+	}
 
+	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				closeCode, closeReason = closeErr.Code, closeErr.Text
+			} else if ctx.Err() != nil {
+				// Closed locally before the server answered
+				c.mu.RLock()
+				closeCode, closeReason = c.closeCode, c.closeReason
+				c.mu.RUnlock()
+			} else {
+				closeReason = err.Error()
+			}
+			// After Close, the server echoing our close code is expected
+			if ctx.Err() == nil && websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				if c.config.Handler != nil {
 					c.config.Handler.OnError(fmt.Sprintf("websocket error: %v", err))
 				}
@@ -234,17 +580,23 @@ func (c *SignalingClient) readPump() {
 			return
 		}
 
+		// Keep reading until the server's close frame, but drop messages
+		// that arrive after Close
+		if ctx.Err() != nil {
+			continue
+		}
+
 		c.handleMessage(message)
 	}
 }
 
-func (c *SignalingClient) pingPump() {
+func (c *SignalingClient) pingPump(ctx context.Context) {
 	ticker := time.NewTicker(c.config.PingInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			c.mu.RLock()
@@ -263,6 +615,38 @@ func (c *SignalingClient) pingPump() {
 	}
 }
 
+// appPingPump sends application-level pings and closes the connection
+// if the server stops answering them
+func (c *SignalingClient) appPingPump(ctx context.Context) {
+	ticker := time.NewTicker(c.config.AppPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.RLock()
+			sinceLastPong := time.Since(c.lastPong)
+			c.mu.RUnlock()
+
+			// The previous ping should have been answered by now
+			if sinceLastPong > c.config.AppPingInterval+c.config.AppPongTimeout {
+				if c.config.Handler != nil {
+					c.config.Handler.OnError(fmt.Sprintf("no pong received for %v, closing connection", sinceLastPong.Round(time.Millisecond)))
+				}
+				c.Close()
+				return
+			}
+
+			payload := PingPayload{Timestamp: time.Now().UnixMilli()}
+			if err := c.sendMessage(MsgTypePing, payload, ""); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (c *SignalingClient) handleMessage(data []byte) {
 	var msg WSMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
@@ -276,14 +660,18 @@ func (c *SignalingClient) handleMessage(data []byte) {
 	case MsgTypeAuthOK:
 		var payload AuthOKPayload
 		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
-			c.mu.Lock()
-			c.isAuthenticated = true
-			c.mu.Unlock()
+			err := c.setAuthenticated()
 			if c.config.Handler != nil {
+				if err != nil {
+					c.config.Handler.OnError(fmt.Sprintf("failed to send queued messages: %v", err))
+				}
 				c.config.Handler.OnAuthenticated(payload)
 			}
+			c.finishAuth(nil)
 			// Auto-register app after auth
-			c.RegisterApp()
+			if !c.config.DisableAutoRegister {
+				c.RegisterApp()
+			}
 		}
 
 	case MsgTypeAuthError:
@@ -292,14 +680,34 @@ func (c *SignalingClient) handleMessage(data []byte) {
 			if c.config.Handler != nil {
 				c.config.Handler.OnAuthError(payload)
 			}
+			c.finishAuth(fmt.Errorf("%w: %s", ErrAuthFailed, payload.Error))
 		}
 
 	case MsgTypeAppRegistered:
 		var payload AppRegisteredPayload
 		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+			c.mu.Lock()
+			previousAppID := c.appID
+			c.appID = payload.AppID
+			c.appRegistered = true
+			c.mu.Unlock()
+
 			if c.config.Handler != nil {
 				c.config.Handler.OnAppRegistered(payload)
 			}
+			if previousAppID != "" && previousAppID != payload.AppID {
+				if h, ok := c.config.Handler.(AppIDChangeHandler); ok {
+					h.OnAppIDChanged(previousAppID, payload.AppID)
+				}
+			}
+		}
+
+	case MsgTypeAppStatus:
+		var payload AppStatusPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+			if h, ok := c.config.Handler.(AppStatusHandler); ok {
+				h.OnAppStatus(payload)
+			}
 		}
 
 	case MsgTypeOffer:
@@ -326,6 +734,19 @@ func (c *SignalingClient) handleMessage(data []byte) {
 			}
 		}
 
+	case MsgTypePing:
+		// Answer server pings, echoing the timestamp if present
+		var payload PingPayload
+		if len(msg.Payload) > 0 {
+			json.Unmarshal(msg.Payload, &payload)
+		}
+		c.sendMessage(MsgTypePong, payload, msg.RequestID)
+
+	case MsgTypePong:
+		c.mu.Lock()
+		c.lastPong = time.Now()
+		c.mu.Unlock()
+
 	case MsgTypeError:
 		var payload ErrorPayload
 		if err := json.Unmarshal(msg.Payload, &payload); err == nil {
@@ -333,5 +754,10 @@ func (c *SignalingClient) handleMessage(data []byte) {
 				c.config.Handler.OnError(payload.Message)
 			}
 		}
+
+	default:
+		if h, ok := c.config.Handler.(CustomMessageHandler); ok {
+			h.OnCustomMessage(msg.Type, msg.Payload)
+		}
 	}
 }
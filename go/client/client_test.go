@@ -3,8 +3,12 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -230,6 +234,92 @@ func TestSignalingClientAuthError(t *testing.T) {
 	}
 }
 
+func TestSignalingClientConnectAndAuthenticate(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   *WSMessage // nil: the server never answers the auth message
+		wantErr error
+	}{
+		{
+			name:  "auth_ok",
+			reply: &WSMessage{Type: MsgTypeAuthOK, Payload: json.RawMessage(`{"userId":"test-user","type":"app"}`)},
+		},
+		{
+			name:    "auth_error",
+			reply:   &WSMessage{Type: MsgTypeAuthError, Payload: json.RawMessage(`{"error":"Invalid API key"}`)},
+			wantErr: ErrAuthFailed,
+		},
+		{
+			name:    "no reply",
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				if tt.reply != nil {
+					respBytes, _ := json.Marshal(tt.reply)
+					conn.WriteMessage(websocket.TextMessage, respBytes)
+				}
+
+				// Keep the connection open until the client closes it
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			handler := &mockHandler{}
+			client := NewSignalingClient(ClientConfig{
+				ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+				APIKey:    "test-key",
+				Handler:   handler,
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := client.ConnectAndAuthenticate(ctx)
+			defer client.Close()
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ConnectAndAuthenticate failed: %v", err)
+				}
+				// No waiting: the client is authenticated on return
+				if !client.IsConnected() {
+					t.Error("Client not authenticated after ConnectAndAuthenticate")
+				}
+				handler.mu.Lock()
+				defer handler.mu.Unlock()
+				if !handler.authenticated {
+					t.Error("OnAuthenticated was not called before returning")
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if client.IsConnected() {
+				t.Error("Client should be closed after a failed authentication")
+			}
+		})
+	}
+}
+
 func TestSignalingClientReceiveOffer(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
@@ -295,6 +385,350 @@ func TestSignalingClientReceiveOffer(t *testing.T) {
 	}
 }
 
+// appStatusHandler records app_status messages in addition to mockHandler's events
+type appStatusHandler struct {
+	mockHandler
+	statuses []AppStatusPayload
+}
+
+func (h *appStatusHandler) OnAppStatus(payload AppStatusPayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses = append(h.statuses, payload)
+}
+
+func TestSignalingClientAppStatus(t *testing.T) {
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != MsgTypeAppRegister {
+			return
+		}
+		status := WSMessage{
+			Type:    MsgTypeAppStatus,
+			Payload: json.RawMessage(`{"appId":"app-2","name":"Printer","capabilities":["print"],"status":"online"}`),
+		}
+		statusBytes, _ := json.Marshal(status)
+		conn.WriteMessage(websocket.TextMessage, statusBytes)
+	})
+	defer server.Close()
+
+	handler := &appStatusHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   handler,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if len(handler.statuses) != 1 {
+		t.Fatalf("Expected 1 app status, got %d", len(handler.statuses))
+	}
+	status := handler.statuses[0]
+	if status.AppID != "app-2" || status.Status != "online" || status.Name != "Printer" {
+		t.Errorf("Unexpected app status: %+v", status)
+	}
+	if len(status.Capabilities) != 1 || status.Capabilities[0] != "print" {
+		t.Errorf("Unexpected capabilities: %v", status.Capabilities)
+	}
+}
+
+// customMessageHandler records custom messages in addition to mockHandler's events
+type customMessageHandler struct {
+	mockHandler
+	customTypes    []string
+	customPayloads []json.RawMessage
+}
+
+func (h *customMessageHandler) OnCustomMessage(msgType string, payload json.RawMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.customTypes = append(h.customTypes, msgType)
+	h.customPayloads = append(h.customPayloads, payload)
+}
+
+func TestSignalingClientCustomMessage(t *testing.T) {
+	received := make(chan WSMessage, 1)
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != "device_info" {
+			return
+		}
+		received <- msg
+		reply, _ := json.Marshal(WSMessage{
+			Type:      "device_info_ack",
+			Payload:   json.RawMessage(`{"ok":true}`),
+			RequestID: msg.RequestID,
+		})
+		conn.WriteMessage(websocket.TextMessage, reply)
+	})
+	defer server.Close()
+
+	handler := &customMessageHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   handler,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+	waitAuthenticated(t, client)
+
+	if err := client.SendCustom("", nil, ""); err == nil {
+		t.Error("Expected error for empty custom type")
+	}
+	if err := client.SendCustom(MsgTypeOffer, nil, ""); err == nil {
+		t.Error("Expected error for built-in type")
+	}
+
+	payload := map[string]string{"model": "X1"}
+	if err := client.SendCustom("device_info", payload, "req-7"); err != nil {
+		t.Fatalf("SendCustom failed: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.RequestID != "req-7" {
+			t.Errorf("Expected requestId req-7, got %q", msg.RequestID)
+		}
+		var got map[string]string
+		if err := json.Unmarshal(msg.Payload, &got); err != nil || got["model"] != "X1" {
+			t.Errorf("Unexpected payload: %s", msg.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not receive custom message")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if len(handler.customTypes) != 1 || handler.customTypes[0] != "device_info_ack" {
+		t.Fatalf("Unexpected custom messages: %v", handler.customTypes)
+	}
+	if string(handler.customPayloads[0]) != `{"ok":true}` {
+		t.Errorf("Unexpected custom payload: %s", handler.customPayloads[0])
+	}
+}
+
+// appIDChangeHandler records app ID changes in addition to mockHandler's events
+type appIDChangeHandler struct {
+	mockHandler
+	changes [][2]string
+}
+
+func (h *appIDChangeHandler) OnAppIDChanged(previousAppID, appID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.changes = append(h.changes, [2]string{previousAppID, appID})
+}
+
+func TestSignalingClientAppIDAcrossReconnects(t *testing.T) {
+	// Each registration gets the next ID; the server keeps the app's ID
+	// for one reconnect, then assigns a new one
+	var mu sync.Mutex
+	appIDs := []string{"app-1", "app-1", "app-2"}
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != MsgTypeAppRegister {
+			return
+		}
+		mu.Lock()
+		appID := appIDs[0]
+		appIDs = appIDs[1:]
+		mu.Unlock()
+		resp, _ := json.Marshal(WSMessage{
+			Type:    MsgTypeAppRegistered,
+			Payload: json.RawMessage(fmt.Sprintf(`{"appId":%q}`, appID)),
+		})
+		conn.WriteMessage(websocket.TextMessage, resp)
+	})
+	defer server.Close()
+
+	handler := &appIDChangeHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   handler,
+	})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if client.AppID() != "" {
+		t.Errorf("Expected no app ID before registering, got %q", client.AppID())
+	}
+
+	for i, want := range []string{"app-1", "app-1", "app-2"} {
+		if i > 0 {
+			client.Close()
+			if client.IsAppRegistered() {
+				t.Error("Expected IsAppRegistered to be false after Close")
+			}
+			if client.AppID() == "" {
+				t.Error("Expected the app ID to be kept after Close")
+			}
+		}
+		if err := client.ConnectAndAuthenticate(ctx); err != nil {
+			t.Fatalf("Connect %d failed: %v", i, err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for !client.IsAppRegistered() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Connect %d: app was not registered", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if client.AppID() != want {
+			t.Errorf("Connect %d: expected app ID %q, got %q", i, want, client.AppID())
+		}
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.changes) != 1 || handler.changes[0] != [2]string{"app-1", "app-2"} {
+		t.Errorf("Expected one change from app-1 to app-2, got %v", handler.changes)
+	}
+}
+
+func TestSignalingClientAutoRegister(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disable=%v", disable), func(t *testing.T) {
+			registers := make(chan AppRegisterPayload, 10)
+			server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+				if msg.Type != MsgTypeAppRegister {
+					return
+				}
+				var payload AppRegisterPayload
+				json.Unmarshal(msg.Payload, &payload)
+				registers <- payload
+				resp, _ := json.Marshal(WSMessage{
+					Type:    MsgTypeAppRegistered,
+					Payload: json.RawMessage(`{"appId":"app-1"}`),
+				})
+				conn.WriteMessage(websocket.TextMessage, resp)
+			})
+			defer server.Close()
+
+			client := NewSignalingClient(ClientConfig{
+				ServerURL:           "ws" + strings.TrimPrefix(server.URL, "http"),
+				APIKey:              "test-key",
+				AppName:             "TestApp",
+				Capabilities:        []string{"print"},
+				Handler:             &mockHandler{},
+				DisableAutoRegister: disable,
+			})
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := client.ConnectAndAuthenticate(ctx); err != nil {
+				t.Fatalf("ConnectAndAuthenticate failed: %v", err)
+			}
+
+			wantCapability := "print"
+			if disable {
+				select {
+				case payload := <-registers:
+					t.Fatalf("Unexpected automatic registration: %+v", payload)
+				case <-time.After(100 * time.Millisecond):
+				}
+				if client.IsAppRegistered() {
+					t.Error("Expected the app not to be registered")
+				}
+
+				wantCapability = "scan"
+				if err := client.RegisterAppWithCapabilities([]string{wantCapability}); err != nil {
+					t.Fatalf("RegisterAppWithCapabilities failed: %v", err)
+				}
+			}
+
+			select {
+			case payload := <-registers:
+				if payload.Name != "TestApp" || len(payload.Capabilities) != 1 || payload.Capabilities[0] != wantCapability {
+					t.Errorf("Unexpected registration: %+v", payload)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("App was not registered")
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for !client.IsAppRegistered() {
+				if time.Now().After(deadline) {
+					t.Fatal("Registration was not confirmed")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+// disconnectHandler records the close code and reason in addition to mockHandler's events
+type disconnectHandler struct {
+	mockHandler
+	closed chan [2]interface{}
+}
+
+func (h *disconnectHandler) OnDisconnectedWithReason(code int, reason string) {
+	h.closed <- [2]interface{}{code, reason}
+}
+
+func TestSignalingClientDisconnectReason(t *testing.T) {
+	// The server revokes the app as soon as it registers
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != MsgTypeAppRegister {
+			return
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "auth revoked"))
+	})
+	defer server.Close()
+
+	handler := &disconnectHandler{closed: make(chan [2]interface{}, 1)}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   handler,
+	})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	select {
+	case got := <-handler.closed:
+		if got != [2]interface{}{4001, "auth revoked"} {
+			t.Errorf("Expected code 4001 and reason 'auth revoked', got %v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnectedWithReason not called")
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.disconnected {
+		t.Error("Expected OnDisconnected not to be called when OnDisconnectedWithReason is implemented")
+	}
+}
+
 func TestMessageTypes(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -309,6 +743,8 @@ func TestMessageTypes(t *testing.T) {
 		{"Offer", MsgTypeOffer, "offer"},
 		{"Answer", MsgTypeAnswer, "answer"},
 		{"ICE", MsgTypeICE, "ice"},
+		{"Ping", MsgTypePing, "ping"},
+		{"Pong", MsgTypePong, "pong"},
 		{"Error", MsgTypeError, "error"},
 	}
 
@@ -320,3 +756,594 @@ func TestMessageTypes(t *testing.T) {
 		})
 	}
 }
+
+// newPingTestServer creates a server that authenticates the client and then
+// hands each subsequent message to onMessage
+func newPingTestServer(t *testing.T, onMessage func(conn *websocket.Conn, msg WSMessage)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg WSMessage
+			json.Unmarshal(data, &msg)
+
+			if msg.Type == MsgTypeAuth {
+				response := WSMessage{
+					Type:    MsgTypeAuthOK,
+					Payload: json.RawMessage(`{"userId":"test-user","type":"app"}`),
+				}
+				respBytes, _ := json.Marshal(response)
+				conn.WriteMessage(websocket.TextMessage, respBytes)
+				continue
+			}
+
+			onMessage(conn, msg)
+		}
+	}))
+}
+
+// waitAuthenticated waits until the client has received auth_ok
+func waitAuthenticated(t *testing.T, client *SignalingClient) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("Client did not authenticate")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSignalingClientSendBeforeAuth(t *testing.T) {
+	for _, queue := range []bool{false, true} {
+		t.Run(fmt.Sprintf("queue=%v", queue), func(t *testing.T) {
+			authOK := make(chan struct{})
+			received := make(chan WSMessage, 10)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				// Hold auth_ok back until the test has tried to send
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				<-authOK
+				respBytes, _ := json.Marshal(WSMessage{
+					Type:    MsgTypeAuthOK,
+					Payload: json.RawMessage(`{"userId":"test-user","type":"app"}`),
+				})
+				conn.WriteMessage(websocket.TextMessage, respBytes)
+
+				for {
+					_, data, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					var msg WSMessage
+					json.Unmarshal(data, &msg)
+					received <- msg
+				}
+			}))
+			defer server.Close()
+
+			client := NewSignalingClient(ClientConfig{
+				ServerURL:               "ws" + strings.TrimPrefix(server.URL, "http"),
+				APIKey:                  "test-key",
+				Handler:                 &mockHandler{},
+				QueueUntilAuthenticated: queue,
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			defer client.Close()
+
+			err := client.SendAnswer("answer-sdp", "req-1")
+			if !queue {
+				if !errors.Is(err, ErrNotAuthenticated) {
+					t.Fatalf("Expected ErrNotAuthenticated, got %v", err)
+				}
+				close(authOK)
+				waitAuthenticated(t, client)
+				if err := client.SendAnswer("answer-sdp", "req-1"); err != nil {
+					t.Fatalf("SendAnswer after auth_ok failed: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Expected SendAnswer to be queued, got %v", err)
+				}
+				close(authOK)
+			}
+
+			// The answer arrives, ahead of the automatic app registration when queued
+			var types []string
+			for len(types) < 2 {
+				select {
+				case msg := <-received:
+					types = append(types, msg.Type)
+					if msg.Type == MsgTypeAnswer && msg.RequestID != "req-1" {
+						t.Errorf("Expected requestId req-1, got %q", msg.RequestID)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Expected 2 messages, got %v", types)
+				}
+			}
+			if !queue {
+				sort.Strings(types)
+			}
+			want := []string{MsgTypeAnswer, MsgTypeAppRegister}
+			if !reflect.DeepEqual(types, want) {
+				t.Errorf("Expected messages %v, got %v", want, types)
+			}
+		})
+	}
+}
+
+func TestAuthOKPayloadExtra(t *testing.T) {
+	var payload AuthOKPayload
+	data := `{"userId":"user-1","type":"app","plan":"pro","scopes":["read","write"]}`
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if payload.UserID != "user-1" || payload.Type != "app" {
+		t.Errorf("Unexpected known fields: %+v", payload)
+	}
+	if len(payload.Extra) != 2 {
+		t.Fatalf("Expected 2 extra fields, got %v", payload.Extra)
+	}
+
+	var plan string
+	if err := json.Unmarshal(payload.Extra["plan"], &plan); err != nil || plan != "pro" {
+		t.Errorf("Expected plan 'pro', got %q (%v)", plan, err)
+	}
+	var scopes []string
+	if err := json.Unmarshal(payload.Extra["scopes"], &scopes); err != nil || len(scopes) != 2 || scopes[1] != "write" {
+		t.Errorf("Expected scopes [read write], got %v (%v)", scopes, err)
+	}
+
+	// Payloads with only known fields have no extras
+	payload = AuthOKPayload{}
+	if err := json.Unmarshal([]byte(`{"userId":"user-1","type":"app"}`), &payload); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if payload.Extra != nil {
+		t.Errorf("Expected nil Extra, got %v", payload.Extra)
+	}
+
+	if err := json.Unmarshal([]byte(`{"userId":1}`), &payload); err == nil {
+		t.Error("Expected error for invalid userId")
+	}
+}
+
+func TestSignalingClientAppPing(t *testing.T) {
+	var mu sync.Mutex
+	pings := 0
+
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != MsgTypePing {
+			return
+		}
+		mu.Lock()
+		pings++
+		mu.Unlock()
+
+		response := WSMessage{Type: MsgTypePong, Payload: msg.Payload}
+		respBytes, _ := json.Marshal(response)
+		conn.WriteMessage(websocket.TextMessage, respBytes)
+	})
+	defer server.Close()
+
+	handler := &mockHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL:       "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:          "test-key",
+		Handler:         handler,
+		AppPingInterval: 20 * time.Millisecond,
+		AppPongTimeout:  20 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	time.Sleep(150 * time.Millisecond)
+
+	mu.Lock()
+	gotPings := pings
+	mu.Unlock()
+	if gotPings < 3 {
+		t.Errorf("Expected at least 3 pings, got %d", gotPings)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.disconnected {
+		t.Error("Client should stay connected while pongs arrive")
+	}
+}
+
+func TestSignalingClientAppPongTimeout(t *testing.T) {
+	// Server that never answers pings
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {})
+	defer server.Close()
+
+	handler := &mockHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL:       "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:          "test-key",
+		Handler:         handler,
+		AppPingInterval: 20 * time.Millisecond,
+		AppPongTimeout:  20 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if client.IsConnected() {
+		t.Error("Client should be closed after missing pongs")
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if !handler.disconnected {
+		t.Error("OnDisconnected was not called")
+	}
+	if len(handler.errors) == 0 {
+		t.Error("Expected an error about the missing pong")
+	}
+}
+
+func TestSignalingClientAnswersServerPing(t *testing.T) {
+	pongs := make(chan WSMessage, 1)
+
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		switch msg.Type {
+		case MsgTypeAppRegister:
+			ping := WSMessage{Type: MsgTypePing, Payload: json.RawMessage(`{"timestamp":1234}`)}
+			pingBytes, _ := json.Marshal(ping)
+			conn.WriteMessage(websocket.TextMessage, pingBytes)
+		case MsgTypePong:
+			pongs <- msg
+		}
+	})
+	defer server.Close()
+
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   &mockHandler{},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case msg := <-pongs:
+		var payload PingPayload
+		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+			t.Fatalf("Invalid pong payload: %v", err)
+		}
+		if payload.Timestamp != 1234 {
+			t.Errorf("Expected echoed timestamp 1234, got %d", payload.Timestamp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No pong received")
+	}
+}
+
+func TestSignalingClientBearerToken(t *testing.T) {
+	type handshake struct {
+		authorization string
+		query         string
+		auth          AuthPayload
+	}
+	received := make(chan handshake, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg WSMessage
+		json.Unmarshal(data, &msg)
+		var auth AuthPayload
+		json.Unmarshal(msg.Payload, &auth)
+
+		received <- handshake{
+			authorization: r.Header.Get("Authorization"),
+			query:         r.URL.RawQuery,
+			auth:          auth,
+		}
+	}))
+	defer server.Close()
+
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-api-key",
+		Token:     "test-jwt",
+		Handler:   &mockHandler{},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case h := <-received:
+		if h.authorization != "Bearer test-jwt" {
+			t.Errorf("Expected bearer Authorization header, got %q", h.authorization)
+		}
+		if strings.Contains(h.query, "apiKey") {
+			t.Errorf("API key should not be in the query string when a token is set, got %q", h.query)
+		}
+		if h.auth.Token != "test-jwt" {
+			t.Errorf("Expected token in auth message, got %q", h.auth.Token)
+		}
+		if h.auth.APIKey != "test-api-key" {
+			t.Errorf("Expected API key in auth message, got %q", h.auth.APIKey)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not receive auth message")
+	}
+}
+
+func TestSignalingClientDialOptions(t *testing.T) {
+	type handshake struct {
+		origin      string
+		custom      string
+		subprotocol string
+	}
+	received := make(chan handshake, 1)
+
+	subprotocolUpgrader := websocket.Upgrader{
+		CheckOrigin:  func(r *http.Request) bool { return true },
+		Subprotocols: []string{"signaling.v1"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := subprotocolUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		received <- handshake{
+			origin:      r.Header.Get("Origin"),
+			custom:      r.Header.Get("X-Custom"),
+			subprotocol: conn.Subprotocol(),
+		}
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Origin", "https://example.com")
+	header.Set("X-Custom", "value")
+
+	client := NewSignalingClient(ClientConfig{
+		ServerURL:        "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:           "test-key",
+		Handler:          &mockHandler{},
+		Header:           header,
+		HandshakeTimeout: time.Second,
+		Subprotocols:     []string{"signaling.v1"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case h := <-received:
+		if h.origin != "https://example.com" {
+			t.Errorf("Expected Origin header, got %q", h.origin)
+		}
+		if h.custom != "value" {
+			t.Errorf("Expected X-Custom header, got %q", h.custom)
+		}
+		if h.subprotocol != "signaling.v1" {
+			t.Errorf("Expected subprotocol signaling.v1, got %q", h.subprotocol)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not receive handshake")
+	}
+
+	// The caller's header is not modified
+	if header.Get("Authorization") != "" || len(header) != 2 {
+		t.Errorf("Config header was modified: %v", header)
+	}
+}
+
+func TestSignalingClientCloseWithReason(t *testing.T) {
+	closeErrs := make(chan *websocket.CloseError, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				// The default close handler has already answered the close frame
+				if ce, ok := err.(*websocket.CloseError); ok {
+					closeErrs <- ce
+				}
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	handler := &mockHandler{}
+	client := NewSignalingClient(ClientConfig{
+		ServerURL:    "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:       "test-key",
+		Handler:      handler,
+		CloseTimeout: time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.CloseWithReason(websocket.CloseGoingAway, "shutting down"); err != nil {
+		t.Fatalf("CloseWithReason failed: %v", err)
+	}
+
+	// Close waited for the server's close frame, which ends the read loop
+	handler.mu.Lock()
+	disconnected := handler.disconnected
+	errors := handler.errors
+	handler.mu.Unlock()
+	if !disconnected {
+		t.Error("Expected OnDisconnected before Close returned")
+	}
+	if len(errors) != 0 {
+		t.Errorf("Expected no errors on clean close, got %v", errors)
+	}
+
+	select {
+	case ce := <-closeErrs:
+		if ce.Code != websocket.CloseGoingAway {
+			t.Errorf("Expected close code %d, got %d", websocket.CloseGoingAway, ce.Code)
+		}
+		if ce.Text != "shutting down" {
+			t.Errorf("Expected close reason 'shutting down', got %q", ce.Text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not receive close frame")
+	}
+}
+
+func TestSignalingClientSetHandler(t *testing.T) {
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {})
+	defer server.Close()
+
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+	})
+
+	handler := &mockHandler{}
+	if err := client.SetHandler(handler); err != nil {
+		t.Fatalf("SetHandler before Connect failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	handler.mu.Lock()
+	connected, authenticated := handler.connected, handler.authenticated
+	handler.mu.Unlock()
+	if !connected || !authenticated {
+		t.Error("Handler set with SetHandler did not receive events")
+	}
+
+	if err := client.SetHandler(&mockHandler{}); err == nil {
+		t.Error("Expected SetHandler to fail while connected")
+	}
+}
+
+func TestSignalingClientSendEndOfCandidates(t *testing.T) {
+	received := make(chan ICEPayload, 1)
+	server := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		if msg.Type != MsgTypeICE {
+			return
+		}
+		var payload ICEPayload
+		json.Unmarshal(msg.Payload, &payload)
+		received <- payload
+	})
+	defer server.Close()
+
+	client := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		APIKey:    "test-key",
+		Handler:   &mockHandler{},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close()
+	waitAuthenticated(t, client)
+
+	if err := client.SendEndOfCandidates(); err != nil {
+		t.Fatalf("SendEndOfCandidates failed: %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		var candidate struct {
+			Candidate *string `json:"candidate"`
+		}
+		if err := json.Unmarshal(payload.Candidate, &candidate); err != nil {
+			t.Fatalf("Invalid candidate JSON: %v", err)
+		}
+		if candidate.Candidate == nil || *candidate.Candidate != "" {
+			t.Errorf("Expected empty candidate, got %s", payload.Candidate)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not receive end-of-candidates")
+	}
+}
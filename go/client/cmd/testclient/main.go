@@ -57,9 +57,8 @@ func (h *TestClientHandler) OnOffer(sdp string, requestID string) {
 	dcHandler := &DataChannelHandler{requestID: requestID}
 
 	// Create a new peer connection for this offer
-	pc, err := client.NewPeerConnection(client.PeerConfig{
-		SignalingClient: h.signalingClient,
-		Handler:         dcHandler,
+	pc, err := h.signalingClient.NewPeerConnection(client.PeerConfig{
+		Handler: dcHandler,
 	})
 	if err != nil {
 		log.Printf("✗ Failed to create peer connection: %v", err)
@@ -110,10 +109,14 @@ type DataChannelHandler struct {
 }
 
 func (h *DataChannelHandler) OnMessage(data []byte) {
-	// Messages are handled by grpcweb.Transport
-	// This callback is called BEFORE transport is set up, so we need to buffer or handle differently
-	// However, once transport.Start() is called, this callback is replaced
-	log.Printf("  [DataChannelHandler] Received message (%d bytes) - transport not ready yet", len(data))
+	// Messages are normally handled by grpcweb.Transport, which replaces this
+	// callback in Start(). Messages that arrived while OnOpen was still running
+	// are buffered by the PeerConnection and replayed here afterwards.
+	if h.transport == nil {
+		log.Printf("  [DataChannelHandler] Received message (%d bytes) - transport not ready", len(data))
+		return
+	}
+	h.transport.HandleMessage(data)
 }
 
 func (h *DataChannelHandler) OnOpen() {
@@ -326,9 +329,9 @@ func main() {
 
 	signalingClient := client.NewSignalingClient(config)
 	handler := NewTestClientHandler(signalingClient)
-	config.Handler = handler
-	signalingClient = client.NewSignalingClient(config)
-	handler.signalingClient = signalingClient
+	if err := signalingClient.SetHandler(handler); err != nil {
+		log.Fatalf("Failed to set handler: %v", err)
+	}
 
 	// Connect to signaling server
 	ctx := context.Background()
@@ -237,15 +237,12 @@ func TestE2EAuthenticationSuccess(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := client.Connect(ctx)
+	err := client.ConnectAndAuthenticate(ctx)
 	if err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
 
-	// Wait for auth messages
-	time.Sleep(2 * time.Second)
-
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
 
@@ -361,19 +358,12 @@ func TestE2EConnectionPersistence(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := client.Connect(ctx)
+	err := client.ConnectAndAuthenticate(ctx)
 	if err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
 
-	// Wait for initial connection
-	time.Sleep(2 * time.Second)
-
-	if !client.IsConnected() {
-		t.Fatal("Client not connected after initial wait")
-	}
-
 	// Wait for multiple ping intervals to ensure connection stays alive
 	t.Log("Testing connection persistence over 15 seconds...")
 	for i := 0; i < 3; i++ {
@@ -421,17 +411,11 @@ func TestE2EReconnection(t *testing.T) {
 	defer cancel1()
 
 	t.Log("Establishing first connection...")
-	err := client.Connect(ctx1)
+	err := client.ConnectAndAuthenticate(ctx1)
 	if err != nil {
 		t.Fatalf("First connection failed: %v", err)
 	}
 
-	time.Sleep(2 * time.Second)
-
-	if !client.IsConnected() {
-		t.Fatal("First connection failed to authenticate")
-	}
-
 	handler.mu.Lock()
 	firstAuthCount := handler.getEventCount("authenticated")
 	handler.mu.Unlock()
@@ -458,18 +442,12 @@ func TestE2EReconnection(t *testing.T) {
 	defer cancel2()
 
 	t.Log("Reconnecting...")
-	err = client.Connect(ctx2)
+	err = client.ConnectAndAuthenticate(ctx2)
 	if err != nil {
 		t.Fatalf("Reconnection failed: %v", err)
 	}
 	defer client.Close()
 
-	time.Sleep(2 * time.Second)
-
-	if !client.IsConnected() {
-		t.Fatal("Reconnection failed to authenticate")
-	}
-
 	handler.mu.Lock()
 	secondAuthCount := handler.getEventCount("authenticated")
 	handler.mu.Unlock()
@@ -506,18 +484,12 @@ func TestE2ESendAnswer(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := client.Connect(ctx)
+	err := client.ConnectAndAuthenticate(ctx)
 	if err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
 
-	time.Sleep(2 * time.Second)
-
-	if !client.IsConnected() {
-		t.Fatal("Client not connected")
-	}
-
 	// Send a test answer (won't be processed without an offer, but tests the send mechanism)
 	testSDP := "v=0\r\no=- 123456 0 IN IP4 127.0.0.1\r\ns=-\r\n"
 	err = client.SendAnswer(testSDP, "test-request-id")
@@ -553,18 +525,12 @@ func TestE2ESendICE(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := client.Connect(ctx)
+	err := client.ConnectAndAuthenticate(ctx)
 	if err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
 
-	time.Sleep(2 * time.Second)
-
-	if !client.IsConnected() {
-		t.Fatal("Client not connected")
-	}
-
 	// Send a test ICE candidate
 	testCandidate := json.RawMessage(`{"candidate":"test-candidate","sdpMid":"0","sdpMLineIndex":0}`)
 	err = client.SendICE(testCandidate)
@@ -7,6 +7,7 @@
 // - ICE candidate handling
 // - DataChannel message exchange
 // - Multiple message handling
+// - Go-initiated offer/answer
 // - Connection cleanup
 //
 // Run with: E2E_TEST=1 go test -v -run TestE2EWebRTC
@@ -30,12 +31,13 @@ import (
 type webrtcTestHandler struct {
 	mu           sync.Mutex
 	messages     [][]byte
+	isString     []bool
 	opened       bool
 	closed       bool
 	messagesCond *sync.Cond
-	openedCond   *sync.Cond
 	closedCond   *sync.Cond
 	t            *testing.T
+	testDone     bool // Pion may fire callbacks after the test returns
 }
 
 func newWebRTCTestHandler(t *testing.T) *webrtcTestHandler {
@@ -44,16 +46,32 @@ func newWebRTCTestHandler(t *testing.T) *webrtcTestHandler {
 		t:        t,
 	}
 	h.messagesCond = sync.NewCond(&h.mu)
-	h.openedCond = sync.NewCond(&h.mu)
 	h.closedCond = sync.NewCond(&h.mu)
+	t.Cleanup(func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.testDone = true
+	})
 	return h
 }
 
+// logf logs unless the test has finished. Must be called with h.mu held.
+func (h *webrtcTestHandler) logf(format string, args ...interface{}) {
+	if !h.testDone {
+		h.t.Logf(format, args...)
+	}
+}
+
 func (h *webrtcTestHandler) OnMessage(data []byte) {
+	h.OnMessageEx(data, false)
+}
+
+func (h *webrtcTestHandler) OnMessageEx(data []byte, isString bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.messages = append(h.messages, data)
-	h.t.Logf("Received message: %s", string(data))
+	h.isString = append(h.isString, isString)
+	h.logf("Received message: %s (text: %v)", string(data), isString)
 	h.messagesCond.Broadcast()
 }
 
@@ -61,32 +79,17 @@ func (h *webrtcTestHandler) OnOpen() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.opened = true
-	h.t.Log("DataChannel opened")
-	h.openedCond.Broadcast()
+	h.logf("DataChannel opened")
 }
 
 func (h *webrtcTestHandler) OnClose() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.closed = true
-	h.t.Log("DataChannel closed")
+	h.logf("DataChannel closed")
 	h.closedCond.Broadcast()
 }
 
-func (h *webrtcTestHandler) waitForOpen(timeout time.Duration) bool {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	deadline := time.Now().Add(timeout)
-	for !h.opened {
-		if time.Now().After(deadline) {
-			return false
-		}
-		h.openedCond.Wait()
-	}
-	return true
-}
-
 func (h *webrtcTestHandler) waitForMessage(timeout time.Duration) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -110,6 +113,14 @@ func (h *webrtcTestHandler) getMessages() [][]byte {
 	return result
 }
 
+func (h *webrtcTestHandler) getIsString() []bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]bool, len(h.isString))
+	copy(result, h.isString)
+	return result
+}
+
 func (h *webrtcTestHandler) isOpened() bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -362,106 +373,36 @@ func TestE2EWebRTCLoopbackConnection(t *testing.T) {
 		}()
 	})
 
-	// Create data channel on offer peer
-	dc, err := offerPeer.pc.CreateDataChannel("test", nil)
-	if err != nil {
-		t.Fatalf("Failed to create data channel: %v", err)
-	}
-
-	// Set up data channel for offer peer
-	offerPeer.mu.Lock()
-	offerPeer.dataChannel = dc
-	offerPeer.mu.Unlock()
-
-	dc.OnOpen(func() {
-		offerHandler.OnOpen()
-	})
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		offerHandler.OnMessage(msg.Data)
-	})
-
-	// Create offer
-	offer, err := offerPeer.pc.CreateOffer(nil)
+	// SDP exchange through the public offer/answer methods
+	offerSDP, err := offerPeer.CreateOffer()
 	if err != nil {
 		t.Fatalf("Failed to create offer: %v", err)
 	}
-
-	err = offerPeer.pc.SetLocalDescription(offer)
-	if err != nil {
-		t.Fatalf("Failed to set offer local description: %v", err)
-	}
-
-	t.Log("Created and set offer")
-
-	// Set remote description on answer peer
-	err = answerPeer.pc.SetRemoteDescription(offer)
-	if err != nil {
-		t.Fatalf("Failed to set remote description on answer peer: %v", err)
-	}
-
-	// Create answer
-	answer, err := answerPeer.pc.CreateAnswer(nil)
-	if err != nil {
-		t.Fatalf("Failed to create answer: %v", err)
-	}
-
-	err = answerPeer.pc.SetLocalDescription(answer)
-	if err != nil {
-		t.Fatalf("Failed to set answer local description: %v", err)
+	if err := answerPeer.HandleOffer(offerSDP, ""); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
 	}
-
-	t.Log("Created and set answer")
-
-	// Set remote description on offer peer
-	err = offerPeer.pc.SetRemoteDescription(answer)
-	if err != nil {
-		t.Fatalf("Failed to set remote description on offer peer: %v", err)
+	if err := offerPeer.HandleAnswer(answerPeer.LocalDescription()); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
 	}
 
 	t.Log("Completed SDP exchange")
 
-	// Wait for connection to establish
+	// Wait until both data channels are open
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	connected := false
-	for {
-		select {
-		case <-ctx.Done():
-			t.Fatal("Timeout waiting for connection to establish")
-		case <-ticker.C:
-			offerState := offerPeer.ConnectionState()
-			answerState := answerPeer.ConnectionState()
-
-			t.Logf("Offer state: %v, Answer state: %v", offerState, answerState)
-
-			if offerState == webrtc.PeerConnectionStateConnected &&
-				answerState == webrtc.PeerConnectionStateConnected {
-				connected = true
-				t.Log("Connection established!")
-			}
-
-			if offerState == webrtc.PeerConnectionStateFailed ||
-				answerState == webrtc.PeerConnectionStateFailed {
-				t.Fatal("Connection failed")
-			}
-
-			if connected {
-				goto connectionEstablished
-			}
-		}
+	if err := offerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Offer peer not ready: %v", err)
+	}
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
 	}
 
-connectionEstablished:
-	// Wait for data channels to open
-	if !offerHandler.waitForOpen(5 * time.Second) {
-		t.Error("Offer peer data channel did not open")
+	if state := offerPeer.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		t.Errorf("Expected offer peer connected, got %v", state)
 	}
-	if !answerHandler.waitForOpen(5 * time.Second) {
-		t.Error("Answer peer data channel did not open")
+	if state := answerPeer.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		t.Errorf("Expected answer peer connected, got %v", state)
 	}
 
 	// Verify both data channels are open
@@ -485,110 +426,93 @@ connectionEstablished:
 	t.Log("Loopback connection test passed")
 }
 
-// TestE2EWebRTCDataChannelMessaging tests message exchange over DataChannel
-func TestE2EWebRTCDataChannelMessaging(t *testing.T) {
+// TestE2EWebRTCConnectLoopback tests the ConnectLoopback helper with
+// trickled and non-trickle candidates
+func TestE2EWebRTCConnectLoopback(t *testing.T) {
 	_, _, runE2E := getE2EConfig()
 	if !runE2E {
 		t.Skip("E2E tests disabled. Set E2E_TEST=1 to run")
 	}
 
-	// Create two peers
-	offerHandler := newWebRTCTestHandler(t)
-	answerHandler := newWebRTCTestHandler(t)
+	for _, nonTrickle := range []bool{false, true} {
+		offerHandler := newWebRTCTestHandler(t)
+		answerHandler := newWebRTCTestHandler(t)
 
-	offerPeer, err := NewPeerConnection(PeerConfig{Handler: offerHandler})
-	if err != nil {
-		t.Fatalf("Failed to create offer peer: %v", err)
-	}
-	defer offerPeer.Close()
+		offerPeer, err := NewPeerConnection(PeerConfig{Handler: offerHandler, NonTrickleICE: nonTrickle, ICEGatheringTimeout: 3 * time.Second})
+		if err != nil {
+			t.Fatalf("Failed to create offer peer: %v", err)
+		}
+		defer offerPeer.Close()
 
-	answerPeer, err := NewPeerConnection(PeerConfig{Handler: answerHandler})
-	if err != nil {
-		t.Fatalf("Failed to create answer peer: %v", err)
-	}
-	defer answerPeer.Close()
+		answerPeer, err := NewPeerConnection(PeerConfig{Handler: answerHandler, NonTrickleICE: nonTrickle, ICEGatheringTimeout: 3 * time.Second})
+		if err != nil {
+			t.Fatalf("Failed to create answer peer: %v", err)
+		}
+		defer answerPeer.Close()
 
-	// Set up ICE candidate exchange
-	offerPeer.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate == nil {
-			return
+		if err := ConnectLoopback(offerPeer, answerPeer, 10*time.Second); err != nil {
+			t.Fatalf("ConnectLoopback (non-trickle %v) failed: %v", nonTrickle, err)
 		}
-		go func() {
-			candidateJSON, _ := json.Marshal(candidate.ToJSON())
-			answerPeer.AddICECandidate(candidateJSON)
-		}()
-	})
 
-	answerPeer.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate == nil {
-			return
+		// Connected and open as soon as it returns
+		for name, peer := range map[string]*PeerConnection{"offer": offerPeer, "answer": answerPeer} {
+			if state := peer.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+				t.Errorf("Expected %s peer connected, got %v", name, state)
+			}
+		}
+		if !offerHandler.isOpened() || !answerHandler.isOpened() {
+			t.Error("Expected both handlers to receive OnOpen")
 		}
-		go func() {
-			candidateJSON, _ := json.Marshal(candidate.ToJSON())
-			offerPeer.AddICECandidate(candidateJSON)
-		}()
-	})
 
-	// Create data channel
-	dc, err := offerPeer.pc.CreateDataChannel("test", nil)
-	if err != nil {
-		t.Fatalf("Failed to create data channel: %v", err)
+		if err := offerPeer.Send([]byte("ping")); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if !answerHandler.waitForMessage(5 * time.Second) {
+			t.Fatal("Answer peer did not receive message")
+		}
 	}
 
-	offerPeer.mu.Lock()
-	offerPeer.dataChannel = dc
-	offerPeer.mu.Unlock()
-
-	dc.OnOpen(func() {
-		offerHandler.OnOpen()
-	})
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		offerHandler.OnMessage(msg.Data)
-	})
-
-	// Create and exchange offers/answers
-	offer, err := offerPeer.pc.CreateOffer(nil)
+	// An unconnectable pair fails within the timeout
+	lonely, err := NewPeerConnection(PeerConfig{Handler: newWebRTCTestHandler(t)})
 	if err != nil {
-		t.Fatalf("Failed to create offer: %v", err)
+		t.Fatalf("Failed to create peer: %v", err)
 	}
-
-	offerPeer.pc.SetLocalDescription(offer)
-	answerPeer.pc.SetRemoteDescription(offer)
-
-	answer, err := answerPeer.pc.CreateAnswer(nil)
+	defer lonely.Close()
+	closed, err := NewPeerConnection(PeerConfig{Handler: newWebRTCTestHandler(t)})
 	if err != nil {
-		t.Fatalf("Failed to create answer: %v", err)
+		t.Fatalf("Failed to create peer: %v", err)
 	}
+	closed.Close()
+	if err := ConnectLoopback(lonely, closed, time.Second); err == nil {
+		t.Error("Expected an error connecting to a closed peer")
+	}
+}
 
-	answerPeer.pc.SetLocalDescription(answer)
-	offerPeer.pc.SetRemoteDescription(answer)
+// TestE2EWebRTCDataChannelMessaging tests message exchange over DataChannel
+func TestE2EWebRTCDataChannelMessaging(t *testing.T) {
+	_, _, runE2E := getE2EConfig()
+	if !runE2E {
+		t.Skip("E2E tests disabled. Set E2E_TEST=1 to run")
+	}
 
-	// Wait for connection
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Create two peers
+	offerHandler := newWebRTCTestHandler(t)
+	answerHandler := newWebRTCTestHandler(t)
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			t.Fatal("Timeout waiting for connection")
-		case <-ticker.C:
-			if offerPeer.ConnectionState() == webrtc.PeerConnectionStateConnected &&
-				answerPeer.ConnectionState() == webrtc.PeerConnectionStateConnected {
-				goto connected
-			}
-		}
+	offerPeer, err := NewPeerConnection(PeerConfig{Handler: offerHandler})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
 	}
+	defer offerPeer.Close()
 
-connected:
-	// Wait for data channels to open
-	if !offerHandler.waitForOpen(5 * time.Second) {
-		t.Fatal("Offer data channel did not open")
+	answerPeer, err := NewPeerConnection(PeerConfig{Handler: answerHandler})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
 	}
-	if !answerHandler.waitForOpen(5 * time.Second) {
-		t.Fatal("Answer data channel did not open")
+	defer answerPeer.Close()
+
+	if err := ConnectLoopback(offerPeer, answerPeer, 10*time.Second); err != nil {
+		t.Fatalf("Failed to connect peers: %v", err)
 	}
 
 	t.Log("Connection established, testing message exchange")
@@ -659,6 +583,14 @@ connected:
 		t.Errorf("Text message mismatch. Expected '%s', got '%s'", testTextMessage, answerMessages[1])
 	}
 
+	answerIsString := answerHandler.getIsString()
+	if answerIsString[0] {
+		t.Error("Binary message should not be flagged as text")
+	}
+	if !answerIsString[1] {
+		t.Error("Text message should be flagged as text")
+	}
+
 	t.Log("Data channel messaging test passed")
 }
 
@@ -679,6 +611,81 @@ func TestE2EWebRTCMultipleMessages(t *testing.T) {
 	answerPeer, _ := NewPeerConnection(PeerConfig{Handler: answerHandler})
 	defer answerPeer.Close()
 
+	if err := ConnectLoopback(offerPeer, answerPeer, 10*time.Second); err != nil {
+		t.Fatalf("Failed to connect peers: %v", err)
+	}
+
+	// Send multiple messages
+	messageCount := 10
+	for i := 0; i < messageCount; i++ {
+		msg := []byte(string(rune('A' + i)))
+		err := offerPeer.Send(msg)
+		if err != nil {
+			t.Fatalf("Failed to send message %d: %v", i, err)
+		}
+		time.Sleep(10 * time.Millisecond) // Small delay between messages
+	}
+
+	// Wait for all messages
+	time.Sleep(2 * time.Second)
+
+	receivedMessages := answerHandler.getMessages()
+	if len(receivedMessages) != messageCount {
+		t.Errorf("Expected %d messages, received %d", messageCount, len(receivedMessages))
+	}
+
+	// Verify message order and content
+	for i := 0; i < len(receivedMessages) && i < messageCount; i++ {
+		expected := string(rune('A' + i))
+		if string(receivedMessages[i]) != expected {
+			t.Errorf("Message %d mismatch. Expected '%s', got '%s'", i, expected, receivedMessages[i])
+		}
+	}
+
+	t.Logf("Successfully sent and received %d messages in order", len(receivedMessages))
+}
+
+// slowOpenHandler delays OnOpen to widen the window in which messages can
+// arrive before the handler is ready, like a transport being set up.
+// Messages delivered before OnOpen finishes are dropped.
+type slowOpenHandler struct {
+	*webrtcTestHandler
+	delay time.Duration
+}
+
+func (h *slowOpenHandler) OnOpen() {
+	time.Sleep(h.delay)
+	h.webrtcTestHandler.OnOpen()
+}
+
+func (h *slowOpenHandler) OnMessageEx(data []byte, isString bool) {
+	if !h.isOpened() {
+		h.t.Logf("Dropped message before open: %s", string(data))
+		return
+	}
+	h.webrtcTestHandler.OnMessageEx(data, isString)
+}
+
+// TestE2EWebRTCMessagesBeforeOpen tests that messages sent as soon as the
+// channel opens are not lost while the receiving handler's OnOpen is running
+func TestE2EWebRTCMessagesBeforeOpen(t *testing.T) {
+	_, _, runE2E := getE2EConfig()
+	if !runE2E {
+		t.Skip("E2E tests disabled. Set E2E_TEST=1 to run")
+	}
+
+	offerHandler := newWebRTCTestHandler(t)
+	answerHandler := &slowOpenHandler{
+		webrtcTestHandler: newWebRTCTestHandler(t),
+		delay:             500 * time.Millisecond,
+	}
+
+	offerPeer, _ := NewPeerConnection(PeerConfig{Handler: offerHandler})
+	defer offerPeer.Close()
+
+	answerPeer, _ := NewPeerConnection(PeerConfig{Handler: answerHandler})
+	defer answerPeer.Close()
+
 	// ICE exchange
 	offerPeer.pc.OnICECandidate(func(c *webrtc.ICECandidate) {
 		if c != nil {
@@ -693,13 +700,16 @@ func TestE2EWebRTCMultipleMessages(t *testing.T) {
 		}
 	})
 
-	// Create data channel
-	dc, _ := offerPeer.pc.CreateDataChannel("test", nil)
-	offerPeer.mu.Lock()
-	offerPeer.dataChannel = dc
-	offerPeer.mu.Unlock()
-	dc.OnOpen(func() { offerHandler.OnOpen() })
-	dc.OnMessage(func(msg webrtc.DataChannelMessage) { offerHandler.OnMessage(msg.Data) })
+	// The "data" label makes the answer peer use its default handler
+	dc, _ := offerPeer.pc.CreateDataChannel("data", nil)
+	messages := []string{"first", "second", "third"}
+	dc.OnOpen(func() {
+		for _, msg := range messages {
+			if err := dc.SendText(msg); err != nil {
+				t.Errorf("Failed to send message: %v", err)
+			}
+		}
+	})
 
 	// SDP exchange
 	offer, _ := offerPeer.pc.CreateOffer(nil)
@@ -709,55 +719,103 @@ func TestE2EWebRTCMultipleMessages(t *testing.T) {
 	answerPeer.pc.SetLocalDescription(answer)
 	offerPeer.pc.SetRemoteDescription(answer)
 
-	// Wait for connection
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			t.Fatal("Connection timeout")
-		case <-ticker.C:
-			if offerPeer.ConnectionState() == webrtc.PeerConnectionStateConnected {
-				goto connected
-			}
-		}
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
 	}
 
-connected:
-	offerHandler.waitForOpen(5 * time.Second)
-	answerHandler.waitForOpen(5 * time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(answerHandler.getMessages()) < len(messages) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
 
-	// Send multiple messages
-	messageCount := 10
-	for i := 0; i < messageCount; i++ {
-		msg := []byte(string(rune('A' + i)))
-		err := offerPeer.Send(msg)
-		if err != nil {
-			t.Fatalf("Failed to send message %d: %v", i, err)
+	received := answerHandler.getMessages()
+	if len(received) != len(messages) {
+		t.Fatalf("Expected %d messages, received %d", len(messages), len(received))
+	}
+	isString := answerHandler.getIsString()
+	for i, msg := range messages {
+		if string(received[i]) != msg {
+			t.Errorf("Message %d mismatch. Expected '%s', got '%s'", i, msg, received[i])
+		}
+		if !isString[i] {
+			t.Errorf("Message %d should be delivered as text", i)
 		}
-		time.Sleep(10 * time.Millisecond) // Small delay between messages
 	}
+}
 
-	// Wait for all messages
-	time.Sleep(2 * time.Second)
+// TestE2EWebRTCGoOfferer tests a Go peer initiating the connection, using
+// only the public CreateOffer/HandleOffer/HandleAnswer methods
+func TestE2EWebRTCGoOfferer(t *testing.T) {
+	_, _, runE2E := getE2EConfig()
+	if !runE2E {
+		t.Skip("E2E tests disabled. Set E2E_TEST=1 to run")
+	}
 
-	receivedMessages := answerHandler.getMessages()
-	if len(receivedMessages) != messageCount {
-		t.Errorf("Expected %d messages, received %d", messageCount, len(receivedMessages))
+	offerHandler := newWebRTCTestHandler(t)
+	answerHandler := newWebRTCTestHandler(t)
+
+	// Without a signaling client, candidates travel in the SDP
+	offerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:             offerHandler,
+		NonTrickleICE:       true,
+		ICEGatheringTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
 	}
+	defer offerPeer.Close()
 
-	// Verify message order and content
-	for i := 0; i < len(receivedMessages) && i < messageCount; i++ {
-		expected := string(rune('A' + i))
-		if string(receivedMessages[i]) != expected {
-			t.Errorf("Message %d mismatch. Expected '%s', got '%s'", i, expected, receivedMessages[i])
-		}
+	answerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:             answerHandler,
+		NonTrickleICE:       true,
+		ICEGatheringTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
 	}
+	defer answerPeer.Close()
 
-	t.Logf("Successfully sent and received %d messages in order", len(receivedMessages))
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	answerSDP, err := answerPeer.HandleOfferWithAnswer(offerSDP, "req-1")
+	if err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if err := offerPeer.HandleAnswer(answerSDP); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := offerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Offer peer not ready: %v", err)
+	}
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
+	}
+
+	if err := offerPeer.SendText("from offerer"); err != nil {
+		t.Fatalf("Failed to send from offerer: %v", err)
+	}
+	if err := answerPeer.SendText("from answerer"); err != nil {
+		t.Fatalf("Failed to send from answerer: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (len(offerHandler.getMessages()) == 0 || len(answerHandler.getMessages()) == 0) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if got := answerHandler.getMessages(); len(got) != 1 || string(got[0]) != "from offerer" {
+		t.Errorf("Answer peer expected 'from offerer', got %q", got)
+	}
+	if got := offerHandler.getMessages(); len(got) != 1 || string(got[0]) != "from answerer" {
+		t.Errorf("Offer peer expected 'from answerer', got %q", got)
+	}
 }
 
 // TestE2EWebRTCConnectionClosure tests proper connection cleanup
@@ -804,5 +862,14 @@ func TestE2EWebRTCConnectionClosure(t *testing.T) {
 		t.Error("Data channel should be nil after Close()")
 	}
 
+	// OnClose is called asynchronously from the state change
+	deadline := time.Now().Add(time.Second)
+	for !handler.isClosed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !handler.isClosed() {
+		t.Error("Handler did not receive OnClose")
+	}
+
 	t.Log("Connection closure test passed")
 }
@@ -37,9 +37,8 @@ func (h *AppHandler) OnOffer(sdp string, requestID string) {
 
 	// Create peer connection if not exists
 	if h.peerConnection == nil {
-		pc, err := client.NewPeerConnection(client.PeerConfig{
-			SignalingClient: h.signalingClient,
-			Handler:         h,
+		pc, err := h.signalingClient.NewPeerConnection(client.PeerConfig{
+			Handler: h,
 		})
 		if err != nil {
 			log.Printf("Failed to create peer connection: %v", err)
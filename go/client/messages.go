@@ -19,6 +19,32 @@ type AuthPayload struct {
 type AuthOKPayload struct {
 	UserID string `json:"userId"`
 	Type   string `json:"type"` // "browser" or "app"
+	// Extra holds fields of the auth_ok payload not known to this client,
+	// e.g. a plan or scopes added by a newer server. Decode one with
+	// json.Unmarshal(payload.Extra["scopes"], &scopes). Nil if there are none.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and collects the rest into Extra
+func (p *AuthOKPayload) UnmarshalJSON(data []byte) error {
+	type known AuthOKPayload // without this method, to avoid recursion
+	var payload known
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "userId")
+	delete(fields, "type")
+	if len(fields) > 0 {
+		payload.Extra = fields
+	}
+
+	*p = AuthOKPayload(payload)
+	return nil
 }
 
 // AuthErrorPayload response from failed auth
@@ -81,6 +107,12 @@ type AppInfo struct {
 	Status string `json:"status"`
 }
 
+// PingPayload for application-level ping/pong messages.
+// A pong echoes the timestamp of the ping it answers.
+type PingPayload struct {
+	Timestamp int64 `json:"timestamp,omitempty"` // Unix milliseconds
+}
+
 // Message types
 const (
 	// Auth
@@ -100,6 +132,10 @@ const (
 	MsgTypeAnswer = "answer"
 	MsgTypeICE    = "ice"
 
+	// Application-level liveness
+	MsgTypePing = "ping"
+	MsgTypePong = "pong"
+
 	// Error
 	MsgTypeError = "error"
 )
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,8 +20,13 @@ type SetupConfig struct {
 	ServerURL    string        // Base URL of the signaling server (e.g., https://example.com)
 	PollInterval time.Duration // Polling interval (default: 2 seconds)
 	Timeout      time.Duration // Setup timeout (default: 5 minutes)
+	MaxPolls     int           // Maximum number of polls (default: 0, unlimited); applies along with Timeout
 }
 
+// ErrSetupMaxPolls is returned, wrapped, by Setup when the setup is still
+// pending after SetupConfig.MaxPolls polls
+var ErrSetupMaxPolls = errors.New("setup poll limit reached")
+
 // SetupResult result from OAuth setup
 type SetupResult struct {
 	APIKey       string
@@ -104,62 +110,84 @@ func Setup(ctx context.Context, config SetupConfig) (*SetupResult, error) {
 	ticker := time.NewTicker(config.PollInterval)
 	defer ticker.Stop()
 
+	polls := 0
 	for {
 		select {
 		case <-timeoutCtx.Done():
-			if ctx.Err() != nil {
-				return nil, fmt.Errorf("setup cancelled")
-			}
-			return nil, fmt.Errorf("setup timed out after %v", config.Timeout)
-
+			return nil, setupContextError(ctx, config.Timeout)
 		case <-ticker.C:
-			// Poll for status
-			pollReq, err := http.NewRequestWithContext(timeoutCtx, "GET", pollURL.String(), nil)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create poll request: %w", err)
-			}
-
-			pollResp, err := http.DefaultClient.Do(pollReq)
-			if err != nil {
-				return nil, fmt.Errorf("failed to poll setup status: %w", err)
-			}
+		}
 
-			if pollResp.StatusCode != http.StatusOK {
-				body, _ := io.ReadAll(pollResp.Body)
-				pollResp.Body.Close()
-				return nil, fmt.Errorf("poll failed with status %d: %s", pollResp.StatusCode, string(body))
+		// The request is bound to timeoutCtx, so cancellation aborts an
+		// in-flight poll instead of waiting for the server
+		pollResult, err := pollSetupStatus(timeoutCtx, pollURL.String())
+		polls++
+		if err != nil {
+			if timeoutCtx.Err() != nil {
+				return nil, setupContextError(ctx, config.Timeout)
 			}
+			return nil, err
+		}
 
-			var pollResult setupPollResponse
-			if err := json.NewDecoder(pollResp.Body).Decode(&pollResult); err != nil {
-				pollResp.Body.Close()
-				return nil, fmt.Errorf("failed to parse poll response: %w", err)
+		switch pollResult.Status {
+		case "complete":
+			if pollResult.APIKey == "" || pollResult.AppID == "" {
+				return nil, fmt.Errorf("invalid poll response: missing apiKey or appId")
 			}
-			pollResp.Body.Close()
-
-			switch pollResult.Status {
-			case "complete":
-				if pollResult.APIKey == "" || pollResult.AppID == "" {
-					return nil, fmt.Errorf("invalid poll response: missing apiKey or appId")
-				}
-				fmt.Printf("Setup completed successfully!\n")
-				return &SetupResult{
-					APIKey:       pollResult.APIKey,
-					AppID:        pollResult.AppID,
-					RefreshToken: pollResult.RefreshToken,
-				}, nil
-
-			case "pending":
-				// Continue polling
-				continue
-
-			default:
-				return nil, fmt.Errorf("unknown status from poll: %s", pollResult.Status)
+			fmt.Printf("Setup completed successfully!\n")
+			return &SetupResult{
+				APIKey:       pollResult.APIKey,
+				AppID:        pollResult.AppID,
+				RefreshToken: pollResult.RefreshToken,
+			}, nil
+
+		case "pending":
+			if config.MaxPolls > 0 && polls >= config.MaxPolls {
+				return nil, fmt.Errorf("setup still pending after %d polls: %w", polls, ErrSetupMaxPolls)
 			}
+			// Continue polling
+			continue
+
+		default:
+			return nil, fmt.Errorf("unknown status from poll: %s", pollResult.Status)
 		}
 	}
 }
 
+// setupContextError returns the error for a setup aborted by its context:
+// a cancellation of the caller's context, or the setup timeout
+func setupContextError(ctx context.Context, timeout time.Duration) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("setup cancelled: %w", ctx.Err())
+	}
+	return fmt.Errorf("setup timed out after %v: %w", timeout, context.DeadlineExceeded)
+}
+
+// pollSetupStatus performs one GET /setup/poll request
+func pollSetupStatus(ctx context.Context, pollURL string) (*setupPollResponse, error) {
+	pollReq, err := http.NewRequestWithContext(ctx, "GET", pollURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create poll request: %w", err)
+	}
+
+	pollResp, err := http.DefaultClient.Do(pollReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll setup status: %w", err)
+	}
+	defer pollResp.Body.Close()
+
+	if pollResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(pollResp.Body)
+		return nil, fmt.Errorf("poll failed with status %d: %s", pollResp.StatusCode, string(body))
+	}
+
+	var pollResult setupPollResponse
+	if err := json.NewDecoder(pollResp.Body).Decode(&pollResult); err != nil {
+		return nil, fmt.Errorf("failed to parse poll response: %w", err)
+	}
+	return &pollResult, nil
+}
+
 // RefreshAPIKeyConfig configuration for refreshing API key
 type RefreshAPIKeyConfig struct {
 	ServerURL    string // Base URL of the signaling server (e.g., https://example.com)
@@ -238,6 +266,73 @@ func RefreshAPIKey(ctx context.Context, config RefreshAPIKeyConfig) (*RefreshAPI
 	}, nil
 }
 
+// RevokeConfig configuration for revoking a refresh token
+type RevokeConfig struct {
+	ServerURL    string // Base URL of the signaling server (e.g., https://example.com)
+	RefreshToken string // Refresh token to revoke
+	// CredentialsPath, if set, is the credentials file (see SaveCredentials)
+	// whose refresh token is cleared once the server has revoked it
+	CredentialsPath string
+}
+
+// revokeResponse response from POST /api/app/revoke
+type revokeResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RevokeRefreshToken revokes a refresh token so it can no longer be used
+// with RefreshAPIKey. The current API key stays valid.
+func RevokeRefreshToken(ctx context.Context, config RevokeConfig) error {
+	revokeURL := config.ServerURL + "/api/app/revoke"
+
+	reqBody := refreshRequest{RefreshToken: config.RefreshToken}
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", revokeURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create revoke request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp revokeResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return fmt.Errorf("revoke failed: %s", errResp.Error)
+		}
+		return fmt.Errorf("revoke failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if config.CredentialsPath == "" {
+		return nil
+	}
+
+	// Keep the API key and app ID, drop the revoked refresh token
+	existing, err := LoadCredentials(config.CredentialsPath)
+	if err != nil {
+		return fmt.Errorf("refresh token revoked, but failed to load credentials: %w", err)
+	}
+	existing.RefreshToken = ""
+	if err := SaveCredentials(config.CredentialsPath, existing); err != nil {
+		return fmt.Errorf("refresh token revoked, but failed to update credentials: %w", err)
+	}
+	return nil
+}
+
 // openBrowser opens the default browser with the given URL
 func openBrowser(url string) error {
 	var cmd *exec.Cmd
@@ -3,11 +3,14 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -114,6 +117,59 @@ func TestSetupTimeout(t *testing.T) {
 	}
 }
 
+func TestSetupMaxPolls(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	// Create mock server that always returns pending
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/setup/init":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"token":"test-token","url":"http://example.com/setup/test-token"}`)
+
+		case "/setup/poll":
+			mu.Lock()
+			polls++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"status":"pending"}`)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	t.Run("poll limit first", func(t *testing.T) {
+		_, err := Setup(context.Background(), SetupConfig{
+			ServerURL:    mockServer.URL,
+			PollInterval: time.Millisecond,
+			Timeout:      time.Minute,
+			MaxPolls:     3,
+		})
+		if !errors.Is(err, ErrSetupMaxPolls) {
+			t.Fatalf("Expected ErrSetupMaxPolls, got %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if polls != 3 {
+			t.Errorf("Expected 3 polls, got %d", polls)
+		}
+	})
+
+	t.Run("timeout first", func(t *testing.T) {
+		_, err := Setup(context.Background(), SetupConfig{
+			ServerURL:    mockServer.URL,
+			PollInterval: 10 * time.Millisecond,
+			Timeout:      50 * time.Millisecond,
+			MaxPolls:     1000,
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
 func TestSetupContextCancel(t *testing.T) {
 	// Create mock server that always returns pending
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -152,6 +208,71 @@ func TestSetupContextCancel(t *testing.T) {
 	}
 }
 
+func TestSetupCancelDuringSlowPoll(t *testing.T) {
+	pollStarted := make(chan struct{}, 1)
+
+	// Mock server whose poll hangs until the request is abandoned
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/setup/init":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"token":"test-token","url":"http://example.com/setup/test-token"}`)
+
+		case "/setup/poll":
+			select {
+			case pollStarted <- struct{}{}:
+			default:
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"status":"pending"}`)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	config := SetupConfig{
+		ServerURL:    mockServer.URL,
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      10 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := Setup(ctx, config)
+		errCh <- err
+	}()
+
+	select {
+	case <-pollStarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Poll request not made")
+	}
+
+	cancelled := time.Now()
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if elapsed := time.Since(cancelled); elapsed > 500*time.Millisecond {
+			t.Errorf("Setup took %v to return after cancellation", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Setup did not return after cancellation")
+	}
+}
+
 func TestSaveAndLoadCredentials(t *testing.T) {
 	tmpDir := t.TempDir()
 	credPath := filepath.Join(tmpDir, "credentials.env")
@@ -400,6 +521,104 @@ func TestRefreshAPIKeyInvalidToken(t *testing.T) {
 	}
 }
 
+// newRevokeServer returns a mock server that revokes each valid token once
+func newRevokeServer(valid string) *httptest.Server {
+	revoked := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/app/revoke" || r.Method != "POST" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":"invalid request"}`)
+			return
+		}
+
+		if req.RefreshToken != valid || revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"Invalid or expired refresh token"}`)
+			return
+		}
+		revoked = true
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":true}`)
+	}))
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	mockServer := newRevokeServer("rt_valid-refresh-token")
+	defer mockServer.Close()
+
+	credPath := filepath.Join(t.TempDir(), "credentials.env")
+	err := SaveCredentials(credPath, &SetupResult{
+		APIKey:       "api-key",
+		AppID:        "app-id",
+		RefreshToken: "rt_valid-refresh-token",
+	})
+	if err != nil {
+		t.Fatalf("SaveCredentials failed: %v", err)
+	}
+
+	config := RevokeConfig{
+		ServerURL:       mockServer.URL,
+		RefreshToken:    "rt_valid-refresh-token",
+		CredentialsPath: credPath,
+	}
+	if err := RevokeRefreshToken(context.Background(), config); err != nil {
+		t.Fatalf("RevokeRefreshToken failed: %v", err)
+	}
+
+	// The refresh token is cleared, the rest is kept
+	loaded, err := LoadCredentials(credPath)
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+	if loaded.RefreshToken != "" {
+		t.Errorf("Expected refresh token to be cleared, got %s", loaded.RefreshToken)
+	}
+	if loaded.APIKey != "api-key" || loaded.AppID != "app-id" {
+		t.Errorf("Expected API key and app ID to be kept, got %+v", loaded)
+	}
+}
+
+func TestRevokeRefreshTokenAlreadyRevoked(t *testing.T) {
+	mockServer := newRevokeServer("rt_valid-refresh-token")
+	defer mockServer.Close()
+
+	config := RevokeConfig{
+		ServerURL:    mockServer.URL,
+		RefreshToken: "rt_valid-refresh-token",
+	}
+	if err := RevokeRefreshToken(context.Background(), config); err != nil {
+		t.Fatalf("First RevokeRefreshToken failed: %v", err)
+	}
+
+	credPath := filepath.Join(t.TempDir(), "credentials.env")
+	original := &SetupResult{APIKey: "api-key", AppID: "app-id", RefreshToken: "rt_valid-refresh-token"}
+	if err := SaveCredentials(credPath, original); err != nil {
+		t.Fatalf("SaveCredentials failed: %v", err)
+	}
+
+	config.CredentialsPath = credPath
+	err := RevokeRefreshToken(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "Invalid or expired refresh token") {
+		t.Errorf("Expected invalid token error, got %v", err)
+	}
+
+	// A failed revoke leaves the credentials file alone
+	loaded, err := LoadCredentials(credPath)
+	if err != nil {
+		t.Fatalf("LoadCredentials failed: %v", err)
+	}
+	if loaded.RefreshToken != "rt_valid-refresh-token" {
+		t.Errorf("Expected refresh token to be kept, got %q", loaded.RefreshToken)
+	}
+}
+
 func TestSaveAndLoadCredentialsWithRefreshToken(t *testing.T) {
 	tmpDir := t.TempDir()
 	credPath := filepath.Join(tmpDir, "credentials.env")
@@ -1,10 +1,18 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/transport"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -15,6 +23,14 @@ type DataChannelHandler interface {
 	OnClose()
 }
 
+// DataChannelMessageHandler can optionally be implemented by a
+// DataChannelHandler to learn whether each message was sent as text
+// (send(string) in the browser) or binary. If implemented, OnMessageEx
+// is called instead of OnMessage.
+type DataChannelMessageHandler interface {
+	OnMessageEx(data []byte, isString bool)
+}
+
 // PeerConnection wraps pion/webrtc peer connection
 type PeerConnection struct {
 	pc              *webrtc.PeerConnection
@@ -22,9 +38,52 @@ type PeerConnection struct {
 	signalingClient *SignalingClient
 	handler         DataChannelHandler
 	onDataChannel   DataChannelCallback
+	channelHandlers map[string]DataChannelHandler
+	channels        map[string]*peerChannel
+	nonTrickleICE   bool
+	gatherTimeout   time.Duration
+	chunkSize       int
+	maxBuffered     uint64
+	bufferLow       chan struct{} // Closed and replaced when the "data" channel's buffer drains
+	sdpTransform    func(string) string
+	metadata        map[string]string
+	nextChunkID     atomic.Uint32
 	mu              sync.RWMutex
 	pendingICE      []webrtc.ICECandidateInit
 	requestID       string
+	// ready is closed once the "data" channel is open and its handler's
+	// OnOpen has returned; failed once the connection fails or closes,
+	// with failedErr saying why
+	ready      chan struct{}
+	readyOnce  sync.Once
+	failed     chan struct{}
+	failedOnce sync.Once
+	failedErr  error
+	// connectTimer fails the connection if it is not connected within
+	// connectTimeout of the offer/answer exchange starting
+	connectTimeout   time.Duration
+	connectTimer     *time.Timer
+	connectTimerOnce sync.Once
+}
+
+// ErrConnectTimeout is the reason a peer connection failed when it did not
+// connect within PeerConfig.ConnectTimeout
+var ErrConnectTimeout = errors.New("peer connection did not connect in time")
+
+// ErrQueuedCandidates is returned, wrapped with the individual failures, when
+// candidates queued by AddICECandidate before the remote description was set
+// could not be added once it was. The description itself was applied.
+var ErrQueuedCandidates = errors.New("failed to add queued ICE candidates")
+
+// peerChannel tracks a DataChannel and the handler its events are routed to
+type peerChannel struct {
+	dc      *webrtc.DataChannel
+	handler DataChannelHandler
+	// Messages received before handler.OnOpen returned
+	pending []webrtc.DataChannelMessage
+	ready   bool
+	// Reassembles incoming chunks if chunking is enabled
+	chunks *codec.Reassembler
 }
 
 // DataChannelCallback is called when a new DataChannel is created
@@ -32,14 +91,65 @@ type DataChannelCallback func(dc *webrtc.DataChannel)
 
 // PeerConfig configuration for peer connection
 type PeerConfig struct {
+	// ICEServers are the STUN/TURN servers to use. If empty, peers created
+	// with SignalingClient.NewPeerConnection use ClientConfig.ICEServers, and
+	// otherwise Google's public STUN server is used.
 	ICEServers      []webrtc.ICEServer
 	SignalingClient *SignalingClient
 	Handler         DataChannelHandler
 	// OnDataChannel is called for each incoming DataChannel (optional)
 	// If set, this is called instead of using the default handler for non-"data" channels
 	OnDataChannel DataChannelCallback
+	// ChannelHandlers routes events of additional DataChannels by label (optional).
+	// A channel whose label has a handler here is not passed to OnDataChannel.
+	ChannelHandlers map[string]DataChannelHandler
+	// NonTrickleICE makes HandleOffer and CreateOffer wait for ICE gathering
+	// to complete and embed all candidates in the SDP instead of trickling
+	// them individually with SendICE
+	NonTrickleICE bool
+	// ChunkSize, if set, makes Send split messages larger than this many
+	// bytes into chunks (see codec.EncodeChunks), and makes every channel
+	// reassemble incoming chunks before delivering them to its handler
+	ChunkSize int
+	// ICEGatheringTimeout limits how long HandleOffer and CreateOffer wait for
+	// gathering in NonTrickleICE mode; the SDP then carries the candidates
+	// gathered so far (default: 10s)
+	ICEGatheringTimeout time.Duration
+	// ConnectTimeout, if set, closes the connection if it is not connected
+	// this long after HandleOffer or CreateOffer. The handler's OnClose is
+	// called, and Err and WaitReady then return ErrConnectTimeout.
+	ConnectTimeout time.Duration
+	// SDPTransform, if set, is applied to the offer or answer SDP that
+	// HandleOffer and CreateOffer send or return, e.g. to add bandwidth lines
+	// or force a codec. The local description is not changed. Returning SDP
+	// the remote peer cannot parse breaks the connection.
+	SDPTransform func(sdp string) string
+	// ICETransportPolicy restricts the candidates used. Set it to
+	// webrtc.ICETransportPolicyRelay to send all traffic through the TURN
+	// servers in ICEServers (default: all candidates)
+	ICETransportPolicy webrtc.ICETransportPolicy
+	// BundlePolicy controls how media is bundled onto transports
+	// (default: webrtc.BundlePolicyBalanced)
+	BundlePolicy webrtc.BundlePolicy
+	// RTCPMuxPolicy controls RTCP multiplexing (default: webrtc.RTCPMuxPolicyRequire)
+	RTCPMuxPolicy webrtc.RTCPMuxPolicy
+	// MaxBufferedAmount is how many bytes may be queued on the "data"
+	// channel before SendContext waits for it to drain
+	// (default: DefaultMaxBufferedAmount). Send never waits.
+	MaxBufferedAmount uint64
+	// Metadata holds connection-level attributes, e.g. the tenant or locale
+	// learned from auth_ok or the offer. Transports created with
+	// PeerConnection.NewTransport pass it to every handler as the
+	// transport.PeerInfo metadata.
+	Metadata map[string]string
 }
 
+// DefaultICEGatheringTimeout is the default ICE gathering timeout for NonTrickleICE
+const DefaultICEGatheringTimeout = 10 * time.Second
+
+// DefaultMaxBufferedAmount is the default PeerConfig.MaxBufferedAmount
+const DefaultMaxBufferedAmount = 1024 * 1024
+
 // NewPeerConnection creates a new WebRTC peer connection
 func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 	// Default STUN servers if not provided
@@ -51,7 +161,19 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 	}
 
 	rtcConfig := webrtc.Configuration{
-		ICEServers: iceServers,
+		ICEServers:         iceServers,
+		ICETransportPolicy: config.ICETransportPolicy,
+		BundlePolicy:       config.BundlePolicy,
+		RTCPMuxPolicy:      config.RTCPMuxPolicy,
+	}
+
+	gatherTimeout := config.ICEGatheringTimeout
+	if gatherTimeout == 0 {
+		gatherTimeout = DefaultICEGatheringTimeout
+	}
+	maxBuffered := config.MaxBufferedAmount
+	if maxBuffered == 0 {
+		maxBuffered = DefaultMaxBufferedAmount
 	}
 
 	pc, err := webrtc.NewPeerConnection(rtcConfig)
@@ -64,7 +186,19 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 		signalingClient: config.SignalingClient,
 		handler:         config.Handler,
 		onDataChannel:   config.OnDataChannel,
+		channelHandlers: config.ChannelHandlers,
+		channels:        make(map[string]*peerChannel),
+		nonTrickleICE:   config.NonTrickleICE,
+		gatherTimeout:   gatherTimeout,
+		chunkSize:       config.ChunkSize,
+		maxBuffered:     maxBuffered,
+		bufferLow:       make(chan struct{}),
+		sdpTransform:    config.SDPTransform,
+		metadata:        copyMetadata(config.Metadata),
+		connectTimeout:  config.ConnectTimeout,
 		pendingICE:      make([]webrtc.ICECandidateInit, 0),
+		ready:           make(chan struct{}),
+		failed:          make(chan struct{}),
 	}
 
 	// Handle ICE candidates
@@ -73,13 +207,18 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 			return
 		}
 
+		// Candidates are sent in the answer SDP instead
+		if peer.nonTrickleICE {
+			return
+		}
+
 		candidateJSON, err := json.Marshal(candidate.ToJSON())
 		if err != nil {
 			return
 		}
 
-		if peer.signalingClient != nil {
-			peer.signalingClient.SendICE(candidateJSON)
+		if sc := peer.SignalingClient(); sc != nil {
+			sc.SendICE(candidateJSON)
 		}
 	})
 
@@ -88,7 +227,9 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 		switch state {
 		case webrtc.PeerConnectionStateConnected:
 			// Connection established
+			peer.stopConnectTimer()
 		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			peer.markFailed(fmt.Errorf("peer connection %s", state))
 			if peer.handler != nil {
 				peer.handler.OnClose()
 			}
@@ -99,11 +240,21 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
 		// Main "data" channel is handled by the default handler
 		if dc.Label() == "data" {
-			peer.setupDataChannel(dc)
+			peer.setupDataChannel(dc, peer.handler)
+			return
+		}
+
+		// Additional channels with a per-label handler are routed to it
+		if handler, ok := peer.channelHandlers[dc.Label()]; ok {
+			peer.setupDataChannel(dc, handler)
 			return
 		}
 
-		// Additional channels (e.g., "stream") are passed to the custom callback
+		// Other channels (e.g., "stream") are passed to the custom callback
+		peer.mu.Lock()
+		peer.channels[dc.Label()] = &peerChannel{dc: dc}
+		peer.mu.Unlock()
+
 		if peer.onDataChannel != nil {
 			peer.onDataChannel(dc)
 		}
@@ -112,54 +263,195 @@ func NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
 	return peer, nil
 }
 
-// HandleOffer processes an incoming SDP offer and returns an answer
+// NewPeerConnection creates a peer connection that signals through this
+// client. It inherits ClientConfig.ICEServers unless config sets its own
+// ICEServers, and uses this client unless config sets a SignalingClient.
+func (c *SignalingClient) NewPeerConnection(config PeerConfig) (*PeerConnection, error) {
+	if len(config.ICEServers) == 0 {
+		config.ICEServers = c.config.ICEServers
+	}
+	if config.SignalingClient == nil {
+		config.SignalingClient = c
+	}
+	return NewPeerConnection(config)
+}
+
+// HandleOffer processes an incoming SDP offer and sends the answer via the
+// signaling client. It is HandleOfferWithAnswer without the returned SDP.
 func (p *PeerConnection) HandleOffer(sdp string, requestID string) error {
+	_, err := p.HandleOfferWithAnswer(sdp, requestID)
+	return err
+}
+
+// HandleOfferWithAnswer processes an incoming SDP offer and returns the
+// answer SDP. The answer is also sent via the signaling client if one is
+// configured; without one, the caller delivers it.
+//
+// If queued candidates could not be added, the answer is still created and
+// sent, and it is returned along with an error wrapping ErrQueuedCandidates.
+func (p *PeerConnection) HandleOfferWithAnswer(sdp string, requestID string) (string, error) {
 	p.mu.Lock()
 	p.requestID = requestID
 	p.mu.Unlock()
 
+	p.startConnectTimer()
+
 	offer := webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
 		SDP:  sdp,
 	}
 
 	if err := p.pc.SetRemoteDescription(offer); err != nil {
-		return fmt.Errorf("failed to set remote description: %w", err)
+		return "", fmt.Errorf("failed to set remote description: %w", err)
 	}
 
-	// Process pending ICE candidates
-	p.mu.Lock()
-	for _, candidate := range p.pendingICE {
-		p.pc.AddICECandidate(candidate)
-	}
-	p.pendingICE = nil
-	p.mu.Unlock()
+	flushErr := p.flushPendingICE()
 
 	// Create answer
 	answer, err := p.pc.CreateAnswer(nil)
 	if err != nil {
-		return fmt.Errorf("failed to create answer: %w", err)
+		return "", fmt.Errorf("failed to create answer: %w", err)
+	}
+
+	// Must be created before SetLocalDescription starts gathering
+	var gatherComplete <-chan struct{}
+	if p.nonTrickleICE {
+		gatherComplete = webrtc.GatheringCompletePromise(p.pc)
 	}
 
 	if err := p.pc.SetLocalDescription(answer); err != nil {
-		return fmt.Errorf("failed to set local description: %w", err)
+		return "", fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	answerSDP := answer.SDP
+	if p.nonTrickleICE {
+		answerSDP = p.waitForGathering(gatherComplete)
 	}
+	answerSDP = p.transformSDP(answerSDP)
 
 	// Send answer via signaling
-	if p.signalingClient != nil {
-		if err := p.signalingClient.SendAnswer(answer.SDP, requestID); err != nil {
-			return fmt.Errorf("failed to send answer: %w", err)
+	if sc := p.SignalingClient(); sc != nil {
+		if err := sc.SendAnswer(answerSDP, requestID); err != nil {
+			return "", fmt.Errorf("failed to send answer: %w", err)
+		}
+	}
+
+	return answerSDP, flushErr
+}
+
+// CreateOffer starts a connection initiated by this side. It creates the
+// "data" channel routed to the configured Handler, sets the local description
+// and returns the offer SDP, to be sent with SignalingClient.SendOffer.
+// The remote answer is applied with HandleAnswer.
+func (p *PeerConnection) CreateOffer() (string, error) {
+	p.startConnectTimer()
+
+	if p.DataChannel() == nil {
+		dc, err := p.pc.CreateDataChannel("data", nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create data channel: %w", err)
+		}
+		p.setupDataChannel(dc, p.handler)
+	}
+
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	// Must be created before SetLocalDescription starts gathering
+	var gatherComplete <-chan struct{}
+	if p.nonTrickleICE {
+		gatherComplete = webrtc.GatheringCompletePromise(p.pc)
+	}
+
+	if err := p.pc.SetLocalDescription(offer); err != nil {
+		return "", fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	offerSDP := offer.SDP
+	if p.nonTrickleICE {
+		offerSDP = p.waitForGathering(gatherComplete)
+	}
+	return p.transformSDP(offerSDP), nil
+}
+
+// HandleAnswer applies the remote answer to an offer made with CreateOffer.
+// If queued candidates could not be added, the answer is still applied and
+// an error wrapping ErrQueuedCandidates is returned.
+func (p *PeerConnection) HandleAnswer(sdp string) error {
+	answer := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  sdp,
+	}
+
+	if err := p.pc.SetRemoteDescription(answer); err != nil {
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+
+	return p.flushPendingICE()
+}
+
+// LocalDescription returns the current local SDP, including the candidates
+// gathered so far. Returns an empty string if no description has been set.
+func (p *PeerConnection) LocalDescription() string {
+	desc := p.pc.LocalDescription()
+	if desc == nil {
+		return ""
+	}
+	return desc.SDP
+}
+
+// transformSDP applies the configured SDPTransform, if any, to outgoing SDP
+func (p *PeerConnection) transformSDP(sdp string) string {
+	if p.sdpTransform == nil {
+		return sdp
+	}
+	return p.sdpTransform(sdp)
+}
+
+// flushPendingICE adds the candidates queued before the remote description
+// was set. Every candidate is tried; the failures are returned together.
+func (p *PeerConnection) flushPendingICE() error {
+	p.mu.Lock()
+	var errs []error
+	for i, candidate := range p.pendingICE {
+		if err := p.pc.AddICECandidate(candidate); err != nil {
+			errs = append(errs, fmt.Errorf("candidate %d (%q): %w", i, candidate.Candidate, err))
 		}
 	}
+	p.pendingICE = nil
+	p.mu.Unlock()
 
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrQueuedCandidates, errors.Join(errs...))
+	}
 	return nil
 }
 
-// AddICECandidate adds an ICE candidate
+// waitForGathering waits for ICE gathering to complete, bounded by the
+// gathering timeout, and returns the local SDP with the gathered candidates
+func (p *PeerConnection) waitForGathering(gatherComplete <-chan struct{}) string {
+	select {
+	case <-gatherComplete:
+	case <-time.After(p.gatherTimeout):
+		// Send what we have rather than hang behind a broken STUN server
+	}
+	return p.pc.LocalDescription().SDP
+}
+
+// AddICECandidate adds an ICE candidate.
+// An empty candidate (empty, null or "" JSON, or an empty "candidate" field)
+// is the end-of-candidates marker and is passed on to the ICE agent as such.
 func (p *PeerConnection) AddICECandidate(candidateJSON json.RawMessage) error {
 	var candidate webrtc.ICECandidateInit
-	if err := json.Unmarshal(candidateJSON, &candidate); err != nil {
-		return fmt.Errorf("failed to unmarshal candidate: %w", err)
+	if !isEndOfCandidates(candidateJSON) {
+		if err := validateCandidateJSON(candidateJSON); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(candidateJSON, &candidate); err != nil {
+			return fmt.Errorf("failed to unmarshal candidate: %w", err)
+		}
 	}
 
 	// If remote description not set yet, queue the candidate
@@ -173,7 +465,34 @@ func (p *PeerConnection) AddICECandidate(candidateJSON json.RawMessage) error {
 	return p.pc.AddICECandidate(candidate)
 }
 
-// Send sends data through the data channel
+// validateCandidateJSON checks that candidateJSON is an RTCIceCandidateInit
+// object with a "candidate" field, so that malformed candidates are rejected
+// when they arrive rather than when a queued candidate is added
+func validateCandidateJSON(candidateJSON json.RawMessage) error {
+	var shape struct {
+		Candidate *string `json:"candidate"`
+	}
+	if err := json.Unmarshal(candidateJSON, &shape); err != nil {
+		return fmt.Errorf("failed to unmarshal candidate: %w", err)
+	}
+	if shape.Candidate == nil {
+		return errors.New("invalid candidate: missing \"candidate\" field")
+	}
+	return nil
+}
+
+// isEndOfCandidates reports whether candidateJSON carries no candidate at
+// all, which peers send as the end-of-candidates marker
+func isEndOfCandidates(candidateJSON json.RawMessage) bool {
+	switch string(bytes.TrimSpace(candidateJSON)) {
+	case "", "null", `""`:
+		return true
+	}
+	return false
+}
+
+// Send sends data through the data channel, in chunks if it is larger
+// than the configured ChunkSize
 func (p *PeerConnection) Send(data []byte) error {
 	p.mu.RLock()
 	dc := p.dataChannel
@@ -183,7 +502,85 @@ func (p *PeerConnection) Send(data []byte) error {
 		return fmt.Errorf("data channel not available")
 	}
 
-	return dc.Send(data)
+	for _, msg := range p.splitMessage(data) {
+		if err := dc.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendContext sends data like Send, but first waits while more than
+// PeerConfig.MaxBufferedAmount bytes are queued on the data channel, so a
+// slow peer cannot make the buffer grow without bound. Chunked messages
+// wait before each chunk. It returns ctx.Err() if ctx is done while
+// waiting; chunks already sent are not recalled.
+func (p *PeerConnection) SendContext(ctx context.Context, data []byte) error {
+	p.mu.RLock()
+	dc := p.dataChannel
+	p.mu.RUnlock()
+
+	if dc == nil {
+		return fmt.Errorf("data channel not available")
+	}
+
+	for _, msg := range p.splitMessage(data) {
+		if err := waitForBufferSpace(ctx, dc, p.maxBuffered, p.bufferLowSignal); err != nil {
+			return err
+		}
+		if err := dc.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage returns data as the messages to send: in chunks if it is
+// larger than the configured ChunkSize, otherwise unchanged
+func (p *PeerConnection) splitMessage(data []byte) [][]byte {
+	if p.chunkSize <= 0 || len(data) <= p.chunkSize {
+		return [][]byte{data}
+	}
+	return codec.EncodeChunks(p.nextChunkID.Add(1), data, p.chunkSize)
+}
+
+// bufferedChannel is the part of *webrtc.DataChannel SendContext waits on
+type bufferedChannel interface {
+	BufferedAmount() uint64
+}
+
+// waitForBufferSpace waits until dc has at most maxBuffered bytes queued,
+// checking again each time the channel returned by bufferLow is closed, or
+// until ctx is done
+func waitForBufferSpace(ctx context.Context, dc bufferedChannel, maxBuffered uint64, bufferLow func() <-chan struct{}) error {
+	for {
+		// Take the signal before checking, so a drain in between is not missed
+		low := bufferLow()
+		if dc.BufferedAmount() <= maxBuffered {
+			return ctx.Err()
+		}
+		select {
+		case <-low:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// bufferLowSignal returns a channel that is closed the next time the "data"
+// channel's buffer drains to MaxBufferedAmount
+func (p *PeerConnection) bufferLowSignal() <-chan struct{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.bufferLow
+}
+
+// signalBufferLow wakes SendContext calls waiting for buffer space
+func (p *PeerConnection) signalBufferLow() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.bufferLow)
+	p.bufferLow = make(chan struct{})
 }
 
 // SendText sends text data through the data channel
@@ -201,9 +598,19 @@ func (p *PeerConnection) SendText(text string) error {
 
 // Close closes the peer connection
 func (p *PeerConnection) Close() error {
+	p.markFailed(fmt.Errorf("peer connection %s", webrtc.PeerConnectionStateClosed))
+	p.stopConnectTimer()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	for label, ch := range p.channels {
+		if ch.dc != p.dataChannel {
+			ch.dc.Close()
+		}
+		delete(p.channels, label)
+	}
+
 	if p.dataChannel != nil {
 		p.dataChannel.Close()
 		p.dataChannel = nil
@@ -216,30 +623,182 @@ func (p *PeerConnection) Close() error {
 	return nil
 }
 
-func (p *PeerConnection) setupDataChannel(dc *webrtc.DataChannel) {
+// setupDataChannel tracks dc by its label and routes its events to handler.
+// The "data" channel also becomes the one used by Send and SendText.
+func (p *PeerConnection) setupDataChannel(dc *webrtc.DataChannel, handler DataChannelHandler) {
+	ch := &peerChannel{dc: dc, handler: handler}
+	if p.chunkSize > 0 {
+		ch.chunks = codec.NewReassembler(0)
+	}
+
 	p.mu.Lock()
-	p.dataChannel = dc
+	p.channels[dc.Label()] = ch
+	if dc.Label() == "data" {
+		p.dataChannel = dc
+	}
 	p.mu.Unlock()
 
+	if dc.Label() == "data" {
+		dc.SetBufferedAmountLowThreshold(p.maxBuffered)
+		dc.OnBufferedAmountLow(p.signalBufferLow)
+	}
+
+	// Messages can arrive before OnOpen has finished (pion runs it in its own
+	// goroutine), e.g. while the handler is still setting up a transport.
+	// Queue them and replay them in order once OnOpen returns.
 	dc.OnOpen(func() {
-		if p.handler != nil {
-			p.handler.OnOpen()
+		if handler != nil {
+			handler.OnOpen()
+		}
+		p.flushPendingMessages(ch)
+		if dc.Label() == "data" {
+			p.readyOnce.Do(func() { close(p.ready) })
 		}
 	})
 
 	dc.OnClose(func() {
-		if p.handler != nil {
-			p.handler.OnClose()
+		if handler != nil {
+			handler.OnClose()
 		}
 	})
 
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		if p.handler != nil {
-			p.handler.OnMessage(msg.Data)
+		if ch.chunks != nil && !msg.IsString && codec.IsChunk(msg.Data) {
+			payload, complete, err := ch.chunks.Add(msg.Data)
+			if err != nil {
+				log.Printf("[PeerConnection] Dropped chunked message on %q: %v", dc.Label(), err)
+				return
+			}
+			if !complete {
+				return
+			}
+			msg.Data = payload
 		}
+
+		p.mu.Lock()
+		if !ch.ready {
+			ch.pending = append(ch.pending, msg)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		deliverMessage(handler, msg)
+	})
+}
+
+// deliverMessage passes msg to handler, including the text/binary flag if
+// the handler implements DataChannelMessageHandler
+func deliverMessage(handler DataChannelHandler, msg webrtc.DataChannelMessage) {
+	if handler == nil {
+		return
+	}
+	if h, ok := handler.(DataChannelMessageHandler); ok {
+		h.OnMessageEx(msg.Data, msg.IsString)
+		return
+	}
+	handler.OnMessage(msg.Data)
+}
+
+// flushPendingMessages delivers queued messages to the channel's handler and
+// marks the channel as ready. Messages that arrive while flushing are queued
+// behind the ones already pending, so delivery order is preserved.
+func (p *PeerConnection) flushPendingMessages(ch *peerChannel) {
+	p.mu.Lock()
+	for len(ch.pending) > 0 {
+		msg := ch.pending[0]
+		ch.pending = ch.pending[1:]
+		p.mu.Unlock()
+
+		deliverMessage(ch.handler, msg)
+
+		p.mu.Lock()
+	}
+	ch.pending = nil
+	ch.ready = true
+	p.mu.Unlock()
+}
+
+// WaitReady blocks until the "data" channel is open and its handler's OnOpen
+// has returned, i.e. until the connection can carry RPCs. It returns an error
+// if the connection fails or is closed first, or if ctx is done.
+func (p *PeerConnection) WaitReady(ctx context.Context) error {
+	// A connection that has since failed is not ready, even if it once was
+	select {
+	case <-p.failed:
+		return p.failedError()
+	default:
+	}
+
+	select {
+	case <-p.ready:
+		return nil
+	case <-p.failed:
+		return p.failedError()
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for data channel: %w", ctx.Err())
+	}
+}
+
+// markFailed records that the connection reached a terminal state.
+// The first reason wins.
+func (p *PeerConnection) markFailed(reason error) {
+	p.failedOnce.Do(func() {
+		p.mu.Lock()
+		p.failedErr = reason
+		p.mu.Unlock()
+		close(p.failed)
+	})
+}
+
+func (p *PeerConnection) failedError() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.failedErr
+}
+
+// Err returns why the connection failed or closed, e.g. ErrConnectTimeout,
+// or nil while it is still usable. Handlers can call it from OnClose.
+func (p *PeerConnection) Err() error {
+	select {
+	case <-p.failed:
+		return p.failedError()
+	default:
+		return nil
+	}
+}
+
+// startConnectTimer starts the ConnectTimeout window, once
+func (p *PeerConnection) startConnectTimer() {
+	if p.connectTimeout <= 0 {
+		return
+	}
+	p.connectTimerOnce.Do(func() {
+		p.mu.Lock()
+		p.connectTimer = time.AfterFunc(p.connectTimeout, p.handleConnectTimeout)
+		p.mu.Unlock()
 	})
 }
 
+func (p *PeerConnection) stopConnectTimer() {
+	p.mu.RLock()
+	timer := p.connectTimer
+	p.mu.RUnlock()
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// handleConnectTimeout closes the connection unless it has connected
+func (p *PeerConnection) handleConnectTimeout() {
+	if p.ConnectionState() == webrtc.PeerConnectionStateConnected {
+		return
+	}
+
+	p.markFailed(ErrConnectTimeout)
+	p.Close()
+}
+
 // ConnectionState returns the current connection state
 func (p *PeerConnection) ConnectionState() webrtc.PeerConnectionState {
 	if p.pc == nil {
@@ -248,6 +807,33 @@ func (p *PeerConnection) ConnectionState() webrtc.PeerConnectionState {
 	return p.pc.ConnectionState()
 }
 
+// ConnectionType returns how the connection reaches the remote peer, from
+// the ICE candidate pair in use: "relay" if either side goes through a TURN
+// server, otherwise the local candidate's type ("host", "srflx" or "prflx").
+// It returns an error if the connection is not established.
+func (p *PeerConnection) ConnectionType() (string, error) {
+	if state := p.ConnectionState(); state != webrtc.PeerConnectionStateConnected {
+		return "", fmt.Errorf("connection not established (state: %s)", state)
+	}
+
+	sctp := p.pc.SCTP()
+	if sctp == nil {
+		return "", errors.New("no selected candidate pair")
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return "", fmt.Errorf("failed to get selected candidate pair: %w", err)
+	}
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return "", errors.New("no selected candidate pair")
+	}
+
+	if pair.Local.Typ == webrtc.ICECandidateTypeRelay || pair.Remote.Typ == webrtc.ICECandidateTypeRelay {
+		return webrtc.ICECandidateTypeRelay.String(), nil
+	}
+	return pair.Local.Typ.String(), nil
+}
+
 // DataChannel returns the underlying WebRTC data channel
 // Returns nil if the data channel hasn't been established yet
 func (p *PeerConnection) DataChannel() *webrtc.DataChannel {
@@ -255,3 +841,68 @@ func (p *PeerConnection) DataChannel() *webrtc.DataChannel {
 	defer p.mu.RUnlock()
 	return p.dataChannel
 }
+
+// SignalingClient returns the client that answers and ICE candidates are
+// sent through, or nil if there is none
+func (p *PeerConnection) SignalingClient() *SignalingClient {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.signalingClient
+}
+
+// SetSignalingClient rebinds the peer to another signaling client, e.g. one
+// created to replace a dropped WebSocket connection. The DataChannels are
+// not affected, since they do not depend on signaling; later answers and
+// ICE candidates go through c. A nil c stops sending them. Peers of a
+// client that reconnects itself with Connect need no rebinding.
+func (p *PeerConnection) SetSignalingClient(c *SignalingClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signalingClient = c
+}
+
+// Metadata returns a copy of PeerConfig.Metadata
+func (p *PeerConnection) Metadata() map[string]string {
+	return copyMetadata(p.metadata)
+}
+
+// NewTransport creates a gRPC-Web transport on the "data" channel whose
+// handlers see PeerConfig.Metadata through transport.PeerInfoFromContext.
+// It must be called once the channel is open, e.g. from the handler's
+// OnOpen. Register handlers, then call Start. Invalid options are
+// reported as an error wrapping transport.ErrInvalidOptions.
+func (p *PeerConnection) NewTransport(opts *transport.HandlerOptions) (*transport.DataChannelTransport, error) {
+	dc := p.DataChannel()
+	if dc == nil {
+		return nil, errors.New("data channel not established")
+	}
+	t, err := transport.NewValidatedDataChannelTransport(dc, opts)
+	if err != nil {
+		return nil, err
+	}
+	t.SetPeerInfo(transport.PeerInfo{Metadata: p.Metadata()})
+	return t, nil
+}
+
+// copyMetadata returns a copy of m, or nil if it is empty
+func copyMetadata(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// DataChannelByLabel returns the most recent data channel opened with the given label
+// Returns nil if no such channel has been established
+func (p *PeerConnection) DataChannelByLabel(label string) *webrtc.DataChannel {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if ch, ok := p.channels[label]; ok {
+		return ch.dc
+	}
+	return nil
+}
@@ -1,7 +1,20 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/transport"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v4"
 )
 
 // TestDataChannelGetter tests the DataChannel() getter method
@@ -104,3 +117,830 @@ func TestDataChannelGetterThreadSafety(t *testing.T) {
 
 	t.Log("Thread safety test completed without race conditions")
 }
+
+// TestDataChannelByLabel tests tracking multiple data channels by label
+func TestDataChannelByLabel(t *testing.T) {
+	controlHandler := newWebRTCTestHandler(t)
+	pc, err := NewPeerConnection(PeerConfig{
+		ChannelHandlers: map[string]DataChannelHandler{"control": controlHandler},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer pc.Close()
+
+	if dc := pc.DataChannelByLabel("control"); dc != nil {
+		t.Error("Expected no channel before one is established")
+	}
+
+	dataDC, err := pc.pc.CreateDataChannel("data", nil)
+	if err != nil {
+		t.Fatalf("Failed to create data channel: %v", err)
+	}
+	controlDC, err := pc.pc.CreateDataChannel("control", nil)
+	if err != nil {
+		t.Fatalf("Failed to create control channel: %v", err)
+	}
+
+	// Normally called from the OnDataChannel callback
+	pc.setupDataChannel(dataDC, nil)
+	pc.setupDataChannel(controlDC, controlHandler)
+
+	if dc := pc.DataChannelByLabel("data"); dc != dataDC {
+		t.Error("DataChannelByLabel(\"data\") returned wrong channel")
+	}
+	if dc := pc.DataChannelByLabel("control"); dc != controlDC {
+		t.Error("DataChannelByLabel(\"control\") returned wrong channel")
+	}
+
+	// The single-channel API still refers to the "data" channel
+	if dc := pc.DataChannel(); dc != dataDC {
+		t.Error("DataChannel() should return the \"data\" channel")
+	}
+
+	if err := pc.Close(); err != nil {
+		t.Errorf("Failed to close peer connection: %v", err)
+	}
+
+	if dc := pc.DataChannelByLabel("control"); dc != nil {
+		t.Error("Expected no channels after Close()")
+	}
+}
+
+// plainMessageHandler implements only DataChannelHandler
+type plainMessageHandler struct {
+	messages [][]byte
+}
+
+func (h *plainMessageHandler) OnMessage(data []byte) { h.messages = append(h.messages, data) }
+func (h *plainMessageHandler) OnOpen()               {}
+func (h *plainMessageHandler) OnClose()              {}
+
+// extMessageHandler also implements DataChannelMessageHandler
+type extMessageHandler struct {
+	plainMessageHandler
+	isString []bool
+}
+
+func (h *extMessageHandler) OnMessageEx(data []byte, isString bool) {
+	h.messages = append(h.messages, data)
+	h.isString = append(h.isString, isString)
+}
+
+// TestDeliverMessage tests routing to OnMessage or OnMessageEx
+func TestDeliverMessage(t *testing.T) {
+	plain := &plainMessageHandler{}
+	deliverMessage(plain, webrtc.DataChannelMessage{IsString: true, Data: []byte("text")})
+	if len(plain.messages) != 1 || string(plain.messages[0]) != "text" {
+		t.Errorf("Expected OnMessage to receive the message, got %v", plain.messages)
+	}
+
+	ext := &extMessageHandler{}
+	deliverMessage(ext, webrtc.DataChannelMessage{IsString: true, Data: []byte(`{"a":1}`)})
+	deliverMessage(ext, webrtc.DataChannelMessage{IsString: false, Data: []byte{0x00, 0x01}})
+	if len(ext.isString) != 2 {
+		t.Fatalf("Expected OnMessageEx to be called twice, got %d", len(ext.isString))
+	}
+	if !ext.isString[0] || ext.isString[1] {
+		t.Errorf("Expected [true false], got %v", ext.isString)
+	}
+
+	// A nil handler is ignored
+	deliverMessage(nil, webrtc.DataChannelMessage{Data: []byte("x")})
+}
+
+// TestNonTrickleICE tests that the answer SDP carries the gathered candidates
+func TestNonTrickleICE(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	if _, err := offerPeer.pc.CreateDataChannel("data", nil); err != nil {
+		t.Fatalf("Failed to create data channel: %v", err)
+	}
+
+	offer, err := offerPeer.pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := offerPeer.pc.SetLocalDescription(offer); err != nil {
+		t.Fatalf("Failed to set local description: %v", err)
+	}
+
+	answerPeer, err := NewPeerConnection(PeerConfig{
+		NonTrickleICE:       true,
+		ICEGatheringTimeout: 3 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	if answerPeer.gatherTimeout != 3*time.Second {
+		t.Errorf("Expected gathering timeout 3s, got %v", answerPeer.gatherTimeout)
+	}
+
+	if err := answerPeer.HandleOffer(offer.SDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+
+	answerSDP := answerPeer.pc.LocalDescription().SDP
+	if !strings.Contains(answerSDP, "a=candidate:") {
+		t.Errorf("Expected answer SDP to contain candidate lines, got:\n%s", answerSDP)
+	}
+}
+
+// TestHandleOfferWithAnswer tests that the answer is returned for out-of-band delivery
+func TestHandleOfferWithAnswer(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	// No signaling client: nothing is sent, the caller delivers the answer
+	answerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	answerSDP, err := answerPeer.HandleOfferWithAnswer(offerSDP, "req-1")
+	if err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if !strings.HasPrefix(answerSDP, "v=0") {
+		t.Fatalf("Expected an SDP answer, got:\n%s", answerSDP)
+	}
+
+	if err := offerPeer.HandleAnswer(answerSDP); err != nil {
+		t.Errorf("Returned answer was not accepted: %v", err)
+	}
+}
+
+// TestSDPTransform tests that the transform is applied to outgoing SDP
+func TestSDPTransform(t *testing.T) {
+	addBandwidth := func(sdp string) string {
+		return sdp + "b=AS:256\r\n"
+	}
+
+	offerPeer, err := NewPeerConnection(PeerConfig{SDPTransform: addBandwidth})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if !strings.HasSuffix(offerSDP, "b=AS:256\r\n") {
+		t.Errorf("Expected transformed offer, got:\n%s", offerSDP)
+	}
+
+	answerPeer, err := NewPeerConnection(PeerConfig{SDPTransform: addBandwidth})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	answerSDP, err := answerPeer.HandleOfferWithAnswer(offerSDP, "req-1")
+	if err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if !strings.HasSuffix(answerSDP, "b=AS:256\r\n") {
+		t.Errorf("Expected transformed answer, got:\n%s", answerSDP)
+	}
+
+	// The transformed answer is still valid SDP
+	if err := offerPeer.HandleAnswer(answerSDP); err != nil {
+		t.Errorf("Transformed answer was not accepted: %v", err)
+	}
+}
+
+// TestSignalingClientNewPeerConnection tests that peers inherit the client's ICE servers
+func TestSignalingClientNewPeerConnection(t *testing.T) {
+	turn := webrtc.ICEServer{
+		URLs:       []string{"turn:turn.example.com:3478"},
+		Username:   "user",
+		Credential: "pass",
+	}
+	sc := NewSignalingClient(ClientConfig{
+		ICEServers: []webrtc.ICEServer{turn},
+	})
+
+	inherited, err := sc.NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer inherited.Close()
+
+	if inherited.signalingClient != sc {
+		t.Error("Expected peer to use the signaling client")
+	}
+	servers := inherited.pc.GetConfiguration().ICEServers
+	if len(servers) != 1 || servers[0].URLs[0] != turn.URLs[0] {
+		t.Errorf("Expected inherited ICE servers, got %v", servers)
+	}
+
+	// PeerConfig.ICEServers takes precedence
+	stun := webrtc.ICEServer{URLs: []string{"stun:stun.example.com:3478"}}
+	overridden, err := sc.NewPeerConnection(PeerConfig{
+		ICEServers: []webrtc.ICEServer{stun},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer overridden.Close()
+
+	servers = overridden.pc.GetConfiguration().ICEServers
+	if len(servers) != 1 || servers[0].URLs[0] != stun.URLs[0] {
+		t.Errorf("Expected PeerConfig ICE servers, got %v", servers)
+	}
+
+	// Without either, the default STUN server is used
+	fallback, err := NewSignalingClient(ClientConfig{}).NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer fallback.Close()
+
+	servers = fallback.pc.GetConfiguration().ICEServers
+	if len(servers) != 1 || servers[0].URLs[0] != "stun:stun.l.google.com:19302" {
+		t.Errorf("Expected default STUN server, got %v", servers)
+	}
+}
+
+func TestPeerConfigPolicies(t *testing.T) {
+	pc, err := NewPeerConnection(PeerConfig{
+		ICEServers: []webrtc.ICEServer{{
+			URLs:       []string{"turn:turn.example.com:3478"},
+			Username:   "user",
+			Credential: "pass",
+		}},
+		ICETransportPolicy: webrtc.ICETransportPolicyRelay,
+		BundlePolicy:       webrtc.BundlePolicyMaxBundle,
+		RTCPMuxPolicy:      webrtc.RTCPMuxPolicyRequire,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer pc.Close()
+
+	config := pc.pc.GetConfiguration()
+	if config.ICETransportPolicy != webrtc.ICETransportPolicyRelay {
+		t.Errorf("ICETransportPolicy = %v, want relay", config.ICETransportPolicy)
+	}
+	if config.BundlePolicy != webrtc.BundlePolicyMaxBundle {
+		t.Errorf("BundlePolicy = %v, want max-bundle", config.BundlePolicy)
+	}
+	if config.RTCPMuxPolicy != webrtc.RTCPMuxPolicyRequire {
+		t.Errorf("RTCPMuxPolicy = %v, want require", config.RTCPMuxPolicy)
+	}
+
+	// Unset policies keep the pion defaults
+	defaults, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer defaults.Close()
+
+	config = defaults.pc.GetConfiguration()
+	if config.ICETransportPolicy != webrtc.ICETransportPolicyAll {
+		t.Errorf("Default ICETransportPolicy = %v, want all", config.ICETransportPolicy)
+	}
+	if config.BundlePolicy != webrtc.BundlePolicyBalanced {
+		t.Errorf("Default BundlePolicy = %v, want balanced", config.BundlePolicy)
+	}
+}
+
+// TestAddEndOfCandidates tests that empty candidates are accepted as the end-of-candidates marker
+func TestAddEndOfCandidates(t *testing.T) {
+	markers := []string{"", "null", `""`, `{"candidate":""}`, ` null `}
+
+	offerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	answerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	// Before the remote description, markers are queued like candidates
+	for _, marker := range markers {
+		if err := answerPeer.AddICECandidate(json.RawMessage(marker)); err != nil {
+			t.Errorf("Queuing marker %q failed: %v", marker, err)
+		}
+	}
+	if len(answerPeer.pendingICE) != len(markers) {
+		t.Errorf("Expected %d queued markers, got %d", len(markers), len(answerPeer.pendingICE))
+	}
+
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+
+	// After it, they go straight to the ICE agent
+	for _, marker := range markers {
+		if err := answerPeer.AddICECandidate(json.RawMessage(marker)); err != nil {
+			t.Errorf("Adding marker %q failed: %v", marker, err)
+		}
+	}
+
+	// Malformed candidates are still rejected
+	if err := answerPeer.AddICECandidate(json.RawMessage(`{"candidate":`)); err == nil {
+		t.Error("Expected an error for malformed candidate JSON")
+	}
+}
+
+// TestAddICECandidateValidation tests that malformed candidates are rejected
+// before queuing and that failures of queued candidates are reported
+func TestAddICECandidateValidation(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	answerPeer, err := NewPeerConnection(PeerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	for _, candidate := range []string{`{"sdpMid":"0","sdpMLineIndex":0}`, `{}`, `[]`, `{"candidate":1}`} {
+		if err := answerPeer.AddICECandidate(json.RawMessage(candidate)); err == nil {
+			t.Errorf("Expected an error for %s", candidate)
+		}
+	}
+	if len(answerPeer.pendingICE) != 0 {
+		t.Fatalf("Expected no queued candidates, got %d", len(answerPeer.pendingICE))
+	}
+
+	// Well-formed JSON with an unparseable candidate is queued, and fails
+	// when the remote description is set
+	if err := answerPeer.AddICECandidate(json.RawMessage(`{"candidate":"candidate:garbage","sdpMid":"0"}`)); err != nil {
+		t.Fatalf("Expected the candidate to be queued, got %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); !errors.Is(err, ErrQueuedCandidates) {
+		t.Fatalf("Expected ErrQueuedCandidates, got %v", err)
+	}
+	if answerPeer.LocalDescription() == "" {
+		t.Error("Expected the answer to be created despite the failed candidate")
+	}
+	if len(answerPeer.pendingICE) != 0 {
+		t.Errorf("Expected the queue to be flushed, got %d", len(answerPeer.pendingICE))
+	}
+}
+
+// TestConnectionType tests ConnectionType before and after a loopback connection
+func TestConnectionType(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{NonTrickleICE: true})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	answerPeer, err := NewPeerConnection(PeerConfig{NonTrickleICE: true})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	if _, err := offerPeer.ConnectionType(); err == nil {
+		t.Error("Expected an error before the connection is established")
+	}
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if err := offerPeer.HandleAnswer(answerPeer.LocalDescription()); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, peer := range []*PeerConnection{offerPeer, answerPeer} {
+		if err := peer.WaitReady(ctx); err != nil {
+			t.Fatalf("Peer not ready: %v", err)
+		}
+		// Without STUN or TURN, a loopback pair is direct. A side may learn
+		// the other's address from its connectivity checks first (prflx).
+		connType, err := peer.ConnectionType()
+		if err != nil {
+			t.Fatalf("ConnectionType failed: %v", err)
+		}
+		if connType != "host" && connType != "prflx" {
+			t.Errorf("Expected a direct connection type, got %q", connType)
+		}
+	}
+}
+
+// TestWaitReady tests WaitReady for a connected, a cancelled and a closed peer
+func TestWaitReady(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{NonTrickleICE: true})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	answerPeer, err := NewPeerConnection(PeerConfig{NonTrickleICE: true})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	// Not connected yet
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := offerPeer.WaitReady(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if err := offerPeer.HandleAnswer(answerPeer.LocalDescription()); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := offerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Offer peer not ready: %v", err)
+	}
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
+	}
+
+	// A closed peer is no longer ready
+	answerPeer.Close()
+	if err := answerPeer.WaitReady(ctx); err == nil {
+		t.Error("Expected an error from WaitReady after Close")
+	}
+}
+
+// closeHandler records OnClose calls
+type closeHandler struct {
+	plainMessageHandler
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (h *closeHandler) OnClose() { h.once.Do(func() { close(h.closed) }) }
+
+// TestConnectTimeout tests that a peer that never connects is closed
+func TestConnectTimeout(t *testing.T) {
+	handler := &closeHandler{closed: make(chan struct{})}
+	peer, err := NewPeerConnection(PeerConfig{
+		Handler:        handler,
+		ConnectTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create peer: %v", err)
+	}
+	defer peer.Close()
+
+	// The window starts with the offer; no answer ever arrives
+	if _, err := peer.CreateOffer(); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := peer.Err(); err != nil {
+		t.Errorf("Expected no error before the timeout, got %v", err)
+	}
+
+	select {
+	case <-handler.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnClose not called after the connect timeout")
+	}
+
+	if err := peer.Err(); !errors.Is(err, ErrConnectTimeout) {
+		t.Errorf("Expected ErrConnectTimeout from Err, got %v", err)
+	}
+	if err := peer.WaitReady(context.Background()); !errors.Is(err, ErrConnectTimeout) {
+		t.Errorf("Expected ErrConnectTimeout from WaitReady, got %v", err)
+	}
+}
+
+// TestChunkedSend tests that large messages are chunked and reassembled
+func TestChunkedSend(t *testing.T) {
+	offerHandler := newWebRTCTestHandler(t)
+	answerHandler := newWebRTCTestHandler(t)
+
+	offerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:       offerHandler,
+		NonTrickleICE: true,
+		ChunkSize:     16 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	answerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:       answerHandler,
+		NonTrickleICE: true,
+		ChunkSize:     16 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if err := offerPeer.HandleAnswer(answerPeer.LocalDescription()); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
+	}
+
+	message := make([]byte, 1024*1024)
+	for i := range message {
+		message[i] = byte(i % 251)
+	}
+	if err := offerPeer.Send(message); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if err := offerPeer.Send([]byte("small")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if err := offerPeer.SendContext(ctx, message); err != nil {
+		t.Fatalf("Failed to send with context: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(answerHandler.getMessages()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	received := answerHandler.getMessages()
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(received))
+	}
+	if !bytes.Equal(received[2], message) {
+		t.Errorf("Message sent with SendContext does not match (got %d bytes)", len(received[2]))
+	}
+	if !bytes.Equal(received[0], message) {
+		t.Errorf("Reassembled message does not match (got %d bytes)", len(received[0]))
+	}
+	if string(received[1]) != "small" {
+		t.Errorf("Expected small message unchanged, got %q", received[1])
+	}
+}
+
+// fakeBufferedChannel reports a settable buffered amount
+type fakeBufferedChannel struct {
+	amount atomic.Uint64
+}
+
+func (c *fakeBufferedChannel) BufferedAmount() uint64 { return c.amount.Load() }
+
+func TestWaitForBufferSpace(t *testing.T) {
+	var mu sync.Mutex
+	low := make(chan struct{})
+	bufferLow := func() <-chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return low
+	}
+
+	dc := &fakeBufferedChannel{}
+	dc.amount.Store(2048)
+
+	t.Run("deadline while over threshold", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := waitForBufferSpace(ctx, dc, 1024, bufferLow); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("cancel while over threshold", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		if err := waitForBufferSpace(ctx, dc, 1024, bufferLow); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("buffer drains", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			dc.amount.Store(512)
+			mu.Lock()
+			close(low)
+			low = make(chan struct{})
+			mu.Unlock()
+		}()
+		if err := waitForBufferSpace(ctx, dc, 1024, bufferLow); err != nil {
+			t.Errorf("Expected nil after drain, got %v", err)
+		}
+	})
+}
+
+func TestSendContextWithoutDataChannel(t *testing.T) {
+	pc, err := NewPeerConnection(PeerConfig{Handler: newWebRTCTestHandler(t)})
+	if err != nil {
+		t.Fatalf("Failed to create peer: %v", err)
+	}
+	defer pc.Close()
+
+	if err := pc.SendContext(context.Background(), []byte("x")); err == nil {
+		t.Error("Expected error without a data channel")
+	}
+}
+
+func TestPeerMetadataInTransport(t *testing.T) {
+	offerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:       newWebRTCTestHandler(t),
+		NonTrickleICE: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	metadata := map[string]string{"tenant": "acme", "locale": "ja-JP"}
+	answerPeer, err := NewPeerConnection(PeerConfig{
+		Handler:       newWebRTCTestHandler(t),
+		NonTrickleICE: true,
+		Metadata:      metadata,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+
+	// Later changes to the caller's map do not leak into the peer
+	metadata["tenant"] = "changed"
+
+	if _, err := answerPeer.NewTransport(nil); err == nil {
+		t.Error("Expected error before the data channel is established")
+	}
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("Failed to handle offer: %v", err)
+	}
+	if err := offerPeer.HandleAnswer(answerPeer.LocalDescription()); err != nil {
+		t.Fatalf("Failed to handle answer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := answerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Answer peer not ready: %v", err)
+	}
+	if err := offerPeer.WaitReady(ctx); err != nil {
+		t.Fatalf("Offer peer not ready: %v", err)
+	}
+
+	if _, err := answerPeer.NewTransport(&transport.HandlerOptions{Timeout: -time.Second}); !errors.Is(err, transport.ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for a negative timeout, got %v", err)
+	}
+
+	server, err := answerPeer.NewTransport(nil)
+	if err != nil {
+		t.Fatalf("NewTransport failed: %v", err)
+	}
+	server.RegisterHandler("/test.Service/Tenant", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		info, ok := transport.PeerInfoFromContext(ctx)
+		if !ok {
+			return nil, &codec.GRPCError{Code: codec.StatusUnauthenticated, Message: "no peer info"}
+		}
+		return &codec.ResponseEnvelope{
+			Messages: [][]byte{[]byte(info.Metadata["tenant"] + "/" + info.Metadata["locale"])},
+		}, nil
+	})
+	server.Start()
+
+	client := transport.NewClient(offerPeer.DataChannel())
+	resp, err := client.Invoke(ctx, "/test.Service/Tenant", []byte("x"), nil)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if got := string(resp.Messages[0]); got != "acme/ja-JP" {
+		t.Errorf("Handler saw metadata %q, want %q", got, "acme/ja-JP")
+	}
+}
+
+func TestSetSignalingClient(t *testing.T) {
+	// The original signaling connection drops
+	serverA := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {})
+	defer serverA.Close()
+	clientA := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(serverA.URL, "http"),
+		APIKey:    "test-key",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := clientA.ConnectAndAuthenticate(ctx); err != nil {
+		t.Fatalf("ConnectAndAuthenticate failed: %v", err)
+	}
+
+	answerPeer, err := clientA.NewPeerConnection(PeerConfig{Handler: newWebRTCTestHandler(t)})
+	if err != nil {
+		t.Fatalf("Failed to create answer peer: %v", err)
+	}
+	defer answerPeer.Close()
+	clientA.Close()
+
+	// A replacement client takes over
+	received := make(chan WSMessage, 100)
+	serverB := newPingTestServer(t, func(conn *websocket.Conn, msg WSMessage) {
+		received <- msg
+	})
+	defer serverB.Close()
+	clientB := NewSignalingClient(ClientConfig{
+		ServerURL: "ws" + strings.TrimPrefix(serverB.URL, "http"),
+		APIKey:    "test-key",
+	})
+	if err := clientB.ConnectAndAuthenticate(ctx); err != nil {
+		t.Fatalf("ConnectAndAuthenticate failed: %v", err)
+	}
+	defer clientB.Close()
+
+	answerPeer.SetSignalingClient(clientB)
+	if answerPeer.SignalingClient() != clientB {
+		t.Fatal("SignalingClient not rebound")
+	}
+
+	offerPeer, err := NewPeerConnection(PeerConfig{Handler: newWebRTCTestHandler(t)})
+	if err != nil {
+		t.Fatalf("Failed to create offer peer: %v", err)
+	}
+	defer offerPeer.Close()
+
+	offerSDP, err := offerPeer.CreateOffer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if err := answerPeer.HandleOffer(offerSDP, "req-1"); err != nil {
+		t.Fatalf("HandleOffer failed after rebinding: %v", err)
+	}
+
+	// The answer and trickled candidates go through the new client
+	gotAnswer, gotICE := false, false
+	timeout := time.After(5 * time.Second)
+	for !gotAnswer || !gotICE {
+		select {
+		case msg := <-received:
+			switch msg.Type {
+			case MsgTypeAnswer:
+				gotAnswer = msg.RequestID == "req-1"
+			case MsgTypeICE:
+				gotICE = true
+			}
+		case <-timeout:
+			t.Fatalf("Timed out: answer received %v, ICE received %v", gotAnswer, gotICE)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Chunking splits payloads that are too large for a single DataChannel
+// message (SCTP stacks commonly limit messages to 64-256 KiB).
+//
+// Chunk format:
+// - 1 byte: PayloadTypeChunk
+// - 4 bytes: message ID (big-endian), shared by all chunks of a payload
+// - 4 bytes: chunk index (big-endian), from 0
+// - 4 bytes: total number of chunks (big-endian)
+// - Rest: fragment of the original payload
+//
+// The reassembled payload is the original DataChannel payload, including
+// its own payload type byte.
+
+// ChunkHeaderSize is the size of the chunk header, including the payload type byte
+const ChunkHeaderSize = 13
+
+// DefaultMaxMessageSize is the default limit for a reassembled payload
+const DefaultMaxMessageSize = 16 * 1024 * 1024
+
+// maxPendingMessages limits how many payloads can be partially received at
+// once. Beyond it, the payload that has gone longest without a chunk is
+// dropped, so that payloads whose remaining chunks never arrive, e.g.
+// because the sender failed halfway, cannot block later ones.
+const maxPendingMessages = 64
+
+// Chunk is one fragment of a chunked payload
+type Chunk struct {
+	MessageID uint32
+	Index     uint32
+	Total     uint32
+	Data      []byte
+}
+
+// EncodeChunks splits payload into chunks carrying at most chunkSize bytes
+// of it each. A payload that fits in one chunk still gets a chunk header;
+// callers normally only chunk payloads larger than chunkSize.
+func EncodeChunks(messageID uint32, payload []byte, chunkSize int) [][]byte {
+	if chunkSize <= 0 {
+		chunkSize = len(payload)
+	}
+	total := (len(payload) + chunkSize - 1) / chunkSize
+	if total == 0 {
+		total = 1
+	}
+
+	chunks := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		start := i * chunkSize
+		end := start + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		buffer := make([]byte, ChunkHeaderSize+end-start)
+		buffer[0] = PayloadTypeChunk
+		binary.BigEndian.PutUint32(buffer[1:5], messageID)
+		binary.BigEndian.PutUint32(buffer[5:9], uint32(i))
+		binary.BigEndian.PutUint32(buffer[9:13], uint32(total))
+		copy(buffer[ChunkHeaderSize:], payload[start:end])
+
+		chunks = append(chunks, buffer)
+	}
+	return chunks
+}
+
+// IsChunk checks if data is a chunk of a larger payload
+func IsChunk(data []byte) bool {
+	return len(data) >= ChunkHeaderSize && data[0] == PayloadTypeChunk
+}
+
+// DecodeChunk decodes a chunk received from DataChannel
+func DecodeChunk(data []byte) (*Chunk, error) {
+	if len(data) < ChunkHeaderSize {
+		return nil, errors.New("chunk too short")
+	}
+	if data[0] != PayloadTypeChunk {
+		return nil, fmt.Errorf("unexpected payload type: 0x%02x", data[0])
+	}
+
+	chunk := &Chunk{
+		MessageID: binary.BigEndian.Uint32(data[1:5]),
+		Index:     binary.BigEndian.Uint32(data[5:9]),
+		Total:     binary.BigEndian.Uint32(data[9:13]),
+		Data:      data[ChunkHeaderSize:],
+	}
+	if chunk.Total == 0 || chunk.Index >= chunk.Total {
+		return nil, fmt.Errorf("invalid chunk index %d of %d", chunk.Index, chunk.Total)
+	}
+	return chunk, nil
+}
+
+// Reassembler collects chunks and returns payloads once all their chunks
+// have arrived. Memory is bounded by the maximum message size and the
+// number of payloads that may be in progress at once. It is safe for
+// concurrent use.
+type Reassembler struct {
+	maxMessageSize int
+	mu             sync.Mutex
+	pending        map[uint32]*partialMessage
+	added          uint64 // Chunks added so far, to order pending payloads
+}
+
+type partialMessage struct {
+	total    uint32
+	size     int    // payload bytes received
+	buffered int    // chunk bytes received, including headers
+	lastAdd  uint64 // Reassembler.added when its last chunk arrived
+	chunks   map[uint32][]byte
+}
+
+// NewReassembler creates a Reassembler that rejects payloads whose chunks,
+// including their headers, add up to more than maxMessageSize bytes
+// (DefaultMaxMessageSize if zero)
+func NewReassembler(maxMessageSize int) *Reassembler {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &Reassembler{
+		maxMessageSize: maxMessageSize,
+		pending:        make(map[uint32]*partialMessage),
+	}
+}
+
+// Add adds a chunk. It returns the reassembled payload and true once the
+// last chunk of a payload has been added. A payload whose chunks are
+// inconsistent or too large is dropped with an error; one that has gone
+// longest without a chunk is dropped silently when too many are pending.
+func (r *Reassembler) Add(data []byte) ([]byte, bool, error) {
+	chunk, err := DecodeChunk(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.pending[chunk.MessageID]
+	if !ok {
+		if len(r.pending) >= maxPendingMessages {
+			r.evictStalest()
+		}
+		msg = &partialMessage{total: chunk.Total, chunks: make(map[uint32][]byte)}
+		r.pending[chunk.MessageID] = msg
+	}
+
+	if chunk.Total != msg.total {
+		delete(r.pending, chunk.MessageID)
+		return nil, false, fmt.Errorf("chunk total %d does not match %d for message %d", chunk.Total, msg.total, chunk.MessageID)
+	}
+	if _, dup := msg.chunks[chunk.Index]; dup {
+		delete(r.pending, chunk.MessageID)
+		return nil, false, fmt.Errorf("duplicate chunk %d for message %d", chunk.Index, chunk.MessageID)
+	}
+	// Headers count too, so that many tiny chunks cannot grow the map unbounded
+	if msg.buffered+len(data) > r.maxMessageSize {
+		delete(r.pending, chunk.MessageID)
+		return nil, false, fmt.Errorf("chunked message %d exceeds %d bytes", chunk.MessageID, r.maxMessageSize)
+	}
+
+	// Copy, since the caller may reuse data
+	msg.chunks[chunk.Index] = append([]byte(nil), chunk.Data...)
+	msg.size += len(chunk.Data)
+	msg.buffered += len(data)
+	r.added++
+	msg.lastAdd = r.added
+
+	if uint32(len(msg.chunks)) < msg.total {
+		return nil, false, nil
+	}
+
+	delete(r.pending, chunk.MessageID)
+	payload := make([]byte, 0, msg.size)
+	for i := uint32(0); i < msg.total; i++ {
+		payload = append(payload, msg.chunks[i]...)
+	}
+	return payload, true, nil
+}
+
+// evictStalest drops the pending payload that has gone longest without a
+// chunk. r.mu must be held.
+func (r *Reassembler) evictStalest() {
+	var stalest uint32
+	var oldest *partialMessage
+	for id, msg := range r.pending {
+		if oldest == nil || msg.lastAdd < oldest.lastAdd {
+			stalest, oldest = id, msg
+		}
+	}
+	delete(r.pending, stalest)
+}
@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	payload := make([]byte, 1000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	chunks := EncodeChunks(7, payload, 64)
+	if len(chunks) != 16 {
+		t.Fatalf("Expected 16 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if !IsChunk(chunk) {
+			t.Errorf("Chunk %d not recognized", i)
+		}
+		if len(chunk) > ChunkHeaderSize+64 {
+			t.Errorf("Chunk %d is %d bytes", i, len(chunk))
+		}
+	}
+
+	// Chunks may arrive out of order
+	r := NewReassembler(0)
+	order := []int{3, 0, 15, 1, 2, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}
+	for _, i := range order {
+		if _, complete, err := r.Add(chunks[i]); err != nil || complete {
+			t.Fatalf("Chunk %d: complete=%v err=%v", i, complete, err)
+		}
+	}
+	got, complete, err := r.Add(chunks[14])
+	if err != nil || !complete {
+		t.Fatalf("Last chunk: complete=%v err=%v", complete, err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("Reassembled payload does not match")
+	}
+
+	if len(r.pending) != 0 {
+		t.Errorf("Expected no pending messages, got %d", len(r.pending))
+	}
+}
+
+func TestChunkInterleavedMessages(t *testing.T) {
+	a := EncodeChunks(1, []byte("first payload"), 4)
+	b := EncodeChunks(2, []byte("second payload"), 4)
+
+	r := NewReassembler(0)
+	var done [][]byte
+	for i := 0; i < len(a) || i < len(b); i++ {
+		for _, chunks := range [][][]byte{a, b} {
+			if i >= len(chunks) {
+				continue
+			}
+			payload, complete, err := r.Add(chunks[i])
+			if err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			if complete {
+				done = append(done, payload)
+			}
+		}
+	}
+
+	if len(done) != 2 || string(done[0]) != "first payload" || string(done[1]) != "second payload" {
+		t.Errorf("Unexpected reassembled payloads: %q", done)
+	}
+}
+
+func TestChunkErrors(t *testing.T) {
+	chunks := EncodeChunks(1, []byte("some payload"), 4)
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{"too short", [][]byte{{PayloadTypeChunk, 0, 0}}},
+		{"index out of range", [][]byte{{PayloadTypeChunk, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 2}}},
+		{"zero total", [][]byte{{PayloadTypeChunk, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}}},
+		{"duplicate", [][]byte{chunks[0], chunks[0]}},
+		{"total mismatch", [][]byte{chunks[0], EncodeChunks(1, []byte("short"), 4)[1]}},
+		{"too large", [][]byte{EncodeChunks(1, make([]byte, 100), 60)[0], EncodeChunks(1, make([]byte, 100), 60)[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(100)
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, _, err = r.Add(chunk); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				t.Error("Expected an error")
+			}
+			if len(r.pending) != 0 {
+				t.Errorf("Expected the message to be dropped, %d pending", len(r.pending))
+			}
+		})
+	}
+}
+
+func TestChunkPendingLimit(t *testing.T) {
+	r := NewReassembler(0)
+	// Leave maxPendingMessages payloads incomplete
+	for id := uint32(0); id < maxPendingMessages; id++ {
+		if _, _, err := r.Add(EncodeChunks(id, []byte("abc"), 1)[0]); err != nil {
+			t.Fatalf("Add %d failed: %v", id, err)
+		}
+	}
+	// Payload 0 gets another chunk, leaving payload 1 the stalest
+	if _, _, err := r.Add(EncodeChunks(0, []byte("abc"), 1)[1]); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// A new payload is still reassembled
+	var payload []byte
+	var complete bool
+	for _, chunk := range EncodeChunks(maxPendingMessages, []byte("new"), 2) {
+		var err error
+		if payload, complete, err = r.Add(chunk); err != nil {
+			t.Fatalf("Add beyond the pending message limit failed: %v", err)
+		}
+	}
+	if !complete || string(payload) != "new" {
+		t.Errorf("Expected payload %q, got %q (complete %v)", "new", payload, complete)
+	}
+
+	if _, ok := r.pending[1]; ok {
+		t.Error("Expected the stalest payload to be dropped")
+	}
+	if _, ok := r.pending[0]; !ok {
+		t.Error("Expected the recently added payload to be kept")
+	}
+	if len(r.pending) != maxPendingMessages-1 {
+		t.Errorf("Expected %d pending payloads, got %d", maxPendingMessages-1, len(r.pending))
+	}
+}
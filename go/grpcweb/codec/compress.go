@@ -0,0 +1,63 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// EncodingIdentity is the grpc-encoding of uncompressed messages
+	EncodingIdentity = "identity"
+	// EncodingGzip is the grpc-encoding of gzip-compressed messages
+	EncodingGzip = "gzip"
+)
+
+// AcceptsEncoding reports whether a grpc-accept-encoding header value
+// (e.g. "gzip, identity") lists encoding. Names are compared
+// case-insensitively and parameters such as ";q=0.5" are ignored.
+func AcceptsEncoding(accept string, encoding string) bool {
+	for _, name := range strings.Split(accept, ",") {
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name = name[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(name), encoding) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressGzip compresses a message for a FrameCompressed frame
+func CompressGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressGzip decompresses the payload of a FrameCompressed frame. The
+// result is limited to DefaultMaxMessageSize bytes.
+func DecompressGzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip message: %w", err)
+	}
+	defer zr.Close()
+
+	message, err := io.ReadAll(io.LimitReader(zr, DefaultMaxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip message: %w", err)
+	}
+	if len(message) > DefaultMaxMessageSize {
+		return nil, fmt.Errorf("decompressed message exceeds %d bytes", DefaultMaxMessageSize)
+	}
+	return message, nil
+}
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"identity", false},
+		{"gzip", true},
+		{"identity, gzip", true},
+		{"deflate,GZIP", true},
+		{"gzip;q=0.5", true},
+		{"x-gzip", false},
+	}
+
+	for _, tt := range tests {
+		if got := AcceptsEncoding(tt.accept, EncodingGzip); got != tt.want {
+			t.Errorf("AcceptsEncoding(%q, gzip) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompressedResponseRoundTrip(t *testing.T) {
+	message := []byte(strings.Repeat("compressible ", 100))
+	envelope := ResponseEnvelope{
+		Headers:  map[string]string{"grpc-encoding": EncodingGzip},
+		Messages: [][]byte{message, {}},
+		Trailers: map[string]string{"grpc-status": "0"},
+	}
+
+	data, err := EncodeResponseWithOptions(envelope, EncodeOptions{Compression: EncodingGzip})
+	if err != nil {
+		t.Fatalf("EncodeResponseWithOptions failed: %v", err)
+	}
+	uncompressed, err := EncodeResponse(envelope)
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+	if len(data) >= len(uncompressed) {
+		t.Errorf("Compressed response is %d bytes, uncompressed %d", len(data), len(uncompressed))
+	}
+
+	decoded, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if len(decoded.Messages) != 2 || !bytes.Equal(decoded.Messages[0], message) || len(decoded.Messages[1]) != 0 {
+		t.Errorf("Messages not preserved: %d messages", len(decoded.Messages))
+	}
+
+	// Compressed frames need a grpc-encoding the decoder understands
+	envelope.Headers = map[string]string{}
+	data, err = EncodeResponseWithOptions(envelope, EncodeOptions{Compression: EncodingGzip})
+	if err != nil {
+		t.Fatalf("EncodeResponseWithOptions failed: %v", err)
+	}
+	if _, err := DecodeResponse(data); err == nil {
+		t.Error("Expected error for compressed frames without grpc-encoding")
+	}
+
+	if _, err := EncodeResponseWithOptions(envelope, EncodeOptions{Compression: "br"}); err == nil {
+		t.Error("Expected error for unsupported compression")
+	}
+}
+
+func TestDecompressGzipInvalid(t *testing.T) {
+	if _, err := DecompressGzip([]byte("not gzip")); err == nil {
+		t.Error("Expected error for invalid gzip data")
+	}
+}
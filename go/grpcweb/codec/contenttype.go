@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"mime"
+	"strings"
+)
+
+// Payload codec names used in gRPC-Web content types
+const (
+	CodecProto = "proto"
+	CodecJSON  = "json"
+)
+
+// gRPC-Web content types. Plain application/grpc-web means protobuf.
+const (
+	ContentTypeGRPCWeb = "application/grpc-web"
+	ContentTypeProto   = ContentTypeGRPCWeb + "+" + CodecProto
+	ContentTypeJSON    = ContentTypeGRPCWeb + "+" + CodecJSON
+)
+
+// ContentType returns the gRPC-Web content type for payloads encoded with
+// the named codec, e.g. "application/grpc-web+json" for CodecJSON
+func ContentType(codecName string) string {
+	if codecName == "" {
+		return ContentTypeProto
+	}
+	return ContentTypeGRPCWeb + "+" + codecName
+}
+
+// CodecFromContentType returns the codec name of a gRPC-Web content type,
+// ignoring parameters. It returns CodecProto for plain application/grpc-web
+// and false if contentType is not a gRPC-Web content type.
+func CodecFromContentType(contentType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	if mediaType == ContentTypeGRPCWeb {
+		return CodecProto, true
+	}
+	codecName, ok := strings.CutPrefix(mediaType, ContentTypeGRPCWeb+"+")
+	if !ok || codecName == "" {
+		return "", false
+	}
+	return codecName, true
+}
+
+// SetContentType sets the content-type header for the named codec and
+// returns headers, allocating it if nil
+func SetContentType(headers map[string]string, codecName string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["content-type"] = ContentType(codecName)
+	return headers
+}
@@ -0,0 +1,89 @@
+package codec
+
+import "testing"
+
+func TestContentType(t *testing.T) {
+	if got := ContentType(CodecProto); got != "application/grpc-web+proto" {
+		t.Errorf("ContentType(proto) = %q", got)
+	}
+	if got := ContentType(CodecJSON); got != "application/grpc-web+json" {
+		t.Errorf("ContentType(json) = %q", got)
+	}
+	if got := ContentType(""); got != ContentTypeProto {
+		t.Errorf("ContentType(\"\") = %q, expected %q", got, ContentTypeProto)
+	}
+}
+
+func TestCodecFromContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		codecName   string
+		ok          bool
+	}{
+		{"application/grpc-web", CodecProto, true},
+		{"application/grpc-web+proto", CodecProto, true},
+		{"application/grpc-web+json", CodecJSON, true},
+		{"application/grpc-web+json; charset=utf-8", CodecJSON, true},
+		{"Application/GRPC-Web+JSON", CodecJSON, true},
+		{"application/json", "", false},
+		{"application/grpc-web+", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		codecName, ok := CodecFromContentType(tt.contentType)
+		if codecName != tt.codecName || ok != tt.ok {
+			t.Errorf("CodecFromContentType(%q) = %q, %v; expected %q, %v",
+				tt.contentType, codecName, ok, tt.codecName, tt.ok)
+		}
+	}
+}
+
+func TestSetContentType(t *testing.T) {
+	headers := SetContentType(nil, CodecJSON)
+	if headers["content-type"] != ContentTypeJSON {
+		t.Errorf("Expected %q, got %q", ContentTypeJSON, headers["content-type"])
+	}
+
+	// Existing headers are kept and the content-type is overridden
+	headers = SetContentType(map[string]string{"x-request-id": "req-1", "content-type": "text/plain"}, CodecProto)
+	if headers["content-type"] != ContentTypeProto || headers["x-request-id"] != "req-1" {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+}
+
+func TestContentTypeRoundTrip(t *testing.T) {
+	for _, codecName := range []string{CodecProto, CodecJSON} {
+		reqData, err := EncodeRequest(RequestEnvelope{
+			Path:    "/test.Service/Method",
+			Headers: SetContentType(nil, codecName),
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("EncodeRequest failed: %v", err)
+		}
+		req, err := DecodeRequest(reqData)
+		if err != nil {
+			t.Fatalf("DecodeRequest failed: %v", err)
+		}
+		if got, _ := CodecFromContentType(req.Headers["content-type"]); got != codecName {
+			t.Errorf("Request: expected codec %q, got %q", codecName, got)
+		}
+
+		respData, err := EncodeResponse(ResponseEnvelope{
+			Headers:  SetContentType(nil, codecName),
+			Messages: [][]byte{[]byte("test")},
+			Trailers: map[string]string{"grpc-status": "0"},
+		})
+		if err != nil {
+			t.Fatalf("EncodeResponse failed: %v", err)
+		}
+		resp, err := DecodeResponse(respData)
+		if err != nil {
+			t.Fatalf("DecodeResponse failed: %v", err)
+		}
+		if resp.Headers["content-type"] != ContentType(codecName) {
+			t.Errorf("Response: expected %q, got %q", ContentType(codecName), resp.Headers["content-type"])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrEncoderFinished is returned by ResponseEncoder methods called after
+// WriteTrailers
+var ErrEncoderFinished = errors.New("response encoder already finished")
+
+// ResponseEncoder encodes a response piece by piece, so that messages can
+// be sent as they are produced instead of buffered for EncodeResponse. The
+// concatenation of everything it returns is a response in the same format:
+// [headers_len(4)][headers_json(N)][data_frames...][trailer_frame]
+//
+// A ResponseEncoder is not safe for concurrent use.
+type ResponseEncoder struct {
+	compression  string
+	jsonTrailers bool
+	finished     bool
+}
+
+// EncodeResponseStreaming starts an incremental response. It returns the
+// encoder and the header section, which is sent first; follow it with the
+// output of WriteMessage for each message and of WriteTrailers.
+//
+// opts.Compression applies to every message and opts.JSONTrailers to the
+// trailer frame. opts.TrailersOnly is ignored, since whether there will be
+// messages is not known up front.
+func EncodeResponseStreaming(headers map[string]string, opts EncodeOptions) (*ResponseEncoder, []byte, error) {
+	switch opts.Compression {
+	case "", EncodingIdentity, EncodingGzip:
+	default:
+		return nil, nil, fmt.Errorf("unsupported compression: %s", opts.Compression)
+	}
+
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	header := make([]byte, 4+len(headersJSON))
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(headersJSON)))
+	copy(header[4:], headersJSON)
+
+	return &ResponseEncoder{compression: opts.Compression, jsonTrailers: opts.JSONTrailers}, header, nil
+}
+
+// WriteMessage returns the data frame for message
+func (e *ResponseEncoder) WriteMessage(message []byte) ([]byte, error) {
+	if e.finished {
+		return nil, ErrEncoderFinished
+	}
+	return encodeMessageFrame(message, e.compression)
+}
+
+// WriteTrailers returns the trailer frame that ends the response. No more
+// messages can be written after it.
+func (e *ResponseEncoder) WriteTrailers(trailers map[string]string) ([]byte, error) {
+	if e.finished {
+		return nil, ErrEncoderFinished
+	}
+	e.finished = true
+	if e.jsonTrailers {
+		frame, err := CreateJSONTrailerFrame(trailers)
+		if err != nil {
+			return nil, err
+		}
+		return EncodeFrame(frame), nil
+	}
+	return EncodeFrame(CreateTrailerFrame(trailers)), nil
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeResponseStreaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope ResponseEnvelope
+	}{
+		{
+			name: "messages",
+			envelope: ResponseEnvelope{
+				Headers:  map[string]string{"content-type": "application/grpc-web+proto"},
+				Messages: [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{0xAB}, 70000)},
+				Trailers: map[string]string{"grpc-status": "0"},
+			},
+		},
+		{
+			name: "no messages",
+			envelope: ResponseEnvelope{
+				Headers:  map[string]string{},
+				Trailers: map[string]string{"grpc-status": "5", "grpc-message": "not found"},
+			},
+		},
+		{
+			name: "nil headers",
+			envelope: ResponseEnvelope{
+				Messages: [][]byte{[]byte("only")},
+				Trailers: map[string]string{"grpc-status": "0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, data, err := EncodeResponseStreaming(tt.envelope.Headers, EncodeOptions{})
+			if err != nil {
+				t.Fatalf("EncodeResponseStreaming failed: %v", err)
+			}
+			for _, message := range tt.envelope.Messages {
+				frame, err := enc.WriteMessage(message)
+				if err != nil {
+					t.Fatalf("WriteMessage failed: %v", err)
+				}
+				data = append(data, frame...)
+			}
+			trailer, err := enc.WriteTrailers(tt.envelope.Trailers)
+			if err != nil {
+				t.Fatalf("WriteTrailers failed: %v", err)
+			}
+			data = append(data, trailer...)
+
+			want, err := EncodeResponse(tt.envelope)
+			if err != nil {
+				t.Fatalf("EncodeResponse failed: %v", err)
+			}
+			// Trailer lines follow map order, so bytes only match for one trailer
+			if len(tt.envelope.Trailers) == 1 && !bytes.Equal(data, want) {
+				t.Errorf("Streaming output differs from EncodeResponse")
+			}
+
+			got, err := DecodeResponse(data)
+			if err != nil {
+				t.Fatalf("DecodeResponse failed: %v", err)
+			}
+			expected, err := DecodeResponse(want)
+			if err != nil {
+				t.Fatalf("DecodeResponse failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Decoded %+v, want %+v", got, expected)
+			}
+		})
+	}
+}
+
+func TestEncodeResponseStreamingCompression(t *testing.T) {
+	message := []byte(strings.Repeat("compressible ", 100))
+	enc, data, err := EncodeResponseStreaming(map[string]string{"grpc-encoding": EncodingGzip}, EncodeOptions{Compression: EncodingGzip})
+	if err != nil {
+		t.Fatalf("EncodeResponseStreaming failed: %v", err)
+	}
+	frame, err := enc.WriteMessage(message)
+	if err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+	if frame[0] != FrameCompressed {
+		t.Errorf("Expected a compressed frame, got flags 0x%02x", frame[0])
+	}
+	trailer, _ := enc.WriteTrailers(map[string]string{"grpc-status": "0"})
+	data = append(append(data, frame...), trailer...)
+
+	resp, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if len(resp.Messages) != 1 || !bytes.Equal(resp.Messages[0], message) {
+		t.Errorf("Expected the decompressed message, got %d messages", len(resp.Messages))
+	}
+
+	if _, _, err := EncodeResponseStreaming(nil, EncodeOptions{Compression: "br"}); err == nil {
+		t.Error("Expected an error for unsupported compression")
+	}
+}
+
+func TestResponseEncoderFinished(t *testing.T) {
+	enc, _, err := EncodeResponseStreaming(nil, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeResponseStreaming failed: %v", err)
+	}
+	if _, err := enc.WriteTrailers(map[string]string{"grpc-status": "0"}); err != nil {
+		t.Fatalf("WriteTrailers failed: %v", err)
+	}
+	if _, err := enc.WriteMessage([]byte("late")); !errors.Is(err, ErrEncoderFinished) {
+		t.Errorf("Expected ErrEncoderFinished from WriteMessage, got %v", err)
+	}
+	if _, err := enc.WriteTrailers(nil); !errors.Is(err, ErrEncoderFinished) {
+		t.Errorf("Expected ErrEncoderFinished from WriteTrailers, got %v", err)
+	}
+}
@@ -18,11 +18,13 @@
 package codec
 
 import (
+	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 // StatusCode represents gRPC status codes
@@ -71,6 +73,37 @@ func (e *GRPCError) Error() string {
 	return fmt.Sprintf("gRPC error %d (%s): %s", e.Code, GetStatusName(e.Code), e.Message)
 }
 
+// NewRequestEnvelope creates a request envelope for path. The headers are
+// copied with lowercased keys, and x-request-id is set to a NewRequestID if
+// headers does not set one. Streaming requests are rejected without an
+// x-request-id, so hand-built requests should use this helper.
+func NewRequestEnvelope(path string, message []byte, headers map[string]string) RequestEnvelope {
+	normalized := normalizeHeaders(headers)
+	if normalized == nil {
+		normalized = make(map[string]string, 1)
+	}
+	if normalized["x-request-id"] == "" {
+		normalized["x-request-id"] = NewRequestID()
+	}
+	return RequestEnvelope{
+		Path:    path,
+		Headers: normalized,
+		Message: message,
+	}
+}
+
+// NewRequestID generates a random (version 4) UUID for use as an
+// x-request-id
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate request ID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 // EncodeRequest encodes a request envelope for sending over DataChannel
 // Format: [path_len(4)][path(N)][headers_len(4)][headers_json(M)][grpc_frames]
 func EncodeRequest(envelope RequestEnvelope) ([]byte, error) {
@@ -120,6 +153,11 @@ func EncodeRequest(envelope RequestEnvelope) ([]byte, error) {
 
 // DecodeRequest decodes a request envelope received from DataChannel
 func DecodeRequest(data []byte) (*RequestEnvelope, error) {
+	data, err := unmarkPayload(data, PayloadTypeEnvelope)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(data) < 8 {
 		return nil, errors.New("incomplete request: data too short")
 	}
@@ -130,8 +168,8 @@ func DecodeRequest(data []byte) (*RequestEnvelope, error) {
 	pathLength := binary.BigEndian.Uint32(data[offset : offset+4])
 	offset += 4
 
-	// Read path
-	if offset+int(pathLength) > len(data) {
+	// Read path (compared as uint64 so an untrusted length cannot overflow int)
+	if uint64(pathLength) > uint64(len(data)-offset) {
 		return nil, errors.New("incomplete request: missing path")
 	}
 	path := string(data[offset : offset+int(pathLength)])
@@ -145,7 +183,7 @@ func DecodeRequest(data []byte) (*RequestEnvelope, error) {
 	offset += 4
 
 	// Read headers
-	if offset+int(headersLength) > len(data) {
+	if uint64(headersLength) > uint64(len(data)-offset) {
 		return nil, errors.New("incomplete request: missing headers")
 	}
 	headersJSON := data[offset : offset+int(headersLength)]
@@ -155,36 +193,43 @@ func DecodeRequest(data []byte) (*RequestEnvelope, error) {
 	if err := json.Unmarshal(headersJSON, &headers); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
 	}
+	headers = normalizeHeaders(headers)
 
 	// Decode gRPC-Web frames
-	framesData := data[offset:]
-	result := DecodeFrames(framesData)
-
-	if len(result.Remaining) > 0 {
-		return nil, errors.New("incomplete request: partial frame remaining")
+	frames, err := DecodeFramesAll(data[offset:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
 	}
 
 	// Extract message from data frames
 	// For requests, we expect exactly one data frame
-	if len(result.Frames) == 0 {
+	if len(frames) == 0 {
 		return nil, errors.New("no data frames in request")
 	}
 
+	// A data frame with zero bytes is a valid empty message (e.g.
+	// google.protobuf.Empty), so track whether one was seen rather than
+	// relying on the payload being non-nil
 	var message []byte
-	for _, frame := range result.Frames {
+	found := false
+	for _, frame := range frames {
 		if frame.Flags == FrameData {
 			// Take the first data frame as the message
-			if message == nil {
+			if !found {
 				message = frame.Data
+				found = true
 			}
 		} else {
-			return nil, fmt.Errorf("unexpected frame type in request: %d", frame.Flags)
+			return nil, fmt.Errorf("invalid request: %w", &ErrUnknownFrameFlag{Flag: frame.Flags})
 		}
 	}
 
-	if message == nil {
+	if !found {
 		return nil, errors.New("no message data found in request")
 	}
+	if message == nil {
+		message = []byte{}
+	}
 
 	return &RequestEnvelope{
 		Path:    path,
@@ -193,9 +238,59 @@ func DecodeRequest(data []byte) (*RequestEnvelope, error) {
 	}, nil
 }
 
+// normalizeHeaders lowercases header keys, since metadata keys are
+// case-insensitive and canonically lowercase (as ParseTrailers does for
+// trailers). If two keys differ only in case, the lowercase one wins.
+func normalizeHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	normalized := make(map[string]string, len(headers))
+	for key, value := range headers {
+		lower := strings.ToLower(key)
+		if _, exists := normalized[lower]; exists && key != lower {
+			continue
+		}
+		normalized[lower] = value
+	}
+	return normalized
+}
+
+// EncodeOptions controls how EncodeResponseWithOptions encodes a response
+type EncodeOptions struct {
+	// TrailersOnly encodes responses without messages as "trailers-only":
+	// the trailers (grpc-status, grpc-message, ...) are merged into the
+	// headers and no trailer frame is written. Some gRPC-Web clients expect
+	// this form for immediate errors. DecodeResponse accepts both forms.
+	TrailersOnly bool
+
+	// Compression compresses each message with the given encoding and
+	// sends it in a FrameCompressed frame. Only EncodingGzip is supported;
+	// "" and EncodingIdentity leave messages uncompressed. The caller sets
+	// the grpc-encoding header to match.
+	Compression string
+
+	// JSONTrailers writes the trailers as a FrameTrailerJSON frame, so that
+	// values may contain line breaks or leading and trailing whitespace.
+	// Header-style trailers stay the default, since other gRPC-Web clients
+	// only understand those. DecodeResponse accepts both.
+	JSONTrailers bool
+}
+
 // EncodeResponse encodes a response envelope for sending over DataChannel
 // Format: [headers_len(4)][headers_json(N)][data_frames...][trailer_frame]
 func EncodeResponse(envelope ResponseEnvelope) ([]byte, error) {
+	return EncodeResponseWithOptions(envelope, EncodeOptions{})
+}
+
+// EncodeResponseWithOptions encodes a response envelope like EncodeResponse,
+// using the given options
+func EncodeResponseWithOptions(envelope ResponseEnvelope, opts EncodeOptions) ([]byte, error) {
+	if opts.TrailersOnly && len(envelope.Messages) == 0 {
+		return encodeTrailersOnlyResponse(envelope)
+	}
+
 	// Encode headers as JSON
 	headersJSON, err := json.Marshal(envelope.Headers)
 	if err != nil {
@@ -208,14 +303,22 @@ func EncodeResponse(envelope ResponseEnvelope) ([]byte, error) {
 	dataFramesLength := 0
 
 	for _, message := range envelope.Messages {
-		dataFrame := CreateDataFrame(message)
-		frameBytes := EncodeFrame(dataFrame)
+		frameBytes, err := encodeMessageFrame(message, opts.Compression)
+		if err != nil {
+			return nil, err
+		}
 		dataFrameBytes = append(dataFrameBytes, frameBytes)
 		dataFramesLength += len(frameBytes)
 	}
 
 	// Encode trailer frame
 	trailerFrame := CreateTrailerFrame(envelope.Trailers)
+	if opts.JSONTrailers {
+		trailerFrame, err = CreateJSONTrailerFrame(envelope.Trailers)
+		if err != nil {
+			return nil, err
+		}
+	}
 	trailerBytes := EncodeFrame(trailerFrame)
 
 	// Calculate total length
@@ -245,8 +348,76 @@ func EncodeResponse(envelope ResponseEnvelope) ([]byte, error) {
 	return buffer, nil
 }
 
+// encodeMessageFrame encodes a message as a data frame, compressed with the
+// given encoding
+func encodeMessageFrame(message []byte, compression string) ([]byte, error) {
+	dataFrame := CreateDataFrame(message)
+	switch compression {
+	case "", EncodingIdentity:
+	case EncodingGzip:
+		compressed, err := CompressGzip(message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress message: %w", err)
+		}
+		dataFrame = Frame{Flags: FrameCompressed, Data: compressed}
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+	return EncodeFrame(dataFrame), nil
+}
+
+// encodeTrailersOnlyResponse encodes a response without messages as
+// [headers_len(4)][headers_json(N)], with the trailers merged into the headers
+func encodeTrailersOnlyResponse(envelope ResponseEnvelope) ([]byte, error) {
+	headers := make(map[string]string, len(envelope.Headers)+len(envelope.Trailers))
+	for k, v := range envelope.Headers {
+		headers[k] = v
+	}
+	for k, v := range envelope.Trailers {
+		headers[k] = v
+	}
+
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	buffer := make([]byte, 4+len(headersJSON))
+	binary.BigEndian.PutUint32(buffer[0:4], uint32(len(headersJSON)))
+	copy(buffer[4:], headersJSON)
+
+	return buffer, nil
+}
+
+// DefaultMaxResponseMessages is the message limit transport.Client applies
+// when decoding buffered responses
+const DefaultMaxResponseMessages = 10000
+
+// ErrTooManyMessages is returned by DecodeResponseWithOptions when a
+// response has more messages than DecodeOptions.MaxMessages
+var ErrTooManyMessages = errors.New("too many messages in response")
+
+// DecodeOptions controls how DecodeResponseWithOptions decodes a response
+type DecodeOptions struct {
+	// MaxMessages limits the number of messages in a response, so that a
+	// response of many tiny frames cannot exhaust memory. Zero means no
+	// limit.
+	MaxMessages int
+}
+
 // DecodeResponse decodes a response envelope received from DataChannel
 func DecodeResponse(data []byte) (*ResponseEnvelope, error) {
+	return DecodeResponseWithOptions(data, DecodeOptions{})
+}
+
+// DecodeResponseWithOptions decodes a response envelope like
+// DecodeResponse, using the given options
+func DecodeResponseWithOptions(data []byte, opts DecodeOptions) (*ResponseEnvelope, error) {
+	data, err := unmarkPayload(data, PayloadTypeEnvelope)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(data) < 4 {
 		return nil, errors.New("incomplete response: data too short")
 	}
@@ -257,8 +428,8 @@ func DecodeResponse(data []byte) (*ResponseEnvelope, error) {
 	headersLength := binary.BigEndian.Uint32(data[offset : offset+4])
 	offset += 4
 
-	// Read headers
-	if offset+int(headersLength) > len(data) {
+	// Read headers (compared as uint64 so an untrusted length cannot overflow int)
+	if uint64(headersLength) > uint64(len(data)-offset) {
 		return nil, errors.New("incomplete response: missing headers")
 	}
 	headersJSON := data[offset : offset+int(headersLength)]
@@ -268,26 +439,56 @@ func DecodeResponse(data []byte) (*ResponseEnvelope, error) {
 	if err := json.Unmarshal(headersJSON, &headers); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
 	}
+	headers = normalizeHeaders(headers)
 
-	// Decode gRPC-Web frames
-	framesData := data[offset:]
-	result := DecodeFrames(framesData)
-
-	if len(result.Remaining) > 0 {
-		return nil, errors.New("incomplete response: partial frame remaining")
-	}
-
-	// Separate data frames and trailer frame
+	// Separate data frames and trailer frame. Frames are decoded one at a
+	// time, so that a response over MaxMessages is rejected before the rest
+	// of it is decoded.
 	messages := make([][]byte, 0)
 	trailers := make(map[string]string)
+	hasTrailerFrame := false
 
-	for _, frame := range result.Frames {
-		if frame.Flags == FrameData {
+	for buffer := data[offset:]; len(buffer) > 0; {
+		frame, n, err := decodeCompleteFrame(buffer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		buffer = buffer[n:]
+
+		isTrailer := frame.Flags == FrameTrailer || frame.Flags == FrameTrailerJSON
+		if !isTrailer && opts.MaxMessages > 0 && len(messages) >= opts.MaxMessages {
+			return nil, fmt.Errorf("%w: limit is %d", ErrTooManyMessages, opts.MaxMessages)
+		}
+		switch frame.Flags {
+		case FrameData:
 			messages = append(messages, frame.Data)
-		} else if frame.Flags == FrameTrailer {
+		case FrameCompressed:
+			if encoding := headers["grpc-encoding"]; encoding != EncodingGzip {
+				return nil, fmt.Errorf("compressed message with unsupported grpc-encoding %q", encoding)
+			}
+			message, err := DecompressGzip(frame.Data)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case FrameTrailer:
 			trailers = ParseTrailers(frame.Data)
-		} else {
-			return nil, fmt.Errorf("unknown frame flags: %d", frame.Flags)
+			hasTrailerFrame = true
+		case FrameTrailerJSON:
+			trailers, err = ParseJSONTrailers(frame.Data)
+			if err != nil {
+				return nil, err
+			}
+			hasTrailerFrame = true
+		}
+	}
+
+	// Trailers-only response: the headers carry the status
+	if !hasTrailerFrame && len(messages) == 0 {
+		if _, ok := headers["grpc-status"]; ok {
+			for k, v := range headers {
+				trailers[k] = v
+			}
 		}
 	}
 
@@ -395,28 +596,115 @@ func GetStatusName(code int) string {
 	}
 }
 
+// Payload type discriminators.
+//
+// Every DataChannel payload sent by the transport starts with one of these
+// bytes, so receivers can tell envelopes and stream messages apart without
+// guessing. Payloads without a discriminator (legacy) start with the high
+// byte of a 4-byte length, which is 0x00 for any message under 16 MiB, so
+// the two forms cannot be confused. Decoders accept both forms.
+const (
+	// PayloadTypeEnvelope marks a request or response envelope
+	PayloadTypeEnvelope byte = 0x01
+	// PayloadTypeStream marks a stream message
+	PayloadTypeStream byte = 0x02
+	// PayloadTypeChunk marks a fragment of a larger payload (see chunk.go)
+	PayloadTypeChunk byte = 0x03
+	// PayloadTypeGoodbye marks a goodbye sent before closing (see goodbye.go)
+	PayloadTypeGoodbye byte = 0x04
+)
+
+// MarkPayload prefixes an encoded envelope or stream message with its payload type
+func MarkPayload(payloadType byte, data []byte) []byte {
+	buffer := make([]byte, 1+len(data))
+	buffer[0] = payloadType
+	copy(buffer[1:], data)
+	return buffer
+}
+
+// SplitPayload returns the payload type and the body of a DataChannel payload.
+// For a legacy payload without a discriminator it returns 0 and data unchanged.
+func SplitPayload(data []byte) (byte, []byte) {
+	if len(data) > 0 && (data[0] == PayloadTypeEnvelope || data[0] == PayloadTypeStream || data[0] == PayloadTypeChunk || data[0] == PayloadTypeGoodbye) {
+		return data[0], data[1:]
+	}
+	return 0, data
+}
+
+// unmarkPayload strips the discriminator from data, which must be of the
+// expected payload type or a legacy payload
+func unmarkPayload(data []byte, expected byte) ([]byte, error) {
+	payloadType, body := SplitPayload(data)
+	if payloadType != 0 && payloadType != expected {
+		return nil, fmt.Errorf("unexpected payload type: 0x%02x", payloadType)
+	}
+	return body, nil
+}
+
 // Stream message flags for streaming RPC over DataChannel
 const (
 	// StreamFlagData indicates a data message in the stream
 	StreamFlagData byte = 0x00
 	// StreamFlagEnd indicates the final message with trailers
 	StreamFlagEnd byte = 0x01
+	// StreamFlagCancel is sent by the client to cancel an in-progress stream.
+	// Cancel messages carry no data.
+	StreamFlagCancel byte = 0x02
+	// StreamFlagKeepalive is sent by the server while a stream is idle.
+	// Keepalive messages carry no data and do not advance the sequence;
+	// clients ignore them.
+	StreamFlagKeepalive byte = 0x03
+	// StreamFlagHeader carries the response headers (initial metadata) as a
+	// JSON object. The server sends it at most once, before any data.
+	StreamFlagHeader byte = 0x04
+	// StreamFlagResumeToken carries a resume token set by the handler, as
+	// UTF-8 data. A client whose stream is interrupted, e.g. because the
+	// DataChannel reconnects, can send the latest token it received in the
+	// ResumeTokenHeader of a new request to continue the stream.
+	StreamFlagResumeToken byte = 0x05
 )
 
+// MaxStreamRequestIDLength is the longest request ID, in bytes, a stream
+// message may carry. DecodeStreamMessage rejects longer ones, so the
+// x-request-id of a streaming request must fit. Legacy (unmarked) stream
+// messages are further limited to 255 bytes by IsStreamMessage.
+const MaxStreamRequestIDLength = 1024
+
+// MissingRequestID is the request ID of the end message a transport sends
+// when it rejects a streaming request that has no x-request-id. The client
+// cannot tell which of its requests failed, but it receives the failure as
+// an ordinary stream message rather than a unary response.
+const MissingRequestID = "missing-request-id"
+
+// StreamCountTrailer is the trailer of a stream's end message holding the
+// number of messages the server sent, so that a client can detect messages
+// it did not receive. Batched messages count individually.
+const StreamCountTrailer = "x-stream-count"
+
+// ResumeTokenHeader is the header of a streaming request that resumes an
+// interrupted stream, holding the last token the server sent in a
+// StreamFlagResumeToken message. The end message of a stream whose handler
+// set a token carries the latest one in a trailer of the same name.
+const ResumeTokenHeader = "x-resume-token"
+
 // StreamMessage represents a single message in a streaming RPC
 type StreamMessage struct {
 	RequestID string // Correlates stream messages to the original request
-	Flag      byte   // StreamFlagData or StreamFlagEnd
-	Data      []byte // Frame data (data frame or trailer frame)
+	Flag      byte   // One of the StreamFlag constants
+	// Sequence numbers the messages of a stream from 0 in the order they are
+	// sent. The end message's sequence equals the number of messages sent
+	// before it, so a client can tell whether it saw all of them.
+	Sequence uint32
+	Data     []byte // Frame data (data frame or trailer frame)
 }
 
 // EncodeStreamMessage encodes a stream message for sending over DataChannel
-// Format: [requestId_len(4)][requestId(N)][flag(1)][data...]
+// Format: [requestId_len(4)][requestId(N)][flag(1)][sequence(4)][data...]
 func EncodeStreamMessage(msg StreamMessage) []byte {
 	requestIDBytes := []byte(msg.RequestID)
 	requestIDLen := len(requestIDBytes)
 
-	totalLen := 4 + requestIDLen + 1 + len(msg.Data)
+	totalLen := 4 + requestIDLen + 1 + 4 + len(msg.Data)
 	buffer := make([]byte, totalLen)
 	offset := 0
 
@@ -432,6 +720,10 @@ func EncodeStreamMessage(msg StreamMessage) []byte {
 	buffer[offset] = msg.Flag
 	offset++
 
+	// Write sequence
+	binary.BigEndian.PutUint32(buffer[offset:offset+4], msg.Sequence)
+	offset += 4
+
 	// Write data
 	copy(buffer[offset:], msg.Data)
 
@@ -440,7 +732,12 @@ func EncodeStreamMessage(msg StreamMessage) []byte {
 
 // DecodeStreamMessage decodes a stream message received from DataChannel
 func DecodeStreamMessage(data []byte) (*StreamMessage, error) {
-	if len(data) < 5 {
+	data, err := unmarkPayload(data, PayloadTypeStream)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 9 {
 		return nil, errors.New("stream message too short")
 	}
 
@@ -450,7 +747,10 @@ func DecodeStreamMessage(data []byte) (*StreamMessage, error) {
 	requestIDLen := binary.BigEndian.Uint32(data[offset : offset+4])
 	offset += 4
 
-	if offset+int(requestIDLen)+1 > len(data) {
+	if requestIDLen > MaxStreamRequestIDLength {
+		return nil, fmt.Errorf("stream message request ID too long: %d bytes (max %d)", requestIDLen, MaxStreamRequestIDLength)
+	}
+	if int(requestIDLen)+1+4 > len(data)-offset {
 		return nil, errors.New("incomplete stream message")
 	}
 
@@ -462,21 +762,35 @@ func DecodeStreamMessage(data []byte) (*StreamMessage, error) {
 	flag := data[offset]
 	offset++
 
+	// Read sequence
+	sequence := binary.BigEndian.Uint32(data[offset : offset+4])
+	offset += 4
+
 	// Read data
 	msgData := data[offset:]
 
 	return &StreamMessage{
 		RequestID: requestID,
 		Flag:      flag,
+		Sequence:  sequence,
 		Data:      msgData,
 	}, nil
 }
 
-// IsStreamMessage checks if data is a stream message (starts with request ID length)
-// Regular responses start with headers length which is typically small JSON
-// Stream messages have a specific pattern we can detect
+// IsStreamMessage checks if data is a stream message.
+// Payloads with a discriminator are classified exactly. Legacy payloads fall
+// back to a heuristic: a small request ID length followed by a valid stream
+// flag. The heuristic can misclassify a legacy unary response (e.g. one with
+// "{}" headers), which is why the transport marks every payload.
 func IsStreamMessage(data []byte) bool {
-	if len(data) < 5 {
+	switch payloadType, _ := SplitPayload(data); payloadType {
+	case PayloadTypeStream:
+		return true
+	case PayloadTypeEnvelope, PayloadTypeChunk, PayloadTypeGoodbye:
+		return false
+	}
+
+	if len(data) < 9 {
 		return false
 	}
 	// Check if first 4 bytes represent a reasonable request ID length (< 256)
@@ -485,9 +799,61 @@ func IsStreamMessage(data []byte) bool {
 	if requestIDLen == 0 || requestIDLen > 255 {
 		return false
 	}
-	if int(4+requestIDLen+1) > len(data) {
+	if int(4+requestIDLen+1+4) > len(data) {
 		return false
 	}
 	flag := data[4+requestIDLen]
-	return flag == StreamFlagData || flag == StreamFlagEnd
+	return flag == StreamFlagData || flag == StreamFlagEnd || flag == StreamFlagKeepalive ||
+		flag == StreamFlagHeader || flag == StreamFlagResumeToken
+}
+
+// EncodeStreamHeaders encodes response headers as the data of a
+// StreamFlagHeader message. Keys are lowercased.
+func EncodeStreamHeaders(headers map[string]string) ([]byte, error) {
+	headers = normalizeHeaders(headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return json.Marshal(headers)
+}
+
+// DecodeStreamHeaders decodes the data of a StreamFlagHeader message
+func DecodeStreamHeaders(data []byte) (map[string]string, error) {
+	var headers map[string]string
+	if err := json.Unmarshal(data, &headers); err != nil {
+		return nil, fmt.Errorf("invalid stream headers: %w", err)
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return normalizeHeaders(headers), nil
+}
+
+// EncodeCancelMessage encodes a cancel message for the stream with the given request ID
+// Format: [requestId_len(4)][requestId(N)][flag(1)][sequence(4)]
+func EncodeCancelMessage(requestID string) []byte {
+	return EncodeStreamMessage(StreamMessage{
+		RequestID: requestID,
+		Flag:      StreamFlagCancel,
+	})
+}
+
+// IsCancelMessage checks if data is a stream cancel message.
+// Unlike IsStreamMessage this is exact: a cancel message is a request ID
+// followed by the cancel flag and sequence and nothing else, which cannot
+// be a valid request envelope.
+func IsCancelMessage(data []byte) bool {
+	data, err := unmarkPayload(data, PayloadTypeStream)
+	if err != nil {
+		return false
+	}
+
+	if len(data) < 9 {
+		return false
+	}
+	requestIDLen := binary.BigEndian.Uint32(data[0:4])
+	if requestIDLen == 0 || requestIDLen > MaxStreamRequestIDLength || int(requestIDLen)+9 != len(data) {
+		return false
+	}
+	return data[4+requestIDLen] == StreamFlagCancel
 }
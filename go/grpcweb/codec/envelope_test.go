@@ -2,7 +2,11 @@ package codec
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -68,6 +72,33 @@ func TestEncodeRequest(t *testing.T) {
 	}
 }
 
+func TestNewRequestEnvelope(t *testing.T) {
+	first := NewRequestEnvelope("/test.Service/Method", []byte("hi"), nil)
+	second := NewRequestEnvelope("/test.Service/Method", []byte("hi"), nil)
+
+	id := first.Headers["x-request-id"]
+	if id == "" {
+		t.Fatal("Expected a generated x-request-id")
+	}
+	if id == second.Headers["x-request-id"] {
+		t.Errorf("Expected unique request IDs, both were %q", id)
+	}
+	if first.Path != "/test.Service/Method" || string(first.Message) != "hi" {
+		t.Errorf("Unexpected envelope: %+v", first)
+	}
+
+	// An existing ID is kept, whatever its case, and the caller's map is
+	// not modified
+	headers := map[string]string{"X-Request-Id": "req-1", "authorization": "token"}
+	envelope := NewRequestEnvelope("/test.Service/Method", nil, headers)
+	if envelope.Headers["x-request-id"] != "req-1" || envelope.Headers["authorization"] != "token" {
+		t.Errorf("Unexpected headers: %v", envelope.Headers)
+	}
+	if len(headers) != 2 || headers["X-Request-Id"] != "req-1" {
+		t.Errorf("Caller's headers were modified: %v", headers)
+	}
+}
+
 func TestDecodeRequest(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -103,6 +134,79 @@ func TestDecodeRequest(t *testing.T) {
 	}
 }
 
+func TestDecodeRequestEmptyMessage(t *testing.T) {
+	// [path_len][path][headers_len][headers]
+	prefix := []byte{0x00, 0x00, 0x00, 0x04}
+	prefix = append(prefix, "/a/b"...)
+	prefix = append(prefix, 0x00, 0x00, 0x00, 0x02)
+	prefix = append(prefix, "{}"...)
+
+	// A data frame with zero bytes is an empty message
+	withEmptyFrame := append(append([]byte{}, prefix...), 0x00, 0x00, 0x00, 0x00, 0x00)
+	req, err := DecodeRequest(withEmptyFrame)
+	if err != nil {
+		t.Fatalf("DecodeRequest() error = %v", err)
+	}
+	if req.Message == nil || len(req.Message) != 0 {
+		t.Errorf("Expected a non-nil empty message, got %#v", req.Message)
+	}
+
+	// No data frame at all is an error
+	if _, err := DecodeRequest(prefix); err == nil {
+		t.Error("Expected an error for a request without a data frame")
+	}
+}
+
+func TestDecodeUnknownFrameFlag(t *testing.T) {
+	request, err := EncodeRequest(RequestEnvelope{Path: "/a/b", Headers: map[string]string{}, Message: []byte("msg")})
+	if err != nil {
+		t.Fatalf("EncodeRequest() error = %v", err)
+	}
+	response, err := EncodeResponse(ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{[]byte("msg")},
+		Trailers: map[string]string{"grpc-status": "0"},
+	})
+	if err != nil {
+		t.Fatalf("EncodeResponse() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		decode func([]byte) error
+		data   []byte
+		frame  Frame
+	}{
+		{"request unknown flag", decodeRequestErr, request, Frame{Flags: 0x80, Data: []byte("x")}},
+		{"request trailer", decodeRequestErr, request, CreateTrailerFrame(map[string]string{"a": "b"})},
+		{"response unknown flag", decodeResponseErr, response, Frame{Flags: 0x04, Data: []byte("x")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := append(append([]byte{}, tt.data...), EncodeFrame(tt.frame)...)
+			err := tt.decode(buf)
+			var flagErr *ErrUnknownFrameFlag
+			if !errors.As(err, &flagErr) {
+				t.Fatalf("Expected *ErrUnknownFrameFlag, got %v", err)
+			}
+			if flagErr.Flag != tt.frame.Flags {
+				t.Errorf("Flag = 0x%02x, want 0x%02x", flagErr.Flag, tt.frame.Flags)
+			}
+		})
+	}
+}
+
+func decodeRequestErr(data []byte) error {
+	_, err := DecodeRequest(data)
+	return err
+}
+
+func decodeResponseErr(data []byte) error {
+	_, err := DecodeResponse(data)
+	return err
+}
+
 func TestRequestRoundTrip(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -152,6 +256,14 @@ func TestRequestRoundTrip(t *testing.T) {
 				Message: make([]byte, 10000),
 			},
 		},
+		{
+			name: "empty message",
+			envelope: RequestEnvelope{
+				Path:    "/test.Service/NoArgs",
+				Headers: map[string]string{},
+				Message: []byte{},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -572,3 +684,448 @@ func TestGRPCErrorInterface(t *testing.T) {
 		t.Error("Error message should contain the message")
 	}
 }
+
+func TestIsCancelMessage(t *testing.T) {
+	request, err := EncodeRequest(RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("EncodeRequest failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"cancel message", EncodeCancelMessage("req-1"), true},
+		{"data message", EncodeStreamMessage(StreamMessage{RequestID: "req-1", Flag: StreamFlagData, Data: []byte{0}}), false},
+		{"end message", EncodeStreamMessage(StreamMessage{RequestID: "req-1", Flag: StreamFlagEnd}), false},
+		{"request envelope", request, false},
+		{"empty request ID", []byte{0, 0, 0, 0, StreamFlagCancel}, false},
+		{"too short", []byte{0, 0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCancelMessage(tt.data); got != tt.want {
+				t.Errorf("IsCancelMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	msg, err := DecodeStreamMessage(EncodeCancelMessage("req-1"))
+	if err != nil {
+		t.Fatalf("DecodeStreamMessage failed: %v", err)
+	}
+	if msg.RequestID != "req-1" || msg.Flag != StreamFlagCancel || len(msg.Data) != 0 {
+		t.Errorf("Unexpected cancel message: %+v", msg)
+	}
+}
+
+func TestStreamMessageRoundTrip(t *testing.T) {
+	original := StreamMessage{
+		RequestID: "stream-1",
+		Flag:      StreamFlagData,
+		Sequence:  42,
+		Data:      []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0xff},
+	}
+
+	encoded := EncodeStreamMessage(original)
+	if !IsStreamMessage(encoded) {
+		t.Error("IsStreamMessage() = false for encoded stream message")
+	}
+
+	decoded, err := DecodeStreamMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeStreamMessage failed: %v", err)
+	}
+
+	if decoded.RequestID != original.RequestID {
+		t.Errorf("RequestID = %q, want %q", decoded.RequestID, original.RequestID)
+	}
+	if decoded.Flag != original.Flag {
+		t.Errorf("Flag = %d, want %d", decoded.Flag, original.Flag)
+	}
+	if decoded.Sequence != original.Sequence {
+		t.Errorf("Sequence = %d, want %d", decoded.Sequence, original.Sequence)
+	}
+	if !bytes.Equal(decoded.Data, original.Data) {
+		t.Errorf("Data = %v, want %v", decoded.Data, original.Data)
+	}
+
+	// A message cut off inside the sequence is rejected
+	if _, err := DecodeStreamMessage(encoded[:4+len("stream-1")+3]); err == nil {
+		t.Error("Expected error for truncated stream message")
+	}
+}
+
+func TestStreamHeadersRoundTrip(t *testing.T) {
+	data, err := EncodeStreamHeaders(map[string]string{"X-Rate-Limit": "10"})
+	if err != nil {
+		t.Fatalf("EncodeStreamHeaders failed: %v", err)
+	}
+
+	encoded := EncodeStreamMessage(StreamMessage{
+		RequestID: "stream-1",
+		Flag:      StreamFlagHeader,
+		Data:      data,
+	})
+	if !IsStreamMessage(encoded) {
+		t.Error("IsStreamMessage() = false for header message")
+	}
+
+	msg, err := DecodeStreamMessage(encoded)
+	if err != nil {
+		t.Fatalf("DecodeStreamMessage failed: %v", err)
+	}
+	headers, err := DecodeStreamHeaders(msg.Data)
+	if err != nil {
+		t.Fatalf("DecodeStreamHeaders failed: %v", err)
+	}
+	if len(headers) != 1 || headers["x-rate-limit"] != "10" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	if _, err := DecodeStreamHeaders([]byte("not json")); err == nil {
+		t.Error("Expected error for invalid header data")
+	}
+}
+
+func TestDecodeStreamMessageRequestIDLength(t *testing.T) {
+	// The longest allowed request ID round-trips
+	longest := StreamMessage{
+		RequestID: strings.Repeat("r", MaxStreamRequestIDLength),
+		Flag:      StreamFlagData,
+		Data:      []byte("data"),
+	}
+	decoded, err := DecodeStreamMessage(EncodeStreamMessage(longest))
+	if err != nil {
+		t.Fatalf("DecodeStreamMessage failed for %d-byte request ID: %v", MaxStreamRequestIDLength, err)
+	}
+	if decoded.RequestID != longest.RequestID {
+		t.Errorf("RequestID not preserved")
+	}
+
+	tests := []struct {
+		name         string
+		requestIDLen uint32
+		size         int
+	}{
+		{"just over the limit", MaxStreamRequestIDLength + 1, MaxStreamRequestIDLength + 1 + 5},
+		{"claimed 64KiB", 1 << 16, 16},
+		{"claimed 4GiB", math.MaxUint32, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, 4+tt.size)
+			binary.BigEndian.PutUint32(data, tt.requestIDLen)
+
+			for _, payload := range [][]byte{data, MarkPayload(PayloadTypeStream, data)} {
+				_, err := DecodeStreamMessage(payload)
+				if err == nil || !strings.Contains(err.Error(), "request ID too long") {
+					t.Errorf("Expected request ID too long error, got %v", err)
+				}
+				if IsCancelMessage(payload) {
+					t.Error("IsCancelMessage() = true for oversized request ID")
+				}
+			}
+
+			// The legacy heuristic does not take it for a stream message either
+			if IsStreamMessage(data) {
+				t.Error("IsStreamMessage() = true for oversized request ID")
+			}
+		})
+	}
+}
+
+func TestDecodeNormalizesHeaderKeys(t *testing.T) {
+	request, err := EncodeRequest(RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"X-Request-Id": "req-1", "Content-Type": "application/grpc-web+proto"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("EncodeRequest failed: %v", err)
+	}
+
+	req, err := DecodeRequest(request)
+	if err != nil {
+		t.Fatalf("DecodeRequest failed: %v", err)
+	}
+	if req.Headers["x-request-id"] != "req-1" {
+		t.Errorf("Expected lowercase x-request-id, got headers %v", req.Headers)
+	}
+	if req.Headers["content-type"] != "application/grpc-web+proto" {
+		t.Errorf("Expected lowercase content-type, got headers %v", req.Headers)
+	}
+	if _, ok := req.Headers["X-Request-Id"]; ok {
+		t.Error("Mixed-case key should not remain after decoding")
+	}
+
+	response, err := EncodeResponse(ResponseEnvelope{
+		Headers:  map[string]string{"X-Custom": "a", "x-custom": "b"},
+		Trailers: map[string]string{"grpc-status": "0"},
+	})
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+
+	resp, err := DecodeResponse(response)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	if len(resp.Headers) != 1 || resp.Headers["x-custom"] != "b" {
+		t.Errorf("Expected lowercase key to win, got headers %v", resp.Headers)
+	}
+}
+
+func TestPayloadDiscriminator(t *testing.T) {
+	// A unary response with empty headers: [0 0 0 2]["{}"][0x00 frame...]
+	// looks like a stream message with a 2-byte request ID and data flag
+	response, err := EncodeResponse(ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{[]byte("hi")},
+		Trailers: map[string]string{"grpc-status": "0"},
+	})
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+	if !IsStreamMessage(response) {
+		t.Fatal("Expected the legacy heuristic to misclassify this response; adjust the test vector")
+	}
+
+	markedResponse := MarkPayload(PayloadTypeEnvelope, response)
+	if IsStreamMessage(markedResponse) {
+		t.Error("Marked envelope must not be classified as a stream message")
+	}
+	if IsCancelMessage(markedResponse) {
+		t.Error("Marked envelope must not be classified as a cancel message")
+	}
+	resp, err := DecodeResponse(markedResponse)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed on marked payload: %v", err)
+	}
+	if len(resp.Messages) != 1 || string(resp.Messages[0]) != "hi" {
+		t.Errorf("Unexpected messages: %v", resp.Messages)
+	}
+
+	// Request IDs longer than the heuristic allows are still recognized when marked
+	longID := string(bytes.Repeat([]byte("a"), 300))
+	stream := EncodeStreamMessage(StreamMessage{RequestID: longID, Flag: StreamFlagData, Data: []byte{0}})
+	if IsStreamMessage(stream) {
+		t.Error("Expected the legacy heuristic to reject a 300-byte request ID")
+	}
+	markedStream := MarkPayload(PayloadTypeStream, stream)
+	if !IsStreamMessage(markedStream) {
+		t.Error("Marked stream message must be classified as a stream message")
+	}
+	msg, err := DecodeStreamMessage(markedStream)
+	if err != nil {
+		t.Fatalf("DecodeStreamMessage failed on marked payload: %v", err)
+	}
+	if msg.RequestID != longID {
+		t.Errorf("RequestID mismatch after decoding marked payload")
+	}
+
+	// Decoding a payload of the wrong type fails instead of misparsing
+	if _, err := DecodeResponse(markedStream); err == nil {
+		t.Error("Expected DecodeResponse to reject a stream payload")
+	}
+	if _, err := DecodeStreamMessage(markedResponse); err == nil {
+		t.Error("Expected DecodeStreamMessage to reject an envelope payload")
+	}
+	if _, err := DecodeRequest(markedStream); err == nil {
+		t.Error("Expected DecodeRequest to reject a stream payload")
+	}
+
+	// Cancel messages work in both forms
+	cancel := EncodeCancelMessage("req-1")
+	if !IsCancelMessage(cancel) || !IsCancelMessage(MarkPayload(PayloadTypeStream, cancel)) {
+		t.Error("Expected cancel message to be detected with and without discriminator")
+	}
+
+	// Legacy payloads are returned unchanged by SplitPayload
+	if payloadType, body := SplitPayload(response); payloadType != 0 || !bytes.Equal(body, response) {
+		t.Errorf("SplitPayload changed a legacy payload: type 0x%02x", payloadType)
+	}
+}
+
+func TestTrailersOnlyResponse(t *testing.T) {
+	envelope := CreateErrorResponse(StatusNotFound, "not found")
+	envelope.Headers["x-request-id"] = "req-1"
+
+	framed, err := EncodeResponse(envelope)
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+	trailersOnly, err := EncodeResponseWithOptions(envelope, EncodeOptions{TrailersOnly: true})
+	if err != nil {
+		t.Fatalf("EncodeResponseWithOptions failed: %v", err)
+	}
+
+	// Trailers-only responses are just the header block
+	headersLength := binary.BigEndian.Uint32(trailersOnly[0:4])
+	if int(headersLength) != len(trailersOnly)-4 {
+		t.Errorf("Expected no frames after the headers, got %d extra bytes", len(trailersOnly)-4-int(headersLength))
+	}
+
+	for name, data := range map[string][]byte{"framed": framed, "trailers-only": trailersOnly} {
+		decoded, err := DecodeResponse(data)
+		if err != nil {
+			t.Fatalf("%s: DecodeResponse failed: %v", name, err)
+		}
+
+		grpcErr := GetError(*decoded)
+		if grpcErr == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+		if grpcErr.Code != StatusNotFound || grpcErr.Message != "not found" {
+			t.Errorf("%s: expected NOT_FOUND 'not found', got %v", name, grpcErr)
+		}
+		if decoded.Headers["x-request-id"] != "req-1" {
+			t.Errorf("%s: expected x-request-id header, got %v", name, decoded.Headers)
+		}
+	}
+}
+
+func TestJSONTrailers(t *testing.T) {
+	trailers := map[string]string{
+		"grpc-status":  "0",
+		"x-multiline":  "first\r\nsecond",
+		"x-colon":      "key: value",
+		"x-padded":     "  leading and trailing  ",
+		"x-unicode":    "こんにちは",
+		"X-Mixed-Case": "kept",
+	}
+	envelope := ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{[]byte("hello")},
+		Trailers: trailers,
+	}
+
+	encoded, err := EncodeResponseWithOptions(envelope, EncodeOptions{JSONTrailers: true})
+	if err != nil {
+		t.Fatalf("EncodeResponseWithOptions failed: %v", err)
+	}
+	headersLength := binary.BigEndian.Uint32(encoded[0:4])
+	frames, err := DecodeFramesAll(encoded[4+headersLength:])
+	if err != nil {
+		t.Fatalf("DecodeFramesAll failed: %v", err)
+	}
+	if last := frames[len(frames)-1]; last.Flags != FrameTrailerJSON {
+		t.Errorf("Expected a JSON trailer frame, got flags 0x%02x", last.Flags)
+	}
+
+	decoded, err := DecodeResponse(encoded)
+	if err != nil {
+		t.Fatalf("DecodeResponse failed: %v", err)
+	}
+	for key, value := range trailers {
+		if got := decoded.Trailers[strings.ToLower(key)]; got != value {
+			t.Errorf("Trailer %s: expected %q, got %q", key, value, got)
+		}
+	}
+	if len(decoded.Messages) != 1 || string(decoded.Messages[0]) != "hello" {
+		t.Errorf("Expected message 'hello', got %q", decoded.Messages)
+	}
+
+	// Header-style trailers stay the default
+	encoded, err = EncodeResponse(envelope)
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+	headersLength = binary.BigEndian.Uint32(encoded[0:4])
+	frames, err = DecodeFramesAll(encoded[4+headersLength:])
+	if err != nil {
+		t.Fatalf("DecodeFramesAll failed: %v", err)
+	}
+	if last := frames[len(frames)-1]; last.Flags != FrameTrailer {
+		t.Errorf("Expected a header-style trailer frame by default, got flags 0x%02x", last.Flags)
+	}
+}
+
+func TestParseJSONTrailersInvalid(t *testing.T) {
+	if _, err := ParseJSONTrailers([]byte("grpc-status: 0")); err == nil {
+		t.Error("Expected an error for a non-JSON payload")
+	}
+
+	frame := Frame{Flags: FrameTrailerJSON, Data: []byte("{")}
+	data := append([]byte{0, 0, 0, 2, '{', '}'}, EncodeFrame(frame)...)
+	if _, err := DecodeResponse(data); err == nil {
+		t.Error("Expected DecodeResponse to fail on invalid JSON trailers")
+	}
+}
+
+func TestTrailersOnlyKeepsMessages(t *testing.T) {
+	// Responses with messages are always framed
+	envelope := ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{[]byte("hello")},
+		Trailers: map[string]string{"grpc-status": "0"},
+	}
+
+	framed, err := EncodeResponse(envelope)
+	if err != nil {
+		t.Fatalf("EncodeResponse failed: %v", err)
+	}
+	withOption, err := EncodeResponseWithOptions(envelope, EncodeOptions{TrailersOnly: true})
+	if err != nil {
+		t.Fatalf("EncodeResponseWithOptions failed: %v", err)
+	}
+	if !bytes.Equal(framed, withOption) {
+		t.Error("Expected TrailersOnly not to change a response with messages")
+	}
+}
+
+func TestDecodeResponseMaxMessages(t *testing.T) {
+	// A response of many empty data frames is only 5 bytes per message
+	const count = 1000
+	frames := make([]byte, 0, count*5)
+	for i := 0; i < count; i++ {
+		frames = append(frames, EncodeFrame(CreateDataFrame(nil))...)
+	}
+	frames = append(frames, EncodeFrame(CreateTrailerFrame(map[string]string{"grpc-status": "0"}))...)
+
+	data := binary.BigEndian.AppendUint32(nil, 2)
+	data = append(data, "{}"...)
+	data = append(data, frames...)
+
+	if _, err := DecodeResponseWithOptions(data, DecodeOptions{MaxMessages: count - 1}); !errors.Is(err, ErrTooManyMessages) {
+		t.Errorf("Expected ErrTooManyMessages, got %v", err)
+	}
+
+	// The trailer frame does not count towards the limit
+	resp, err := DecodeResponseWithOptions(data, DecodeOptions{MaxMessages: count})
+	if err != nil {
+		t.Fatalf("DecodeResponseWithOptions failed: %v", err)
+	}
+	if len(resp.Messages) != count || resp.Trailers["grpc-status"] != "0" {
+		t.Errorf("Expected %d messages and grpc-status 0, got %d and %q", count, len(resp.Messages), resp.Trailers["grpc-status"])
+	}
+
+	// Zero means no limit
+	if _, err := DecodeResponse(data); err != nil {
+		t.Errorf("DecodeResponse failed: %v", err)
+	}
+
+	// Decoding stops at the limit: a bad frame after it is never reached,
+	// and the frames after it are not decoded
+	corrupt := append(data[:len(data):len(data)], EncodeFrame(Frame{Flags: 0x80})...)
+	if _, err := DecodeResponseWithOptions(corrupt, DecodeOptions{MaxMessages: 10}); !errors.Is(err, ErrTooManyMessages) {
+		t.Errorf("Expected ErrTooManyMessages before the bad frame, got %v", err)
+	}
+	oneByte := binary.BigEndian.AppendUint32(nil, 2)
+	oneByte = append(oneByte, "{}"...)
+	for i := 0; i < count; i++ {
+		oneByte = append(oneByte, EncodeFrame(CreateDataFrame([]byte{1}))...)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		DecodeResponseWithOptions(oneByte, DecodeOptions{MaxMessages: 10})
+	})
+	if allocs > 50 {
+		t.Errorf("Expected decoding to stop after 10 of %d messages, got %.0f allocations", count, allocs)
+	}
+}
@@ -1,13 +1,15 @@
 // Package codec implements gRPC-Web frame encoding and decoding.
 //
 // Frame format:
-// - 1 byte: flags (0 = data, 1 = trailer)
+// - 1 byte: flags (0 = data, 1 = trailer, 2 = compressed data, 3 = JSON trailer)
 // - 4 bytes: big-endian message length
 // - N bytes: message payload
 package codec
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -17,6 +19,12 @@ const (
 	FrameData byte = 0x00
 	// FrameTrailer represents a trailer frame
 	FrameTrailer byte = 0x01
+	// FrameCompressed represents a data frame whose payload is compressed
+	// with the response's grpc-encoding
+	FrameCompressed byte = 0x02
+	// FrameTrailerJSON represents a trailer frame whose payload is a JSON
+	// object, for trailer values header-style trailers cannot carry
+	FrameTrailerJSON byte = 0x03
 	// HeaderSize is the size of the frame header (1 byte flags + 4 bytes length)
 	HeaderSize = 5
 )
@@ -53,6 +61,22 @@ type DecodeResult struct {
 // DecodeFrames decodes frames from buffer (may contain multiple frames or partial frames).
 // Returns decoded frames and any remaining bytes that don't form a complete frame.
 func DecodeFrames(buffer []byte) DecodeResult {
+	return decodeFrames(buffer, true)
+}
+
+// DecodeFramesNoCopy decodes frames like DecodeFrames, but each frame's Data
+// is a slice of buffer instead of a copy. This saves an allocation and a
+// copy per frame when decoding many frames.
+//
+// The frames alias buffer: the caller must not modify or reuse buffer while
+// the frames are in use, and modifying a frame's Data modifies buffer. Use
+// DecodeFrames unless buffer is known to outlive the frames unchanged.
+func DecodeFramesNoCopy(buffer []byte) DecodeResult {
+	return decodeFrames(buffer, false)
+}
+
+// decodeFrames implements DecodeFrames and DecodeFramesNoCopy
+func decodeFrames(buffer []byte, copyData bool) DecodeResult {
 	frames := []Frame{}
 	offset := 0
 	bufferLen := len(buffer)
@@ -73,9 +97,9 @@ func DecodeFrames(buffer []byte) DecodeResult {
 		// Read message length (big-endian)
 		messageLength := binary.BigEndian.Uint32(buffer[offset+1 : offset+5])
 
-		// Check if we have enough bytes for the complete message
-		frameEnd := offset + HeaderSize + int(messageLength)
-		if frameEnd > bufferLen {
+		// Check if we have enough bytes for the complete message. The length
+		// is untrusted, so compare as uint64 before converting to int.
+		if uint64(messageLength) > uint64(bufferLen-offset-HeaderSize) {
 			// Incomplete frame, return remaining bytes
 			return DecodeResult{
 				Frames:    frames,
@@ -83,9 +107,15 @@ func DecodeFrames(buffer []byte) DecodeResult {
 			}
 		}
 
-		// Extract frame data (make a copy to avoid referencing original buffer)
-		data := make([]byte, messageLength)
-		copy(data, buffer[offset+HeaderSize:frameEnd])
+		frameEnd := offset + HeaderSize + int(messageLength)
+
+		// Extract frame data. Unless copying, cap the slice so that appending
+		// to it cannot overwrite the next frame.
+		data := buffer[offset+HeaderSize : frameEnd : frameEnd]
+		if copyData {
+			data = make([]byte, messageLength)
+			copy(data, buffer[offset+HeaderSize:frameEnd])
+		}
 
 		frames = append(frames, Frame{
 			Flags: flags,
@@ -102,6 +132,64 @@ func DecodeFrames(buffer []byte) DecodeResult {
 	}
 }
 
+// ErrPartialFrame is returned by DecodeFramesAll when the buffer ends in
+// the middle of a frame
+var ErrPartialFrame = errors.New("partial frame remaining")
+
+// ErrUnknownFrameFlag is returned (possibly wrapped) when a frame has flags
+// the decoder does not accept, so callers can detect it with errors.As and
+// inspect Flag, e.g. to tolerate flag bits added by newer peers.
+type ErrUnknownFrameFlag struct {
+	Flag byte
+}
+
+// Error implements the error interface
+func (e *ErrUnknownFrameFlag) Error() string {
+	return fmt.Sprintf("unknown frame flag: 0x%02x", e.Flag)
+}
+
+// DecodeFramesAll decodes a buffer that must hold only complete frames, as
+// in a request or response envelope. Unlike DecodeFrames, it returns an
+// error wrapping ErrPartialFrame if bytes are left over, and an
+// *ErrUnknownFrameFlag if a frame has flags other than FrameData,
+// FrameTrailer, FrameCompressed or FrameTrailerJSON.
+func DecodeFramesAll(buffer []byte) ([]Frame, error) {
+	frames := []Frame{}
+	for len(buffer) > 0 {
+		frame, n, err := decodeCompleteFrame(buffer)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+		buffer = buffer[n:]
+	}
+	return frames, nil
+}
+
+// decodeCompleteFrame decodes the frame at the start of buffer and returns
+// it with its encoded size, failing like DecodeFramesAll if buffer holds
+// only part of a frame or the frame has unknown flags. Decoding frame by
+// frame lets callers stop before decoding the rest of an oversized buffer.
+func decodeCompleteFrame(buffer []byte) (Frame, int, error) {
+	// The length is untrusted, so compare as uint64 before converting to int
+	if len(buffer) < HeaderSize ||
+		uint64(binary.BigEndian.Uint32(buffer[1:5])) > uint64(len(buffer)-HeaderSize) {
+		return Frame{}, 0, fmt.Errorf("%w: %d bytes", ErrPartialFrame, len(buffer))
+	}
+
+	flags := buffer[0]
+	switch flags {
+	case FrameData, FrameTrailer, FrameCompressed, FrameTrailerJSON:
+	default:
+		return Frame{}, 0, &ErrUnknownFrameFlag{Flag: flags}
+	}
+
+	end := HeaderSize + int(binary.BigEndian.Uint32(buffer[1:5]))
+	data := make([]byte, end-HeaderSize)
+	copy(data, buffer[HeaderSize:end])
+	return Frame{Flags: flags, Data: data}, end, nil
+}
+
 // CreateDataFrame creates a data frame
 func CreateDataFrame(data []byte) Frame {
 	return Frame{
@@ -110,6 +198,38 @@ func CreateDataFrame(data []byte) Frame {
 	}
 }
 
+// EncodeMessages encodes each message as a data frame, for framing a stream
+// of messages outside of RPCs. The result has no request or response
+// envelope; DecodeMessages parses it back.
+func EncodeMessages(msgs [][]byte) []byte {
+	size := 0
+	for _, msg := range msgs {
+		size += HeaderSize + len(msg)
+	}
+
+	buffer := make([]byte, 0, size)
+	for _, msg := range msgs {
+		buffer = append(buffer, FrameData)
+		buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(msg)))
+		buffer = append(buffer, msg...)
+	}
+	return buffer
+}
+
+// DecodeMessages decodes the messages of data frames in buffer, as written
+// by EncodeMessages. Like DecodeFrames, it returns the bytes of a trailing
+// partial frame as remaining, to be prefixed to the next buffer. Frames
+// other than data frames, such as trailers, are skipped.
+func DecodeMessages(buffer []byte) (msgs [][]byte, remaining []byte) {
+	result := DecodeFrames(buffer)
+	for _, frame := range result.Frames {
+		if frame.Flags == FrameData {
+			msgs = append(msgs, frame.Data)
+		}
+	}
+	return msgs, result.Remaining
+}
+
 // CreateTrailerFrame creates a trailer frame from headers.
 // Trailers are encoded as HTTP/1.1 headers format:
 // "key1: value1\r\nkey2: value2\r\n"
@@ -130,13 +250,14 @@ func CreateTrailerFrame(trailers map[string]string) Frame {
 }
 
 // ParseTrailers parses trailer frame data to headers.
-// Expects HTTP/1.1 header format: "key1: value1\r\nkey2: value2\r\n"
+// Expects HTTP/1.1 header format: "key1: value1\r\nkey2: value2\r\n".
+// Bare "\n" line endings and a missing final line ending are accepted too.
 func ParseTrailers(data []byte) map[string]string {
 	text := string(data)
 	trailers := make(map[string]string)
 
-	// Split by CRLF
-	lines := strings.Split(text, "\r\n")
+	// Split by LF; the CR of a CRLF is trimmed with the other whitespace
+	lines := strings.Split(text, "\n")
 
 	for _, line := range lines {
 		// Skip empty lines
@@ -159,3 +280,34 @@ func ParseTrailers(data []byte) map[string]string {
 
 	return trailers
 }
+
+// CreateJSONTrailerFrame creates a FrameTrailerJSON frame holding the
+// trailers as a JSON object. Unlike CreateTrailerFrame, values may contain
+// line breaks and leading or trailing whitespace. Keys are lowercased.
+func CreateJSONTrailerFrame(trailers map[string]string) (Frame, error) {
+	trailers = normalizeHeaders(trailers)
+	if trailers == nil {
+		trailers = map[string]string{}
+	}
+	data, err := json.Marshal(trailers)
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to marshal trailers: %w", err)
+	}
+	return Frame{
+		Flags: FrameTrailerJSON,
+		Data:  data,
+	}, nil
+}
+
+// ParseJSONTrailers parses the data of a FrameTrailerJSON frame.
+// Keys are normalized to lowercase; values are returned exactly.
+func ParseJSONTrailers(data []byte) (map[string]string, error) {
+	var trailers map[string]string
+	if err := json.Unmarshal(data, &trailers); err != nil {
+		return nil, fmt.Errorf("invalid JSON trailers: %w", err)
+	}
+	if trailers == nil {
+		trailers = map[string]string{}
+	}
+	return normalizeHeaders(trailers), nil
+}
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"bytes"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -131,6 +132,85 @@ func TestDecodeFrames(t *testing.T) {
 	}
 }
 
+func TestDecodeFramesNoCopy(t *testing.T) {
+	first := EncodeFrame(CreateDataFrame([]byte("abc")))
+	second := EncodeFrame(CreateTrailerFrame(map[string]string{"grpc-status": "0"}))
+	buffer := append(append(append([]byte{}, first...), second...), 0x00, 0x00)
+
+	got := DecodeFramesNoCopy(buffer)
+	want := DecodeFrames(buffer)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DecodeFramesNoCopy() = %+v, want %+v", got, want)
+	}
+
+	// The frames alias the buffer
+	buffer[HeaderSize] = 'x'
+	if string(got.Frames[0].Data) != "xbc" {
+		t.Errorf("Expected frame data to alias the buffer, got %q", got.Frames[0].Data)
+	}
+	if string(want.Frames[0].Data) != "abc" {
+		t.Errorf("Expected DecodeFrames to copy, got %q", want.Frames[0].Data)
+	}
+
+	// Appending to a frame must not overwrite the next one
+	_ = append(got.Frames[0].Data, 'z')
+	if buffer[len(first)] != FrameTrailer {
+		t.Error("Appending to frame data overwrote the next frame")
+	}
+}
+
+func BenchmarkDecodeFrames(b *testing.B) {
+	var buffer []byte
+	for i := 0; i < 1000; i++ {
+		buffer = append(buffer, EncodeFrame(CreateDataFrame([]byte("small message payload")))...)
+	}
+
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(buffer)))
+		for i := 0; i < b.N; i++ {
+			DecodeFrames(buffer)
+		}
+	})
+	b.Run("nocopy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(buffer)))
+		for i := 0; i < b.N; i++ {
+			DecodeFramesNoCopy(buffer)
+		}
+	})
+}
+
+func TestDecodeFramesAll(t *testing.T) {
+	complete := append(EncodeFrame(CreateDataFrame([]byte("hello"))),
+		EncodeFrame(CreateTrailerFrame(map[string]string{"grpc-status": "0"}))...)
+
+	frames, err := DecodeFramesAll(complete)
+	if err != nil {
+		t.Fatalf("DecodeFramesAll() error = %v", err)
+	}
+	if len(frames) != 2 || frames[0].Flags != FrameData || frames[1].Flags != FrameTrailer {
+		t.Errorf("DecodeFramesAll() = %+v, want data and trailer frames", frames)
+	}
+
+	frames, err = DecodeFramesAll(nil)
+	if err != nil || len(frames) != 0 {
+		t.Errorf("DecodeFramesAll(nil) = %v, %v, want no frames", frames, err)
+	}
+
+	// A trailing partial frame is an error rather than Remaining bytes
+	_, err = DecodeFramesAll(append(complete, 0x00, 0x00, 0x00))
+	if !errors.Is(err, ErrPartialFrame) {
+		t.Errorf("Expected ErrPartialFrame for trailing bytes, got %v", err)
+	}
+
+	_, err = DecodeFramesAll(EncodeFrame(Frame{Flags: 0x80, Data: []byte("x")}))
+	var flagErr *ErrUnknownFrameFlag
+	if !errors.As(err, &flagErr) || flagErr.Flag != 0x80 {
+		t.Errorf("Expected *ErrUnknownFrameFlag with flag 0x80, got %v", err)
+	}
+}
+
 func TestCreateDataFrame(t *testing.T) {
 	data := []byte("test data")
 	frame := CreateDataFrame(data)
@@ -216,6 +296,30 @@ func TestParseTrailers(t *testing.T) {
 				"grpc-message": "OK",
 			},
 		},
+		{
+			name: "LF line endings",
+			data: []byte("grpc-status: 0\ngrpc-message: OK\n"),
+			expected: map[string]string{
+				"grpc-status":  "0",
+				"grpc-message": "OK",
+			},
+		},
+		{
+			name: "no final line ending",
+			data: []byte("grpc-status: 0\r\ngrpc-message: OK"),
+			expected: map[string]string{
+				"grpc-status":  "0",
+				"grpc-message": "OK",
+			},
+		},
+		{
+			name: "mixed line endings and trailing whitespace",
+			data: []byte("grpc-status: 0 \t\ngrpc-message: not found \r\n\r\n"),
+			expected: map[string]string{
+				"grpc-status":  "0",
+				"grpc-message": "not found",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -306,3 +410,50 @@ func TestLargeMessage(t *testing.T) {
 		t.Error("Large message data mismatch")
 	}
 }
+
+func TestEncodeDecodeMessages(t *testing.T) {
+	msgs := [][]byte{
+		[]byte("first"),
+		{},
+		[]byte("third"),
+		{},
+	}
+
+	encoded := EncodeMessages(msgs)
+	if want := 4*HeaderSize + len("first") + len("third"); len(encoded) != want {
+		t.Errorf("Expected %d bytes, got %d", want, len(encoded))
+	}
+
+	decoded, remaining := DecodeMessages(encoded)
+	if len(remaining) != 0 {
+		t.Errorf("Expected no remaining bytes, got %d", len(remaining))
+	}
+	if len(decoded) != len(msgs) {
+		t.Fatalf("Expected %d messages, got %d", len(msgs), len(decoded))
+	}
+	for i := range msgs {
+		if !bytes.Equal(decoded[i], msgs[i]) {
+			t.Errorf("Message %d: expected %q, got %q", i, msgs[i], decoded[i])
+		}
+	}
+
+	// A partial frame is returned for the next buffer
+	decoded, remaining = DecodeMessages(encoded[:len(encoded)-1])
+	if len(decoded) != 3 || len(remaining) != HeaderSize-1 {
+		t.Errorf("Expected 3 messages and %d remaining bytes, got %d and %d", HeaderSize-1, len(decoded), len(remaining))
+	}
+
+	// Trailer frames are skipped
+	withTrailer := append(EncodeMessages(msgs[:1]), EncodeFrame(CreateTrailerFrame(map[string]string{"grpc-status": "0"}))...)
+	decoded, _ = DecodeMessages(withTrailer)
+	if len(decoded) != 1 || string(decoded[0]) != "first" {
+		t.Errorf("Expected only the data frame's message, got %q", decoded)
+	}
+
+	if encoded := EncodeMessages(nil); len(encoded) != 0 {
+		t.Errorf("Expected no bytes for no messages, got %d", len(encoded))
+	}
+	if decoded, _ := DecodeMessages(nil); len(decoded) != 0 {
+		t.Errorf("Expected no messages from an empty buffer, got %q", decoded)
+	}
+}
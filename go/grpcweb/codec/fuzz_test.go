@@ -0,0 +1,105 @@
+package codec
+
+import "testing"
+
+// The decoders read DataChannel payloads from the remote peer, so they must
+// not panic, and must not allocate more than the input size, for any input.
+
+func FuzzDecodeRequest(f *testing.F) {
+	valid, _ := EncodeRequest(RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("hello"),
+	})
+	f.Add(valid)
+	f.Add(MarkPayload(PayloadTypeEnvelope, valid))
+	f.Add(valid[:len(valid)-3])
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := DecodeRequest(data)
+		if err != nil {
+			return
+		}
+		if len(req.Path)+len(req.Message) > len(data) {
+			t.Errorf("Decoded request is larger than its %d byte input", len(data))
+		}
+	})
+}
+
+func FuzzDecodeResponse(f *testing.F) {
+	valid, _ := EncodeResponse(ResponseEnvelope{
+		Headers:  map[string]string{"x-request-id": "req-1"},
+		Messages: [][]byte{[]byte("one"), []byte("two")},
+		Trailers: map[string]string{"grpc-status": "0"},
+	})
+	f.Add(valid)
+	f.Add(MarkPayload(PayloadTypeEnvelope, valid))
+	f.Add(valid[:len(valid)-3])
+	f.Add([]byte{0x7f, 0xff, 0xff, 0xff})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resp, err := DecodeResponse(data)
+		if err != nil {
+			return
+		}
+		total := 0
+		for _, msg := range resp.Messages {
+			total += len(msg)
+		}
+		if total > len(data) {
+			t.Errorf("Decoded %d message bytes from a %d byte input", total, len(data))
+		}
+	})
+}
+
+func FuzzDecodeFrames(f *testing.F) {
+	f.Add(EncodeFrame(CreateDataFrame([]byte("hello"))))
+	f.Add(EncodeFrame(CreateTrailerFrame(map[string]string{"grpc-status": "0"})))
+	f.Add([]byte{FrameData, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{FrameData, 0, 0})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		result := DecodeFrames(data)
+
+		// Every input byte is either part of a frame or remaining
+		consumed := len(result.Remaining)
+		for _, frame := range result.Frames {
+			consumed += HeaderSize + len(frame.Data)
+		}
+		if consumed != len(data) {
+			t.Errorf("Accounted for %d bytes of a %d byte input", consumed, len(data))
+		}
+	})
+}
+
+func FuzzDecodeStreamMessage(f *testing.F) {
+	valid := EncodeStreamMessage(StreamMessage{
+		RequestID: "req-1",
+		Flag:      StreamFlagData,
+		Sequence:  3,
+		Data:      []byte("data"),
+	})
+	f.Add(valid)
+	f.Add(MarkPayload(PayloadTypeStream, valid))
+	f.Add(EncodeCancelMessage("req-1"))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The classifiers read the same untrusted lengths
+		IsStreamMessage(data)
+		IsCancelMessage(data)
+
+		msg, err := DecodeStreamMessage(data)
+		if err != nil {
+			return
+		}
+		if len(msg.RequestID)+len(msg.Data) > len(data) {
+			t.Errorf("Decoded stream message is larger than its %d byte input", len(data))
+		}
+	})
+}
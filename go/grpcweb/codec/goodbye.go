@@ -0,0 +1,72 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// A goodbye tells the peer why the DataChannel is about to close, e.g. that
+// a quota was exceeded or the session's authorization was revoked, so it
+// does not have to treat the close as an unexplained disconnect.
+//
+// Goodbye format:
+// - 1 byte: PayloadTypeGoodbye
+// - 4 bytes: code (big-endian)
+// - Rest: UTF-8 message
+//
+// The code is application-defined; using a gRPC status code (e.g.
+// StatusResourceExhausted or StatusUnauthenticated) lets clients report it
+// like a failed call.
+
+// GoodbyeHeaderSize is the size of the goodbye header, including the payload type byte
+const GoodbyeHeaderSize = 5
+
+// Goodbye is the reason a peer gave for closing the DataChannel
+type Goodbye struct {
+	Code    int
+	Message string
+}
+
+// Error implements error, so a Goodbye can be returned to callers whose
+// calls failed because of it
+func (g *Goodbye) Error() string {
+	if g.Message == "" {
+		return fmt.Sprintf("peer closed the connection (code %d)", g.Code)
+	}
+	return fmt.Sprintf("peer closed the connection (code %d): %s", g.Code, g.Message)
+}
+
+// EncodeGoodbye encodes a goodbye, including its payload type byte
+func EncodeGoodbye(code int, message string) []byte {
+	buffer := make([]byte, GoodbyeHeaderSize+len(message))
+	buffer[0] = PayloadTypeGoodbye
+	binary.BigEndian.PutUint32(buffer[1:5], uint32(int32(code)))
+	copy(buffer[GoodbyeHeaderSize:], message)
+	return buffer
+}
+
+// IsGoodbye checks if data is a goodbye
+func IsGoodbye(data []byte) bool {
+	return len(data) >= GoodbyeHeaderSize && data[0] == PayloadTypeGoodbye
+}
+
+// DecodeGoodbye decodes a goodbye received from DataChannel
+func DecodeGoodbye(data []byte) (*Goodbye, error) {
+	if len(data) < GoodbyeHeaderSize {
+		return nil, errors.New("goodbye too short")
+	}
+	if data[0] != PayloadTypeGoodbye {
+		return nil, fmt.Errorf("unexpected payload type: 0x%02x", data[0])
+	}
+	message := data[GoodbyeHeaderSize:]
+	if !utf8.Valid(message) {
+		return nil, errors.New("goodbye message is not valid UTF-8")
+	}
+
+	return &Goodbye{
+		Code:    int(int32(binary.BigEndian.Uint32(data[1:5]))),
+		Message: string(message),
+	}, nil
+}
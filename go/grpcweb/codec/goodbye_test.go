@@ -0,0 +1,66 @@
+package codec
+
+import (
+	"testing"
+)
+
+func TestGoodbyeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		message string
+	}{
+		{"quota", StatusResourceExhausted, "daily quota exceeded"},
+		{"empty message", StatusUnauthenticated, ""},
+		{"negative code", -1, "shutting down"},
+		{"unicode", 0, "さようなら"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeGoodbye(tt.code, tt.message)
+			if !IsGoodbye(data) {
+				t.Fatal("Goodbye not recognized")
+			}
+			if IsStreamMessage(data) || IsChunk(data) {
+				t.Error("Goodbye mistaken for another payload type")
+			}
+			if payloadType, _ := SplitPayload(data); payloadType != PayloadTypeGoodbye {
+				t.Errorf("Expected payload type 0x%02x, got 0x%02x", PayloadTypeGoodbye, payloadType)
+			}
+
+			goodbye, err := DecodeGoodbye(data)
+			if err != nil {
+				t.Fatalf("DecodeGoodbye failed: %v", err)
+			}
+			if goodbye.Code != tt.code || goodbye.Message != tt.message {
+				t.Errorf("Expected %d %q, got %d %q", tt.code, tt.message, goodbye.Code, goodbye.Message)
+			}
+		})
+	}
+}
+
+func TestDecodeGoodbyeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte{PayloadTypeGoodbye, 0, 0, 0}},
+		{"wrong type", MarkPayload(PayloadTypeStream, []byte{0, 0, 0, 8})},
+		{"invalid UTF-8", append(EncodeGoodbye(1, ""), 0xff, 0xfe)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeGoodbye(tt.data); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+
+	// A marked envelope or stream message is never a goodbye
+	if IsGoodbye(MarkPayload(PayloadTypeEnvelope, []byte{0, 0, 0, 2, '{', '}'})) {
+		t.Error("Envelope mistaken for a goodbye")
+	}
+}
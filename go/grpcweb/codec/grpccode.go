@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FromGRPCCode converts a google.golang.org/grpc code to its Status*
+// constant. The values are the same; codes this package does not define
+// map to StatusUnknown.
+func FromGRPCCode(code codes.Code) int {
+	if code > codes.Unauthenticated {
+		return StatusUnknown
+	}
+	return int(code)
+}
+
+// ToGRPCCode converts a Status* constant to a google.golang.org/grpc code.
+// Values outside StatusOK..StatusUnauthenticated map to codes.Unknown.
+func ToGRPCCode(code int) codes.Code {
+	if code < StatusOK || code > StatusUnauthenticated {
+		return codes.Unknown
+	}
+	return codes.Code(code)
+}
+
+// GRPCStatus returns the error as a *status.Status, so status.FromError
+// and status.Code understand a GRPCError returned to google.golang.org/grpc
+// code
+func (e *GRPCError) GRPCStatus() *status.Status {
+	return status.New(ToGRPCCode(e.Code), e.Message)
+}
+
+// GRPCErrorFrom returns err as a *GRPCError: a *GRPCError in err's chain as
+// is, or an error carrying a grpc status, such as those generated handlers
+// return with status.Error, converted with FromGRPCCode. It returns false
+// for nil and for other errors.
+func GRPCErrorFrom(err error) (*GRPCError, bool) {
+	if err == nil {
+		return nil, false
+	}
+
+	var grpcErr *GRPCError
+	if errors.As(err, &grpcErr) {
+		return grpcErr, true
+	}
+
+	var withStatus interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &withStatus) {
+		st := withStatus.GRPCStatus()
+		if st == nil {
+			return &GRPCError{Code: StatusUnknown, Message: err.Error()}, true
+		}
+		return &GRPCError{Code: FromGRPCCode(st.Code()), Message: st.Message()}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,108 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCCodeConversion(t *testing.T) {
+	tests := []struct {
+		status int
+		code   codes.Code
+	}{
+		{StatusOK, codes.OK},
+		{StatusCancelled, codes.Canceled},
+		{StatusUnknown, codes.Unknown},
+		{StatusInvalidArgument, codes.InvalidArgument},
+		{StatusDeadlineExceeded, codes.DeadlineExceeded},
+		{StatusNotFound, codes.NotFound},
+		{StatusAlreadyExists, codes.AlreadyExists},
+		{StatusPermissionDenied, codes.PermissionDenied},
+		{StatusResourceExhausted, codes.ResourceExhausted},
+		{StatusFailedPrecondition, codes.FailedPrecondition},
+		{StatusAborted, codes.Aborted},
+		{StatusOutOfRange, codes.OutOfRange},
+		{StatusUnimplemented, codes.Unimplemented},
+		{StatusInternal, codes.Internal},
+		{StatusUnavailable, codes.Unavailable},
+		{StatusDataLoss, codes.DataLoss},
+		{StatusUnauthenticated, codes.Unauthenticated},
+	}
+	if len(tests) != 17 {
+		t.Fatalf("Expected all 17 codes, got %d", len(tests))
+	}
+
+	for _, tt := range tests {
+		t.Run(GetStatusName(tt.status), func(t *testing.T) {
+			if got := FromGRPCCode(tt.code); got != tt.status {
+				t.Errorf("FromGRPCCode(%v) = %d, want %d", tt.code, got, tt.status)
+			}
+			if got := ToGRPCCode(tt.status); got != tt.code {
+				t.Errorf("ToGRPCCode(%d) = %v, want %v", tt.status, got, tt.code)
+			}
+		})
+	}
+
+	// Codes outside the known range are UNKNOWN either way
+	if got := FromGRPCCode(codes.Code(42)); got != StatusUnknown {
+		t.Errorf("FromGRPCCode(42) = %d, want UNKNOWN", got)
+	}
+	for _, code := range []int{-1, 17, 100} {
+		if got := ToGRPCCode(code); got != codes.Unknown {
+			t.Errorf("ToGRPCCode(%d) = %v, want Unknown", code, got)
+		}
+	}
+}
+
+func TestGRPCErrorFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   *GRPCError
+		wantOK bool
+	}{
+		{"nil", nil, nil, false},
+		{"plain error", errors.New("boom"), nil, false},
+		{"GRPCError", &GRPCError{Code: StatusNotFound, Message: "no user"}, &GRPCError{Code: StatusNotFound, Message: "no user"}, true},
+		{"wrapped GRPCError", fmt.Errorf("lookup: %w", &GRPCError{Code: StatusAborted, Message: "retry"}), &GRPCError{Code: StatusAborted, Message: "retry"}, true},
+		{"status error", status.Error(codes.PermissionDenied, "not yours"), &GRPCError{Code: StatusPermissionDenied, Message: "not yours"}, true},
+		{"wrapped status error", fmt.Errorf("call: %w", status.Error(codes.Unavailable, "down")), &GRPCError{Code: StatusUnavailable, Message: "down"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GRPCErrorFrom(tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("Expected nil, got %v", got)
+				}
+				return
+			}
+			if got.Code != tt.want.Code || got.Message != tt.want.Message {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGRPCErrorStatus(t *testing.T) {
+	err := error(&GRPCError{Code: StatusResourceExhausted, Message: "slow down"})
+
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatal("status.FromError did not recognize GRPCError")
+	}
+	if st.Code() != codes.ResourceExhausted || st.Message() != "slow down" {
+		t.Errorf("Expected ResourceExhausted 'slow down', got %v %q", st.Code(), st.Message())
+	}
+	if code := status.Code(fmt.Errorf("wrapped: %w", err)); code != codes.ResourceExhausted {
+		t.Errorf("Expected status.Code to see through wrapping, got %v", code)
+	}
+}
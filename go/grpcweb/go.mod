@@ -2,7 +2,11 @@ module github.com/anthropics/cf-wbrtc-auth/go/grpcweb
 
 go 1.23
 
-require github.com/pion/webrtc/v4 v4.0.0
+require (
+	github.com/pion/webrtc/v4 v4.0.0
+	google.golang.org/grpc v1.71.1
+	google.golang.org/protobuf v1.36.11
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
@@ -22,8 +26,8 @@ require (
 	github.com/pion/transport/v3 v3.0.7 // indirect
 	github.com/pion/turn/v4 v4.0.0 // indirect
 	github.com/wlynxg/anet v0.0.3 // indirect
-	golang.org/x/crypto v0.28.0 // indirect
-	golang.org/x/net v0.29.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
-	google.golang.org/protobuf v1.36.11 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
 )
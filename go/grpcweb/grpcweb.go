@@ -57,6 +57,7 @@ import (
 	"time"
 
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/health"
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/reflection"
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/transport"
 	"github.com/pion/webrtc/v4"
@@ -72,12 +73,27 @@ type (
 	ResponseEnvelope = codec.ResponseEnvelope
 	// GRPCError represents a gRPC error
 	GRPCError = codec.GRPCError
+	// EncodeOptions controls how EncodeResponseWithOptions encodes a response
+	EncodeOptions = codec.EncodeOptions
+	// DecodeOptions controls how DecodeResponseWithOptions decodes a response
+	DecodeOptions = codec.DecodeOptions
+	// ResponseEncoder encodes a response incrementally
+	ResponseEncoder = codec.ResponseEncoder
+	// Goodbye is the reason a peer gave for closing the DataChannel
+	Goodbye = codec.Goodbye
+	// ErrUnknownFrameFlag reports a frame flag a decoder does not accept
+	ErrUnknownFrameFlag = codec.ErrUnknownFrameFlag
 )
 
 // Re-export codec constants
 const (
-	FrameData    = codec.FrameData
-	FrameTrailer = codec.FrameTrailer
+	FrameData       = codec.FrameData
+	FrameTrailer    = codec.FrameTrailer
+	FrameCompressed = codec.FrameCompressed
+	FrameTrailerJSON = codec.FrameTrailerJSON
+
+	EncodingIdentity = codec.EncodingIdentity
+	EncodingGzip     = codec.EncodingGzip
 
 	StatusOK                 = codec.StatusOK
 	StatusCancelled          = codec.StatusCancelled
@@ -96,6 +112,12 @@ const (
 	StatusUnavailable        = codec.StatusUnavailable
 	StatusDataLoss           = codec.StatusDataLoss
 	StatusUnauthenticated    = codec.StatusUnauthenticated
+
+	CodecProto         = codec.CodecProto
+	CodecJSON          = codec.CodecJSON
+	ContentTypeGRPCWeb = codec.ContentTypeGRPCWeb
+	ContentTypeProto   = codec.ContentTypeProto
+	ContentTypeJSON    = codec.ContentTypeJSON
 )
 
 // Re-export codec functions
@@ -103,19 +125,45 @@ var (
 	// Frame encoding/decoding
 	EncodeFrame       = codec.EncodeFrame
 	DecodeFrames      = codec.DecodeFrames
+	DecodeFramesAll   = codec.DecodeFramesAll
+	DecodeFramesNoCopy = codec.DecodeFramesNoCopy
 	CreateDataFrame   = codec.CreateDataFrame
 	CreateTrailerFrame = codec.CreateTrailerFrame
 	ParseTrailers     = codec.ParseTrailers
+	CreateJSONTrailerFrame = codec.CreateJSONTrailerFrame
+	ParseJSONTrailers = codec.ParseJSONTrailers
+	EncodeMessages    = codec.EncodeMessages
+	DecodeMessages    = codec.DecodeMessages
 
 	// Envelope encoding/decoding
+	NewRequestEnvelope = codec.NewRequestEnvelope
+	NewRequestID       = codec.NewRequestID
 	EncodeRequest      = codec.EncodeRequest
 	DecodeRequest      = codec.DecodeRequest
 	EncodeResponse     = codec.EncodeResponse
+	EncodeResponseWithOptions = codec.EncodeResponseWithOptions
+	EncodeResponseStreaming = codec.EncodeResponseStreaming
 	DecodeResponse     = codec.DecodeResponse
+	DecodeResponseWithOptions = codec.DecodeResponseWithOptions
 	CreateErrorResponse = codec.CreateErrorResponse
 	IsErrorResponse    = codec.IsErrorResponse
 	GetError           = codec.GetError
 	GetStatusName      = codec.GetStatusName
+
+	// Content types
+	ContentType          = codec.ContentType
+	CodecFromContentType = codec.CodecFromContentType
+	SetContentType       = codec.SetContentType
+
+	// google.golang.org/grpc interop
+	FromGRPCCode  = codec.FromGRPCCode
+	ToGRPCCode    = codec.ToGRPCCode
+	GRPCErrorFrom = codec.GRPCErrorFrom
+
+	// Goodbye encoding/decoding
+	EncodeGoodbye = codec.EncodeGoodbye
+	DecodeGoodbye = codec.DecodeGoodbye
+	IsGoodbye     = codec.IsGoodbye
 )
 
 // Transport is the server-side gRPC-Web transport over DataChannel
@@ -130,20 +178,118 @@ type StreamingHandler = transport.StreamingHandler
 // ServerStream provides methods to send streaming responses
 type ServerStream = transport.ServerStream
 
+// ClientStreamingHandler handles a client-streaming gRPC method call
+type ClientStreamingHandler = transport.ClientStreamingHandler
+
+// ClientStreamReceiver provides the messages of a client-streaming call to its handler
+type ClientStreamReceiver = transport.ClientStreamReceiver
+
 // TypedServerStream provides a typed wrapper for ServerStream
 type TypedServerStream[Resp any] = transport.TypedServerStream[Resp]
 
+// ResponseWriter collects the messages and metadata of a MakeWriterHandler response
+type ResponseWriter = transport.ResponseWriter
+
 // HandlerOptions provides options for handling requests
 type HandlerOptions = transport.HandlerOptions
 
+// MethodInfo describes a registered method and whether it is streaming
+type MethodInfo = transport.MethodInfo
+
+// RequestInfo describes a request being handled (see Transport.ActiveRequests)
+type RequestInfo = transport.RequestInfo
+
+// Limiter decides whether a request may be dispatched (see HandlerOptions.Limiter)
+type Limiter = transport.Limiter
+
+// NewTokenBucketLimiter creates a Limiter with a token bucket per method path
+var NewTokenBucketLimiter = transport.NewTokenBucketLimiter
+
+// TokenVerifier checks the token of an RPC (see TokenAuth)
+type TokenVerifier = transport.TokenVerifier
+
+// TokenAuthenticator wraps handlers to require a token accepted by a TokenVerifier
+type TokenAuthenticator = transport.TokenAuthenticator
+
+// TokenAuth creates a TokenAuthenticator reading the authorization or x-api-key header
+var TokenAuth = transport.TokenAuth
+
+// Registration errors returned by the transport's strict Register methods and aliases
+var (
+	ErrDuplicateHandler   = transport.ErrDuplicateHandler
+	ErrConflictingHandler = transport.ErrConflictingHandler
+	ErrHandlerNotFound    = transport.ErrHandlerNotFound
+)
+
+// Send errors returned by Transport.SendResponse and ServerStream.Send
+var (
+	ErrTransportClosed = transport.ErrTransportClosed
+	ErrSendFailed      = transport.ErrSendFailed
+)
+
+// ErrInvalidOptions is returned, wrapped, by HandlerOptions.Validate and NewValidatedTransport
+var ErrInvalidOptions = transport.ErrInvalidOptions
+
+// DefaultTimeout is the request timeout used when no options are given
+const DefaultTimeout = transport.DefaultTimeout
+
+// RequestIDFromContext returns the request ID of the RPC being handled.
+// If the client did not send x-request-id, this is an ID generated by the transport.
+var RequestIDFromContext = transport.RequestIDFromContext
+
+// ResumeTokenFromContext returns the resume token of a streaming request
+// resuming an interrupted stream, or "" for a new stream
+var ResumeTokenFromContext = transport.ResumeTokenFromContext
+
+// EncodingFromContext returns the response encoding negotiated for a unary request
+var EncodingFromContext = transport.EncodingFromContext
+
+// Client makes unary and client-streaming calls to a Transport over a DataChannel
+type Client = transport.Client
+
+// ClientStream is a client-streaming call started by Client.InvokeClientStream
+type ClientStream = transport.ClientStream
+
+// NewClient creates a Client on one end of a DataChannel
+var NewClient = transport.NewClient
+
+// RetryPolicy describes how Client.Invoke retries an idempotent method
+type RetryPolicy = transport.RetryPolicy
+
+// PingPath is the path of the built-in ping method (see Transport.RegisterPingHandler)
+const PingPath = transport.PingPath
+
+// PeerInfo identifies the remote peer of a transport (see Transport.SetPeerInfo)
+type PeerInfo = transport.PeerInfo
+
+// PeerInfoFromContext returns the peer info of the transport handling the request
+var PeerInfoFromContext = transport.PeerInfoFromContext
+
 // NewTransport creates a new Transport from a WebRTC DataChannel.
 //
-// The opts parameter is optional; if nil, defaults are used.
+// The opts parameter is optional; if nil, defaults are used. Invalid
+// options are logged and replaced by their defaults, a negative Timeout by
+// DefaultTimeout; use NewValidatedTransport to get an error instead.
 func NewTransport(dc *webrtc.DataChannel, opts *HandlerOptions) *Transport {
 	return transport.NewDataChannelTransport(dc, opts)
 }
 
+// NewValidatedTransport is NewTransport, but returns an error wrapping
+// ErrInvalidOptions for invalid options, e.g. a negative Timeout.
+func NewValidatedTransport(dc *webrtc.DataChannel, opts *HandlerOptions) (*Transport, error) {
+	return transport.NewValidatedDataChannelTransport(dc, opts)
+}
+
+// NewTransportContext creates a new Transport whose request contexts derive
+// from ctx. Closing the transport cancels them in any case. Invalid options
+// are replaced as in NewTransport.
+func NewTransportContext(ctx context.Context, dc *webrtc.DataChannel, opts *HandlerOptions) *Transport {
+	return transport.NewDataChannelTransportContext(ctx, dc, opts)
+}
+
 // NewTransportWithTimeout creates a new Transport with a custom timeout.
+// A zero timeout means no timeout; a negative one is logged and replaced
+// by DefaultTimeout, as in NewTransport.
 func NewTransportWithTimeout(dc *webrtc.DataChannel, timeout time.Duration) *Transport {
 	return transport.NewDataChannelTransport(dc, &HandlerOptions{
 		Timeout: timeout,
@@ -179,6 +325,55 @@ func MakeHandler[Req, Resp any](
 	return transport.MakeHandler(deserialize, serialize, handle)
 }
 
+// MakeValidatedHandler is MakeHandler with a validate function run on each
+// deserialized request before handle. Validation errors are sent as
+// INVALID_ARGUMENT unless they already carry a gRPC status.
+func MakeValidatedHandler[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	validate func(Req) error,
+	handle func(ctx context.Context, req Req) (Resp, error),
+) Handler {
+	return transport.MakeValidatedHandler(deserialize, serialize, validate, handle)
+}
+
+// MakeHandlerWithMetadata creates a Handler from typed serialization functions
+// whose business function also returns response headers and trailers.
+//
+// Values returned by the handler win; x-request-id is echoed and grpc-status
+// is set to OK only when the handler leaves them unset.
+func MakeHandlerWithMetadata[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	handle func(ctx context.Context, req Req) (Resp, map[string]string, map[string]string, error),
+) Handler {
+	return transport.MakeHandlerWithMetadata(deserialize, serialize, handle)
+}
+
+// MakeJSONHandler creates a Handler for a JSON service, using encoding/json
+// for (de)serialization instead of protobuf.
+//
+// Responses carry content-type: application/grpc-web+json, and error
+// responses have a {"error": "..."} JSON body in addition to the
+// grpc-status trailer.
+//
+// Example:
+//
+//	handler := grpcweb.MakeJSONHandler(func(ctx context.Context, req EchoRequest) (EchoResponse, error) {
+//	    return EchoResponse{Message: req.Message}, nil
+//	})
+//	transport.RegisterHandler("/example.EchoService/EchoJSON", handler)
+func MakeJSONHandler[Req, Resp any](handle func(ctx context.Context, req Req) (Resp, error)) Handler {
+	return transport.MakeJSONHandler(handle)
+}
+
+// MakeWriterHandler creates a Handler whose business function writes zero or
+// more messages through a ResponseWriter. The messages are buffered and sent
+// as one unary response when the function returns.
+func MakeWriterHandler(handle func(ctx context.Context, req *RequestEnvelope, w ResponseWriter) error) Handler {
+	return transport.MakeWriterHandler(handle)
+}
+
 // MakeStreamingHandler creates a StreamingHandler from typed serialization functions.
 func MakeStreamingHandler[Req, Resp any](
 	deserialize func([]byte) (Req, error),
@@ -188,6 +383,16 @@ func MakeStreamingHandler[Req, Resp any](
 	return transport.MakeStreamingHandler(deserialize, serialize, handle)
 }
 
+// MakeStreamingHandlerWithContext is like MakeStreamingHandler, but the
+// business function also receives the stream's context.
+func MakeStreamingHandlerWithContext[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	handle func(ctx context.Context, req Req, stream *TypedServerStream[Resp]) error,
+) StreamingHandler {
+	return transport.MakeStreamingHandlerWithContext(deserialize, serialize, handle)
+}
+
 // NewErrorResponse creates an error ResponseEnvelope with the given status code
 // and message. This is useful for returning errors from handlers.
 func NewErrorResponse(code int, message string) ResponseEnvelope {
@@ -212,12 +417,18 @@ type (
 	Reflection = reflection.Reflection
 	// ServiceInfo contains information about a registered service
 	ServiceInfo = reflection.ServiceInfo
+	// ReflectionMethodInfo describes a method in a ListServices response
+	ReflectionMethodInfo = reflection.MethodInfo
 	// ListServicesResponse is the response for ListServices
 	ListServicesResponse = reflection.ListServicesResponse
 	// FileContainingSymbolRequest is the request for FileContainingSymbol
 	FileContainingSymbolRequest = reflection.FileContainingSymbolRequest
 	// FileContainingSymbolResponse is the response for FileContainingSymbol
 	FileContainingSymbolResponse = reflection.FileContainingSymbolResponse
+	// ListMethodsResponse is the response for ListMethods
+	ListMethodsResponse = reflection.ListMethodsResponse
+	// ReflectionOptions configures the paths reflection is served under
+	ReflectionOptions = reflection.Options
 )
 
 // ReflectionMethodPath is the path for the ListServices method
@@ -226,6 +437,9 @@ const ReflectionMethodPath = reflection.MethodPath
 // FileContainingSymbolPath is the path for the FileContainingSymbol method
 const FileContainingSymbolPath = reflection.FileContainingSymbolPath
 
+// ListMethodsPath is the path for the ListMethods method
+const ListMethodsPath = reflection.ListMethodsPath
+
 // NewReflection creates a new Reflection instance.
 // The transport must implement the HandlerRegistry interface.
 //
@@ -238,6 +452,12 @@ func NewReflection(transport *Transport) *Reflection {
 	return reflection.New(transport)
 }
 
+// NewReflectionWithOptions creates a new Reflection instance served under
+// the paths in opts; see RegisterReflectionWithOptions
+func NewReflectionWithOptions(transport *Transport, opts *ReflectionOptions) *Reflection {
+	return reflection.NewWithOptions(transport, opts)
+}
+
 // RegisterReflection is a convenience function that creates and registers
 // reflection handlers on the transport.
 //
@@ -246,8 +466,55 @@ func NewReflection(transport *Transport) *Reflection {
 //	transport := grpcweb.NewTransport(dataChannel, nil)
 //	grpcweb.RegisterReflection(transport)
 func RegisterReflection(transport *Transport) *Reflection {
-	refl := reflection.New(transport)
-	transport.RegisterHandler(reflection.MethodPath, refl.Handler())
-	transport.RegisterHandler(reflection.FileContainingSymbolPath, refl.FileContainingSymbolHandler())
+	return RegisterReflectionWithOptions(transport, nil)
+}
+
+// RegisterReflectionWithOptions creates and registers reflection handlers
+// under the paths in opts. Empty paths, or a nil opts, use the defaults.
+//
+// Example:
+//
+//	grpcweb.RegisterReflectionWithOptions(transport, &grpcweb.ReflectionOptions{
+//		ListServicesPath:         "/grpc.reflection.v1.ServerReflection/ListServices",
+//		FileContainingSymbolPath: "/grpc.reflection.v1.ServerReflection/FileContainingSymbol",
+//	})
+func RegisterReflectionWithOptions(transport *Transport, opts *ReflectionOptions) *Reflection {
+	refl := reflection.NewWithOptions(transport, opts)
+	refl.Register(transport)
 	return refl
 }
+
+// Health check types and functions
+type (
+	// Health provides the grpc.health.v1.Health service
+	Health = health.Health
+	// HealthCheckRequest is the request for Check
+	HealthCheckRequest = health.HealthCheckRequest
+	// HealthCheckResponse is the response for Check
+	HealthCheckResponse = health.HealthCheckResponse
+)
+
+// HealthCheckPath is the path for the Health Check method
+const HealthCheckPath = health.CheckPath
+
+// Re-export health serving status values
+const (
+	HealthStatusUnknown        = health.StatusUnknown
+	HealthStatusServing        = health.StatusServing
+	HealthStatusNotServing     = health.StatusNotServing
+	HealthStatusServiceUnknown = health.StatusServiceUnknown
+)
+
+// RegisterHealth is a convenience function that creates and registers
+// the health check handler on the transport.
+//
+// Example:
+//
+//	transport := grpcweb.NewTransport(dataChannel, nil)
+//	h := grpcweb.RegisterHealth(transport)
+//	h.SetServingStatus("mypackage.MyService", false)
+func RegisterHealth(transport *Transport) *Health {
+	h := health.New(transport)
+	transport.RegisterHandler(health.CheckPath, h.Handler())
+	return h
+}
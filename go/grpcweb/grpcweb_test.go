@@ -0,0 +1,57 @@
+package grpcweb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestConstructorsNegativeTimeout(t *testing.T) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer pc.Close()
+	dc, err := pc.CreateDataChannel("data", nil)
+	if err != nil {
+		t.Fatalf("Failed to create data channel: %v", err)
+	}
+
+	// The constructors without an error result use DefaultTimeout instead
+	transports := map[string]*Transport{
+		"NewTransport":            NewTransport(dc, &HandlerOptions{Timeout: -time.Second}),
+		"NewTransportContext":     NewTransportContext(context.Background(), dc, &HandlerOptions{Timeout: -time.Second}),
+		"NewTransportWithTimeout": NewTransportWithTimeout(dc, -time.Second),
+	}
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{Path: "/test.Service/Deadline", Headers: map[string]string{}})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	for name, transport := range transports {
+		var remaining time.Duration
+		transport.RegisterHandler("/test.Service/Deadline", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				remaining = time.Until(deadline)
+			}
+			return &codec.ResponseEnvelope{}, nil
+		})
+		// The response cannot be sent on the unconnected channel, but the
+		// handler runs regardless
+		transport.HandleMessage(reqData)
+		if remaining <= DefaultTimeout-time.Second || remaining > DefaultTimeout {
+			t.Errorf("%s: expected a deadline of about %v, got %v", name, DefaultTimeout, remaining)
+		}
+	}
+
+	// The validating constructor reports it
+	if _, err := NewValidatedTransport(dc, &HandlerOptions{Timeout: -time.Second}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("NewValidatedTransport: expected ErrInvalidOptions, got %v", err)
+	}
+	if transport, err := NewValidatedTransport(dc, &HandlerOptions{Timeout: time.Second}); err != nil || transport == nil {
+		t.Errorf("NewValidatedTransport failed for a valid timeout: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package health provides a gRPC Health Checking service.
+//
+// This is a simplified implementation of grpc.health.v1.Health that uses
+// JSON instead of protobuf. The request and response shapes mirror the
+// standard health proto so that existing tooling understands them:
+//
+//	Request:  {"service": "mypackage.MyService"}
+//	Response: {"status": "SERVING"}
+//
+// A service is reported as SERVING if it has at least one registered method
+// on the transport, unless its status has been overridden with
+// SetServingStatus. The empty service name refers to the server as a whole.
+//
+// # Usage
+//
+//	transport := grpcweb.NewTransport(dataChannel, nil)
+//	h := grpcweb.RegisterHealth(transport)
+//
+//	// Mark a service as not ready until its backend is up
+//	h.SetServingStatus("mypackage.MyService", false)
+//
+//	transport.Start()
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// CheckPath is the path for the Check method
+const CheckPath = "/grpc.health.v1.Health/Check"
+
+// Serving status values, matching grpc.health.v1.HealthCheckResponse.ServingStatus
+const (
+	StatusUnknown        = "UNKNOWN"
+	StatusServing        = "SERVING"
+	StatusNotServing     = "NOT_SERVING"
+	StatusServiceUnknown = "SERVICE_UNKNOWN"
+)
+
+// HealthCheckRequest is the request for Check
+type HealthCheckRequest struct {
+	Service string `json:"service"`
+}
+
+// HealthCheckResponse is the response for Check
+type HealthCheckResponse struct {
+	Status string `json:"status"`
+}
+
+// HandlerRegistry is an interface for getting registered handlers
+type HandlerRegistry interface {
+	// GetRegisteredMethods returns all registered method paths
+	GetRegisteredMethods() []string
+}
+
+// Health provides health checking functionality
+type Health struct {
+	registry HandlerRegistry
+	mu       sync.RWMutex
+	statuses map[string]bool
+}
+
+// New creates a new Health instance
+func New(registry HandlerRegistry) *Health {
+	return &Health{
+		registry: registry,
+		statuses: make(map[string]bool),
+	}
+}
+
+// SetServingStatus overrides the serving status of a service.
+// Use the empty service name to set the status of the server as a whole.
+func (h *Health) SetServingStatus(service string, serving bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses[service] = serving
+}
+
+// Check returns the serving status of a service
+func (h *Health) Check(service string) *HealthCheckResponse {
+	h.mu.RLock()
+	serving, ok := h.statuses[service]
+	h.mu.RUnlock()
+
+	if ok {
+		if serving {
+			return &HealthCheckResponse{Status: StatusServing}
+		}
+		return &HealthCheckResponse{Status: StatusNotServing}
+	}
+
+	// The server as a whole is serving unless told otherwise
+	if service == "" {
+		return &HealthCheckResponse{Status: StatusServing}
+	}
+
+	prefix := "/" + service + "/"
+	for _, method := range h.registry.GetRegisteredMethods() {
+		if strings.HasPrefix(method, prefix) {
+			return &HealthCheckResponse{Status: StatusServing}
+		}
+	}
+
+	return &HealthCheckResponse{Status: StatusServiceUnknown}
+}
+
+// Handler returns a gRPC handler for the Check method
+func (h *Health) Handler() func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+	return func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		// Parse request JSON
+		var request HealthCheckRequest
+		if len(req.Message) > 0 {
+			if err := json.Unmarshal(req.Message, &request); err != nil {
+				return &codec.ResponseEnvelope{
+					Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+					Messages: [][]byte{[]byte(`{"error":"invalid request"}`)},
+					Trailers: map[string]string{
+						"grpc-status":  strconv.Itoa(codec.StatusInvalidArgument),
+						"grpc-message": "invalid request JSON",
+					},
+				}, nil
+			}
+		}
+
+		resp := h.Check(request.Service)
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return &codec.ResponseEnvelope{
+				Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+				Messages: [][]byte{[]byte(`{"error":"failed to encode response"}`)},
+				Trailers: map[string]string{
+					"grpc-status":  strconv.Itoa(codec.StatusInternal),
+					"grpc-message": "failed to encode response",
+				},
+			}, nil
+		}
+
+		// Unknown services are reported as NOT_FOUND, like the standard service
+		if resp.Status == StatusServiceUnknown {
+			return &codec.ResponseEnvelope{
+				Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+				Messages: [][]byte{data},
+				Trailers: map[string]string{
+					"grpc-status":  strconv.Itoa(codec.StatusNotFound),
+					"grpc-message": "unknown service: " + request.Service,
+				},
+			}, nil
+		}
+
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+			Messages: [][]byte{data},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	}
+}
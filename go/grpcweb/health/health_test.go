@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// mockRegistry is a mock implementation of HandlerRegistry for testing
+type mockRegistry struct {
+	methods []string
+}
+
+func (m *mockRegistry) GetRegisteredMethods() []string {
+	return m.methods
+}
+
+func TestCheckServer(t *testing.T) {
+	h := New(&mockRegistry{})
+
+	if got := h.Check("").Status; got != StatusServing {
+		t.Errorf("Expected SERVING for server, got %s", got)
+	}
+
+	h.SetServingStatus("", false)
+	if got := h.Check("").Status; got != StatusNotServing {
+		t.Errorf("Expected NOT_SERVING after SetServingStatus, got %s", got)
+	}
+}
+
+func TestCheckRegisteredService(t *testing.T) {
+	registry := &mockRegistry{
+		methods: []string{"/echo.EchoService/Echo"},
+	}
+	h := New(registry)
+
+	if got := h.Check("echo.EchoService").Status; got != StatusServing {
+		t.Errorf("Expected SERVING, got %s", got)
+	}
+
+	// Prefix of a registered service is not a match
+	if got := h.Check("echo.Echo").Status; got != StatusServiceUnknown {
+		t.Errorf("Expected SERVICE_UNKNOWN, got %s", got)
+	}
+}
+
+func TestSetServingStatus(t *testing.T) {
+	registry := &mockRegistry{
+		methods: []string{"/echo.EchoService/Echo"},
+	}
+	h := New(registry)
+
+	h.SetServingStatus("echo.EchoService", false)
+	if got := h.Check("echo.EchoService").Status; got != StatusNotServing {
+		t.Errorf("Expected NOT_SERVING, got %s", got)
+	}
+
+	h.SetServingStatus("echo.EchoService", true)
+	if got := h.Check("echo.EchoService").Status; got != StatusServing {
+		t.Errorf("Expected SERVING, got %s", got)
+	}
+
+	// Services without handlers can be declared explicitly
+	h.SetServingStatus("other.Service", true)
+	if got := h.Check("other.Service").Status; got != StatusServing {
+		t.Errorf("Expected SERVING for explicit service, got %s", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := &mockRegistry{
+		methods: []string{"/echo.EchoService/Echo"},
+	}
+	h := New(registry)
+	handler := h.Handler()
+
+	req := &codec.RequestEnvelope{
+		Path:    CheckPath,
+		Headers: map[string]string{},
+		Message: []byte(`{"service":"echo.EchoService"}`),
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "0" {
+		t.Errorf("Expected grpc-status 0, got %s", resp.Trailers["grpc-status"])
+	}
+
+	var result HealthCheckResponse
+	if err := json.Unmarshal(resp.Messages[0], &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if result.Status != StatusServing {
+		t.Errorf("Expected SERVING, got %s", result.Status)
+	}
+}
+
+func TestHandlerUnknownService(t *testing.T) {
+	h := New(&mockRegistry{})
+	handler := h.Handler()
+
+	req := &codec.RequestEnvelope{
+		Path:    CheckPath,
+		Headers: map[string]string{},
+		Message: []byte(`{"service":"missing.Service"}`),
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "5" {
+		t.Errorf("Expected grpc-status 5 (NOT_FOUND), got %s", resp.Trailers["grpc-status"])
+	}
+}
+
+func TestHandlerInvalidJSON(t *testing.T) {
+	h := New(&mockRegistry{})
+	handler := h.Handler()
+
+	req := &codec.RequestEnvelope{
+		Path:    CheckPath,
+		Headers: map[string]string{},
+		Message: []byte(`not json`),
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "3" {
+		t.Errorf("Expected grpc-status 3 (INVALID_ARGUMENT), got %s", resp.Trailers["grpc-status"])
+	}
+}
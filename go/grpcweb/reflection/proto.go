@@ -0,0 +1,128 @@
+package reflection
+
+import (
+	"mime"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers from grpc/reflection/v1alpha/reflection.proto
+const (
+	requestFileContainingSymbol    protowire.Number = 4 // ServerReflectionRequest.file_containing_symbol
+	responseFileDescriptorResponse protowire.Number = 4 // ServerReflectionResponse.file_descriptor_response
+	responseListServicesResponse   protowire.Number = 6 // ServerReflectionResponse.list_services_response
+	responseErrorResponse          protowire.Number = 7 // ServerReflectionResponse.error_response
+	fileDescriptorProtoField       protowire.Number = 1 // FileDescriptorResponse.file_descriptor_proto
+	listServiceServiceField        protowire.Number = 1 // ListServiceResponse.service
+	serviceResponseNameField       protowire.Number = 1 // ServiceResponse.name
+	errorResponseErrorCodeField    protowire.Number = 1 // ErrorResponse.error_code
+	errorResponseErrorMessageField protowire.Number = 2 // ErrorResponse.error_message
+)
+
+// wantsProto reports whether the request asks for a protobuf response.
+// The accept header decides if present; otherwise a protobuf content-type
+// does. Anything else gets JSON.
+func wantsProto(headers map[string]string) bool {
+	if accept := headers["accept"]; accept != "" {
+		for _, part := range strings.Split(accept, ",") {
+			switch {
+			case isProtoMediaType(part):
+				return true
+			case isJSONMediaType(part):
+				return false
+			}
+		}
+		return false
+	}
+	return isProtoMediaType(headers["content-type"])
+}
+
+func isProtoMediaType(s string) bool {
+	mt, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(mt, "+proto") || mt == "application/x-protobuf" || mt == "application/protobuf"
+}
+
+func isJSONMediaType(s string) bool {
+	mt, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// decodeFileContainingSymbolRequest extracts file_containing_symbol from a
+// protobuf ServerReflectionRequest. Other fields are skipped.
+func decodeFileContainingSymbolRequest(data []byte) (string, error) {
+	var symbol string
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if num == requestFileContainingSymbol && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return "", protowire.ParseError(n)
+			}
+			symbol = string(v)
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return "", protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return symbol, nil
+}
+
+// encodeListServicesProto encodes the response as a ServerReflectionResponse
+// with list_services_response set
+func encodeListServicesProto(resp *ListServicesResponse) []byte {
+	var list []byte
+	for _, svc := range resp.Services {
+		var service []byte
+		service = protowire.AppendTag(service, serviceResponseNameField, protowire.BytesType)
+		service = protowire.AppendString(service, svc.Name)
+
+		list = protowire.AppendTag(list, listServiceServiceField, protowire.BytesType)
+		list = protowire.AppendBytes(list, service)
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, responseListServicesResponse, protowire.BytesType)
+	return protowire.AppendBytes(b, list)
+}
+
+// encodeFileDescriptorProto encodes a serialized FileDescriptorProto as a
+// ServerReflectionResponse with file_descriptor_response set
+func encodeFileDescriptorProto(fileDescriptor []byte) []byte {
+	var fd []byte
+	fd = protowire.AppendTag(fd, fileDescriptorProtoField, protowire.BytesType)
+	fd = protowire.AppendBytes(fd, fileDescriptor)
+
+	var b []byte
+	b = protowire.AppendTag(b, responseFileDescriptorResponse, protowire.BytesType)
+	return protowire.AppendBytes(b, fd)
+}
+
+// encodeErrorProto encodes a ServerReflectionResponse with error_response set
+func encodeErrorProto(code int, message string) []byte {
+	var e []byte
+	e = protowire.AppendTag(e, errorResponseErrorCodeField, protowire.VarintType)
+	e = protowire.AppendVarint(e, uint64(int32(code)))
+	e = protowire.AppendTag(e, errorResponseErrorMessageField, protowire.BytesType)
+	e = protowire.AppendString(e, message)
+
+	var b []byte
+	b = protowire.AppendTag(b, responseErrorResponse, protowire.BytesType)
+	return protowire.AppendBytes(b, e)
+}
@@ -5,11 +5,16 @@
 // protobuf file descriptors; instead, it returns a list of registered
 // method paths.
 //
+// Responses are JSON by default. Clients that send an accept header (or,
+// without one, a content-type) of application/grpc-web+proto or
+// application/x-protobuf get a grpc.reflection.v1alpha.ServerReflectionResponse
+// instead, so grpcurl-style tools can use the same paths.
+//
 // # Usage
 //
 //	transport := grpcweb.NewTransport(dataChannel, nil)
-//	reflection := reflection.New(transport)
-//	reflection.Register()
+//	refl := reflection.New(transport)
+//	refl.Register(transport)
 //
 //	// Register your handlers
 //	transport.RegisterHandler("/mypackage.MyService/MyMethod", handler)
@@ -22,10 +27,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/transport"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -38,10 +45,23 @@ const MethodPath = "/grpc.reflection.v1alpha.ServerReflection/ListServices"
 // FileContainingSymbolPath is the path for the FileContainingSymbol method
 const FileContainingSymbolPath = "/grpc.reflection.v1alpha.ServerReflection/FileContainingSymbol"
 
+// ListMethodsPath is the path for the ListMethods method
+const ListMethodsPath = "/grpc.reflection.v1alpha.ServerReflection/ListMethods"
+
 // ServiceInfo contains information about a registered service
 type ServiceInfo struct {
 	Name    string   `json:"name"`
 	Methods []string `json:"methods"`
+	// MethodInfo describes the methods in the same order as Methods.
+	// It is only set if the registry implements DetailedHandlerRegistry.
+	MethodInfo []MethodInfo `json:"methodInfo,omitempty"`
+}
+
+// MethodInfo describes a method of a service
+type MethodInfo struct {
+	Name            string `json:"name"`
+	ServerStreaming bool   `json:"serverStreaming"`
+	ClientStreaming bool   `json:"clientStreaming"`
 }
 
 // ListServicesResponse is the response for ListServices
@@ -49,6 +69,13 @@ type ListServicesResponse struct {
 	Services []ServiceInfo `json:"services"`
 }
 
+// ListMethodsResponse is the response for ListMethods
+type ListMethodsResponse struct {
+	// Methods are the full paths of the methods (e.g.
+	// "/mypackage.MyService/GetUser"), sorted
+	Methods []string `json:"methods"`
+}
+
 // FileContainingSymbolRequest is the request for FileContainingSymbol
 type FileContainingSymbolRequest struct {
 	Symbol string `json:"symbol"`
@@ -65,34 +92,123 @@ type HandlerRegistry interface {
 	GetRegisteredMethods() []string
 }
 
+// DetailedHandlerRegistry is optionally implemented by a HandlerRegistry to
+// report whether each method is streaming
+type DetailedHandlerRegistry interface {
+	// GetRegisteredMethodsDetailed returns all registered methods with their streaming kind
+	GetRegisteredMethodsDetailed() []transport.MethodInfo
+}
+
+// Options configures the paths a Reflection is served under, e.g. to use
+// the grpc.reflection.v1 namespace or to avoid a collision with a service of
+// your own. Empty paths use the defaults.
+type Options struct {
+	// ListServicesPath is the path of the ListServices method (default: MethodPath)
+	ListServicesPath string
+	// FileContainingSymbolPath is the path of the FileContainingSymbol
+	// method (default: FileContainingSymbolPath)
+	FileContainingSymbolPath string
+	// ListMethodsPath is the path of the ListMethods method (default:
+	// ListMethodsPath)
+	ListMethodsPath string
+}
+
+// Registrar is implemented by transports that Register adds handlers to
+type Registrar interface {
+	RegisterHandler(path string, handler transport.Handler)
+}
+
 // Reflection provides server reflection functionality
 type Reflection struct {
-	registry HandlerRegistry
-	mu       sync.RWMutex
+	registry                 HandlerRegistry
+	listServicesPath         string
+	fileContainingSymbolPath string
+	listMethodsPath          string
+	mu                       sync.RWMutex
 }
 
-// New creates a new Reflection instance
+// New creates a new Reflection instance served under the default paths
 func New(registry HandlerRegistry) *Reflection {
-	return &Reflection{
-		registry: registry,
+	return NewWithOptions(registry, nil)
+}
+
+// NewWithOptions creates a new Reflection instance served under the paths
+// in opts. A nil opts uses the defaults, like New.
+func NewWithOptions(registry HandlerRegistry, opts *Options) *Reflection {
+	r := &Reflection{
+		registry:                 registry,
+		listServicesPath:         MethodPath,
+		fileContainingSymbolPath: FileContainingSymbolPath,
+		listMethodsPath:          ListMethodsPath,
 	}
+	if opts != nil {
+		if opts.ListServicesPath != "" {
+			r.listServicesPath = opts.ListServicesPath
+		}
+		if opts.FileContainingSymbolPath != "" {
+			r.fileContainingSymbolPath = opts.FileContainingSymbolPath
+		}
+		if opts.ListMethodsPath != "" {
+			r.listMethodsPath = opts.ListMethodsPath
+		}
+	}
+	return r
+}
+
+// ListServicesPath returns the path the ListServices handler is registered under
+func (r *Reflection) ListServicesPath() string {
+	return r.listServicesPath
+}
+
+// FileContainingSymbolPath returns the path the FileContainingSymbol handler
+// is registered under
+func (r *Reflection) FileContainingSymbolPath() string {
+	return r.fileContainingSymbolPath
+}
+
+// ListMethodsPath returns the path the ListMethods handler is registered under
+func (r *Reflection) ListMethodsPath() string {
+	return r.listMethodsPath
+}
+
+// Register registers the ListServices, FileContainingSymbol and ListMethods
+// handlers on t under the configured paths
+func (r *Reflection) Register(t Registrar) {
+	t.RegisterHandler(r.listServicesPath, r.Handler())
+	t.RegisterHandler(r.fileContainingSymbolPath, r.FileContainingSymbolHandler())
+	t.RegisterHandler(r.listMethodsPath, r.ListMethodsHandler())
+}
+
+// isReflectionPath reports whether path belongs to the reflection service,
+// wherever it is registered
+func (r *Reflection) isReflectionPath(path string) bool {
+	return strings.HasPrefix(path, "/grpc.reflection.") ||
+		path == r.listServicesPath || path == r.fileContainingSymbolPath || path == r.listMethodsPath
 }
 
 // ListServices returns information about all registered services
 func (r *Reflection) ListServices() *ListServicesResponse {
-	methods := r.registry.GetRegisteredMethods()
+	var methods []transport.MethodInfo
+	detailed, hasDetails := r.registry.(DetailedHandlerRegistry)
+	if hasDetails {
+		methods = detailed.GetRegisteredMethodsDetailed()
+	} else {
+		for _, path := range r.registry.GetRegisteredMethods() {
+			methods = append(methods, transport.MethodInfo{Path: path})
+		}
+	}
 
 	// Group methods by service
-	serviceMap := make(map[string][]string)
+	serviceMap := make(map[string][]MethodInfo)
 
 	for _, method := range methods {
 		// Skip reflection service itself
-		if strings.HasPrefix(method, "/grpc.reflection.") {
+		if r.isReflectionPath(method.Path) {
 			continue
 		}
 
 		// Parse method path: /package.Service/Method
-		parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+		parts := strings.Split(strings.TrimPrefix(method.Path, "/"), "/")
 		if len(parts) != 2 {
 			continue
 		}
@@ -100,17 +216,33 @@ func (r *Reflection) ListServices() *ListServicesResponse {
 		serviceName := parts[0]
 		methodName := parts[1]
 
-		serviceMap[serviceName] = append(serviceMap[serviceName], methodName)
+		serviceMap[serviceName] = append(serviceMap[serviceName], MethodInfo{
+			Name:            methodName,
+			ServerStreaming: method.ServerStreaming,
+			ClientStreaming: method.ClientStreaming,
+		})
 	}
 
 	// Convert to response
 	services := make([]ServiceInfo, 0, len(serviceMap))
-	for name, methods := range serviceMap {
-		sort.Strings(methods)
-		services = append(services, ServiceInfo{
-			Name:    name,
-			Methods: methods,
+	for name, infos := range serviceMap {
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name < infos[j].Name
 		})
+
+		names := make([]string, len(infos))
+		for i, info := range infos {
+			names[i] = info.Name
+		}
+
+		svc := ServiceInfo{
+			Name:    name,
+			Methods: names,
+		}
+		if hasDetails {
+			svc.MethodInfo = infos
+		}
+		services = append(services, svc)
 	}
 
 	// Sort services by name for consistent output
@@ -123,16 +255,59 @@ func (r *Reflection) ListServices() *ListServicesResponse {
 	}
 }
 
-// Handler returns a gRPC handler for the ListServices method
+// Handler returns a gRPC handler for the ListServices method.
+// The response is JSON unless the request's accept header (or, without one,
+// its content-type) asks for protobuf, in which case it is a
+// grpc.reflection.v1alpha.ServerReflectionResponse.
 func (r *Reflection) Handler() func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 	return func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 		resp := r.ListServices()
 
-		// Simple JSON encoding (avoiding external dependencies)
+		if wantsProto(req.Headers) {
+			return &codec.ResponseEnvelope{
+				Headers:  map[string]string{"content-type": codec.ContentTypeProto},
+				Messages: [][]byte{encodeListServicesProto(resp)},
+				Trailers: map[string]string{"grpc-status": "0"},
+			}, nil
+		}
+
 		data := encodeListServicesResponse(resp)
 
 		return &codec.ResponseEnvelope{
-			Headers:  map[string]string{"content-type": "application/json"},
+			Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+			Messages: [][]byte{data},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	}
+}
+
+// ListMethods returns the full paths of all registered methods, sorted,
+// excluding the reflection service. Unlike ListServices, the paths can be
+// invoked as they are.
+func (r *Reflection) ListMethods() *ListMethodsResponse {
+	methods := []string{}
+	for _, path := range r.registry.GetRegisteredMethods() {
+		if !r.isReflectionPath(path) {
+			methods = append(methods, path)
+		}
+	}
+	sort.Strings(methods)
+
+	return &ListMethodsResponse{
+		Methods: methods,
+	}
+}
+
+// ListMethodsHandler returns a gRPC handler for the ListMethods method. The
+// response is always JSON; ListMethods has no counterpart in the protobuf
+// reflection API.
+func (r *Reflection) ListMethodsHandler() func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+	return func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		// Cannot fail: the response holds only strings
+		data, _ := json.Marshal(r.ListMethods())
+
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
 			Messages: [][]byte{data},
 			Trailers: map[string]string{"grpc-status": "0"},
 		}, nil
@@ -143,6 +318,21 @@ func (r *Reflection) Handler() func(ctx context.Context, req *codec.RequestEnvel
 // The symbol can be a fully qualified service name (e.g., "mypackage.MyService")
 // or a method name (e.g., "mypackage.MyService.MyMethod").
 func (r *Reflection) FileContainingSymbol(symbol string) (*FileContainingSymbolResponse, error) {
+	data, err := fileContainingSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	// Base64 encode
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	return &FileContainingSymbolResponse{
+		FileDescriptorProto: encoded,
+	}, nil
+}
+
+// fileContainingSymbol returns the serialized FileDescriptorProto for symbol
+func fileContainingSymbol(symbol string) ([]byte, error) {
 	// Find the descriptor by name in the global registry
 	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(symbol))
 	if err != nil {
@@ -155,143 +345,102 @@ func (r *Reflection) FileContainingSymbol(symbol string) (*FileContainingSymbolR
 		return nil, protoregistry.NotFound
 	}
 
-	// Convert to FileDescriptorProto
-	fileDescProto := protodesc.ToFileDescriptorProto(fileDesc)
-
-	// Serialize to bytes
-	data, err := proto.Marshal(fileDescProto)
-	if err != nil {
-		return nil, err
-	}
-
-	// Base64 encode
-	encoded := base64.StdEncoding.EncodeToString(data)
-
-	return &FileContainingSymbolResponse{
-		FileDescriptorProto: encoded,
-	}, nil
+	// Convert to FileDescriptorProto and serialize
+	return proto.Marshal(protodesc.ToFileDescriptorProto(fileDesc))
 }
 
-// FileContainingSymbolHandler returns a gRPC handler for the FileContainingSymbol method
+// FileContainingSymbolHandler returns a gRPC handler for the FileContainingSymbol method.
+// Like Handler, it negotiates the format: JSON requests and responses by
+// default, or a protobuf ServerReflectionRequest and ServerReflectionResponse
+// when the client asks for protobuf.
 func (r *Reflection) FileContainingSymbolHandler() func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 	return func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
-		// Parse request JSON
+		asProto := wantsProto(req.Headers)
+
+		// Parse request
 		var request FileContainingSymbolRequest
 		if len(req.Message) > 0 {
-			if err := json.Unmarshal(req.Message, &request); err != nil {
-				return &codec.ResponseEnvelope{
-					Headers:  map[string]string{"content-type": "application/json"},
-					Messages: [][]byte{[]byte(`{"error":"invalid request"}`)},
-					Trailers: map[string]string{
-						"grpc-status":  "3", // InvalidArgument
-						"grpc-message": "invalid request JSON",
-					},
-				}, nil
+			var err error
+			if isProtoMediaType(req.Headers["content-type"]) {
+				request.Symbol, err = decodeFileContainingSymbolRequest(req.Message)
+			} else {
+				err = json.Unmarshal(req.Message, &request)
+			}
+			if err != nil {
+				return errorEnvelope(asProto, codec.StatusInvalidArgument, "invalid request", "invalid request message"), nil
 			}
 		}
 
 		if request.Symbol == "" {
-			return &codec.ResponseEnvelope{
-				Headers:  map[string]string{"content-type": "application/json"},
-				Messages: [][]byte{[]byte(`{"error":"symbol is required"}`)},
-				Trailers: map[string]string{
-					"grpc-status":  "3", // InvalidArgument
-					"grpc-message": "symbol is required",
-				},
-			}, nil
+			return errorEnvelope(asProto, codec.StatusInvalidArgument, "symbol is required", "symbol is required"), nil
 		}
 
 		// Get file descriptor
-		resp, err := r.FileContainingSymbol(request.Symbol)
+		fileDescriptor, err := fileContainingSymbol(request.Symbol)
 		if err != nil {
 			if err == protoregistry.NotFound {
-				return &codec.ResponseEnvelope{
-					Headers:  map[string]string{"content-type": "application/json"},
-					Messages: [][]byte{[]byte(`{"error":"symbol not found"}`)},
-					Trailers: map[string]string{
-						"grpc-status":  "5", // NotFound
-						"grpc-message": "symbol not found: " + request.Symbol,
-					},
-				}, nil
+				return errorEnvelope(asProto, codec.StatusNotFound, "symbol not found", "symbol not found: "+request.Symbol), nil
 			}
+			return errorEnvelope(asProto, codec.StatusInternal, "internal error", "internal error: "+err.Error()), nil
+		}
+
+		if asProto {
 			return &codec.ResponseEnvelope{
-				Headers:  map[string]string{"content-type": "application/json"},
-				Messages: [][]byte{[]byte(`{"error":"internal error"}`)},
-				Trailers: map[string]string{
-					"grpc-status":  "13", // Internal
-					"grpc-message": "internal error: " + err.Error(),
-				},
+				Headers:  map[string]string{"content-type": codec.ContentTypeProto},
+				Messages: [][]byte{encodeFileDescriptorProto(fileDescriptor)},
+				Trailers: map[string]string{"grpc-status": "0"},
 			}, nil
 		}
 
 		// Encode response
-		data, err := json.Marshal(resp)
+		data, err := json.Marshal(&FileContainingSymbolResponse{
+			FileDescriptorProto: base64.StdEncoding.EncodeToString(fileDescriptor),
+		})
 		if err != nil {
-			return &codec.ResponseEnvelope{
-				Headers:  map[string]string{"content-type": "application/json"},
-				Messages: [][]byte{[]byte(`{"error":"failed to encode response"}`)},
-				Trailers: map[string]string{
-					"grpc-status":  "13", // Internal
-					"grpc-message": "failed to encode response",
-				},
-			}, nil
+			return errorEnvelope(false, codec.StatusInternal, "failed to encode response", "failed to encode response"), nil
 		}
 
 		return &codec.ResponseEnvelope{
-			Headers:  map[string]string{"content-type": "application/json"},
+			Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
 			Messages: [][]byte{data},
 			Trailers: map[string]string{"grpc-status": "0"},
 		}, nil
 	}
 }
 
-// encodeListServicesResponse encodes the response to JSON
-func encodeListServicesResponse(resp *ListServicesResponse) []byte {
-	// Manual JSON encoding to avoid importing encoding/json
-	var sb strings.Builder
-	sb.WriteString(`{"services":[`)
-
-	for i, svc := range resp.Services {
-		if i > 0 {
-			sb.WriteString(",")
-		}
-		sb.WriteString(`{"name":"`)
-		sb.WriteString(escapeJSON(svc.Name))
-		sb.WriteString(`","methods":[`)
-
-		for j, method := range svc.Methods {
-			if j > 0 {
-				sb.WriteString(",")
-			}
-			sb.WriteString(`"`)
-			sb.WriteString(escapeJSON(method))
-			sb.WriteString(`"`)
-		}
-		sb.WriteString("]}")
+// errorEnvelope builds an error response. The body is {"error":jsonError}
+// for JSON clients and an error_response for protobuf clients; the status
+// and message are in the trailers either way.
+func errorEnvelope(asProto bool, status int, jsonError, message string) *codec.ResponseEnvelope {
+	headers := map[string]string{"content-type": codec.ContentTypeJSON}
+	body, _ := json.Marshal(map[string]string{"error": jsonError})
+	if asProto {
+		headers["content-type"] = codec.ContentTypeProto
+		body = encodeErrorProto(status, message)
 	}
 
-	sb.WriteString("]}")
-	return []byte(sb.String())
+	return &codec.ResponseEnvelope{
+		Headers:  headers,
+		Messages: [][]byte{body},
+		Trailers: map[string]string{
+			"grpc-status":  strconv.Itoa(status),
+			"grpc-message": message,
+		},
+	}
 }
 
-// escapeJSON escapes special characters for JSON strings
-func escapeJSON(s string) string {
-	var sb strings.Builder
-	for _, r := range s {
-		switch r {
-		case '"':
-			sb.WriteString(`\"`)
-		case '\\':
-			sb.WriteString(`\\`)
-		case '\n':
-			sb.WriteString(`\n`)
-		case '\r':
-			sb.WriteString(`\r`)
-		case '\t':
-			sb.WriteString(`\t`)
-		default:
-			sb.WriteRune(r)
+// encodeListServicesResponse encodes the response to JSON. Services
+// without methods get "methods":[] rather than null.
+func encodeListServicesResponse(resp *ListServicesResponse) []byte {
+	out := ListServicesResponse{Services: make([]ServiceInfo, len(resp.Services))}
+	for i, svc := range resp.Services {
+		if svc.Methods == nil {
+			svc.Methods = []string{}
 		}
+		out.Services[i] = svc
 	}
-	return sb.String()
+
+	// Cannot fail: the response holds only strings and bools
+	data, _ := json.Marshal(&out)
+	return data
 }
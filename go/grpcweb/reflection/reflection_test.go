@@ -3,9 +3,18 @@ package reflection
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/transport"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 // mockRegistry is a mock implementation of HandlerRegistry for testing
@@ -118,6 +127,183 @@ func TestListServicesExcludesReflection(t *testing.T) {
 	}
 }
 
+func TestListMethods(t *testing.T) {
+	clientEnd, serverEnd := transport.Pipe()
+	tr := transport.NewDataChannelTransportWithInterface(serverEnd, nil)
+	client := transport.NewClient(clientEnd)
+	defer client.Close()
+
+	r := New(tr)
+	r.Register(tr)
+	noop := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	}
+	tr.RegisterHandler("/users.UserService/GetUser", noop)
+	tr.RegisterHandler("/orders.OrderService/CreateOrder", noop)
+	tr.RegisterStreamingHandler("/users.UserService/Watch", func(req *codec.RequestEnvelope, stream transport.ServerStream) error {
+		return nil
+	})
+	tr.Start()
+
+	// The flat list is the registered methods minus reflection, sorted
+	var expected []string
+	for _, path := range tr.GetRegisteredMethods() {
+		if !strings.HasPrefix(path, "/grpc.reflection.") {
+			expected = append(expected, path)
+		}
+	}
+	sort.Strings(expected)
+	if len(expected) != 3 {
+		t.Fatalf("Expected 3 non-reflection methods, got %v", expected)
+	}
+
+	if got := r.ListMethods().Methods; !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, ListMethodsPath, nil, nil)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	var listResp ListMethodsResponse
+	if err := json.Unmarshal(resp.Messages[0], &listResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if !slices.Equal(listResp.Methods, expected) {
+		t.Errorf("Expected %v from handler, got %v", expected, listResp.Methods)
+	}
+
+	// Every listed path can be invoked as is
+	if _, err := client.Invoke(ctx, listResp.Methods[0], nil, nil); err != nil {
+		t.Errorf("Invoke %s failed: %v", listResp.Methods[0], err)
+	}
+}
+
+func TestListMethodsEmpty(t *testing.T) {
+	r := New(&mockRegistry{methods: []string{MethodPath, ListMethodsPath}})
+
+	data, err := json.Marshal(r.ListMethods())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"methods":[]}` {
+		t.Errorf(`Expected {"methods":[]}, got %s`, data)
+	}
+}
+
+func TestCustomPaths(t *testing.T) {
+	clientEnd, serverEnd := transport.Pipe()
+	tr := transport.NewDataChannelTransportWithInterface(serverEnd, nil)
+	client := transport.NewClient(clientEnd)
+	defer client.Close()
+
+	r := NewWithOptions(tr, &Options{ListServicesPath: "/admin.Reflection/List"})
+	r.Register(tr)
+	tr.RegisterHandler("/test.TestService/TestMethod", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	})
+	tr.Start()
+
+	if r.ListServicesPath() != "/admin.Reflection/List" {
+		t.Errorf("Expected custom ListServices path, got %s", r.ListServicesPath())
+	}
+	if r.FileContainingSymbolPath() != FileContainingSymbolPath {
+		t.Errorf("Expected default FileContainingSymbol path, got %s", r.FileContainingSymbolPath())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, "/admin.Reflection/List", nil, nil)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	var listResp ListServicesResponse
+	if err := json.Unmarshal(resp.Messages[0], &listResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	// The reflection service is excluded from its own listing
+	if len(listResp.Services) != 1 || listResp.Services[0].Name != "test.TestService" {
+		t.Errorf("Expected only test.TestService, got %+v", listResp.Services)
+	}
+
+	var grpcErr *codec.GRPCError
+	if _, err := client.Invoke(ctx, MethodPath, nil, nil); !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED for the default path, got %v", err)
+	}
+}
+
+// mockDetailedRegistry also reports streaming-ness
+type mockDetailedRegistry struct {
+	methods []transport.MethodInfo
+}
+
+func (m *mockDetailedRegistry) GetRegisteredMethods() []string {
+	paths := make([]string, len(m.methods))
+	for i, method := range m.methods {
+		paths[i] = method.Path
+	}
+	return paths
+}
+
+func (m *mockDetailedRegistry) GetRegisteredMethodsDetailed() []transport.MethodInfo {
+	return m.methods
+}
+
+func TestListServicesStreamingInfo(t *testing.T) {
+	registry := &mockDetailedRegistry{
+		methods: []transport.MethodInfo{
+			{Path: "/echo.EchoService/StreamNumbers", ServerStreaming: true},
+			{Path: "/echo.EchoService/Echo"},
+		},
+	}
+	r := New(registry)
+
+	resp := r.ListServices()
+	if len(resp.Services) != 1 {
+		t.Fatalf("Expected 1 service, got %d", len(resp.Services))
+	}
+
+	svc := resp.Services[0]
+	if len(svc.Methods) != 2 || svc.Methods[0] != "Echo" || svc.Methods[1] != "StreamNumbers" {
+		t.Errorf("Expected methods [Echo StreamNumbers], got %v", svc.Methods)
+	}
+
+	want := []MethodInfo{
+		{Name: "Echo"},
+		{Name: "StreamNumbers", ServerStreaming: true},
+	}
+	if len(svc.MethodInfo) != len(want) {
+		t.Fatalf("Expected %d method infos, got %d", len(want), len(svc.MethodInfo))
+	}
+	for i := range want {
+		if svc.MethodInfo[i] != want[i] {
+			t.Errorf("MethodInfo %d: expected %+v, got %+v", i, want[i], svc.MethodInfo[i])
+		}
+	}
+
+	// Streaming info survives JSON encoding
+	var decoded ListServicesResponse
+	if err := json.Unmarshal(encodeListServicesResponse(resp), &decoded); err != nil {
+		t.Fatalf("Failed to parse encoded response: %v", err)
+	}
+	if len(decoded.Services) != 1 || len(decoded.Services[0].MethodInfo) != 2 || !decoded.Services[0].MethodInfo[1].ServerStreaming {
+		t.Errorf("Streaming info lost in JSON encoding: %+v", decoded)
+	}
+}
+
+func TestListServicesWithoutStreamingInfo(t *testing.T) {
+	r := New(&mockRegistry{methods: []string{"/echo.EchoService/Echo"}})
+
+	resp := r.ListServices()
+	if len(resp.Services) != 1 || resp.Services[0].MethodInfo != nil {
+		t.Errorf("Expected no MethodInfo from a plain registry, got %+v", resp.Services)
+	}
+}
+
 func TestHandler(t *testing.T) {
 	registry := &mockRegistry{
 		methods: []string{
@@ -138,8 +324,8 @@ func TestHandler(t *testing.T) {
 		t.Fatalf("Handler returned error: %v", err)
 	}
 
-	if resp.Headers["content-type"] != "application/json" {
-		t.Errorf("Expected content-type 'application/json', got '%s'", resp.Headers["content-type"])
+	if resp.Headers["content-type"] != codec.ContentTypeJSON {
+		t.Errorf("Expected content-type '%s', got '%s'", codec.ContentTypeJSON, resp.Headers["content-type"])
 	}
 
 	if resp.Trailers["grpc-status"] != "0" {
@@ -189,23 +375,233 @@ func TestEncodeListServicesResponse(t *testing.T) {
 	}
 }
 
-func TestEscapeJSON(t *testing.T) {
+func TestEncodeListServicesResponseEscaping(t *testing.T) {
+	// The shape matches what clients have always received
+	data := encodeListServicesResponse(&ListServicesResponse{
+		Services: []ServiceInfo{{Name: "test.Service"}},
+	})
+	if want := `{"services":[{"name":"test.Service","methods":[]}]}`; string(data) != want {
+		t.Errorf("encodeListServicesResponse = %s, want %s", data, want)
+	}
+
+	names := []string{
+		"simple",
+		`with"quote`,
+		"with\\backslash",
+		"with\nnewline\ttab\rcarriage",
+		"with\x01control\x1fchars",
+		"with\u2028separator",
+	}
+	resp := &ListServicesResponse{}
+	for _, name := range names {
+		resp.Services = append(resp.Services, ServiceInfo{
+			Name:       name,
+			Methods:    []string{name},
+			MethodInfo: []MethodInfo{{Name: name}},
+		})
+	}
+
+	data = encodeListServicesResponse(resp)
+	if !json.Valid(data) {
+		t.Fatalf("encodeListServicesResponse produced invalid JSON: %q", data)
+	}
+
+	var decoded ListServicesResponse
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to parse encoded response: %v", err)
+	}
+	for i, name := range names {
+		svc := decoded.Services[i]
+		if svc.Name != name || svc.Methods[0] != name || svc.MethodInfo[0].Name != name {
+			t.Errorf("Name %q not preserved: %+v", name, svc)
+		}
+	}
+}
+
+// fieldBytes returns the length-delimited values of field num in a protobuf message
+func fieldBytes(t *testing.T, data []byte, num protowire.Number) [][]byte {
+	t.Helper()
+	var values [][]byte
+	for len(data) > 0 {
+		n, typ, l := protowire.ConsumeTag(data)
+		if l < 0 {
+			t.Fatalf("Invalid tag: %v", protowire.ParseError(l))
+		}
+		data = data[l:]
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(data)
+			if l < 0 {
+				t.Fatalf("Invalid bytes field: %v", protowire.ParseError(l))
+			}
+			values = append(values, v)
+			data = data[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, data)
+		if l < 0 {
+			t.Fatalf("Invalid field: %v", protowire.ParseError(l))
+		}
+		data = data[l:]
+	}
+	return values
+}
+
+func TestWantsProto(t *testing.T) {
 	tests := []struct {
-		input    string
-		expected string
+		headers  map[string]string
+		expected bool
 	}{
-		{"simple", "simple"},
-		{`with"quote`, `with\"quote`},
-		{"with\\backslash", "with\\\\backslash"},
-		{"with\nnewline", "with\\nnewline"},
-		{"with\ttab", "with\\ttab"},
-		{"with\rcarriage", "with\\rcarriage"},
+		{map[string]string{}, false},
+		{map[string]string{"accept": "application/json"}, false},
+		{map[string]string{"accept": "*/*"}, false},
+		{map[string]string{"accept": "application/grpc-web+proto"}, true},
+		{map[string]string{"accept": "application/x-protobuf; q=0.9, application/json"}, true},
+		{map[string]string{"accept": "application/json, application/grpc+proto"}, false},
+		{map[string]string{"content-type": "application/grpc-web+proto"}, true},
+		{map[string]string{"content-type": "application/grpc-web+proto", "accept": "application/json"}, false},
 	}
 
 	for _, tt := range tests {
-		result := escapeJSON(tt.input)
-		if result != tt.expected {
-			t.Errorf("escapeJSON(%q) = %q, expected %q", tt.input, result, tt.expected)
+		if got := wantsProto(tt.headers); got != tt.expected {
+			t.Errorf("wantsProto(%v) = %v, expected %v", tt.headers, got, tt.expected)
 		}
 	}
 }
+
+func TestHandlerProto(t *testing.T) {
+	registry := &mockRegistry{
+		methods: []string{
+			"/test.TestService/TestMethod",
+			"/other.OtherService/OtherMethod",
+		},
+	}
+	handler := New(registry).Handler()
+
+	req := &codec.RequestEnvelope{
+		Path:    MethodPath,
+		Headers: map[string]string{"accept": "application/grpc-web+proto"},
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Headers["content-type"] != "application/grpc-web+proto" {
+		t.Errorf("Expected content-type 'application/grpc-web+proto', got '%s'", resp.Headers["content-type"])
+	}
+
+	lists := fieldBytes(t, resp.Messages[0], 6) // list_services_response
+	if len(lists) != 1 {
+		t.Fatalf("Expected list_services_response, got %d", len(lists))
+	}
+
+	var names []string
+	for _, svc := range fieldBytes(t, lists[0], 1) {
+		for _, name := range fieldBytes(t, svc, 1) {
+			names = append(names, string(name))
+		}
+	}
+	if len(names) != 2 || names[0] != "other.OtherService" || names[1] != "test.TestService" {
+		t.Errorf("Expected [other.OtherService test.TestService], got %v", names)
+	}
+}
+
+func TestFileContainingSymbolHandler(t *testing.T) {
+	handler := New(&mockRegistry{}).FileContainingSymbolHandler()
+
+	req := &codec.RequestEnvelope{
+		Path:    FileContainingSymbolPath,
+		Headers: map[string]string{},
+		Message: []byte(`{"symbol":"google.protobuf.FileDescriptorProto"}`),
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "0" {
+		t.Fatalf("Expected grpc-status '0', got '%s' (%s)", resp.Trailers["grpc-status"], resp.Trailers["grpc-message"])
+	}
+	if resp.Headers["content-type"] != codec.ContentTypeJSON {
+		t.Errorf("Expected content-type '%s', got '%s'", codec.ContentTypeJSON, resp.Headers["content-type"])
+	}
+
+	var result FileContainingSymbolResponse
+	if err := json.Unmarshal(resp.Messages[0], &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if result.FileDescriptorProto == "" {
+		t.Error("Expected a file descriptor")
+	}
+}
+
+func TestFileContainingSymbolHandlerProto(t *testing.T) {
+	handler := New(&mockRegistry{}).FileContainingSymbolHandler()
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 4, protowire.BytesType) // file_containing_symbol
+	msg = protowire.AppendString(msg, "google.protobuf.FileDescriptorProto")
+
+	req := &codec.RequestEnvelope{
+		Path:    FileContainingSymbolPath,
+		Headers: map[string]string{"content-type": "application/grpc-web+proto"},
+		Message: msg,
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "0" {
+		t.Fatalf("Expected grpc-status '0', got '%s' (%s)", resp.Trailers["grpc-status"], resp.Trailers["grpc-message"])
+	}
+	if resp.Headers["content-type"] != "application/grpc-web+proto" {
+		t.Errorf("Expected content-type 'application/grpc-web+proto', got '%s'", resp.Headers["content-type"])
+	}
+
+	fdResponses := fieldBytes(t, resp.Messages[0], 4) // file_descriptor_response
+	if len(fdResponses) != 1 {
+		t.Fatalf("Expected file_descriptor_response, got %d", len(fdResponses))
+	}
+	files := fieldBytes(t, fdResponses[0], 1)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file descriptor, got %d", len(files))
+	}
+
+	var fd descriptorpb.FileDescriptorProto
+	if err := proto.Unmarshal(files[0], &fd); err != nil {
+		t.Fatalf("Failed to unmarshal file descriptor: %v", err)
+	}
+	if fd.GetName() != "google/protobuf/descriptor.proto" {
+		t.Errorf("Expected google/protobuf/descriptor.proto, got %s", fd.GetName())
+	}
+}
+
+func TestFileContainingSymbolHandlerProtoNotFound(t *testing.T) {
+	handler := New(&mockRegistry{}).FileContainingSymbolHandler()
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 4, protowire.BytesType) // file_containing_symbol
+	msg = protowire.AppendString(msg, "missing.Symbol")
+
+	req := &codec.RequestEnvelope{
+		Path:    FileContainingSymbolPath,
+		Headers: map[string]string{"content-type": "application/grpc-web+proto"},
+		Message: msg,
+	}
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Handler returned error: %v", err)
+	}
+
+	if resp.Trailers["grpc-status"] != "5" {
+		t.Errorf("Expected grpc-status '5', got '%s'", resp.Trailers["grpc-status"])
+	}
+	if errs := fieldBytes(t, resp.Messages[0], 7); len(errs) != 1 { // error_response
+		t.Errorf("Expected error_response, got %d", len(errs))
+	}
+}
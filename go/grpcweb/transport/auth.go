@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"strings"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// TokenVerifier checks the token of an RPC. It returns the context the
+// handler runs with, typically ctx carrying the authenticated identity, or
+// an error to reject the call. Errors are sent as UNAUTHENTICATED unless
+// they are a *codec.GRPCError or a grpc status error, whose code is kept
+// (e.g. PERMISSION_DENIED for a valid token without access to the method).
+type TokenVerifier func(ctx context.Context, token string) (context.Context, error)
+
+// TokenAuthenticator wraps handlers so that they only run for requests
+// carrying a token accepted by its TokenVerifier. The DataChannel is already
+// authenticated by signaling; this authorizes individual RPCs on it.
+type TokenAuthenticator struct {
+	verify TokenVerifier
+}
+
+// TokenAuth creates a TokenAuthenticator. The token is read from the
+// authorization header ("Bearer <token>" or the bare token), or from the
+// x-api-key header if there is no authorization header. Requests without a
+// token are rejected with UNAUTHENTICATED before verify is called.
+func TokenAuth(verify TokenVerifier) *TokenAuthenticator {
+	return &TokenAuthenticator{verify: verify}
+}
+
+// Unary wraps a unary handler
+func (a *TokenAuthenticator) Unary(next Handler) Handler {
+	return func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		ctx, err := a.authenticate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// Streaming wraps a server-streaming handler. The handler's
+// stream.Context() is the context returned by the verifier.
+func (a *TokenAuthenticator) Streaming(next StreamingHandler) StreamingHandler {
+	return func(req *codec.RequestEnvelope, stream ServerStream) error {
+		ctx, err := a.authenticate(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		return next(req, &authServerStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// ClientStreaming wraps a client-streaming handler. The handler's
+// stream.Context() is the context returned by the verifier.
+func (a *TokenAuthenticator) ClientStreaming(next ClientStreamingHandler) ClientStreamingHandler {
+	return func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+		ctx, err := a.authenticate(stream.Context(), req)
+		if err != nil {
+			return nil, err
+		}
+		return next(req, &authClientStream{ClientStreamReceiver: stream, ctx: ctx})
+	}
+}
+
+// authenticate verifies the request's token and returns the handler's context
+func (a *TokenAuthenticator) authenticate(ctx context.Context, req *codec.RequestEnvelope) (context.Context, error) {
+	token := tokenFromHeaders(req.Headers)
+	if token == "" {
+		return nil, &codec.GRPCError{Code: codec.StatusUnauthenticated, Message: "missing token"}
+	}
+
+	authCtx, err := a.verify(ctx, token)
+	if err != nil {
+		if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
+			return nil, grpcErr
+		}
+		return nil, &codec.GRPCError{Code: codec.StatusUnauthenticated, Message: err.Error()}
+	}
+	if authCtx == nil {
+		authCtx = ctx
+	}
+	return authCtx, nil
+}
+
+// tokenFromHeaders returns the token from the authorization or x-api-key
+// header, or "" if there is none
+func tokenFromHeaders(headers map[string]string) string {
+	if auth := strings.TrimSpace(headers["authorization"]); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return auth
+	}
+	return strings.TrimSpace(headers["x-api-key"])
+}
+
+// authServerStream is a ServerStream with the authenticated context
+type authServerStream struct {
+	ServerStream
+	ctx context.Context
+}
+
+// Context implements ServerStream
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// authClientStream is a ClientStreamReceiver with the authenticated context
+type authClientStream struct {
+	ClientStreamReceiver
+	ctx context.Context
+}
+
+// Context implements ClientStreamReceiver
+func (s *authClientStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+type authUserKey struct{}
+
+// verifyTestToken accepts "good" as user alice and "readonly" as a user
+// without access
+func verifyTestToken(ctx context.Context, token string) (context.Context, error) {
+	switch token {
+	case "good":
+		return context.WithValue(ctx, authUserKey{}, "alice"), nil
+	case "readonly":
+		return nil, &codec.GRPCError{Code: codec.StatusPermissionDenied, Message: "read only"}
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestTokenAuthUnary(t *testing.T) {
+	auth := TokenAuth(verifyTestToken)
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Whoami", auth.Unary(func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		user, _ := ctx.Value(authUserKey{}).(string)
+		if RequestIDFromContext(ctx) == "" {
+			t.Error("Expected the request context to be kept")
+		}
+		return &codec.ResponseEnvelope{Messages: [][]byte{[]byte(user)}}, nil
+	}))
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"missing token", nil, codec.StatusUnauthenticated},
+		{"invalid token", map[string]string{"authorization": "Bearer bad"}, codec.StatusUnauthenticated},
+		{"forbidden token", map[string]string{"x-api-key": "readonly"}, codec.StatusPermissionDenied},
+		{"bearer token", map[string]string{"Authorization": "bearer good"}, codec.StatusOK},
+		{"api key", map[string]string{"x-api-key": "good"}, codec.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Invoke(ctx, "/test.Service/Whoami", nil, tt.headers)
+			if tt.code != codec.StatusOK {
+				var grpcErr *codec.GRPCError
+				if !errors.As(err, &grpcErr) || grpcErr.Code != tt.code {
+					t.Fatalf("Expected status %d, got %v", tt.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoke failed: %v", err)
+			}
+			if len(resp.Messages) != 1 || string(resp.Messages[0]) != "alice" {
+				t.Errorf("Expected user alice, got %q", resp.Messages)
+			}
+		})
+	}
+}
+
+func TestTokenAuthStreaming(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+	transport.RegisterStreamingHandler("/test.Service/Watch", TokenAuth(verifyTestToken).Streaming(func(req *codec.RequestEnvelope, stream ServerStream) error {
+		user, _ := stream.Context().Value(authUserKey{}).(string)
+		return stream.Send([]byte(user))
+	}))
+	transport.Start()
+
+	send := func(requestID string, headers map[string]string) {
+		headers["x-request-id"] = requestID
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{Path: "/test.Service/Watch", Headers: headers})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+	status := func(msgs []*codec.StreamMessage) string {
+		frames := codec.DecodeFrames(msgs[len(msgs)-1].Data).Frames
+		return codec.ParseTrailers(frames[0].Data)["grpc-status"]
+	}
+
+	send("no-token", map[string]string{})
+	msgs := waitForStreamEnd(t, dc, "no-token")
+	if len(msgs) != 1 || status(msgs) != strconv.Itoa(codec.StatusUnauthenticated) {
+		t.Errorf("Expected only an UNAUTHENTICATED end message, got %d messages, status %s", len(msgs), status(msgs))
+	}
+
+	send("good-token", map[string]string{"authorization": "Bearer good"})
+	msgs = waitForStreamEnd(t, dc, "good-token")
+	if len(msgs) != 2 || string(msgs[0].Data) != string(codec.EncodeFrame(codec.CreateDataFrame([]byte("alice")))) {
+		t.Fatalf("Expected a message for alice and the end message, got %d messages", len(msgs))
+	}
+	if status(msgs) != strconv.Itoa(codec.StatusOK) {
+		t.Errorf("Expected grpc-status 0, got %s", status(msgs))
+	}
+}
+
+func TestTokenAuthClientStreaming(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterClientStreamingHandler("/test.Service/Join", TokenAuth(verifyTestToken).ClientStreaming(func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+		if user, _ := stream.Context().Value(authUserKey{}).(string); user != "alice" {
+			t.Errorf("Expected user alice in the stream context, got %q", user)
+		}
+		return joinHandler(req, stream)
+	}))
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	stream, err := client.InvokeClientStream(ctx, "/test.Service/Join", map[string]string{"authorization": "bad"})
+	if err != nil {
+		t.Fatalf("InvokeClientStream failed: %v", err)
+	}
+	var grpcErr *codec.GRPCError
+	if _, err := stream.CloseAndRecv(); !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnauthenticated {
+		t.Errorf("Expected UNAUTHENTICATED, got %v", err)
+	}
+
+	stream, err = client.InvokeClientStream(ctx, "/test.Service/Join", map[string]string{"authorization": "good"})
+	if err != nil {
+		t.Fatalf("InvokeClientStream failed: %v", err)
+	}
+	if err := stream.Send([]byte("a")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	if len(resp.Messages) != 1 || string(resp.Messages[0]) != "a" {
+		t.Errorf("Expected 'a', got %q", resp.Messages)
+	}
+}
@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/pion/webrtc/v4"
+)
+
+// Client makes unary and client-streaming gRPC-Web calls over a DataChannel,
+// e.g. from a Go peer to a DataChannelTransport on the other end. Responses
+// are matched to calls by their x-request-id. A Client is safe for
+// concurrent use.
+type Client struct {
+	dc        DataChannelInterface
+	mu        sync.Mutex
+	pending   map[string]chan *codec.ResponseEnvelope
+	chunks    *codec.Reassembler
+	closed    chan struct{}
+	closeOnce sync.Once
+	goodbye   *codec.Goodbye // Set under mu before closed is closed
+	retry     map[string]*RetryPolicy
+}
+
+// NewClient creates a client that sends requests on dc and handles its
+// incoming messages. dc must not be shared with a DataChannelTransport.
+func NewClient(dc DataChannelInterface) *Client {
+	c := &Client{
+		dc:      dc,
+		pending: make(map[string]chan *codec.ResponseEnvelope),
+		chunks:  codec.NewReassembler(0),
+		closed:  make(chan struct{}),
+		retry:   make(map[string]*RetryPolicy),
+	}
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		c.handleMessage(msg.Data)
+	})
+	dc.OnClose(c.markClosed)
+
+	return c
+}
+
+// Invoke calls the unary method at path and waits for its response.
+//
+// The x-request-id header is generated if headers does not set one. If the
+// response has a non-OK grpc-status, Invoke returns it along with a
+// *codec.GRPCError. It returns ctx.Err() if ctx is done first, and
+// ErrTransportClosed if the client or the DataChannel is closed. If the
+// server closed it with a goodbye, the error also wraps the *codec.Goodbye.
+//
+// If path has a retry policy (see SetRetryPolicy), failed attempts are
+// retried within ctx, and the result of the last attempt is returned.
+func (c *Client) Invoke(ctx context.Context, path string, message []byte, headers map[string]string) (*codec.ResponseEnvelope, error) {
+	if policy := c.retryPolicy(path); policy != nil {
+		return c.invokeWithRetry(ctx, policy, func() (*codec.ResponseEnvelope, error) {
+			return c.invoke(ctx, path, message, headers)
+		})
+	}
+	return c.invoke(ctx, path, message, headers)
+}
+
+// invoke makes a single attempt of Invoke
+func (c *Client) invoke(ctx context.Context, path string, message []byte, headers map[string]string) (*codec.ResponseEnvelope, error) {
+	envelope := codec.NewRequestEnvelope(path, message, headers)
+	requestID := envelope.Headers["x-request-id"]
+
+	data, err := codec.EncodeRequest(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	// Register before sending so a fast response is not missed
+	respCh, err := c.register(requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(requestID)
+
+	if err := c.dc.Send(codec.MarkPayload(codec.PayloadTypeEnvelope, data)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+
+	select {
+	case resp := <-respCh:
+		if grpcErr := codec.GetError(*resp); grpcErr != nil {
+			return resp, grpcErr
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.closedErr()
+	}
+}
+
+// register adds a call waiting for the response to requestID
+func (c *Client) register(requestID string) (chan *codec.ResponseEnvelope, error) {
+	respCh := make(chan *codec.ResponseEnvelope, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+		return nil, c.closedErrLocked()
+	default:
+	}
+	if _, ok := c.pending[requestID]; ok {
+		return nil, fmt.Errorf("request %s already in progress", requestID)
+	}
+	c.pending[requestID] = respCh
+	return respCh, nil
+}
+
+// unregister removes a call added by register
+func (c *Client) unregister(requestID string) {
+	c.mu.Lock()
+	delete(c.pending, requestID)
+	c.mu.Unlock()
+}
+
+// Close closes the DataChannel; calls in progress fail with ErrTransportClosed
+func (c *Client) Close() error {
+	c.markClosed()
+	return c.dc.Close()
+}
+
+// markClosed fails calls in progress and new calls
+func (c *Client) markClosed() {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		close(c.closed)
+	})
+}
+
+// Goodbye returns the reason the server gave for closing the DataChannel
+// with DataChannelTransport.SendGoodbye, or nil if it did not send one
+func (c *Client) Goodbye() *codec.Goodbye {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.goodbye
+}
+
+// closedErr returns the error for calls failing because the client is closed
+func (c *Client) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closedErrLocked()
+}
+
+// closedErrLocked is closedErr with mu held
+func (c *Client) closedErrLocked() error {
+	if c.goodbye != nil {
+		return fmt.Errorf("%w: %w", ErrTransportClosed, c.goodbye)
+	}
+	return ErrTransportClosed
+}
+
+// handleGoodbye records the server's goodbye and fails calls in progress
+// with it. The DataChannel closing follows.
+func (c *Client) handleGoodbye(data []byte) {
+	goodbye, err := codec.DecodeGoodbye(data)
+	if err != nil {
+		log.Printf("[Client] Failed to decode goodbye: %v", err)
+		goodbye = &codec.Goodbye{Code: codec.StatusUnknown}
+	}
+
+	c.mu.Lock()
+	if c.goodbye == nil {
+		c.goodbye = goodbye
+	}
+	c.mu.Unlock()
+	c.markClosed()
+}
+
+// handleMessage delivers an incoming response to the call waiting for it
+func (c *Client) handleMessage(data []byte) {
+	// Large responses arrive in chunks; handle them once complete
+	if codec.IsChunk(data) {
+		payload, complete, err := c.chunks.Add(data)
+		if err != nil {
+			log.Printf("[Client] Dropped chunked message: %v", err)
+			return
+		}
+		if !complete {
+			return
+		}
+		data = payload
+	}
+
+	if codec.IsGoodbye(data) {
+		c.handleGoodbye(data)
+		return
+	}
+
+	if codec.IsStreamMessage(data) {
+		c.handleStreamMessage(data)
+		return
+	}
+
+	resp, err := codec.DecodeResponseWithOptions(data, codec.DecodeOptions{
+		MaxMessages: codec.DefaultMaxResponseMessages,
+	})
+	if err != nil {
+		log.Printf("[Client] Failed to decode response: %v", err)
+		return
+	}
+
+	if !c.deliver(resp.Headers["x-request-id"], resp) {
+		log.Printf("[Client] Received response for unknown request ID: %s", resp.Headers["x-request-id"])
+	}
+}
+
+// handleStreamMessage ends the call a stream end or cancel message is for.
+// The server answers client-streaming calls it cannot continue this way,
+// e.g. with NOT_FOUND for messages of a stream it no longer knows, so the
+// status is delivered as the call's response instead of leaving it waiting.
+// Other stream messages, and ones for no pending call, are dropped.
+func (c *Client) handleStreamMessage(data []byte) {
+	msg, err := codec.DecodeStreamMessage(data)
+	if err != nil {
+		log.Printf("[Client] Failed to decode stream message: %v", err)
+		return
+	}
+
+	var trailers map[string]string
+	switch msg.Flag {
+	case codec.StreamFlagEnd:
+		trailers = make(map[string]string)
+		for _, frame := range codec.DecodeFrames(msg.Data).Frames {
+			switch frame.Flags {
+			case codec.FrameTrailer:
+				trailers = codec.ParseTrailers(frame.Data)
+			case codec.FrameTrailerJSON:
+				if parsed, err := codec.ParseJSONTrailers(frame.Data); err == nil {
+					trailers = parsed
+				}
+			}
+		}
+		if _, ok := trailers["grpc-status"]; !ok {
+			trailers["grpc-status"] = strconv.Itoa(codec.StatusUnknown)
+			trailers["grpc-message"] = "stream ended without status"
+		}
+	case codec.StreamFlagCancel:
+		trailers = map[string]string{
+			"grpc-status":  strconv.Itoa(codec.StatusCancelled),
+			"grpc-message": "stream cancelled by server",
+		}
+	default:
+		return
+	}
+
+	c.deliver(msg.RequestID, &codec.ResponseEnvelope{
+		Headers:  map[string]string{"x-request-id": msg.RequestID},
+		Messages: [][]byte{},
+		Trailers: trailers,
+	})
+}
+
+// deliver passes resp to the call waiting for requestID, reporting false
+// if there is none
+func (c *Client) deliver(requestID string, resp *codec.ResponseEnvelope) bool {
+	c.mu.Lock()
+	respCh, ok := c.pending[requestID]
+	delete(c.pending, requestID)
+	c.mu.Unlock()
+	if ok {
+		respCh <- resp
+	}
+	return ok
+}
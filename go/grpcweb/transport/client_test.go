@@ -0,0 +1,282 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newPipeClient returns a client connected over a Pipe to a started transport
+func newPipeClient(t *testing.T, opts *HandlerOptions) (*Client, *DataChannelTransport) {
+	t.Helper()
+	clientEnd, serverEnd := Pipe()
+	transport := NewDataChannelTransportWithInterface(serverEnd, opts)
+	client := NewClient(clientEnd)
+	t.Cleanup(func() { client.Close() })
+	return client, transport
+}
+
+func TestClientInvoke(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{"x-echo": req.Headers["x-custom"]},
+			Messages: [][]byte{req.Message},
+		}, nil
+	})
+	transport.RegisterHandler("/test.Service/Fail", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return nil, &codec.GRPCError{Code: codec.StatusNotFound, Message: "no such thing"}
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, "/test.Service/Echo", []byte("hello"), map[string]string{"x-custom": "value"})
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if len(resp.Messages) != 1 || string(resp.Messages[0]) != "hello" {
+		t.Errorf("Expected echo of 'hello', got %q", resp.Messages)
+	}
+	if resp.Headers["x-echo"] != "value" {
+		t.Errorf("Expected request headers to be sent, got %v", resp.Headers)
+	}
+	if resp.Headers["x-request-id"] == "" {
+		t.Error("Expected a generated x-request-id")
+	}
+
+	resp, err = client.Invoke(ctx, "/test.Service/Fail", nil, nil)
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusNotFound {
+		t.Fatalf("Expected NOT_FOUND error, got %v", err)
+	}
+	if resp == nil || resp.Trailers["grpc-message"] != "no such thing" {
+		t.Errorf("Expected error response to be returned, got %+v", resp)
+	}
+}
+
+func TestClientJSONTrailers(t *testing.T) {
+	client, transport := newPipeClient(t, &HandlerOptions{JSONTrailers: true})
+	transport.RegisterHandler("/test.Service/Detail", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+			Trailers: map[string]string{"x-detail": "line 1\r\nline 2: done"},
+		}, nil
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, "/test.Service/Detail", []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if got := resp.Trailers["x-detail"]; got != "line 1\r\nline 2: done" {
+		t.Errorf("Expected x-detail to round-trip, got %q", got)
+	}
+	if resp.Trailers["grpc-status"] != "0" {
+		t.Errorf("Expected grpc-status 0, got %v", resp.Trailers)
+	}
+}
+
+func TestClientInvokeConcurrent(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			msg := []byte{byte(i)}
+			resp, err := client.Invoke(ctx, "/test.Service/Echo", msg, nil)
+			if err == nil && (len(resp.Messages) != 1 || resp.Messages[0][0] != byte(i)) {
+				err = errors.New("response delivered to the wrong call")
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClientInvokeCancelAndClose(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	release := make(chan struct{})
+	transport.RegisterHandler("/test.Service/Slow", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		<-release
+		return &codec.ResponseEnvelope{}, nil
+	})
+	transport.Start()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Invoke(ctx, "/test.Service/Slow", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// Closing the client fails calls in progress and later calls
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Invoke(context.Background(), "/test.Service/Slow", nil, nil)
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrTransportClosed) {
+			t.Errorf("Expected ErrTransportClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Invoke did not return after Close")
+	}
+	if _, err := client.Invoke(context.Background(), "/test.Service/Slow", nil, nil); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("Expected ErrTransportClosed after Close, got %v", err)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Raw", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	})
+	transport.RegisterHandler("/test.Service/Typed", MakeHandler(
+		func(data []byte) (string, error) { return string(data), nil },
+		func(resp string) ([]byte, error) { return []byte(resp), nil },
+		func(ctx context.Context, req string) (string, error) {
+			return "", status.Errorf(codes.PermissionDenied, "%s is not yours", req)
+		},
+	))
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		path    string
+		code    int
+		message string
+	}{
+		{"/test.Service/Raw", codec.StatusNotFound, "no such user"},
+		{"/test.Service/Typed", codec.StatusPermissionDenied, "x is not yours"},
+	}
+	for _, tt := range tests {
+		_, err := client.Invoke(ctx, tt.path, []byte("x"), nil)
+		var grpcErr *codec.GRPCError
+		if !errors.As(err, &grpcErr) {
+			t.Fatalf("%s: expected GRPCError, got %v", tt.path, err)
+		}
+		if grpcErr.Code != tt.code || grpcErr.Message != tt.message {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.code, tt.message, grpcErr.Code, grpcErr.Message)
+		}
+	}
+}
+
+func TestClientGoodbye(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Slow", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	transport.Start()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Invoke(context.Background(), "/test.Service/Slow", nil, nil)
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := transport.SendGoodbye(codec.StatusResourceExhausted, "quota exceeded"); err != nil {
+		t.Fatalf("SendGoodbye failed: %v", err)
+	}
+	if !transport.IsClosed() {
+		t.Error("Expected transport to be closed after SendGoodbye")
+	}
+
+	// The call in progress fails with the goodbye
+	select {
+	case err := <-errCh:
+		var goodbye *codec.Goodbye
+		if !errors.Is(err, ErrTransportClosed) || !errors.As(err, &goodbye) {
+			t.Fatalf("Expected ErrTransportClosed wrapping a goodbye, got %v", err)
+		}
+		if goodbye.Code != codec.StatusResourceExhausted || goodbye.Message != "quota exceeded" {
+			t.Errorf("Expected RESOURCE_EXHAUSTED 'quota exceeded', got %d %q", goodbye.Code, goodbye.Message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Invoke did not return after goodbye")
+	}
+
+	if goodbye := client.Goodbye(); goodbye == nil || goodbye.Code != codec.StatusResourceExhausted {
+		t.Errorf("Expected Goodbye() to return the goodbye, got %+v", goodbye)
+	}
+	if _, err := client.Invoke(context.Background(), "/test.Service/Slow", nil, nil); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("Expected ErrTransportClosed after goodbye, got %v", err)
+	}
+	if err := transport.SendGoodbye(codec.StatusUnavailable, "again"); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("Expected ErrTransportClosed from second SendGoodbye, got %v", err)
+	}
+}
+
+func TestClientWithoutGoodbye(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterHandler("/test.Service/Slow", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	transport.Start()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Invoke(context.Background(), "/test.Service/Slow", nil, nil)
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	transport.Close()
+
+	select {
+	case err := <-errCh:
+		var goodbye *codec.Goodbye
+		if !errors.Is(err, ErrTransportClosed) || errors.As(err, &goodbye) {
+			t.Errorf("Expected plain ErrTransportClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Invoke did not return after Close")
+	}
+	if client.Goodbye() != nil {
+		t.Errorf("Expected no goodbye, got %+v", client.Goodbye())
+	}
+}
+
+func TestTransportReceivesGoodbye(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+	transport.Start()
+
+	dc.simulateMessage(codec.EncodeGoodbye(codec.StatusOK, "bye"))
+	if !transport.IsClosed() {
+		t.Error("Expected transport to close on a goodbye")
+	}
+	if sent := dc.sent(); len(sent) != 0 {
+		t.Errorf("Expected no response to a goodbye, got %d messages", len(sent))
+	}
+}
@@ -0,0 +1,306 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// clientStreamBuffer is the number of client messages queued for a
+// client-streaming handler. Delivery never waits for the handler, since
+// that would stall every call on the DataChannel; a client that gets
+// further ahead fails the stream with errClientStreamOverflow.
+const clientStreamBuffer = 256
+
+// errClientStreamOverflow is returned by Recv once the client has sent more
+// messages than clientStreamBuffer ahead of the handler
+var errClientStreamOverflow = &codec.GRPCError{
+	Code:    codec.StatusResourceExhausted,
+	Message: "client stream queue full: the handler is not keeping up",
+}
+
+// clientStreamReceiver implements ClientStreamReceiver. The transport
+// delivers the client's data messages to it until an end message.
+type clientStreamReceiver struct {
+	ctx      context.Context
+	messages chan []byte   // Closed by the client's end message
+	overflow chan struct{} // Closed when messages is full
+
+	mu    sync.Mutex // Serializes deliveries
+	ended bool
+}
+
+// Recv implements ClientStreamReceiver
+func (s *clientStreamReceiver) Recv() ([]byte, error) {
+	select {
+	case <-s.overflow:
+		return nil, errClientStreamOverflow
+	default:
+	}
+	select {
+	case message, ok := <-s.messages:
+		if !ok {
+			return nil, io.EOF
+		}
+		return message, nil
+	case <-s.overflow:
+		return nil, errClientStreamOverflow
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// Context implements ClientStreamReceiver
+func (s *clientStreamReceiver) Context() context.Context {
+	return s.ctx
+}
+
+// deliver passes a data or end message from the client to the handler.
+// Each data frame of a data message is one message. It runs on the
+// DataChannel's message loop, so it never blocks: if the queue is full, the
+// stream fails and later messages are dropped.
+func (s *clientStreamReceiver) deliver(msg *codec.StreamMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		log.Printf("[Transport] Dropped stream message (flag %d) after end of client stream %s", msg.Flag, msg.RequestID)
+		return
+	}
+
+	switch msg.Flag {
+	case codec.StreamFlagData:
+		frames, err := codec.DecodeFramesAll(msg.Data)
+		if err != nil {
+			log.Printf("[Transport] Dropped invalid client stream message for %s: %v", msg.RequestID, err)
+			return
+		}
+		for _, frame := range frames {
+			if frame.Flags != codec.FrameData {
+				continue
+			}
+			select {
+			case s.messages <- frame.Data:
+			default:
+				log.Printf("[Transport] Client stream %s queue full, failing the stream", msg.RequestID)
+				s.ended = true
+				close(s.overflow)
+				return
+			}
+		}
+	case codec.StreamFlagEnd:
+		s.ended = true
+		close(s.messages)
+	default:
+		log.Printf("[Transport] Dropped stream message (flag %d) from client for stream %s", msg.Flag, msg.RequestID)
+	}
+}
+
+// startClientStream registers a client-streaming call so that the client's
+// stream messages reach it, then runs its handler in its own goroutine and
+// sends the handler's response. The call is registered before returning so
+// that messages following the request are not missed.
+func (t *DataChannelTransport) startClientStream(ctx context.Context, req *codec.RequestEnvelope, handler ClientStreamingHandler, timeout time.Duration) {
+	requestID := req.Headers["x-request-id"]
+	if requestID == "" {
+		log.Printf("[Transport] Client-streaming request missing x-request-id")
+		errResp := codec.CreateErrorResponse(codec.StatusInvalidArgument, "Missing x-request-id header")
+		if err := t.SendResponse(&errResp); err != nil {
+			log.Printf("Failed to send error response: %v", err)
+		}
+		return
+	}
+	if !t.acquireStream() {
+		log.Printf("[Transport] Too many concurrent streams, rejecting %s", req.Path)
+		t.sendResourceExhausted(requestID, false, "Too many concurrent streams")
+		return
+	}
+
+	// Create a cancellable context so the client can abandon the call
+	ctx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		stop := cancel
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+
+	stream := &clientStreamReceiver{
+		ctx:      ctx,
+		messages: make(chan []byte, clientStreamBuffer),
+		overflow: make(chan struct{}),
+	}
+
+	if !t.registerStream(requestID, cancel, stream) {
+		cancel()
+		t.releaseStream()
+		log.Printf("[Transport] Client-streaming request reuses active x-request-id %s", requestID)
+		errResp := codec.CreateErrorResponse(codec.StatusAlreadyExists, fmt.Sprintf("Stream %s is already active", requestID))
+		errResp.Headers["x-request-id"] = requestID
+		if err := t.SendResponse(&errResp); err != nil {
+			log.Printf("Failed to send error response: %v", err)
+		}
+		return
+	}
+
+	untrack := t.trackRequest(req.Path, requestID, true)
+	go func() {
+		defer t.releaseStream()
+		defer untrack()
+		defer cancel()
+		defer t.unregisterStream(requestID)
+
+		resp, err := handler(req, stream)
+		t.sendUnaryResult(ctx, req.Path, requestID, resp, err)
+	}()
+}
+
+// ClientStream is a client-streaming call started by
+// Client.InvokeClientStream. Its methods must not be called concurrently.
+type ClientStream struct {
+	client    *Client
+	ctx       context.Context
+	requestID string
+	respCh    chan *codec.ResponseEnvelope
+	sequence  uint32
+	resp      *codec.ResponseEnvelope // Response received before CloseAndRecv
+	closed    bool
+	done      chan struct{} // Closed by CloseAndRecv
+}
+
+// InvokeClientStream starts a client-streaming call to the method at path.
+// Send the request messages with Send, then call CloseAndRecv for the
+// response. The x-request-id header is generated if headers does not set
+// one.
+//
+// If ctx is done before CloseAndRecv returns, the call is cancelled on the
+// server. It returns ErrTransportClosed if the client or the DataChannel is
+// closed.
+func (c *Client) InvokeClientStream(ctx context.Context, path string, headers map[string]string) (*ClientStream, error) {
+	envelope := codec.NewRequestEnvelope(path, nil, headers)
+	requestID := envelope.Headers["x-request-id"]
+
+	data, err := codec.EncodeRequest(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	respCh, err := c.register(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.dc.Send(codec.MarkPayload(codec.PayloadTypeEnvelope, data)); err != nil {
+		c.unregister(requestID)
+		return nil, fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+
+	s := &ClientStream{
+		client:    c,
+		ctx:       ctx,
+		requestID: requestID,
+		respCh:    respCh,
+		done:      make(chan struct{}),
+	}
+	go s.watchContext()
+	return s, nil
+}
+
+// watchContext cancels the call on the server if ctx is done before
+// CloseAndRecv returns
+func (s *ClientStream) watchContext() {
+	select {
+	case <-s.ctx.Done():
+		s.client.unregister(s.requestID)
+		cancelMsg := codec.MarkPayload(codec.PayloadTypeStream, codec.EncodeCancelMessage(s.requestID))
+		if err := s.client.dc.Send(cancelMsg); err != nil {
+			log.Printf("[Client] Failed to send cancel for %s: %v", s.requestID, err)
+		}
+	case <-s.done:
+	}
+}
+
+// Send sends a request message as a codec.StreamFlagData message. It
+// returns io.EOF if the server has already responded, in which case
+// CloseAndRecv returns the response, and ctx.Err() once ctx is done.
+func (s *ClientStream) Send(message []byte) error {
+	if s.closed {
+		return errors.New("send on closed client stream")
+	}
+	if s.resp != nil {
+		return io.EOF
+	}
+	select {
+	case resp := <-s.respCh:
+		s.resp = resp
+		return io.EOF
+	default:
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.send(codec.StreamFlagData, codec.EncodeFrame(codec.CreateDataFrame(message)))
+}
+
+// CloseAndRecv sends a codec.StreamFlagEnd message and waits for the
+// response. Like Client.Invoke, it returns a *codec.GRPCError along with
+// the response if its grpc-status is not OK.
+func (s *ClientStream) CloseAndRecv() (*codec.ResponseEnvelope, error) {
+	if s.closed {
+		return nil, errors.New("client stream already closed")
+	}
+	s.closed = true
+	defer close(s.done)
+	defer s.client.unregister(s.requestID)
+
+	resp := s.resp
+	if resp == nil {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.send(codec.StreamFlagEnd, nil); err != nil {
+			return nil, err
+		}
+		select {
+		case resp = <-s.respCh:
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		case <-s.client.closed:
+			return nil, s.client.closedErr()
+		}
+	}
+
+	if grpcErr := codec.GetError(*resp); grpcErr != nil {
+		return resp, grpcErr
+	}
+	return resp, nil
+}
+
+// send numbers and sends a stream message for the call
+func (s *ClientStream) send(flag byte, data []byte) error {
+	select {
+	case <-s.client.closed:
+		return s.client.closedErr()
+	default:
+	}
+
+	msg := codec.EncodeStreamMessage(codec.StreamMessage{
+		RequestID: s.requestID,
+		Flag:      flag,
+		Sequence:  s.sequence,
+		Data:      data,
+	})
+	s.sequence++
+	if err := s.client.dc.Send(codec.MarkPayload(codec.PayloadTypeStream, msg)); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/pion/webrtc/v4"
+)
+
+// joinHandler responds with the client's messages joined by commas
+func joinHandler(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+	var parts []string
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, string(message))
+	}
+	return &codec.ResponseEnvelope{
+		Headers:  map[string]string{"x-count": strconv.Itoa(len(parts))},
+		Messages: [][]byte{[]byte(strings.Join(parts, ","))},
+	}, nil
+}
+
+func TestClientStream(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterClientStreamingHandler("/test.Service/Join", joinHandler)
+	transport.RegisterClientStreamingHandler("/test.Service/Reject", func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+		return nil, &codec.GRPCError{Code: codec.StatusPermissionDenied, Message: "no"}
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	t.Run("send and close", func(t *testing.T) {
+		stream, err := client.InvokeClientStream(ctx, "/test.Service/Join", nil)
+		if err != nil {
+			t.Fatalf("InvokeClientStream failed: %v", err)
+		}
+		for _, message := range []string{"a", "b", "c"} {
+			if err := stream.Send([]byte(message)); err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil {
+			t.Fatalf("CloseAndRecv failed: %v", err)
+		}
+		if len(resp.Messages) != 1 || string(resp.Messages[0]) != "a,b,c" {
+			t.Errorf("Expected 'a,b,c', got %q", resp.Messages)
+		}
+		if resp.Headers["x-count"] != "3" {
+			t.Errorf("Expected x-count 3, got %q", resp.Headers["x-count"])
+		}
+		if err := stream.Send([]byte("late")); err == nil {
+			t.Error("Expected Send after CloseAndRecv to fail")
+		}
+	})
+
+	t.Run("no messages", func(t *testing.T) {
+		stream, err := client.InvokeClientStream(ctx, "/test.Service/Join", nil)
+		if err != nil {
+			t.Fatalf("InvokeClientStream failed: %v", err)
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil {
+			t.Fatalf("CloseAndRecv failed: %v", err)
+		}
+		if resp.Headers["x-count"] != "0" {
+			t.Errorf("Expected x-count 0, got %q", resp.Headers["x-count"])
+		}
+	})
+
+	t.Run("early error", func(t *testing.T) {
+		stream, err := client.InvokeClientStream(ctx, "/test.Service/Reject", nil)
+		if err != nil {
+			t.Fatalf("InvokeClientStream failed: %v", err)
+		}
+
+		// The handler responds without reading; Send reports it with io.EOF
+		deadline := time.Now().Add(time.Second)
+		for {
+			err = stream.Send([]byte("x"))
+			if err != nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != io.EOF {
+			t.Fatalf("Expected io.EOF from Send, got %v", err)
+		}
+
+		_, err = stream.CloseAndRecv()
+		var grpcErr *codec.GRPCError
+		if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusPermissionDenied {
+			t.Errorf("Expected PERMISSION_DENIED, got %v", err)
+		}
+	})
+}
+
+func TestClientStreamCancel(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	handlerErr := make(chan error, 1)
+	transport.RegisterClientStreamingHandler("/test.Service/Wait", func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				handlerErr <- err
+				return nil, err
+			}
+		}
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.InvokeClientStream(ctx, "/test.Service/Wait", nil)
+	if err != nil {
+		t.Fatalf("InvokeClientStream failed: %v", err)
+	}
+	if err := stream.Send([]byte("x")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-handlerErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled in handler, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Handler was not cancelled")
+	}
+	if _, err := stream.CloseAndRecv(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from CloseAndRecv, got %v", err)
+	}
+}
+
+// dropRequests is a DataChannelInterface that loses the request envelopes
+// it receives, as a server that restarted would
+type dropRequests struct {
+	DataChannelInterface
+}
+
+// OnMessage implements DataChannelInterface
+func (d dropRequests) OnMessage(f func(msg webrtc.DataChannelMessage)) {
+	d.DataChannelInterface.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if payloadType, _ := codec.SplitPayload(msg.Data); payloadType == codec.PayloadTypeEnvelope {
+			return
+		}
+		f(msg)
+	})
+}
+
+func TestClientStreamRejectedByServer(t *testing.T) {
+	clientEnd, serverEnd := Pipe()
+	transport := NewDataChannelTransportWithInterface(dropRequests{serverEnd}, nil)
+	transport.RegisterClientStreamingHandler("/test.Service/Join", joinHandler)
+	transport.Start()
+	client := NewClient(clientEnd)
+	defer client.Close()
+
+	stream, err := client.InvokeClientStream(context.Background(), "/test.Service/Join", nil)
+	if err != nil {
+		t.Fatalf("InvokeClientStream failed: %v", err)
+	}
+	if err := stream.Send([]byte("a")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	// The server answers the message for a stream it does not know with
+	// NOT_FOUND, which ends the call
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.CloseAndRecv()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var grpcErr *codec.GRPCError
+		if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusNotFound {
+			t.Errorf("Expected NOT_FOUND, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CloseAndRecv did not return after the server rejected the stream")
+	}
+}
+
+func TestClientStreamSlowHandler(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	release := make(chan struct{})
+	transport.RegisterClientStreamingHandler("/test.Service/Slow", func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error) {
+		<-release
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return nil, err
+			}
+		}
+	})
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	stream, err := client.InvokeClientStream(ctx, "/test.Service/Slow", nil)
+	if err != nil {
+		t.Fatalf("InvokeClientStream failed: %v", err)
+	}
+	for i := 0; i < clientStreamBuffer+10; i++ {
+		if err := stream.Send([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+
+	// A handler that is not reading does not hold up other calls
+	if _, err := client.Invoke(ctx, "/test.Service/Echo", []byte("hi"), nil); err != nil {
+		t.Fatalf("Invoke failed while the handler was not reading: %v", err)
+	}
+
+	// The stream that got too far ahead fails
+	close(release)
+	_, err = stream.CloseAndRecv()
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusResourceExhausted {
+		t.Errorf("Expected RESOURCE_EXHAUSTED, got %v", err)
+	}
+}
+
+func TestRegisteredClientStreamingMethods(t *testing.T) {
+	transport := NewDataChannelTransportWithInterface(newMockDataChannel(), nil)
+	transport.RegisterClientStreamingHandler("/test.Service/Join", joinHandler)
+
+	methods := transport.GetRegisteredMethodsDetailed()
+	if len(methods) != 1 || !methods[0].ClientStreaming || methods[0].ServerStreaming {
+		t.Errorf("Expected one client-streaming method, got %+v", methods)
+	}
+	if err := transport.RegisterHandlerStrict("/test.Service/Join", nil); !errors.Is(err, ErrConflictingHandler) {
+		t.Errorf("Expected ErrConflictingHandler, got %v", err)
+	}
+}
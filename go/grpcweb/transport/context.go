@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID of the RPC being handled.
+// This is the client's x-request-id header, or an ID generated by the
+// transport if the client did not send one. It returns "" if ctx does not
+// belong to a transport request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID returns a copy of ctx carrying the request ID
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// resumeTokenKey is the context key for the resume token of a stream
+type resumeTokenKey struct{}
+
+// ResumeTokenFromContext returns the resume token a client sent in the
+// codec.ResumeTokenHeader of a streaming request, i.e. the token of an
+// interrupted stream set with ServerStream.SetResumeToken. The handler
+// continues from the point the token identifies. It returns "" for a new
+// stream.
+func ResumeTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(resumeTokenKey{}).(string)
+	return token
+}
+
+// withResumeToken returns a copy of ctx carrying the resume token
+func withResumeToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, resumeTokenKey{}, token)
+}
+
+// peerInfoKey is the context key for the peer info
+type peerInfoKey struct{}
+
+// PeerInfo identifies the remote peer of a transport, e.g. the user and app
+// authenticated by the signaling layer. It is attached with SetPeerInfo and
+// available to every handler on that transport.
+type PeerInfo struct {
+	UserID   string            // Authenticated user of the remote peer
+	AppID    string            // App the connection belongs to
+	Metadata map[string]string // Additional connection-scoped values
+}
+
+// PeerInfoFromContext returns the peer info of the transport handling the
+// request. The second result is false if none was set.
+func PeerInfoFromContext(ctx context.Context) (*PeerInfo, bool) {
+	info, ok := ctx.Value(peerInfoKey{}).(*PeerInfo)
+	return info, ok
+}
+
+// withPeerInfo returns a copy of ctx carrying the peer info
+func withPeerInfo(ctx context.Context, info *PeerInfo) context.Context {
+	return context.WithValue(ctx, peerInfoKey{}, info)
+}
+
+// encodingKey is the context key for the negotiated response encoding
+type encodingKey struct{}
+
+// EncodingFromContext returns the response encoding negotiated from the
+// client's grpc-accept-encoding header: codec.EncodingGzip if the client
+// accepts gzip, codec.EncodingIdentity otherwise. Only unary and
+// client-streaming requests negotiate compression, so it is always
+// codec.EncodingIdentity for server streams.
+func EncodingFromContext(ctx context.Context) string {
+	if encoding, ok := ctx.Value(encodingKey{}).(string); ok {
+		return encoding
+	}
+	return codec.EncodingIdentity
+}
+
+// withEncoding returns a copy of ctx carrying the negotiated encoding
+func withEncoding(ctx context.Context, encoding string) context.Context {
+	return context.WithValue(ctx, encodingKey{}, encoding)
+}
+
+// negotiateEncoding picks the response encoding for a request's
+// grpc-accept-encoding header
+func negotiateEncoding(headers map[string]string) string {
+	if codec.AcceptsEncoding(headers["grpc-accept-encoding"], codec.EncodingGzip) {
+		return codec.EncodingGzip
+	}
+	return codec.EncodingIdentity
+}
+
+// generateRequestID returns an ID for a request without x-request-id, from
+// HandlerOptions.RequestIDFunc if set
+func (t *DataChannelTransport) generateRequestID() string {
+	if t.options.RequestIDFunc != nil {
+		if id := t.options.RequestIDFunc(); id != "" {
+			return id
+		}
+	}
+	return codec.NewRequestID()
+}
@@ -6,10 +6,15 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
@@ -56,9 +61,33 @@ type Handler func(ctx context.Context, req *codec.RequestEnvelope) (*codec.Respo
 
 // ServerStream provides methods to send streaming responses
 type ServerStream interface {
-	// Send sends a message to the client
+	// Send sends a message to the client. Once the stream's context is
+	// done it returns the context's error (context.Canceled when the client
+	// cancelled, context.DeadlineExceeded on timeout) without sending, and it
+	// returns an error matching ErrTransportClosed or ErrSendFailed once the
+	// client is gone. Handlers should stop when Send fails; ignoring the
+	// error only produces messages nobody receives.
 	Send(message []byte) error
-	// Context returns the request context
+	// SendHeader sends response headers (initial metadata) to the client
+	// as a codec.StreamFlagHeader message. It must be called before the
+	// first Send and at most once.
+	SendHeader(md map[string]string) error
+	// SetTrailer sets custom trailers to be sent with the end of the stream.
+	// It may be called multiple times; values are merged. The grpc-status,
+	// grpc-message and x-stream-count trailers are always set by the
+	// transport.
+	SetTrailer(md map[string]string)
+	// SetResumeToken sends token to the client as a
+	// codec.StreamFlagResumeToken message, after the messages already sent.
+	// A client whose stream is interrupted can send the latest token back
+	// in a new request, where the handler reads it with
+	// ResumeTokenFromContext and continues after the messages the token
+	// covers. The latest token is also sent as the codec.ResumeTokenHeader
+	// trailer. The transport only delivers tokens; their meaning is up to
+	// the handler.
+	SetResumeToken(token string) error
+	// Context returns the request context. It is done when the client
+	// cancels the stream, the timeout expires or the transport closes.
 	Context() context.Context
 }
 
@@ -67,111 +96,595 @@ type ServerStream interface {
 // The handler should call stream.Send() for each message and return when done.
 type StreamingHandler func(req *codec.RequestEnvelope, stream ServerStream) error
 
+// ClientStreamReceiver provides the messages of a client-streaming call to
+// its handler
+type ClientStreamReceiver interface {
+	// Recv returns the next message from the client. It returns io.EOF once
+	// the client has closed its side of the stream, the context's error once
+	// the stream's context is done, and a RESOURCE_EXHAUSTED
+	// *codec.GRPCError if the client sent too many messages ahead of the
+	// handler.
+	Recv() ([]byte, error)
+	// Context returns the request context. It is done when the client
+	// cancels the stream, the timeout expires or the transport closes.
+	Context() context.Context
+}
+
+// ClientStreamingHandler handles a client-streaming gRPC method call.
+// It receives the request envelope, which carries the path and headers but
+// no message, reads the client's messages from stream until io.EOF and
+// returns the single response.
+type ClientStreamingHandler func(req *codec.RequestEnvelope, stream ClientStreamReceiver) (*codec.ResponseEnvelope, error)
+
 // HandlerOptions provides options for handling requests
 type HandlerOptions struct {
-	// Timeout is the request timeout, default 30s
+	// Timeout is the request timeout. DefaultHandlerOptions, which nil
+	// options stand for, sets DefaultTimeout; zero means no timeout, and a
+	// negative timeout is invalid (see Validate).
 	Timeout time.Duration
+	// IdleTimeout closes the transport if no message is received for this
+	// long while no stream or request is in progress. Zero disables it.
+	// Only the transport-wide options use it; it is ignored for per-method
+	// options.
+	IdleTimeout time.Duration
+	// Limiter, if set, is consulted before each request is dispatched;
+	// denied requests get RESOURCE_EXHAUSTED. Only the transport-wide
+	// options use it; it receives the method path to limit per method.
+	Limiter Limiter
+	// ChunkSize, if set, splits outgoing payloads larger than this many
+	// bytes into chunks the client reassembles, for messages beyond the
+	// DataChannel's message size limit. Incoming chunks are always
+	// reassembled. Only the transport-wide options use it.
+	ChunkSize int
+	// KeepaliveInterval, if set, makes streaming handlers send a keepalive
+	// message whenever nothing has been sent on the stream for this long,
+	// so idle streams are not dropped. Zero disables it.
+	KeepaliveInterval time.Duration
+	// TrailersOnly sends unary responses without messages, such as
+	// immediate errors, as trailers-only responses: grpc-status and
+	// grpc-message go in the headers (see codec.EncodeOptions). Only the
+	// transport-wide options use it.
+	TrailersOnly bool
+	// JSONTrailers sends the trailers of unary and client-streaming
+	// responses as a JSON object in a codec.FrameTrailerJSON frame, so
+	// that their values may contain line breaks. Only clients that decode
+	// it, such as Client and the TypeScript client, should be served this
+	// way. Stream end messages keep header-style trailers. Only the
+	// transport-wide options use it.
+	JSONTrailers bool
+	// RequestIDFunc, if set, generates the request ID of unary requests
+	// that lack x-request-id, e.g. to use trace IDs. It must be safe for
+	// concurrent use. A random UUID is used if it is nil or returns "".
+	// Only the transport-wide options use it.
+	RequestIDFunc func() string
+	// MaxConcurrentStreams, if set, limits the streaming and
+	// client-streaming requests handled at once; further ones get
+	// RESOURCE_EXHAUSTED until a stream ends. Zero means no limit. Only the
+	// transport-wide options use it.
+	MaxConcurrentStreams int
+	// StreamBatchInterval, if set, makes streaming handlers coalesce the
+	// messages sent within this window into one stream message carrying
+	// several data frames, so a burst of small messages takes one
+	// DataChannel write instead of one each. Messages are delayed by up to
+	// the interval; leave it zero (the default) for latency-sensitive methods.
+	// A failed batched write is returned by the next Send.
+	StreamBatchInterval time.Duration
+	// StreamBatchSize flushes a batch early once its frames reach this many
+	// bytes. Defaults to DefaultStreamBatchSize when batching is enabled.
+	StreamBatchSize int
+	// OnHandlerError, if set, is called whenever a unary or streaming
+	// handler returns an error, with the method path, the grpc-status sent
+	// to the client and the handler's original error. It runs on the
+	// request's goroutine before the error response is sent, so it must be
+	// quick and safe for concurrent use. Only the transport-wide options
+	// use it.
+	OnHandlerError func(path string, code int, err error)
+	// TrailerFunc, if set, is called with the final response of each unary
+	// or client-streaming handler, including error responses, just before
+	// it is sent. It may add or change trailers (and headers), e.g. timing
+	// or grpc-status-details-bin, with the request's context in hand. Its
+	// Trailers map is never nil and already holds grpc-status. Only the
+	// transport-wide options use it.
+	TrailerFunc func(ctx context.Context, resp *codec.ResponseEnvelope)
+	// Logger, if set and enabled for slog.LevelDebug, receives a debug
+	// record for each unary and server-streaming request a handler
+	// answered: the method path, request ID, request and response sizes in
+	// bytes, the grpc-status and the duration. Message contents are never
+	// logged. Only the transport-wide options use it.
+	Logger *slog.Logger
 }
 
+// DefaultStreamBatchSize is the StreamBatchSize used when it is unset
+const DefaultStreamBatchSize = 16 * 1024
+
+// DefaultTimeout is the request timeout of DefaultHandlerOptions
+const DefaultTimeout = 30 * time.Second
+
 // DefaultHandlerOptions returns default handler options
 func DefaultHandlerOptions() *HandlerOptions {
 	return &HandlerOptions{
-		Timeout: 30 * time.Second,
+		Timeout: DefaultTimeout,
 	}
 }
 
+// ErrInvalidOptions is returned, wrapped, by HandlerOptions.Validate
+var ErrInvalidOptions = errors.New("invalid handler options")
+
+// Validate reports the options the transport cannot honor: negative
+// durations, sizes and limits. Zero values are valid and mean the default
+// or disabled, as documented on each field; in particular a zero Timeout
+// means no timeout.
+func (o *HandlerOptions) Validate() error {
+	var errs []error
+	invalid := func(field string, value any) {
+		errs = append(errs, fmt.Errorf("%w: negative %s %v", ErrInvalidOptions, field, value))
+	}
+	if o.Timeout < 0 {
+		invalid("Timeout", o.Timeout)
+	}
+	if o.IdleTimeout < 0 {
+		invalid("IdleTimeout", o.IdleTimeout)
+	}
+	if o.KeepaliveInterval < 0 {
+		invalid("KeepaliveInterval", o.KeepaliveInterval)
+	}
+	if o.StreamBatchInterval < 0 {
+		invalid("StreamBatchInterval", o.StreamBatchInterval)
+	}
+	if o.ChunkSize < 0 {
+		invalid("ChunkSize", o.ChunkSize)
+	}
+	if o.StreamBatchSize < 0 {
+		invalid("StreamBatchSize", o.StreamBatchSize)
+	}
+	if o.MaxConcurrentStreams < 0 {
+		invalid("MaxConcurrentStreams", o.MaxConcurrentStreams)
+	}
+	return errors.Join(errs...)
+}
+
+// validOptions returns opts if Validate accepts it, and otherwise logs why
+// and returns a copy with the invalid fields replaced: a negative Timeout by
+// DefaultTimeout rather than no timeout at all, anything else by zero. The
+// constructors and registration methods, which cannot return an error, use
+// it so a bad value does not silently disable the request deadline.
+func validOptions(opts *HandlerOptions) *HandlerOptions {
+	err := opts.Validate()
+	if err == nil {
+		return opts
+	}
+	log.Printf("[Transport] Replacing invalid options: %v", err)
+
+	fixed := *opts
+	if fixed.Timeout < 0 {
+		fixed.Timeout = DefaultTimeout
+	}
+	fixed.IdleTimeout = max(fixed.IdleTimeout, 0)
+	fixed.KeepaliveInterval = max(fixed.KeepaliveInterval, 0)
+	fixed.StreamBatchInterval = max(fixed.StreamBatchInterval, 0)
+	fixed.ChunkSize = max(fixed.ChunkSize, 0)
+	fixed.StreamBatchSize = max(fixed.StreamBatchSize, 0)
+	fixed.MaxConcurrentStreams = max(fixed.MaxConcurrentStreams, 0)
+	return &fixed
+}
+
+// Registration errors returned by RegisterHandlerStrict and RegisterStreamingHandlerStrict
+var (
+	// ErrDuplicateHandler is returned when a handler of the same kind is
+	// already registered for the path
+	ErrDuplicateHandler = errors.New("handler already registered")
+	// ErrConflictingHandler is returned when the path is already registered
+	// as the other kind (unary vs streaming)
+	ErrConflictingHandler = errors.New("path already registered with a different handler kind")
+	// ErrHandlerNotFound is returned by RegisterHandlerAlias when the
+	// target path has no handler
+	ErrHandlerNotFound = errors.New("no handler registered")
+)
+
+// Send errors returned by SendResponse and ServerStream.Send. Handlers can
+// check for them with errors.Is to stop producing once the client is gone.
+var (
+	// ErrTransportClosed is returned when sending on a closed transport
+	ErrTransportClosed = errors.New("transport is closed")
+	// ErrSendFailed is returned, wrapping the underlying error, when the
+	// DataChannel write fails, e.g. because the channel is no longer open
+	ErrSendFailed = errors.New("data channel send failed")
+)
+
 // DataChannelTransport handles gRPC-Web over DataChannel (server side)
 type DataChannelTransport struct {
 	dc                DataChannelInterface
 	handlers          map[string]Handler
 	streamingHandlers map[string]StreamingHandler
+	clientHandlers    map[string]ClientStreamingHandler
+	methodOptions     map[string]*HandlerOptions
+	aliases           map[string]string // Alias path -> target path
+	streams           map[string]context.CancelFunc
+	clientStreams     map[string]*clientStreamReceiver // Client-streaming calls in progress
+	active            map[*RequestInfo]struct{}        // Requests being handled, for ActiveRequests
 	mu                sync.RWMutex
 	closed            bool
 	options           *HandlerOptions
 	onClose           func()
+	idleTimer         *time.Timer
+	peerInfo          *PeerInfo
+	chunks            *codec.Reassembler
+	nextChunkID       atomic.Uint32
+	activeStreams     int // Streaming handlers running, for MaxConcurrentStreams
+	bytesSent         atomic.Uint64
+	bytesReceived     atomic.Uint64
+	ctx               context.Context    // Parent of every request context
+	cancel            context.CancelFunc // Cancels ctx when the transport closes
 }
 
-// NewDataChannelTransport creates a new transport from a DataChannel
+// NewDataChannelTransport creates a new transport from a DataChannel.
+// Like the other constructors that return no error, it logs invalid
+// options and uses the default for each invalid field.
 func NewDataChannelTransport(dc *webrtc.DataChannel, opts *HandlerOptions) *DataChannelTransport {
-	if opts == nil {
-		opts = DefaultHandlerOptions()
-	}
+	return NewDataChannelTransportWithInterface(&dataChannelAdapter{dc: dc}, opts)
+}
 
-	return &DataChannelTransport{
-		dc:                &dataChannelAdapter{dc: dc},
-		handlers:          make(map[string]Handler),
-		streamingHandlers: make(map[string]StreamingHandler),
-		closed:            false,
-		options:           opts,
+// NewValidatedDataChannelTransport is NewDataChannelTransport for callers
+// that want invalid options reported: instead of replacing them, it returns
+// the HandlerOptions.Validate error, which wraps ErrInvalidOptions.
+func NewValidatedDataChannelTransport(dc *webrtc.DataChannel, opts *HandlerOptions) (*DataChannelTransport, error) {
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
 	}
+	return NewDataChannelTransport(dc, opts), nil
+}
+
+// NewDataChannelTransportWithInterface creates a transport from a
+// DataChannelInterface, e.g. one end of a Pipe in tests
+func NewDataChannelTransportWithInterface(dc DataChannelInterface, opts *HandlerOptions) *DataChannelTransport {
+	return NewDataChannelTransportContext(context.Background(), dc, opts)
 }
 
-// newDataChannelTransportWithInterface creates a transport from a DataChannelInterface
-// This is primarily for testing purposes
-func newDataChannelTransportWithInterface(dc DataChannelInterface, opts *HandlerOptions) *DataChannelTransport {
+// NewDataChannelTransportContext creates a transport whose request contexts
+// derive from ctx, so that they carry its values and are cancelled with it.
+// Request contexts are also cancelled when the transport closes, whichever
+// constructor created it. Cancelling ctx does not close the transport.
+//
+// Like NewDataChannelTransport, it logs invalid options (see
+// HandlerOptions.Validate) and uses the default for each invalid field.
+func NewDataChannelTransportContext(ctx context.Context, dc DataChannelInterface, opts *HandlerOptions) *DataChannelTransport {
 	if opts == nil {
 		opts = DefaultHandlerOptions()
 	}
+	opts = validOptions(opts)
+	ctx, cancel := context.WithCancel(ctx)
 
 	return &DataChannelTransport{
+		ctx:               ctx,
+		cancel:            cancel,
 		dc:                dc,
 		handlers:          make(map[string]Handler),
 		streamingHandlers: make(map[string]StreamingHandler),
+		clientHandlers:    make(map[string]ClientStreamingHandler),
+		methodOptions:     make(map[string]*HandlerOptions),
+		aliases:           make(map[string]string),
+		streams:           make(map[string]context.CancelFunc),
+		clientStreams:     make(map[string]*clientStreamReceiver),
+		active:            make(map[*RequestInfo]struct{}),
 		closed:            false,
 		options:           opts,
+		chunks:            codec.NewReassembler(0),
 	}
 }
 
 // RegisterHandler registers a handler for a method path.
 // path should be in format "/package.Service/Method"
+//
+// It is safe to call at any time, including after Start while requests are
+// being dispatched. Requests already dispatched keep the handler they were
+// routed to.
 func (t *DataChannelTransport) RegisterHandler(path string, handler Handler) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.handlers[path] = handler
 }
 
-// UnregisterHandler removes a handler
+// RegisterHandlerStrict registers a handler for a method path, returning an
+// error instead of overwriting if the path is already registered as either a
+// unary or a streaming method.
+func (t *DataChannelTransport) RegisterHandlerStrict(path string, handler Handler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.handlers[path]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, path)
+	}
+	if _, ok := t.streamingHandlers[path]; ok {
+		return fmt.Errorf("%w: %s is a streaming method", ErrConflictingHandler, path)
+	}
+	if _, ok := t.clientHandlers[path]; ok {
+		return fmt.Errorf("%w: %s is a client-streaming method", ErrConflictingHandler, path)
+	}
+	t.handlers[path] = handler
+	return nil
+}
+
+// RegisterHandlerWithOptions registers a handler with method-specific options.
+// The options override the transport defaults for this path only.
+func (t *DataChannelTransport) RegisterHandlerWithOptions(path string, handler Handler, opts *HandlerOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[path] = handler
+	t.setMethodOptionsLocked(path, opts)
+}
+
+// UnregisterHandler removes a handler.
+// Like RegisterHandler, it is safe to call after Start.
 func (t *DataChannelTransport) UnregisterHandler(path string) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	delete(t.handlers, path)
 	delete(t.streamingHandlers, path)
+	delete(t.clientHandlers, path)
+	delete(t.methodOptions, path)
+	delete(t.aliases, path)
+	for alias, target := range t.aliases {
+		if target == path {
+			delete(t.aliases, alias)
+		}
+	}
+}
+
+// RegisterHandlerAlias makes aliasPath dispatch to the unary or streaming
+// handler registered at targetPath, with its options, e.g. to serve a
+// legacy path during a migration. Unregistering the target also removes
+// its aliases. A handler registered directly at aliasPath later takes
+// precedence over the alias.
+//
+// It returns ErrHandlerNotFound if targetPath has no handler, and
+// ErrDuplicateHandler if aliasPath already has one.
+func (t *DataChannelTransport) RegisterHandlerAlias(aliasPath, targetPath string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hasHandlerLocked(aliasPath) {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, aliasPath)
+	}
+	// An alias of an alias points at the final target
+	targetPath = t.resolvePathLocked(targetPath)
+	if !t.hasHandlerLocked(targetPath) {
+		return fmt.Errorf("%w: %s", ErrHandlerNotFound, targetPath)
+	}
+	t.aliases[aliasPath] = targetPath
+	return nil
+}
+
+// hasHandlerLocked reports whether a unary, streaming or client-streaming
+// handler is registered directly at path. Must be called with t.mu held.
+func (t *DataChannelTransport) hasHandlerLocked(path string) bool {
+	_, unary := t.handlers[path]
+	_, streaming := t.streamingHandlers[path]
+	_, clientStreaming := t.clientHandlers[path]
+	return unary || streaming || clientStreaming
+}
+
+// resolvePathLocked returns the path whose handler serves path: the alias
+// target if path is an alias without a handler of its own, otherwise path.
+// Must be called with t.mu held (read or write).
+func (t *DataChannelTransport) resolvePathLocked(path string) string {
+	if t.hasHandlerLocked(path) {
+		return path
+	}
+	if target, ok := t.aliases[path]; ok {
+		return target
+	}
+	return path
 }
 
 // RegisterStreamingHandler registers a streaming handler for a method path.
 // path should be in format "/package.Service/Method"
+//
+// Like RegisterHandler, it is safe to call after Start.
 func (t *DataChannelTransport) RegisterStreamingHandler(path string, handler StreamingHandler) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.streamingHandlers[path] = handler
 }
 
+// RegisterStreamingHandlerStrict registers a streaming handler for a method
+// path, returning an error instead of overwriting if the path is already
+// registered as either a unary or a streaming method.
+func (t *DataChannelTransport) RegisterStreamingHandlerStrict(path string, handler StreamingHandler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.streamingHandlers[path]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateHandler, path)
+	}
+	if _, ok := t.handlers[path]; ok {
+		return fmt.Errorf("%w: %s is a unary method", ErrConflictingHandler, path)
+	}
+	if _, ok := t.clientHandlers[path]; ok {
+		return fmt.Errorf("%w: %s is a client-streaming method", ErrConflictingHandler, path)
+	}
+	t.streamingHandlers[path] = handler
+	return nil
+}
+
+// RegisterStreamingHandlerWithOptions registers a streaming handler with
+// method-specific options. The options override the transport defaults for
+// this path only.
+func (t *DataChannelTransport) RegisterStreamingHandlerWithOptions(path string, handler StreamingHandler, opts *HandlerOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.streamingHandlers[path] = handler
+	t.setMethodOptionsLocked(path, opts)
+}
+
+// RegisterClientStreamingHandler registers a client-streaming handler for
+// a method path. Server-streaming handlers registered at the same path
+// take precedence, and it takes precedence over unary handlers.
+//
+// Like RegisterHandler, it is safe to call after Start.
+func (t *DataChannelTransport) RegisterClientStreamingHandler(path string, handler ClientStreamingHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clientHandlers[path] = handler
+}
+
+// setMethodOptionsLocked stores per-method options; nil clears them.
+// Must be called with t.mu held.
+func (t *DataChannelTransport) setMethodOptionsLocked(path string, opts *HandlerOptions) {
+	if opts == nil {
+		delete(t.methodOptions, path)
+		return
+	}
+	t.methodOptions[path] = validOptions(opts)
+}
+
+// timeoutForLocked returns the timeout for a method path, preferring
+// per-method options over the transport default.
+// Must be called with t.mu held (read or write).
+func (t *DataChannelTransport) timeoutForLocked(path string) time.Duration {
+	if opts, ok := t.methodOptions[path]; ok {
+		return opts.Timeout
+	}
+	return t.options.Timeout
+}
+
+// batchForLocked returns the stream batch interval and size for a method
+// path, preferring per-method options over the transport default.
+// Must be called with t.mu held (read or write).
+func (t *DataChannelTransport) batchForLocked(path string) (time.Duration, int) {
+	opts, ok := t.methodOptions[path]
+	if !ok {
+		opts = t.options
+	}
+	size := opts.StreamBatchSize
+	if size <= 0 {
+		size = DefaultStreamBatchSize
+	}
+	return opts.StreamBatchInterval, size
+}
+
+// keepaliveForLocked returns the stream keepalive interval for a method path,
+// preferring per-method options over the transport default.
+// Must be called with t.mu held (read or write).
+func (t *DataChannelTransport) keepaliveForLocked(path string) time.Duration {
+	if opts, ok := t.methodOptions[path]; ok {
+		return opts.KeepaliveInterval
+	}
+	return t.options.KeepaliveInterval
+}
+
 // GetRegisteredMethods returns all registered method paths
 // This implements the HandlerRegistry interface for reflection support
 func (t *DataChannelTransport) GetRegisteredMethods() []string {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	methods := make([]string, 0, len(t.handlers)+len(t.streamingHandlers))
+	methods := make([]string, 0, len(t.handlers)+len(t.streamingHandlers)+len(t.clientHandlers))
+	// Avoid duplicates if same path registered for several kinds
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			methods = append(methods, path)
+		}
+	}
 	for path := range t.handlers {
-		methods = append(methods, path)
+		add(path)
 	}
 	for path := range t.streamingHandlers {
-		// Avoid duplicates if same path registered for both
-		found := false
-		for _, m := range methods {
-			if m == path {
-				found = true
-				break
-			}
+		add(path)
+	}
+	for path := range t.clientHandlers {
+		add(path)
+	}
+	for alias := range t.aliases {
+		if !t.hasHandlerLocked(alias) {
+			methods = append(methods, alias)
 		}
-		if !found {
-			methods = append(methods, path)
+	}
+	return methods
+}
+
+// SetPeerInfo attaches the identity of the remote peer to the transport.
+// Handlers can read it with PeerInfoFromContext. It applies to requests
+// received after the call; the info must not be modified afterwards.
+func (t *DataChannelTransport) SetPeerInfo(info PeerInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peerInfo = &info
+}
+
+// requestContext returns the base context for a request, carrying the
+// request ID and the transport's peer info
+func (t *DataChannelTransport) requestContext(requestID string) context.Context {
+	ctx := withRequestID(t.ctx, requestID)
+
+	t.mu.RLock()
+	info := t.peerInfo
+	t.mu.RUnlock()
+
+	if info != nil {
+		ctx = withPeerInfo(ctx, info)
+	}
+	return ctx
+}
+
+// MethodInfo describes a registered method
+type MethodInfo struct {
+	Path            string // Method path like "/package.Service/Method"
+	ServerStreaming bool   // Registered with a StreamingHandler
+	ClientStreaming bool   // Registered with a ClientStreamingHandler
+}
+
+// GetRegisteredMethodsDetailed returns all registered methods with their
+// streaming kind, sorted by path
+func (t *DataChannelTransport) GetRegisteredMethodsDetailed() []MethodInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	methods := make([]MethodInfo, 0, len(t.handlers)+len(t.streamingHandlers)+len(t.clientHandlers))
+	for path := range t.handlers {
+		// Streaming handlers take precedence when dispatching
+		if _, ok := t.streamingHandlers[path]; ok {
+			continue
+		}
+		if _, ok := t.clientHandlers[path]; ok {
+			continue
+		}
+		methods = append(methods, MethodInfo{Path: path})
+	}
+	for path := range t.streamingHandlers {
+		methods = append(methods, MethodInfo{Path: path, ServerStreaming: true})
+	}
+	for path := range t.clientHandlers {
+		if _, ok := t.streamingHandlers[path]; ok {
+			continue
+		}
+		methods = append(methods, MethodInfo{Path: path, ClientStreaming: true})
+	}
+	for alias, target := range t.aliases {
+		if t.hasHandlerLocked(alias) {
+			continue
 		}
+		_, streaming := t.streamingHandlers[target]
+		_, clientStreaming := t.clientHandlers[target]
+		methods = append(methods, MethodInfo{Path: alias, ServerStreaming: streaming, ClientStreaming: clientStreaming && !streaming})
 	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Path < methods[j].Path
+	})
 	return methods
 }
 
+// IsClosed reports whether the transport has been closed, by Close, the
+// DataChannel closing or the idle timeout. A closed transport cannot send,
+// so handlers can check it to skip expensive work; use OnClose to be
+// notified instead of polling.
+func (t *DataChannelTransport) IsClosed() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.closed
+}
+
 // OnClose sets a callback to be called when the transport is closed
 func (t *DataChannelTransport) OnClose(callback func()) {
 	t.mu.Lock()
@@ -180,9 +693,16 @@ func (t *DataChannelTransport) OnClose(callback func()) {
 }
 
 // Start begins listening for incoming requests.
-// This should be called after all handlers are registered.
+// Handlers registered before Start are available to the first request;
+// handlers may also be registered or unregistered afterwards.
 func (t *DataChannelTransport) Start() {
 	log.Printf("[Transport] Start() called, setting up OnMessage handler")
+	if t.options.IdleTimeout > 0 {
+		t.mu.Lock()
+		t.idleTimer = time.AfterFunc(t.options.IdleTimeout, t.handleIdleTimeout)
+		t.mu.Unlock()
+	}
+
 	t.dc.OnMessage(func(msg webrtc.DataChannelMessage) {
 		log.Printf("[Transport] Received message (%d bytes)", len(msg.Data))
 		t.handleMessage(msg.Data)
@@ -190,10 +710,19 @@ func (t *DataChannelTransport) Start() {
 
 	t.dc.OnClose(func() {
 		t.mu.Lock()
+		if t.closed {
+			// Already closed via Close(), which fired the callback
+			t.mu.Unlock()
+			return
+		}
 		t.closed = true
 		onClose := t.onClose
+		if t.idleTimer != nil {
+			t.idleTimer.Stop()
+		}
 		t.mu.Unlock()
 
+		t.cancel()
 		if onClose != nil {
 			onClose()
 		}
@@ -204,8 +733,86 @@ func (t *DataChannelTransport) Start() {
 	})
 }
 
+// HandleMessage processes a request message that was received outside the
+// transport's own OnMessage handler, e.g. one the peer buffered before Start
+// replaced the DataChannel's handler. Responses are sent on the DataChannel
+// as usual.
+func (t *DataChannelTransport) HandleMessage(data []byte) {
+	t.handleMessage(data)
+}
+
+// handleIdleTimeout closes the transport when the idle timer fires, unless
+// a stream or request is still in progress
+func (t *DataChannelTransport) handleIdleTimeout() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	// Unary handlers receive no messages while they run, so they are
+	// counted through t.active
+	if len(t.streams) > 0 || len(t.active) > 0 {
+		t.idleTimer.Reset(t.options.IdleTimeout)
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	log.Printf("[Transport] No messages for %v, closing idle transport", t.options.IdleTimeout)
+	if err := t.Close(); err != nil {
+		log.Printf("Failed to close idle transport: %v", err)
+	}
+}
+
 // handleMessage processes an incoming request message
 func (t *DataChannelTransport) handleMessage(data []byte) {
+	t.bytesReceived.Add(uint64(len(data)))
+
+	// Any message counts as activity
+	t.mu.RLock()
+	if t.idleTimer != nil {
+		t.idleTimer.Reset(t.options.IdleTimeout)
+	}
+	t.mu.RUnlock()
+
+	// Large payloads arrive in chunks; handle them once complete
+	if codec.IsChunk(data) {
+		payload, complete, err := t.chunks.Add(data)
+		if err != nil {
+			log.Printf("[Transport] Dropped chunked message: %v", err)
+			return
+		}
+		if !complete {
+			return
+		}
+		data = payload
+	}
+
+	// A goodbye from the client ends the session
+	if codec.IsGoodbye(data) {
+		if goodbye, err := codec.DecodeGoodbye(data); err == nil {
+			log.Printf("[Transport] Client said goodbye (code %d): %s", goodbye.Code, goodbye.Message)
+		}
+		if err := t.Close(); err != nil {
+			log.Printf("Failed to close transport: %v", err)
+		}
+		return
+	}
+
+	// Cancel messages stop an in-progress stream
+	if codec.IsCancelMessage(data) {
+		t.handleCancelMessage(data)
+		return
+	}
+
+	// Other stream messages are never requests, so they are not passed to
+	// DecodeRequest. Only marked payloads are checked: the legacy
+	// IsStreamMessage heuristic also matches unmarked request envelopes.
+	if payloadType, _ := codec.SplitPayload(data); payloadType == codec.PayloadTypeStream {
+		t.handleClientStreamMessage(data)
+		return
+	}
+
 	// Decode the request envelope
 	req, err := codec.DecodeRequest(data)
 	if err != nil {
@@ -220,189 +827,825 @@ func (t *DataChannelTransport) handleMessage(data []byte) {
 
 	// Look up handler (check streaming first, then unary)
 	t.mu.RLock()
-	streamingHandler, isStreaming := t.streamingHandlers[req.Path]
-	handler, ok := t.handlers[req.Path]
+	path := t.resolvePathLocked(req.Path)
+	streamingHandler, isStreaming := t.streamingHandlers[path]
+	clientHandler, isClientStreaming := t.clientHandlers[path]
+	isClientStreaming = isClientStreaming && !isStreaming
+	handler, ok := t.handlers[path]
+	timeout := t.timeoutForLocked(path)
+	keepalive := t.keepaliveForLocked(path)
+	batchInterval, batchSize := t.batchForLocked(path)
 	t.mu.RUnlock()
 
-	if !ok && !isStreaming {
+	// Every unary request gets an ID for tracing, even if the client omitted it.
+	// Streaming and client-streaming requests must bring their own, since
+	// the client needs it to correlate stream messages.
+	requestID := req.Headers["x-request-id"]
+	if requestID == "" && !isStreaming && !isClientStreaming {
+		requestID = t.generateRequestID()
+	}
+
+	if !ok && !isStreaming && !isClientStreaming {
 		log.Printf("[Transport] No handler registered for path: %s", req.Path)
 		// Send UNIMPLEMENTED error
 		errResp := codec.CreateErrorResponse(codec.StatusUnimplemented, fmt.Sprintf("Method %s is not implemented", req.Path))
-		// Echo x-request-id if present
-		if reqID, ok := req.Headers["x-request-id"]; ok {
-			errResp.Headers["x-request-id"] = reqID
-		}
+		errResp.Headers["x-request-id"] = requestID
 		if err := t.SendResponse(&errResp); err != nil {
 			log.Printf("Failed to send error response: %v", err)
 		}
 		return
 	}
 
-	// Create context with timeout
-	ctx := context.Background()
-	if t.options.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, t.options.Timeout)
-		defer cancel()
-	}
+	if t.options.Limiter != nil && !t.options.Limiter.Allow(req.Path) {
+		log.Printf("[Transport] Rate limit exceeded for path: %s", req.Path)
+		t.sendResourceExhausted(requestID, isStreaming, "Rate limit exceeded")
+		return
+	}
+
+	// Handle streaming RPC in its own goroutine so that cancel messages
+	// for it can still be received
+	if isStreaming {
+		if !t.acquireStream() {
+			log.Printf("[Transport] Too many concurrent streams, rejecting %s", req.Path)
+			t.sendResourceExhausted(requestID, isStreaming, "Too many concurrent streams")
+			return
+		}
+		// Register the stream before returning, so that a cancel message
+		// following the request finds it
+		start := time.Now()
+		ctx, cancel, status, sent := t.openStream(req, timeout)
+		if ctx == nil {
+			t.releaseStream()
+			t.logRequest(t.requestContext(requestID), req.Path, len(data), sent, status, start)
+			return
+		}
+		go func() {
+			defer t.releaseStream()
+			status, sent := t.handleStreamingRequest(ctx, cancel, req, streamingHandler, keepalive, batchInterval, batchSize)
+			t.logRequest(t.requestContext(requestID), req.Path, len(data), sent, status, start)
+		}()
+		return
+	}
+
+	// Create context with request ID, peer info, encoding and timeout
+	encoding := negotiateEncoding(req.Headers)
+	ctx := withEncoding(t.requestContext(requestID), encoding)
+
+	if isClientStreaming {
+		t.startClientStream(ctx, req, clientHandler, timeout)
+		return
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Call the unary handler
+	defer t.trackRequest(req.Path, requestID, false)()
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	status, sent := t.sendUnaryResult(ctx, req.Path, requestID, resp, err)
+	t.logRequest(ctx, req.Path, len(data), sent, status, start)
+}
+
+// logRequest records a handled request on HandlerOptions.Logger at debug
+// level. Only sizes are logged, never message contents.
+func (t *DataChannelTransport) logRequest(ctx context.Context, path string, requestBytes, responseBytes, status int, start time.Time) {
+	logger := t.options.Logger
+	if logger == nil || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "grpc-web request",
+		slog.String("path", path),
+		slog.String("request_id", RequestIDFromContext(ctx)),
+		slog.Int("request_bytes", requestBytes),
+		slog.Int("response_bytes", responseBytes),
+		slog.Int("grpc_status", status),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// sendUnaryResult sends the response or error returned by a unary or
+// client-streaming handler, after HandlerOptions.TrailerFunc. It returns
+// the grpc-status and the size of the response sent (0 if sending failed).
+func (t *DataChannelTransport) sendUnaryResult(ctx context.Context, path, requestID string, resp *codec.ResponseEnvelope, err error) (status, sent int) {
+	if err != nil {
+		log.Printf("Handler error for %s: %v", path, err)
+		// Convert error to gRPC error response
+		var errResp codec.ResponseEnvelope
+		var jsonErr *jsonError
+		if errors.As(err, &jsonErr) {
+			errResp = *jsonErrorResponse(jsonErr.GRPCError)
+			t.reportHandlerError(path, jsonErr.Code, err)
+		} else if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
+			errResp = codec.CreateErrorResponse(grpcErr.Code, grpcErr.Message)
+			t.reportHandlerError(path, grpcErr.Code, err)
+		} else {
+			errResp = codec.CreateErrorResponse(codec.StatusInternal, err.Error())
+			t.reportHandlerError(path, codec.StatusInternal, err)
+		}
+		errResp.Headers["x-request-id"] = requestID
+		t.applyTrailerFunc(ctx, &errResp)
+		sent, err := t.sendResponse(&errResp)
+		if err != nil {
+			log.Printf("Failed to send error response: %v", err)
+		}
+		return responseStatus(&errResp), sent
+	}
+
+	// Echo x-request-id from request to response, unless the handler set it
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	if _, set := resp.Headers["x-request-id"]; !set {
+		resp.Headers["x-request-id"] = requestID
+	}
+
+	// Ensure trailers have grpc-status if not set
+	if resp.Trailers == nil {
+		resp.Trailers = make(map[string]string)
+	}
+	if _, ok := resp.Trailers["grpc-status"]; !ok {
+		resp.Trailers["grpc-status"] = strconv.Itoa(codec.StatusOK)
+	}
+	t.applyTrailerFunc(ctx, resp)
+
+	// Compress if the client accepts gzip, unless the handler opted out
+	// by setting grpc-encoding to identity
+	if EncodingFromContext(ctx) == codec.EncodingGzip && resp.Headers["grpc-encoding"] != codec.EncodingIdentity {
+		resp.Headers["grpc-encoding"] = codec.EncodingGzip
+	}
+
+	// Send the response
+	sent, err = t.sendResponse(resp)
+	if err != nil {
+		log.Printf("Failed to send response: %v", err)
+	}
+	return responseStatus(resp), sent
+}
+
+// responseStatus returns the grpc-status of a response, from its trailers
+// or, for a trailers-only response, its headers
+func responseStatus(resp *codec.ResponseEnvelope) int {
+	status, ok := resp.Trailers["grpc-status"]
+	if !ok {
+		status = resp.Headers["grpc-status"]
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return codec.StatusUnknown
+	}
+	return code
+}
+
+// serverStream implements ServerStream interface for streaming responses
+type serverStream struct {
+	transport  *DataChannelTransport
+	requestID  string
+	ctx        context.Context
+	mu         sync.Mutex
+	headerSent bool
+	trailer    map[string]string
+	sequence   uint32
+	lastSent   time.Time
+	sent       int    // Messages sent, reported in the codec.StreamCountTrailer trailer
+	resume     string // Latest resume token, reported in the codec.ResumeTokenHeader trailer
+	bytes      int    // Size of the stream messages sent, for HandlerOptions.Logger
+
+	// Send batching (see HandlerOptions.StreamBatchInterval)
+	batchInterval time.Duration
+	batchSize     int
+	batch         []byte      // Encoded data frames not yet sent
+	batchCount    int         // Number of messages in batch
+	batchTimer    *time.Timer // Flushes batch when the interval expires
+	batchErr      error       // Error of a timer flush, returned by the next Send
+}
+
+// sendMessage numbers and sends a stream message, after any batched data.
+// The lock is held across the send so that messages go out in sequence order.
+func (s *serverStream) sendMessage(flag byte, frameBytes []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flushLocked(); err != nil {
+		return err
+	}
+	return s.sendMessageLocked(flag, frameBytes)
+}
+
+// sendMessageLocked numbers and sends a stream message.
+// Must be called with s.mu held.
+func (s *serverStream) sendMessageLocked(flag byte, frameBytes []byte) error {
+	streamMsg := codec.StreamMessage{
+		RequestID: s.requestID,
+		Flag:      flag,
+		Sequence:  s.sequence,
+		Data:      frameBytes,
+	}
+	s.sequence++
+	s.lastSent = time.Now()
+
+	data := codec.MarkPayload(codec.PayloadTypeStream, codec.EncodeStreamMessage(streamMsg))
+	if err := s.transport.send(data); err != nil {
+		return err
+	}
+	s.bytes += len(data)
+	return nil
+}
+
+// batchLocked adds a data frame to the batch, sending the batch once it
+// reaches the batch size and otherwise scheduling a flush.
+// Must be called with s.mu held.
+func (s *serverStream) batchLocked(frameBytes []byte) error {
+	if err := s.batchErr; err != nil {
+		return err
+	}
+
+	s.batch = append(s.batch, frameBytes...)
+	s.batchCount++
+	if len(s.batch) >= s.batchSize {
+		return s.flushLocked()
+	}
+	if s.batchTimer == nil {
+		s.batchTimer = time.AfterFunc(s.batchInterval, s.flushBatch)
+	}
+	return nil
+}
+
+// flushBatch sends the batch when the batch interval expires
+func (s *serverStream) flushBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flushLocked(); err != nil {
+		log.Printf("Failed to send batched stream messages: %v", err)
+		s.batchErr = err
+	}
+}
+
+// flushLocked sends the batched data frames, if any, as one data message.
+// Must be called with s.mu held.
+func (s *serverStream) flushLocked() error {
+	if s.batchTimer != nil {
+		s.batchTimer.Stop()
+		s.batchTimer = nil
+	}
+	if len(s.batch) == 0 {
+		return nil
+	}
+	frames, count := s.batch, s.batchCount
+	s.batch, s.batchCount = nil, 0
+	if err := s.sendMessageLocked(codec.StreamFlagData, frames); err != nil {
+		return err
+	}
+	s.sent += count
+	return nil
+}
+
+// startKeepalive sends a keepalive message whenever nothing has been sent for
+// interval. The returned function stops it and waits until no keepalive is
+// being sent, so the end message always comes last.
+func (s *serverStream) startKeepalive(interval time.Duration) func() {
+	s.mu.Lock()
+	s.lastSent = time.Now()
+	s.mu.Unlock()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			// Sent under the stream lock so it cannot interleave with Send
+			s.mu.Lock()
+			wait := interval - time.Since(s.lastSent)
+			if wait <= 0 {
+				// Keepalives do not advance the sequence
+				data := codec.EncodeStreamMessage(codec.StreamMessage{
+					RequestID: s.requestID,
+					Flag:      codec.StreamFlagKeepalive,
+					Sequence:  s.sequence,
+				})
+				payload := codec.MarkPayload(codec.PayloadTypeStream, data)
+				if err := s.transport.send(payload); err != nil {
+					log.Printf("Failed to send stream keepalive: %v", err)
+				} else {
+					s.bytes += len(payload)
+				}
+				s.lastSent = time.Now()
+				wait = interval
+			}
+			s.mu.Unlock()
+
+			timer.Reset(wait)
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+func (s *serverStream) Send(message []byte) error {
+	// Closing the transport also cancels the context; report it as a close
+	if s.transport.IsClosed() {
+		return ErrTransportClosed
+	}
+	// Nobody is listening once the client cancelled or the timeout expired
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Create a data frame for the message
+	dataFrame := codec.CreateDataFrame(message)
+	frameBytes := codec.EncodeFrame(dataFrame)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Headers can no longer be sent once data has been sent
+	s.headerSent = true
+
+	if s.batchInterval > 0 {
+		return s.batchLocked(frameBytes)
+	}
+	if err := s.sendMessageLocked(codec.StreamFlagData, frameBytes); err != nil {
+		return err
+	}
+	s.sent++
+	return nil
+}
+
+func (s *serverStream) SendHeader(md map[string]string) error {
+	s.mu.Lock()
+	if s.headerSent {
+		s.mu.Unlock()
+		return fmt.Errorf("headers already sent")
+	}
+	s.headerSent = true
+	s.mu.Unlock()
+
+	// Headers go in their own message, ahead of any data
+	data, err := codec.EncodeStreamHeaders(md)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+
+	return s.sendMessage(codec.StreamFlagHeader, data)
+}
+
+func (s *serverStream) SetTrailer(md map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trailer == nil {
+		s.trailer = make(map[string]string, len(md))
+	}
+	for k, v := range md {
+		s.trailer[k] = v
+	}
+}
+
+func (s *serverStream) SetResumeToken(token string) error {
+	if s.transport.IsClosed() {
+		return ErrTransportClosed
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The token covers the messages sent so far, including batched ones
+	if err := s.flushLocked(); err != nil {
+		return err
+	}
+	if err := s.sendMessageLocked(codec.StreamFlagResumeToken, []byte(token)); err != nil {
+		return err
+	}
+	s.resume = token
+	return nil
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// sendResourceExhausted answers a request denied by the limiter or the
+// stream limit with RESOURCE_EXHAUSTED, as a stream end message for
+// streaming requests
+func (t *DataChannelTransport) sendResourceExhausted(requestID string, isStreaming bool, message string) {
+	if isStreaming {
+		if requestID == "" {
+			requestID = codec.MissingRequestID
+		}
+		t.sendStreamError(requestID, codec.StatusResourceExhausted, message)
+		return
+	}
+
+	errResp := codec.CreateErrorResponse(codec.StatusResourceExhausted, message)
+	errResp.Headers["x-request-id"] = requestID
+	if err := t.SendResponse(&errResp); err != nil {
+		log.Printf("Failed to send error response: %v", err)
+	}
+}
+
+// sendStreamError ends the stream with the given request ID with an error
+// status, without any preceding messages
+func (t *DataChannelTransport) sendStreamError(requestID string, code int, message string) {
+	trailers := map[string]string{
+		"grpc-status":  strconv.Itoa(code),
+		"grpc-message": message,
+	}
+	stream := &serverStream{transport: t, requestID: requestID}
+	if err := stream.sendMessage(codec.StreamFlagEnd, codec.EncodeFrame(codec.CreateTrailerFrame(trailers))); err != nil {
+		log.Printf("Failed to send stream end message: %v", err)
+	}
+}
+
+// acquireStream reserves a slot for a streaming request, reporting false if
+// MaxConcurrentStreams streams are already running
+func (t *DataChannelTransport) acquireStream() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit := t.options.MaxConcurrentStreams; limit > 0 && t.activeStreams >= limit {
+		return false
+	}
+	t.activeStreams++
+	return true
+}
+
+// releaseStream frees the slot of a finished streaming request
+func (t *DataChannelTransport) releaseStream() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.activeStreams--
+}
+
+// handleCancelMessage cancels the context of the stream named in a cancel message
+func (t *DataChannelTransport) handleCancelMessage(data []byte) {
+	msg, err := codec.DecodeStreamMessage(data)
+	if err != nil {
+		log.Printf("[Transport] Failed to decode cancel message: %v", err)
+		return
+	}
+
+	t.mu.RLock()
+	cancel, ok := t.streams[msg.RequestID]
+	t.mu.RUnlock()
 
-	// Handle streaming RPC
-	if isStreaming {
-		t.handleStreamingRequest(ctx, req, streamingHandler)
+	if !ok {
+		log.Printf("[Transport] Cancel for unknown stream: %s", msg.RequestID)
 		return
 	}
 
-	// Call the unary handler
-	resp, err := handler(ctx, req)
+	log.Printf("[Transport] Stream cancelled by client: %s", msg.RequestID)
+	cancel()
+}
+
+// handleClientStreamMessage handles a stream message other than a cancel.
+// Messages for a client-streaming call are delivered to its handler.
+// Server-streaming calls take no messages after the request, so those are
+// dropped with a warning; a data or end message for a request ID with no
+// active stream is also answered with a NOT_FOUND end message, so a client
+// waiting on that ID fails instead of hanging. Undecodable messages have no
+// request ID to answer and are only logged.
+func (t *DataChannelTransport) handleClientStreamMessage(data []byte) {
+	msg, err := codec.DecodeStreamMessage(data)
 	if err != nil {
-		log.Printf("Handler error for %s: %v", req.Path, err)
-		// Convert error to gRPC error response
-		var errResp codec.ResponseEnvelope
-		if grpcErr, ok := err.(*codec.GRPCError); ok {
-			errResp = codec.CreateErrorResponse(grpcErr.Code, grpcErr.Message)
-		} else {
-			errResp = codec.CreateErrorResponse(codec.StatusInternal, err.Error())
-		}
-		// Echo x-request-id if present
-		if reqID, ok := req.Headers["x-request-id"]; ok {
-			errResp.Headers["x-request-id"] = reqID
-		}
-		if err := t.SendResponse(&errResp); err != nil {
-			log.Printf("Failed to send error response: %v", err)
-		}
+		log.Printf("[Transport] Dropped undecodable stream message: %v", err)
 		return
 	}
 
-	// Echo x-request-id from request to response
-	if reqID, ok := req.Headers["x-request-id"]; ok {
-		if resp.Headers == nil {
-			resp.Headers = make(map[string]string)
-		}
-		resp.Headers["x-request-id"] = reqID
-	}
+	t.mu.RLock()
+	clientStream := t.clientStreams[msg.RequestID]
+	_, active := t.streams[msg.RequestID]
+	t.mu.RUnlock()
 
-	// Ensure trailers have grpc-status if not set
-	if resp.Trailers == nil {
-		resp.Trailers = make(map[string]string)
+	if clientStream != nil {
+		clientStream.deliver(msg)
+		return
 	}
-	if _, ok := resp.Trailers["grpc-status"]; !ok {
-		resp.Trailers["grpc-status"] = strconv.Itoa(codec.StatusOK)
+	if active {
+		log.Printf("[Transport] Dropped stream message (flag %d) from client for stream %s", msg.Flag, msg.RequestID)
+		return
 	}
 
-	// Send the response
-	if err := t.SendResponse(resp); err != nil {
-		log.Printf("Failed to send response: %v", err)
+	log.Printf("[Transport] Stream message (flag %d) for unknown stream: %s", msg.Flag, msg.RequestID)
+	if msg.Flag == codec.StreamFlagData || msg.Flag == codec.StreamFlagEnd {
+		t.sendStreamError(msg.RequestID, codec.StatusNotFound, fmt.Sprintf("No active stream %s", msg.RequestID))
 	}
 }
 
-// serverStream implements ServerStream interface for streaming responses
-type serverStream struct {
-	transport *DataChannelTransport
-	requestID string
-	ctx       context.Context
-}
-
-func (s *serverStream) Send(message []byte) error {
-	// Create a data frame for the message
-	dataFrame := codec.CreateDataFrame(message)
-	frameBytes := codec.EncodeFrame(dataFrame)
-
-	// Create stream message
-	streamMsg := codec.StreamMessage{
-		RequestID: s.requestID,
-		Flag:      codec.StreamFlagData,
-		Data:      frameBytes,
+// registerStream records the cancel function of the stream with requestID,
+// and for client-streaming calls the receiver of its messages, so that
+// stream messages from the client reach it. It reports false if a stream
+// with that ID is already active.
+func (t *DataChannelTransport) registerStream(requestID string, cancel context.CancelFunc, receiver *clientStreamReceiver) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.streams[requestID]; ok {
+		return false
 	}
-
-	// Encode and send
-	data := codec.EncodeStreamMessage(streamMsg)
-	return s.transport.dc.Send(data)
+	t.streams[requestID] = cancel
+	if receiver != nil {
+		t.clientStreams[requestID] = receiver
+	}
+	return true
 }
 
-func (s *serverStream) Context() context.Context {
-	return s.ctx
+// unregisterStream removes a stream added by registerStream
+func (t *DataChannelTransport) unregisterStream(requestID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streams, requestID)
+	delete(t.clientStreams, requestID)
 }
 
-// handleStreamingRequest handles a streaming RPC request
-func (t *DataChannelTransport) handleStreamingRequest(ctx context.Context, req *codec.RequestEnvelope, handler StreamingHandler) {
+// openStream validates the request ID of a streaming request and registers
+// the stream with a cancellable context. If the request is rejected, it
+// sends the error and returns a nil context with the grpc-status and the
+// size of the response sent. Otherwise the stream must be ended with
+// handleStreamingRequest.
+func (t *DataChannelTransport) openStream(req *codec.RequestEnvelope, timeout time.Duration) (ctx context.Context, cancel context.CancelFunc, status, sent int) {
 	requestID := req.Headers["x-request-id"]
 	if requestID == "" {
 		log.Printf("[Transport] Streaming request missing x-request-id")
-		errResp := codec.CreateErrorResponse(codec.StatusInvalidArgument, "Missing x-request-id header")
-		if err := t.SendResponse(&errResp); err != nil {
+		t.sendStreamError(codec.MissingRequestID, codec.StatusInvalidArgument, "Missing x-request-id header")
+		return nil, nil, codec.StatusInvalidArgument, 0
+	}
+	if len(requestID) > codec.MaxStreamRequestIDLength {
+		// Stream messages with a longer ID would be rejected by the client
+		log.Printf("[Transport] Streaming request x-request-id too long (%d bytes)", len(requestID))
+		errResp := codec.CreateErrorResponse(codec.StatusInvalidArgument,
+			fmt.Sprintf("x-request-id too long for streaming (max %d bytes)", codec.MaxStreamRequestIDLength))
+		errResp.Headers["x-request-id"] = requestID
+		sent, err := t.sendResponse(&errResp)
+		if err != nil {
 			log.Printf("Failed to send error response: %v", err)
 		}
-		return
+		return nil, nil, codec.StatusInvalidArgument, sent
+	}
+
+	// Create a cancellable context so the client can stop the stream
+	ctx, cancel = context.WithCancel(t.requestContext(requestID))
+	if token := req.Headers[codec.ResumeTokenHeader]; token != "" {
+		ctx = withResumeToken(ctx, token)
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		stop := cancel
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
 	}
 
+	if !t.registerStream(requestID, cancel, nil) {
+		cancel()
+		log.Printf("[Transport] Streaming request reuses active x-request-id %s", requestID)
+		t.sendStreamError(requestID, codec.StatusAlreadyExists, fmt.Sprintf("Stream %s is already active", requestID))
+		return nil, nil, codec.StatusAlreadyExists, 0
+	}
+	return ctx, cancel, codec.StatusOK, 0
+}
+
+// handleStreamingRequest runs the handler of a stream opened by openStream,
+// then ends and unregisters the stream. It returns the grpc-status the
+// stream ended with and the size of the messages sent.
+func (t *DataChannelTransport) handleStreamingRequest(ctx context.Context, cancel context.CancelFunc, req *codec.RequestEnvelope, handler StreamingHandler, keepalive, batchInterval time.Duration, batchSize int) (status, sent int) {
+	requestID := req.Headers["x-request-id"]
+	defer cancel()
+	defer t.unregisterStream(requestID)
+
+	defer t.trackRequest(req.Path, requestID, true)()
+
 	// Create stream
 	stream := &serverStream{
-		transport: t,
-		requestID: requestID,
-		ctx:       ctx,
+		transport:     t,
+		requestID:     requestID,
+		ctx:           ctx,
+		batchInterval: batchInterval,
+		batchSize:     batchSize,
+	}
+
+	// Keep the stream alive while the handler has nothing to send
+	var stopKeepalive func()
+	if keepalive > 0 {
+		stopKeepalive = stream.startKeepalive(keepalive)
 	}
 
 	// Call the streaming handler
 	err := handler(req, stream)
 
-	// Send end message with trailers
-	var trailers map[string]string
+	if stopKeepalive != nil {
+		stopKeepalive()
+	}
+
+	// Send end message with trailers, starting from the handler's custom trailers
+	trailers := make(map[string]string)
+	stream.mu.Lock()
+	// Send batched messages first so that the count includes them
+	if err := stream.flushLocked(); err != nil {
+		log.Printf("Failed to send batched stream messages: %v", err)
+	}
+	for k, v := range stream.trailer {
+		trailers[k] = v
+	}
+	trailers[codec.StreamCountTrailer] = strconv.Itoa(stream.sent)
+	if stream.resume != "" {
+		trailers[codec.ResumeTokenHeader] = stream.resume
+	}
+	stream.mu.Unlock()
+
+	delete(trailers, "grpc-message")
 	if err != nil {
 		log.Printf("Streaming handler error for %s: %v", req.Path, err)
-		if grpcErr, ok := err.(*codec.GRPCError); ok {
-			trailers = map[string]string{
-				"grpc-status":  strconv.Itoa(grpcErr.Code),
-				"grpc-message": grpcErr.Message,
-			}
+		if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
+			trailers["grpc-status"] = strconv.Itoa(grpcErr.Code)
+			trailers["grpc-message"] = grpcErr.Message
+			t.reportHandlerError(req.Path, grpcErr.Code, err)
 		} else {
-			trailers = map[string]string{
-				"grpc-status":  strconv.Itoa(codec.StatusInternal),
-				"grpc-message": err.Error(),
-			}
+			trailers["grpc-status"] = strconv.Itoa(codec.StatusInternal)
+			trailers["grpc-message"] = err.Error()
+			t.reportHandlerError(req.Path, codec.StatusInternal, err)
 		}
 	} else {
-		trailers = map[string]string{
-			"grpc-status": strconv.Itoa(codec.StatusOK),
-		}
+		trailers["grpc-status"] = strconv.Itoa(codec.StatusOK)
 	}
 
 	// Create trailer frame
 	trailerFrame := codec.CreateTrailerFrame(trailers)
 	trailerBytes := codec.EncodeFrame(trailerFrame)
 
-	// Send end message
-	endMsg := codec.StreamMessage{
-		RequestID: requestID,
-		Flag:      codec.StreamFlagEnd,
-		Data:      trailerBytes,
+	// Send end message; its sequence tells the client how many messages preceded it
+	if err := stream.sendMessage(codec.StreamFlagEnd, trailerBytes); err != nil {
+		log.Printf("Failed to send stream end message: %v", err)
 	}
 
-	endData := codec.EncodeStreamMessage(endMsg)
-	if err := t.dc.Send(endData); err != nil {
-		log.Printf("Failed to send stream end message: %v", err)
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	status, _ = strconv.Atoi(trailers["grpc-status"])
+	return status, stream.bytes
+}
+
+// applyTrailerFunc passes a unary response about to be sent to
+// HandlerOptions.TrailerFunc
+func (t *DataChannelTransport) applyTrailerFunc(ctx context.Context, resp *codec.ResponseEnvelope) {
+	if t.options.TrailerFunc == nil {
+		return
+	}
+	if resp.Trailers == nil {
+		resp.Trailers = make(map[string]string)
+	}
+	t.options.TrailerFunc(ctx, resp)
+}
+
+// reportHandlerError passes a handler error to HandlerOptions.OnHandlerError
+func (t *DataChannelTransport) reportHandlerError(path string, code int, err error) {
+	if t.options.OnHandlerError != nil {
+		t.options.OnHandlerError(path, code, err)
 	}
 }
 
-// SendResponse sends a response (used internally or for async responses)
+// SendResponse sends a response (used internally or for async responses).
+// If the envelope's grpc-encoding header is gzip, its messages are sent
+// compressed.
 func (t *DataChannelTransport) SendResponse(envelope *codec.ResponseEnvelope) error {
+	_, err := t.sendResponse(envelope)
+	return err
+}
+
+// sendResponse is SendResponse, also returning the size of the payload sent
+func (t *DataChannelTransport) sendResponse(envelope *codec.ResponseEnvelope) (int, error) {
 	t.mu.RLock()
-	if t.closed {
-		t.mu.RUnlock()
-		return fmt.Errorf("transport is closed")
-	}
+	closed := t.closed
 	t.mu.RUnlock()
+	if closed {
+		return 0, ErrTransportClosed
+	}
 
 	// Encode the response
-	data, err := codec.EncodeResponse(*envelope)
+	var compression string
+	if envelope.Headers["grpc-encoding"] == codec.EncodingGzip {
+		compression = codec.EncodingGzip
+	}
+	data, err := codec.EncodeResponseWithOptions(*envelope, codec.EncodeOptions{
+		TrailersOnly: t.options.TrailersOnly,
+		Compression:  compression,
+		JSONTrailers: t.options.JSONTrailers,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to encode response: %w", err)
+		return 0, fmt.Errorf("failed to encode response: %w", err)
 	}
 
 	// Send over DataChannel
-	return t.dc.Send(data)
+	payload := codec.MarkPayload(codec.PayloadTypeEnvelope, data)
+	if err := t.send(payload); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// send sends a marked payload on the DataChannel, split into chunks if it
+// is larger than the configured chunk size. It returns ErrTransportClosed or
+// ErrSendFailed if the payload cannot be sent.
+func (t *DataChannelTransport) send(payload []byte) error {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return ErrTransportClosed
+	}
+
+	if t.options.ChunkSize <= 0 || len(payload) <= t.options.ChunkSize {
+		return t.write(payload)
+	}
+
+	for _, chunk := range codec.EncodeChunks(t.nextChunkID.Add(1), payload, t.options.ChunkSize) {
+		if err := t.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write sends one message on the DataChannel, wrapping failures in ErrSendFailed
+func (t *DataChannelTransport) write(data []byte) error {
+	if err := t.dc.Send(data); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	t.bytesSent.Add(uint64(len(data)))
+	return nil
+}
+
+// BytesSent returns the number of bytes the transport has sent on the
+// DataChannel: responses, stream messages and chunk headers. Failed sends
+// are not counted.
+func (t *DataChannelTransport) BytesSent() uint64 {
+	return t.bytesSent.Load()
+}
+
+// BytesReceived returns the number of bytes the transport has received from
+// the DataChannel, including messages it dropped as invalid
+func (t *DataChannelTransport) BytesReceived() uint64 {
+	return t.bytesReceived.Load()
+}
+
+// RequestInfo describes a request being handled
+type RequestInfo struct {
+	Path      string    // Method path as requested, before alias resolution
+	RequestID string    // The request's x-request-id
+	Streaming bool      // Server- or client-streaming call
+	Started   time.Time // When the handler was called
+}
+
+// ActiveRequests returns the requests whose handlers are running, oldest
+// first, e.g. for a debug endpoint showing live RPCs
+func (t *DataChannelTransport) ActiveRequests() []RequestInfo {
+	t.mu.RLock()
+	requests := make([]RequestInfo, 0, len(t.active))
+	for info := range t.active {
+		requests = append(requests, *info)
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Started.Before(requests[j].Started)
+	})
+	return requests
+}
+
+// trackRequest adds a request to ActiveRequests until the returned function
+// is called
+func (t *DataChannelTransport) trackRequest(path, requestID string, streaming bool) func() {
+	info := &RequestInfo{Path: path, RequestID: requestID, Streaming: streaming, Started: time.Now()}
+	t.mu.Lock()
+	t.active[info] = struct{}{}
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		delete(t.active, info)
+		t.mu.Unlock()
+	}
 }
 
-// Close closes the transport and data channel
+// Close closes the transport and data channel and cancels the contexts of
+// requests still being handled
 func (t *DataChannelTransport) Close() error {
 	t.mu.Lock()
 	if t.closed {
@@ -411,8 +1654,13 @@ func (t *DataChannelTransport) Close() error {
 	}
 	t.closed = true
 	onClose := t.onClose
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+	}
 	t.mu.Unlock()
 
+	// Handlers still running observe the close through their contexts
+	t.cancel()
 	if onClose != nil {
 		onClose()
 	}
@@ -420,6 +1668,25 @@ func (t *DataChannelTransport) Close() error {
 	return t.dc.Close()
 }
 
+// SendGoodbye tells the client why the session is ending, then closes the
+// transport like Close. Use it when a handler decides to end the session,
+// e.g. because a quota was exceeded or the authorization was revoked, so
+// that the client sees code and message instead of an unexplained
+// disconnect. Using a gRPC status code as code lets clients report it like
+// a failed call. The transport is closed even if sending fails; it returns
+// ErrTransportClosed if the transport was already closed.
+func (t *DataChannelTransport) SendGoodbye(code int, message string) error {
+	if t.IsClosed() {
+		return ErrTransportClosed
+	}
+
+	sendErr := t.send(codec.EncodeGoodbye(code, message))
+	if err := t.Close(); err != nil && sendErr == nil {
+		return err
+	}
+	return sendErr
+}
+
 // MakeHandler creates a Handler from typed serialization functions.
 //
 // This helper makes it easier to create handlers with typed request/response
@@ -445,6 +1712,78 @@ func MakeHandler[Req, Resp any](
 	deserialize func([]byte) (Req, error),
 	serialize func(Resp) ([]byte, error),
 	handle func(ctx context.Context, req Req) (Resp, error),
+) Handler {
+	return MakeHandlerWithMetadata(deserialize, serialize, func(ctx context.Context, req Req) (Resp, map[string]string, map[string]string, error) {
+		resp, err := handle(ctx, req)
+		return resp, nil, nil, err
+	})
+}
+
+// MakeValidatedHandler is MakeHandler with a validate function run on each
+// deserialized request before handle. A validation error is sent as
+// INVALID_ARGUMENT, unless it is a *codec.GRPCError or a grpc status error,
+// whose code is kept; handle is not called.
+//
+// Example:
+//
+//	handler := MakeValidatedHandler(
+//	    deserializeRequest,
+//	    serializeResponse,
+//	    func(req *pb.PrintRequest) error {
+//	        if req.Copies <= 0 {
+//	            return errors.New("copies must be positive")
+//	        }
+//	        return nil
+//	    },
+//	    handlePrint,
+//	)
+func MakeValidatedHandler[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	validate func(Req) error,
+	handle func(ctx context.Context, req Req) (Resp, error),
+) Handler {
+	return MakeHandler(deserialize, serialize, func(ctx context.Context, req Req) (Resp, error) {
+		if err := validate(req); err != nil {
+			var zero Resp
+			if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
+				return zero, grpcErr
+			}
+			return zero, &codec.GRPCError{
+				Code:    codec.StatusInvalidArgument,
+				Message: err.Error(),
+			}
+		}
+		return handle(ctx, req)
+	})
+}
+
+// MakeHandlerWithMetadata creates a Handler from typed serialization functions
+// whose business function can also return response headers and trailers.
+//
+// Precedence when building the response:
+//   - Headers and trailers returned by handle are used as-is; handler values win.
+//   - The transport echoes x-request-id into the headers only if handle did not set it.
+//   - grpc-status is filled in as OK only if handle did not set it.
+//
+// If handle returns an error, the returned metadata is discarded and an
+// error response is sent as with MakeHandler.
+//
+// Example:
+//
+//	handler := MakeHandlerWithMetadata(
+//	    deserializeRequest,
+//	    serializeResponse,
+//	    func(ctx context.Context, req *pb.Request) (*pb.Response, map[string]string, map[string]string, error) {
+//	        headers := map[string]string{"x-cache": "hit"}
+//	        trailers := map[string]string{"x-items": "3"}
+//	        return &pb.Response{...}, headers, trailers, nil
+//	    },
+//	)
+func MakeHandlerWithMetadata[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	handle func(ctx context.Context, req Req) (Resp, map[string]string, map[string]string, error),
 ) Handler {
 	return func(ctx context.Context, reqEnv *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 		// Deserialize request
@@ -457,10 +1796,10 @@ func MakeHandler[Req, Resp any](
 		}
 
 		// Call handler
-		resp, err := handle(ctx, req)
+		resp, headers, trailers, err := handle(ctx, req)
 		if err != nil {
-			// If it's already a GRPCError, return it
-			if grpcErr, ok := err.(*codec.GRPCError); ok {
+			// If it's already a GRPCError or a grpc status error, return it
+			if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
 				return nil, grpcErr
 			}
 			// Otherwise, wrap it as INTERNAL error
@@ -479,17 +1818,182 @@ func MakeHandler[Req, Resp any](
 			}
 		}
 
+		// Handler metadata wins; fill in grpc-status only if absent
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		if trailers == nil {
+			trailers = make(map[string]string)
+		}
+		if _, ok := trailers["grpc-status"]; !ok {
+			trailers["grpc-status"] = strconv.Itoa(codec.StatusOK)
+		}
+
 		// Create response envelope
 		return &codec.ResponseEnvelope{
-			Headers:  make(map[string]string),
+			Headers:  headers,
 			Messages: [][]byte{respData},
-			Trailers: map[string]string{
-				"grpc-status": strconv.Itoa(codec.StatusOK),
-			},
+			Trailers: trailers,
 		}, nil
 	}
 }
 
+// MakeJSONHandler creates a Handler for a JSON service, using encoding/json
+// to deserialize requests and serialize responses.
+//
+// An empty request message decodes to the zero value of Req. Responses
+// carry content-type: application/grpc-web+json. The Handler returns errors
+// as a *codec.GRPCError (reported to HandlerOptions.OnHandlerError like any
+// handler error), which the transport sends as a JSON body of the form
+// {"error": "..."} alongside the usual grpc-status and grpc-message
+// trailers, so the body is valid JSON in every case.
+//
+// Example:
+//
+//	handler := MakeJSONHandler(func(ctx context.Context, req EchoRequest) (EchoResponse, error) {
+//	    return EchoResponse{Message: req.Message}, nil
+//	})
+func MakeJSONHandler[Req, Resp any](handle func(ctx context.Context, req Req) (Resp, error)) Handler {
+	handler := MakeHandler(
+		func(data []byte) (Req, error) {
+			var req Req
+			if len(data) == 0 {
+				return req, nil
+			}
+			err := json.Unmarshal(data, &req)
+			return req, err
+		},
+		func(resp Resp) ([]byte, error) {
+			return json.Marshal(resp)
+		},
+		handle,
+	)
+
+	return func(ctx context.Context, reqEnv *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		resp, err := handler(ctx, reqEnv)
+		if err != nil {
+			// MakeHandler always returns a GRPCError
+			grpcErr, ok := err.(*codec.GRPCError)
+			if !ok {
+				grpcErr = &codec.GRPCError{Code: codec.StatusInternal, Message: err.Error()}
+			}
+			return nil, &jsonError{grpcErr}
+		}
+
+		resp.Headers["content-type"] = codec.ContentTypeJSON
+		return resp, nil
+	}
+}
+
+// jsonError is an error returned by a MakeJSONHandler handler. The
+// transport reports it like any handler error and answers it with
+// jsonErrorResponse.
+type jsonError struct {
+	*codec.GRPCError
+}
+
+// Unwrap returns the gRPC error
+func (e *jsonError) Unwrap() error {
+	return e.GRPCError
+}
+
+// jsonErrorResponse creates an error response with a JSON error body
+func jsonErrorResponse(grpcErr *codec.GRPCError) *codec.ResponseEnvelope {
+	body, err := json.Marshal(map[string]string{"error": grpcErr.Message})
+	if err != nil {
+		body = []byte(`{"error":"internal error"}`)
+	}
+
+	return &codec.ResponseEnvelope{
+		Headers:  map[string]string{"content-type": codec.ContentTypeJSON},
+		Messages: [][]byte{body},
+		Trailers: map[string]string{
+			"grpc-status":  strconv.Itoa(grpcErr.Code),
+			"grpc-message": grpcErr.Message,
+		},
+	}
+}
+
+// ResponseWriter collects the response of a handler created with
+// MakeWriterHandler. It is not safe for concurrent use.
+type ResponseWriter interface {
+	// WriteMessage appends a response message. It may be called zero or
+	// more times; messages are sent in order once the handler returns.
+	WriteMessage(msg []byte)
+	// SetHeader merges md into the response headers
+	SetHeader(md map[string]string)
+	// SetTrailer merges md into the response trailers. grpc-status is
+	// filled in with OK if the handler does not set it.
+	SetTrailer(md map[string]string)
+}
+
+// responseWriter buffers a response envelope for MakeWriterHandler
+type responseWriter struct {
+	env codec.ResponseEnvelope
+}
+
+func (w *responseWriter) WriteMessage(msg []byte) {
+	w.env.Messages = append(w.env.Messages, msg)
+}
+
+func (w *responseWriter) SetHeader(md map[string]string) {
+	for k, v := range md {
+		w.env.Headers[k] = v
+	}
+}
+
+func (w *responseWriter) SetTrailer(md map[string]string) {
+	for k, v := range md {
+		w.env.Trailers[k] = v
+	}
+}
+
+// MakeWriterHandler creates a Handler whose business function writes its
+// response through a ResponseWriter. The function decides at runtime how
+// many messages to return; they are buffered and sent as one unary response
+// when it returns, so this suits methods that compute all results up front.
+// Use a StreamingHandler to send messages as they are produced.
+//
+// If the function returns an error, the buffered response is discarded and
+// the error is returned as from MakeHandler.
+//
+// Example:
+//
+//	handler := MakeWriterHandler(func(ctx context.Context, req *codec.RequestEnvelope, w ResponseWriter) error {
+//	    for _, item := range lookup(req.Message) {
+//	        w.WriteMessage(item)
+//	    }
+//	    return nil
+//	})
+func MakeWriterHandler(handle func(ctx context.Context, req *codec.RequestEnvelope, w ResponseWriter) error) Handler {
+	return func(ctx context.Context, reqEnv *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		w := &responseWriter{
+			env: codec.ResponseEnvelope{
+				Headers:  make(map[string]string),
+				Trailers: make(map[string]string),
+			},
+		}
+
+		if err := handle(ctx, reqEnv, w); err != nil {
+			// If it's already a GRPCError or a grpc status error, return it
+			if grpcErr, ok := codec.GRPCErrorFrom(err); ok {
+				return nil, grpcErr
+			}
+			// Otherwise, wrap it as INTERNAL error
+			return nil, &codec.GRPCError{
+				Code:    codec.StatusInternal,
+				Message: err.Error(),
+			}
+		}
+
+		if _, ok := w.env.Trailers["grpc-status"]; !ok {
+			w.env.Trailers["grpc-status"] = strconv.Itoa(codec.StatusOK)
+		}
+
+		return &w.env, nil
+	}
+}
+
 // TypedServerStream provides a typed wrapper for ServerStream
 type TypedServerStream[Resp any] struct {
 	stream    ServerStream
@@ -508,6 +2012,21 @@ func (s *TypedServerStream[Resp]) Send(msg Resp) error {
 	return s.stream.Send(data)
 }
 
+// SendHeader sends response headers to the client before the first message
+func (s *TypedServerStream[Resp]) SendHeader(md map[string]string) error {
+	return s.stream.SendHeader(md)
+}
+
+// SetTrailer sets custom trailers to be sent with the end of the stream
+func (s *TypedServerStream[Resp]) SetTrailer(md map[string]string) {
+	s.stream.SetTrailer(md)
+}
+
+// SetResumeToken sends a token the client can resume the stream from
+func (s *TypedServerStream[Resp]) SetResumeToken(token string) error {
+	return s.stream.SetResumeToken(token)
+}
+
 // Context returns the request context
 func (s *TypedServerStream[Resp]) Context() context.Context {
 	return s.stream.Context()
@@ -539,6 +2058,36 @@ func MakeStreamingHandler[Req, Resp any](
 	deserialize func([]byte) (Req, error),
 	serialize func(Resp) ([]byte, error),
 	handle func(req Req, stream *TypedServerStream[Resp]) error,
+) StreamingHandler {
+	return MakeStreamingHandlerWithContext(deserialize, serialize, func(ctx context.Context, req Req, stream *TypedServerStream[Resp]) error {
+		return handle(req, stream)
+	})
+}
+
+// MakeStreamingHandlerWithContext is like MakeStreamingHandler, but the
+// business function also receives the stream's context, as with MakeHandler.
+// The context is done when the client cancels the stream or the timeout expires.
+//
+// Example:
+//
+//	handler := MakeStreamingHandlerWithContext(deserialize, serialize,
+//	    func(ctx context.Context, req *pb.Request, stream *TypedServerStream[*pb.Response]) error {
+//	        for {
+//	            select {
+//	            case <-ctx.Done():
+//	                return ctx.Err()
+//	            case event := <-events:
+//	                if err := stream.Send(event); err != nil {
+//	                    return err
+//	                }
+//	            }
+//	        }
+//	    },
+//	)
+func MakeStreamingHandlerWithContext[Req, Resp any](
+	deserialize func([]byte) (Req, error),
+	serialize func(Resp) ([]byte, error),
+	handle func(ctx context.Context, req Req, stream *TypedServerStream[Resp]) error,
 ) StreamingHandler {
 	return func(reqEnv *codec.RequestEnvelope, stream ServerStream) error {
 		// Deserialize request
@@ -557,6 +2106,6 @@ func MakeStreamingHandler[Req, Resp any](
 		}
 
 		// Call handler
-		return handle(req, typedStream)
+		return handle(stream.Context(), req, typedStream)
 	}
 }
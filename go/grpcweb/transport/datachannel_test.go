@@ -1,8 +1,19 @@
 package transport
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,11 +23,14 @@ import (
 
 // mockDataChannel is a mock implementation of DataChannelInterface for testing
 type mockDataChannel struct {
+	mu           sync.Mutex
 	onMessage    func(msg webrtc.DataChannelMessage)
 	onClose      func()
 	onError      func(err error)
 	sentMessages [][]byte
 	closed       bool
+	// sendErr, if set, is returned by Send
+	sendErr error
 }
 
 func newMockDataChannel() *mockDataChannel {
@@ -26,12 +40,26 @@ func newMockDataChannel() *mockDataChannel {
 }
 
 func (m *mockDataChannel) Send(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sendErr != nil {
+		return m.sendErr
+	}
 	m.sentMessages = append(m.sentMessages, data)
 	return nil
 }
 
+// sent returns a snapshot of the messages sent so far
+func (m *mockDataChannel) sent() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]byte(nil), m.sentMessages...)
+}
+
 func (m *mockDataChannel) Close() error {
+	m.mu.Lock()
 	m.closed = true
+	m.mu.Unlock()
 	if m.onClose != nil {
 		m.onClose()
 	}
@@ -58,7 +86,7 @@ func (m *mockDataChannel) simulateMessage(data []byte) {
 
 func TestNewDataChannelTransport(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	if transport == nil {
 		t.Fatal("Expected non-nil transport")
@@ -75,7 +103,7 @@ func TestNewDataChannelTransport(t *testing.T) {
 
 func TestRegisterHandler(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	handler := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 		return &codec.ResponseEnvelope{}, nil
@@ -90,7 +118,7 @@ func TestRegisterHandler(t *testing.T) {
 
 func TestUnregisterHandler(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	handler := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
 		return &codec.ResponseEnvelope{}, nil
@@ -198,9 +226,74 @@ func TestMakeHandlerError(t *testing.T) {
 	}
 }
 
+func TestMakeValidatedHandler(t *testing.T) {
+	type TestRequest struct{ Name string }
+	type TestResponse struct{ Greeting string }
+
+	called := false
+	handler := MakeValidatedHandler(
+		func(data []byte) (*TestRequest, error) {
+			return &TestRequest{Name: string(data)}, nil
+		},
+		func(resp *TestResponse) ([]byte, error) {
+			return []byte(resp.Greeting), nil
+		},
+		func(req *TestRequest) error {
+			switch req.Name {
+			case "":
+				return errors.New("name is required")
+			case "root":
+				return &codec.GRPCError{Code: codec.StatusPermissionDenied, Message: "reserved name"}
+			}
+			return nil
+		},
+		func(ctx context.Context, req *TestRequest) (*TestResponse, error) {
+			called = true
+			return &TestResponse{Greeting: "hello " + req.Name}, nil
+		},
+	)
+
+	call := func(message string) (*codec.ResponseEnvelope, error) {
+		return handler(context.Background(), &codec.RequestEnvelope{
+			Path:    "/test.Service/Method",
+			Headers: map[string]string{},
+			Message: []byte(message),
+		})
+	}
+
+	_, err := call("")
+	grpcErr, ok := err.(*codec.GRPCError)
+	if !ok {
+		t.Fatalf("Expected GRPCError, got %T", err)
+	}
+	if grpcErr.Code != codec.StatusInvalidArgument || grpcErr.Message != "name is required" {
+		t.Errorf("Expected INVALID_ARGUMENT 'name is required', got %v", grpcErr)
+	}
+	if called {
+		t.Error("Handler was called for an invalid request")
+	}
+
+	// A GRPCError from the validator keeps its code
+	_, err = call("root")
+	if grpcErr, ok := err.(*codec.GRPCError); !ok || grpcErr.Code != codec.StatusPermissionDenied {
+		t.Errorf("Expected PERMISSION_DENIED, got %v", err)
+	}
+	if called {
+		t.Error("Handler was called for an invalid request")
+	}
+
+	resp, err := call("world")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !called || string(resp.Messages[0]) != "hello world" {
+		t.Errorf("Unexpected response %q (called=%v)", resp.Messages, called)
+	}
+}
+
 func TestOnClose(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	called := false
 	transport.OnClose(func() {
@@ -219,12 +312,147 @@ func TestOnClose(t *testing.T) {
 	}
 }
 
+func TestIsClosed(t *testing.T) {
+	// Closed by Close
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+	transport.Start()
+	if transport.IsClosed() {
+		t.Error("New transport reports closed")
+	}
+	transport.Close()
+	if !transport.IsClosed() {
+		t.Error("Transport not closed after Close")
+	}
+
+	// Closed by the DataChannel closing underneath it
+	dc = newMockDataChannel()
+	transport = NewDataChannelTransportWithInterface(dc, nil)
+	transport.Start()
+	dc.Close()
+	if !transport.IsClosed() {
+		t.Error("Transport not closed after its DataChannel closed")
+	}
+}
+
+func TestCloseCancelsRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(dc *mockDataChannel, transport *DataChannelTransport)
+	}{
+		{"Close", func(dc *mockDataChannel, transport *DataChannelTransport) { transport.Close() }},
+		{"DataChannel closed", func(dc *mockDataChannel, transport *DataChannelTransport) { dc.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := newMockDataChannel()
+			transport := NewDataChannelTransportWithInterface(dc, nil)
+
+			started := make(chan struct{}, 2)
+			done := make(chan error, 2)
+			transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+				started <- struct{}{}
+				<-stream.Context().Done()
+				done <- stream.Context().Err()
+				return nil
+			})
+			transport.RegisterHandler("/test.Service/Unary", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+				started <- struct{}{}
+				<-ctx.Done()
+				done <- ctx.Err()
+				return nil, ctx.Err()
+			})
+			transport.Start()
+
+			for i, path := range []string{"/test.Service/Stream", "/test.Service/Unary"} {
+				reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+					Path:    path,
+					Headers: map[string]string{"x-request-id": "req-" + strconv.Itoa(i)},
+				})
+				if err != nil {
+					t.Fatalf("Failed to encode request: %v", err)
+				}
+				go dc.simulateMessage(reqData)
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case <-started:
+				case <-time.After(time.Second):
+					t.Fatal("Handlers did not start")
+				}
+			}
+
+			tt.close(dc, transport)
+
+			for i := 0; i < 2; i++ {
+				select {
+				case err := <-done:
+					if !errors.Is(err, context.Canceled) {
+						t.Errorf("Expected context.Canceled, got %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("Handler context was not cancelled by closing the transport")
+				}
+			}
+		})
+	}
+}
+
+func TestNewDataChannelTransportContext(t *testing.T) {
+	type key struct{}
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "server"))
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportContext(parent, dc, nil)
+
+	values := make(chan any, 1)
+	errs := make(chan error, 1)
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		values <- stream.Context().Value(key{})
+		<-stream.Context().Done()
+		errs <- stream.Context().Err()
+		return nil
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	go dc.simulateMessage(reqData)
+
+	select {
+	case v := <-values:
+		if v != "server" {
+			t.Errorf("Expected the parent context's value, got %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Handler did not start")
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Handler context was not cancelled with its parent")
+	}
+	if transport.IsClosed() {
+		t.Error("Cancelling the parent context should not close the transport")
+	}
+}
+
 func TestCustomTimeout(t *testing.T) {
 	dc := newMockDataChannel()
 	opts := &HandlerOptions{
 		Timeout: 5 * time.Second,
 	}
-	transport := newDataChannelTransportWithInterface(dc, opts)
+	transport := NewDataChannelTransportWithInterface(dc, opts)
 
 	if transport.options.Timeout != 5*time.Second {
 		t.Errorf("Expected timeout 5s, got %v", transport.options.Timeout)
@@ -233,7 +461,7 @@ func TestCustomTimeout(t *testing.T) {
 
 func TestSendResponseAfterClose(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	transport.Close()
 
@@ -244,14 +472,189 @@ func TestSendResponseAfterClose(t *testing.T) {
 	}
 
 	err := transport.SendResponse(envelope)
-	if err == nil {
-		t.Error("Expected error when sending after close")
+	if !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("Expected ErrTransportClosed when sending after close, got %v", err)
+	}
+}
+
+func TestSendResponseWriteFailure(t *testing.T) {
+	dc := newMockDataChannel()
+	dc.sendErr = io.ErrClosedPipe
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	err := transport.SendResponse(&codec.ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{[]byte("test")},
+		Trailers: map[string]string{"grpc-status": "0"},
+	})
+	if !errors.Is(err, ErrSendFailed) {
+		t.Errorf("Expected ErrSendFailed, got %v", err)
+	}
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Expected the DataChannel error to be wrapped, got %v", err)
+	}
+}
+
+func TestStreamSendAfterClose(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	started := make(chan struct{})
+	closed := make(chan struct{})
+	sendErr := make(chan error, 1)
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		close(started)
+		<-closed
+		err := stream.Send([]byte("late"))
+		sendErr <- err
+		return err
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Handler not called")
+	}
+	transport.Close()
+	close(closed)
+
+	select {
+	case err := <-sendErr:
+		if !errors.Is(err, ErrTransportClosed) {
+			t.Errorf("Expected ErrTransportClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return")
+	}
+}
+
+func TestStreamRequestIDTooLong(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	called := make(chan struct{}, 1)
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		called <- struct{}{}
+		return nil
+	})
+	transport.Start()
+
+	requestID := strings.Repeat("r", codec.MaxStreamRequestIDLength+1)
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": requestID},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	deadline := time.Now().Add(time.Second)
+	for len(dc.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 error response, got %d messages", len(sent))
+	}
+	respEnv, err := codec.DecodeResponse(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if respEnv.Trailers["grpc-status"] != strconv.Itoa(codec.StatusInvalidArgument) {
+		t.Errorf("Expected INVALID_ARGUMENT, got grpc-status %s", respEnv.Trailers["grpc-status"])
+	}
+	if respEnv.Headers["x-request-id"] != requestID {
+		t.Error("Expected x-request-id to be echoed")
+	}
+
+	select {
+	case <-called:
+		t.Error("Handler called for request ID that cannot be streamed")
+	default:
+	}
+}
+
+func TestStreamMissingRequestID(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	called := make(chan struct{}, 1)
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		called <- struct{}{}
+		return nil
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	deadline := time.Now().Add(time.Second)
+	for len(dc.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 stream end message, got %d messages", len(sent))
+	}
+
+	// The documented prefix: payload type, request ID length and request ID,
+	// end flag, sequence 0
+	prefix := []byte{codec.PayloadTypeStream, 0, 0, 0, byte(len(codec.MissingRequestID))}
+	prefix = append(prefix, codec.MissingRequestID...)
+	prefix = append(prefix, codec.StreamFlagEnd, 0, 0, 0, 0)
+	if !bytes.HasPrefix(sent[0], prefix) {
+		t.Errorf("Expected message to start with % x, got % x", prefix, sent[0])
+	}
+
+	msg, err := codec.DecodeStreamMessage(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode stream message: %v", err)
+	}
+	if msg.RequestID != codec.MissingRequestID || msg.Flag != codec.StreamFlagEnd || msg.Sequence != 0 {
+		t.Errorf("Unexpected stream message: %+v", msg)
+	}
+	frames, err := codec.DecodeFramesAll(msg.Data)
+	if err != nil || len(frames) != 1 || frames[0].Flags != codec.FrameTrailer {
+		t.Fatalf("Expected a single trailer frame, got %v, %v", frames, err)
+	}
+	trailers := codec.ParseTrailers(frames[0].Data)
+	if trailers["grpc-status"] != strconv.Itoa(codec.StatusInvalidArgument) {
+		t.Errorf("Expected INVALID_ARGUMENT, got grpc-status %s", trailers["grpc-status"])
+	}
+	if trailers["grpc-message"] != "Missing x-request-id header" {
+		t.Errorf("Unexpected grpc-message %q", trailers["grpc-message"])
+	}
+
+	select {
+	case <-called:
+		t.Error("Handler called for streaming request without x-request-id")
+	default:
 	}
 }
 
 func TestRequestIDEcho(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	// Register a simple handler
 	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
@@ -302,7 +705,7 @@ func TestRequestIDEcho(t *testing.T) {
 
 func TestUnimplementedMethod(t *testing.T) {
 	dc := newMockDataChannel()
-	transport := newDataChannelTransportWithInterface(dc, nil)
+	transport := NewDataChannelTransportWithInterface(dc, nil)
 
 	transport.Start()
 
@@ -346,3 +749,2792 @@ func TestUnimplementedMethod(t *testing.T) {
 		t.Errorf("Expected UNIMPLEMENTED status, got %d", grpcErr.Code)
 	}
 }
+
+func TestTrailersOnlyErrors(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:      time.Second,
+		TrailersOnly: true,
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/unknown.Service/Method",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+
+	// The status is in the headers, and there is no trailer frame
+	data := sent[0][1:]
+	headersLength := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if len(data) != 4+headersLength {
+		t.Errorf("Expected a trailers-only response, got %d bytes after the headers", len(data)-4-headersLength)
+	}
+
+	respEnv, err := codec.DecodeResponse(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if respEnv.Headers["grpc-status"] != strconv.Itoa(codec.StatusUnimplemented) {
+		t.Errorf("Expected grpc-status header, got %v", respEnv.Headers)
+	}
+	grpcErr := codec.GetError(*respEnv)
+	if grpcErr == nil || grpcErr.Code != codec.StatusUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED error, got %v", grpcErr)
+	}
+}
+
+func TestPerMethodTimeout(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{Timeout: 30 * time.Second})
+
+	deadlines := make(map[string]time.Duration)
+	recordDeadline := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		deadline, ok := ctx.Deadline()
+		if ok {
+			deadlines[req.Path] = time.Until(deadline)
+		} else {
+			deadlines[req.Path] = 0
+		}
+		return &codec.ResponseEnvelope{}, nil
+	}
+
+	transport.RegisterHandler("/test.Service/Default", recordDeadline)
+	transport.RegisterHandlerWithOptions("/test.Service/Fast", recordDeadline, &HandlerOptions{Timeout: time.Second})
+	transport.RegisterHandlerWithOptions("/test.Service/Slow", recordDeadline, &HandlerOptions{Timeout: 5 * time.Minute})
+
+	transport.Start()
+
+	for _, path := range []string{"/test.Service/Default", "/test.Service/Fast", "/test.Service/Slow"} {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    path,
+			Headers: map[string]string{},
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+
+	tests := []struct {
+		path string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"/test.Service/Default", 29 * time.Second, 30 * time.Second},
+		{"/test.Service/Fast", 0, time.Second},
+		{"/test.Service/Slow", 4 * time.Minute, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, ok := deadlines[tt.path]
+		if !ok {
+			t.Errorf("Handler for %s was not called", tt.path)
+			continue
+		}
+		if got <= tt.min || got > tt.max {
+			t.Errorf("Deadline for %s: expected in (%v, %v], got %v", tt.path, tt.min, tt.max, got)
+		}
+	}
+}
+
+func TestHandlerOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    HandlerOptions
+		wantErr bool
+	}{
+		{"zero timeout", HandlerOptions{Timeout: 0}, false},
+		{"positive timeout", HandlerOptions{Timeout: time.Second}, false},
+		{"negative timeout", HandlerOptions{Timeout: -time.Second}, true},
+		{"defaults", *DefaultHandlerOptions(), false},
+		{"negative idle timeout", HandlerOptions{IdleTimeout: -1}, true},
+		{"negative chunk size", HandlerOptions{ChunkSize: -1}, true},
+		{"negative stream limit", HandlerOptions{MaxConcurrentStreams: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("Expected ErrInvalidOptions, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidTimeoutUsesDefault(t *testing.T) {
+	deadlineOf := func(t *testing.T, transport *DataChannelTransport, dc *mockDataChannel, path string) (time.Duration, bool) {
+		t.Helper()
+		got := make(chan time.Duration, 1)
+		hasDeadline := false
+		transport.RegisterHandler(path, func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+			var deadline time.Time
+			deadline, hasDeadline = ctx.Deadline()
+			got <- time.Until(deadline)
+			return &codec.ResponseEnvelope{}, nil
+		})
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{Path: path, Headers: map[string]string{}})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+		return <-got, hasDeadline
+	}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration // Zero for no deadline
+	}{
+		{"zero means no timeout", 0, 0},
+		{"positive", 5 * time.Second, 5 * time.Second},
+		{"negative uses default", -time.Second, DefaultTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &HandlerOptions{Timeout: tt.timeout}
+			dc := newMockDataChannel()
+			transport := NewDataChannelTransportWithInterface(dc, opts)
+			transport.Start()
+
+			remaining, ok := deadlineOf(t, transport, dc, "/test.Service/Method")
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("Expected no deadline, got %v", remaining)
+				}
+			} else if !ok || remaining <= tt.want-time.Second || remaining > tt.want {
+				t.Errorf("Expected deadline in (%v, %v], got %v (set %v)", tt.want-time.Second, tt.want, remaining, ok)
+			}
+			if opts.Timeout != tt.timeout {
+				t.Errorf("Caller's options were modified: %v", opts.Timeout)
+			}
+		})
+	}
+
+	t.Run("per-method", func(t *testing.T) {
+		dc := newMockDataChannel()
+		transport := NewDataChannelTransportWithInterface(dc, nil)
+		transport.Start()
+		transport.RegisterHandlerWithOptions("/test.Service/Negative", nil, &HandlerOptions{Timeout: -time.Minute})
+		transport.mu.RLock()
+		timeout := transport.timeoutForLocked("/test.Service/Negative")
+		transport.mu.RUnlock()
+		if timeout != DefaultTimeout {
+			t.Errorf("Expected per-method timeout %v, got %v", DefaultTimeout, timeout)
+		}
+	})
+}
+
+func TestConstructorsNegativeTimeout(t *testing.T) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("Failed to create peer connection: %v", err)
+	}
+	defer pc.Close()
+	dc, err := pc.CreateDataChannel("data", nil)
+	if err != nil {
+		t.Fatalf("Failed to create data channel: %v", err)
+	}
+	negative := func() *HandlerOptions { return &HandlerOptions{Timeout: -time.Second} }
+
+	// The constructors without an error result replace the timeout
+	replacing := map[string]*DataChannelTransport{
+		"NewDataChannelTransport":              NewDataChannelTransport(dc, negative()),
+		"NewDataChannelTransportWithInterface": NewDataChannelTransportWithInterface(newMockDataChannel(), negative()),
+		"NewDataChannelTransportContext":       NewDataChannelTransportContext(context.Background(), newMockDataChannel(), negative()),
+	}
+	for name, transport := range replacing {
+		if transport.options.Timeout != DefaultTimeout {
+			t.Errorf("%s: expected timeout %v, got %v", name, DefaultTimeout, transport.options.Timeout)
+		}
+	}
+
+	// The validating constructor reports it
+	if _, err := NewValidatedDataChannelTransport(dc, negative()); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("NewValidatedDataChannelTransport: expected ErrInvalidOptions, got %v", err)
+	}
+	for _, opts := range []*HandlerOptions{nil, {Timeout: 0}, {Timeout: time.Second}} {
+		transport, err := NewValidatedDataChannelTransport(dc, opts)
+		if err != nil || transport == nil {
+			t.Errorf("NewValidatedDataChannelTransport(%+v) failed: %v", opts, err)
+		}
+	}
+}
+
+func TestUnregisterHandlerClearsOptions(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	handler := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	}
+
+	transport.RegisterHandlerWithOptions("/test.Service/Method", handler, &HandlerOptions{Timeout: time.Second})
+	transport.UnregisterHandler("/test.Service/Method")
+
+	if _, ok := transport.methodOptions["/test.Service/Method"]; ok {
+		t.Error("Method options should be removed on unregister")
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"x-request-id": "buffered-1"},
+		Message: []byte("early"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	// Delivered by the caller rather than through the DataChannel's OnMessage
+	transport.HandleMessage(reqData)
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+
+	resp, err := codec.DecodeResponse(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Headers["x-request-id"] != "buffered-1" {
+		t.Errorf("Expected x-request-id buffered-1, got %s", resp.Headers["x-request-id"])
+	}
+	if len(resp.Messages) != 1 || string(resp.Messages[0]) != "early" {
+		t.Errorf("Expected echoed message 'early', got %v", resp.Messages)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:     time.Second,
+		IdleTimeout: 100 * time.Millisecond,
+	})
+
+	var mu sync.Mutex
+	closeCount := 0
+	transport.OnClose(func() {
+		mu.Lock()
+		closeCount++
+		mu.Unlock()
+	})
+
+	transport.Start()
+
+	// A message resets the idle window
+	time.Sleep(60 * time.Millisecond)
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Unknown",
+		Headers: map[string]string{},
+		Message: []byte("ping"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	time.Sleep(60 * time.Millisecond)
+	mu.Lock()
+	if closeCount != 0 {
+		t.Error("Transport closed although a message was received within the idle timeout")
+	}
+	mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := closeCount
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if closeCount != 1 {
+		t.Errorf("Expected OnClose to fire once after idle timeout, got %d", closeCount)
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if !dc.closed {
+		t.Error("Expected DataChannel to be closed")
+	}
+}
+
+func TestIdleTimeoutSlowUnary(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:     time.Second,
+		IdleTimeout: 50 * time.Millisecond,
+	})
+	transport.RegisterHandler("/test.Service/Slow", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		time.Sleep(200 * time.Millisecond)
+		return &codec.ResponseEnvelope{Messages: [][]byte{[]byte("done")}}, nil
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Slow",
+		Headers: map[string]string{"x-request-id": "slow"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+	resp, err := codec.DecodeResponse(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Trailers["grpc-status"] != "0" {
+		t.Errorf("Expected grpc-status 0, got %q", resp.Trailers["grpc-status"])
+	}
+
+	// Once the request is done, the idle timeout applies again
+	deadline := time.Now().Add(time.Second)
+	for !transport.IsClosed() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !transport.IsClosed() {
+		t.Error("Expected the transport to close once idle")
+	}
+}
+
+func TestIdleTimeoutDisabled(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+	transport.Start()
+
+	if transport.idleTimer != nil {
+		t.Error("Idle timer should not be started when IdleTimeout is zero")
+	}
+}
+
+func TestMixedCaseRequestID(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	var seen string
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		seen = RequestIDFromContext(ctx)
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{[]byte("ok")},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"X-Request-Id": "Mixed-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	if seen != "Mixed-1" {
+		t.Errorf("Expected request ID Mixed-1 in context, got %q", seen)
+	}
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+	resp, err := codec.DecodeResponse(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Headers["x-request-id"] != "Mixed-1" {
+		t.Errorf("Expected echoed x-request-id Mixed-1, got %v", resp.Headers)
+	}
+}
+
+func TestPeerInfoFromContext(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	infos := make(chan *PeerInfo, 2)
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		info, _ := PeerInfoFromContext(ctx)
+		infos <- info
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{[]byte("ok")},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		info, _ := PeerInfoFromContext(stream.Context())
+		infos <- info
+		return nil
+	})
+
+	transport.SetPeerInfo(PeerInfo{UserID: "user-1", AppID: "app-1"})
+	transport.Start()
+
+	for _, path := range []string{"/test.Service/Method", "/test.Service/Stream"} {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    path,
+			Headers: map[string]string{"x-request-id": "req-1"},
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+
+		select {
+		case info := <-infos:
+			if info == nil || info.UserID != "user-1" || info.AppID != "app-1" {
+				t.Errorf("%s: expected peer info for user-1/app-1, got %+v", path, info)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: handler not called", path)
+		}
+	}
+
+	if _, ok := PeerInfoFromContext(context.Background()); ok {
+		t.Error("Expected no peer info in a plain context")
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout: time.Second,
+		Limiter: NewTokenBucketLimiter(0.001, 3),
+	})
+
+	calls := 0
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		calls++
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{[]byte("ok")},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+
+	transport.Start()
+
+	for i := 0; i < 10; i++ {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/Method",
+			Headers: map[string]string{"x-request-id": fmt.Sprintf("req-%d", i)},
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+
+	exhausted := 0
+	for _, data := range dc.sent() {
+		resp, err := codec.DecodeResponse(data)
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Trailers["grpc-status"] == strconv.Itoa(codec.StatusResourceExhausted) {
+			exhausted++
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 requests to reach the handler, got %d", calls)
+	}
+	if exhausted != 7 {
+		t.Errorf("Expected 7 RESOURCE_EXHAUSTED responses, got %d", exhausted)
+	}
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:              5 * time.Second,
+		MaxConcurrentStreams: 2,
+	})
+
+	started := make(chan string, 5)
+	release := make(chan struct{})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		started <- req.Headers["x-request-id"]
+		<-release
+		return nil
+	})
+	transport.Start()
+
+	openStream := func(requestID string) {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/Stream",
+			Headers: map[string]string{"x-request-id": requestID},
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+
+	for i := 0; i < 4; i++ {
+		openStream(fmt.Sprintf("stream-%d", i))
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("Streaming handler not started")
+		}
+	}
+
+	// The excess streams are rejected right away with their request IDs
+	for _, requestID := range []string{"stream-2", "stream-3"} {
+		msgs := waitForStreamEnd(t, dc, requestID)
+		result := codec.DecodeFrames(msgs[len(msgs)-1].Data)
+		if len(result.Frames) != 1 {
+			t.Fatalf("%s: expected a trailer frame", requestID)
+		}
+		trailers := codec.ParseTrailers(result.Frames[0].Data)
+		if trailers["grpc-status"] != strconv.Itoa(codec.StatusResourceExhausted) {
+			t.Errorf("%s: expected RESOURCE_EXHAUSTED, got %v", requestID, trailers)
+		}
+	}
+	select {
+	case requestID := <-started:
+		t.Fatalf("Handler started for rejected stream %s", requestID)
+	default:
+	}
+
+	// Finished streams free their slots
+	close(release)
+	waitForStreamEnd(t, dc, "stream-0")
+	waitForStreamEnd(t, dc, "stream-1")
+	deadline := time.Now().Add(time.Second)
+	for {
+		transport.mu.RLock()
+		active := transport.activeStreams
+		transport.mu.RUnlock()
+		if active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no active streams, got %d", active)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	openStream("stream-4")
+	select {
+	case requestID := <-started:
+		if requestID != "stream-4" {
+			t.Errorf("Expected stream-4 to start, got %s", requestID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stream not accepted after others finished")
+	}
+}
+
+func TestChunkedMessages(t *testing.T) {
+	const chunkSize = 16 * 1024
+
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:   5 * time.Second,
+		ChunkSize: chunkSize,
+	})
+
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+
+	transport.Start()
+
+	message := make([]byte, 1024*1024)
+	for i := range message {
+		message[i] = byte(i % 251)
+	}
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Echo",
+		Headers: map[string]string{"x-request-id": "big-1"},
+		Message: message,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	// The client sends the request in chunks too
+	for _, chunk := range codec.EncodeChunks(1, codec.MarkPayload(codec.PayloadTypeEnvelope, reqData), chunkSize) {
+		dc.simulateMessage(chunk)
+	}
+
+	sent := dc.sent()
+	if len(sent) < 2 {
+		t.Fatalf("Expected a chunked response, got %d messages", len(sent))
+	}
+
+	r := codec.NewReassembler(0)
+	var payload []byte
+	for i, data := range sent {
+		if len(data) > codec.ChunkHeaderSize+chunkSize {
+			t.Errorf("Chunk %d is %d bytes, above the chunk size", i, len(data))
+		}
+		got, complete, err := r.Add(data)
+		if err != nil {
+			t.Fatalf("Failed to reassemble response: %v", err)
+		}
+		if complete {
+			payload = got
+		}
+	}
+	if payload == nil {
+		t.Fatal("Response was not complete")
+	}
+
+	resp, err := codec.DecodeResponse(payload)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Headers["x-request-id"] != "big-1" {
+		t.Errorf("Expected x-request-id big-1, got %q", resp.Headers["x-request-id"])
+	}
+	if len(resp.Messages) != 1 || !bytes.Equal(resp.Messages[0], message) {
+		t.Error("Echoed message does not match the 1MB request")
+	}
+}
+
+func TestSmallMessagesNotChunked(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:   5 * time.Second,
+		ChunkSize: 16 * 1024,
+	})
+
+	resp := codec.CreateErrorResponse(codec.StatusNotFound, "missing")
+	if err := transport.SendResponse(&resp); err != nil {
+		t.Fatalf("SendResponse failed: %v", err)
+	}
+
+	sent := dc.sent()
+	if len(sent) != 1 || sent[0][0] != codec.PayloadTypeEnvelope {
+		t.Errorf("Expected one unchunked envelope, got %d messages", len(sent))
+	}
+}
+
+func TestPayloadsAreMarked(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return stream.Send([]byte("item"))
+	})
+
+	transport.Start()
+
+	// Requests are accepted with a discriminator
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("marked"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(codec.MarkPayload(codec.PayloadTypeEnvelope, reqData))
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+	if sent[0][0] != codec.PayloadTypeEnvelope {
+		t.Errorf("Expected response to start with 0x%02x, got 0x%02x", codec.PayloadTypeEnvelope, sent[0][0])
+	}
+
+	streamReq, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(streamReq)
+	waitForStreamEnd(t, dc, "stream-1")
+
+	for _, data := range dc.sent()[1:] {
+		if data[0] != codec.PayloadTypeStream {
+			t.Errorf("Expected stream message to start with 0x%02x, got 0x%02x", codec.PayloadTypeStream, data[0])
+		}
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		close(started)
+		<-stream.Context().Done()
+		done <- stream.Context().Err()
+		return stream.Context().Err()
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	dc.simulateMessage(reqData)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Streaming handler not started")
+	}
+
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-1"))
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Streaming handler context was not cancelled")
+	}
+
+	// The stream should still be terminated with an end message
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		sent := dc.sent()
+		if len(sent) > 0 {
+			msg, err := codec.DecodeStreamMessage(sent[len(sent)-1])
+			if err != nil {
+				t.Fatalf("Failed to decode stream message: %v", err)
+			}
+			if msg.Flag != codec.StreamFlagEnd || msg.RequestID != "stream-1" {
+				t.Errorf("Expected end message for stream-1, got %+v", msg)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The stream should be forgotten once the handler returns
+	deadline = time.Now().Add(time.Second)
+	for {
+		transport.mu.RLock()
+		remaining := len(transport.streams)
+		transport.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no active streams, got %d", remaining)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamCancelRightAfterRequest(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		select {
+		case <-stream.Context().Done():
+		case <-release:
+		}
+		done <- stream.Context().Err()
+		return stream.Context().Err()
+	})
+	transport.Start()
+	defer close(release)
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	// The cancel follows without waiting for the handler to start
+	dc.simulateMessage(reqData)
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-1"))
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cancel sent right after the request was lost")
+	}
+	waitForStreamEnd(t, dc, "stream-1")
+}
+
+func TestStreamDuplicateRequestID(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	var calls atomic.Int32
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		calls.Add(1)
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	dc.simulateMessage(reqData)
+	dc.simulateMessage(reqData)
+
+	// The duplicate is rejected without replacing the first stream
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	trailers := codec.ParseTrailers(codec.DecodeFrames(msgs[len(msgs)-1].Data).Frames[0].Data)
+	if trailers["grpc-status"] != strconv.Itoa(codec.StatusAlreadyExists) {
+		t.Errorf("Expected ALREADY_EXISTS for the duplicate, got %v", trailers)
+	}
+
+	transport.mu.RLock()
+	cancel := transport.streams["stream-1"]
+	transport.mu.RUnlock()
+	if cancel == nil {
+		t.Fatal("Expected the first stream to stay registered")
+	}
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-1"))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		transport.mu.RLock()
+		remaining := len(transport.streams)
+		transport.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the cancel to end the first stream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the handler to run once, got %d", n)
+	}
+}
+
+func TestStreamSendAfterCancel(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	started := make(chan struct{})
+	sendErr := make(chan error, 1)
+
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		if err := stream.Send([]byte("first")); err != nil {
+			return err
+		}
+		close(started)
+		<-stream.Context().Done()
+		err := stream.Send([]byte("late"))
+		sendErr <- err
+		return err
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Streaming handler not started")
+	}
+
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-1"))
+
+	select {
+	case err := <-sendErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return")
+	}
+
+	// Only the first message and the end message were sent
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 stream messages, got %d", len(msgs))
+	}
+	if msgs[1].Sequence != 1 {
+		t.Errorf("Expected end message sequence 1, got %d", msgs[1].Sequence)
+	}
+}
+
+// streamDataFrames returns the data frame payloads of a stream message
+func streamDataFrames(t *testing.T, msg *codec.StreamMessage) []string {
+	t.Helper()
+	result := codec.DecodeFrames(msg.Data)
+	if len(result.Remaining) != 0 {
+		t.Fatalf("Failed to decode frames: %d bytes remaining", len(result.Remaining))
+	}
+	var payloads []string
+	for _, frame := range result.Frames {
+		if frame.Flags == codec.FrameData {
+			payloads = append(payloads, string(frame.Data))
+		}
+	}
+	return payloads
+}
+
+func TestStreamBatching(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	// Each frame is 5+5 bytes, so the size limit flushes every 3 messages;
+	// the interval is long enough that only size and the end flush batches
+	opts := &HandlerOptions{
+		Timeout:             time.Second,
+		StreamBatchInterval: time.Minute,
+		StreamBatchSize:     30,
+	}
+	transport.RegisterStreamingHandlerWithOptions("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		for i := 0; i < 7; i++ {
+			if err := stream.Send([]byte(fmt.Sprintf("msg-%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts)
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	want := [][]string{
+		{"msg-0", "msg-1", "msg-2"},
+		{"msg-3", "msg-4", "msg-5"},
+		{"msg-6"}, // flushed before the end message
+	}
+	if len(msgs) != len(want)+1 {
+		t.Fatalf("Expected %d stream messages, got %d", len(want)+1, len(msgs))
+	}
+	for i, w := range want {
+		if msgs[i].Flag != codec.StreamFlagData || msgs[i].Sequence != uint32(i) {
+			t.Errorf("Message %d: unexpected flag %d or sequence %d", i, msgs[i].Flag, msgs[i].Sequence)
+		}
+		if got := streamDataFrames(t, msgs[i]); !reflect.DeepEqual(got, w) {
+			t.Errorf("Message %d: expected frames %v, got %v", i, w, got)
+		}
+	}
+	end := msgs[len(msgs)-1]
+	if end.Flag != codec.StreamFlagEnd || end.Sequence != uint32(len(want)) {
+		t.Errorf("Unexpected end message: flag %d, sequence %d", end.Flag, end.Sequence)
+	}
+}
+
+func TestStreamBatchingInterval(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:             time.Second,
+		StreamBatchInterval: 20 * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		stream.Send([]byte("a"))
+		stream.Send([]byte("b"))
+		<-release
+		return nil
+	})
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	// The batch is flushed by the timer while the handler is still running
+	deadline := time.Now().Add(time.Second)
+	for len(dc.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 batched message, got %d", len(sent))
+	}
+	msg, err := codec.DecodeStreamMessage(sent[0])
+	if err != nil {
+		t.Fatalf("Failed to decode stream message: %v", err)
+	}
+	if got := streamDataFrames(t, msg); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Expected frames [a b], got %v", got)
+	}
+
+	close(release)
+	waitForStreamEnd(t, dc, "stream-1")
+}
+
+// BenchmarkStreamBurst measures a streaming handler sending a burst of small
+// messages, with and without batching
+func BenchmarkStreamBurst(b *testing.B) {
+	const burst = 1000
+
+	req := &codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+	}
+	message := make([]byte, 32)
+	handler := func(req *codec.RequestEnvelope, stream ServerStream) error {
+		for i := 0; i < burst; i++ {
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, bc := range []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"unbatched", 0},
+		{"batched", time.Millisecond},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var writes int
+			for i := 0; i < b.N; i++ {
+				dc := newMockDataChannel()
+				transport := NewDataChannelTransportWithInterface(dc, nil)
+				ctx, cancel, _, _ := transport.openStream(req, 0)
+				transport.handleStreamingRequest(ctx, cancel, req, handler, 0, bc.interval, DefaultStreamBatchSize)
+				writes += len(dc.sent())
+			}
+			b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+// waitForStreamEnd waits until the end message for requestID has been sent
+// and returns all stream messages sent for it, in order
+func waitForStreamEnd(t *testing.T, dc *mockDataChannel, requestID string) []*codec.StreamMessage {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		var msgs []*codec.StreamMessage
+		for _, data := range dc.sent() {
+			msg, err := codec.DecodeStreamMessage(data)
+			if err != nil || msg.RequestID != requestID {
+				continue
+			}
+			msgs = append(msgs, msg)
+			if msg.Flag == codec.StreamFlagEnd {
+				return msgs
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for end of stream %s", requestID)
+	return nil
+}
+
+func TestStreamPartialThenError(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		if err := stream.Send([]byte("one")); err != nil {
+			return err
+		}
+		if err := stream.Send([]byte("two")); err != nil {
+			return err
+		}
+		return &codec.GRPCError{Code: codec.StatusUnavailable, Message: "backend went away"}
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 stream messages (2 data, end), got %d", len(msgs))
+	}
+
+	for i, msg := range msgs {
+		if msg.Sequence != uint32(i) {
+			t.Errorf("Message %d: expected sequence %d, got %d", i, i, msg.Sequence)
+		}
+	}
+
+	// The end message's sequence counts the messages that preceded it
+	end := msgs[2]
+	if end.Flag != codec.StreamFlagEnd || end.Sequence != 2 {
+		t.Errorf("Expected end message with sequence 2, got flag %d sequence %d", end.Flag, end.Sequence)
+	}
+
+	frames := codec.DecodeFrames(end.Data).Frames
+	trailers := codec.ParseTrailers(frames[0].Data)
+	if trailers["grpc-status"] != strconv.Itoa(codec.StatusUnavailable) {
+		t.Errorf("Expected grpc-status %d, got %s", codec.StatusUnavailable, trailers["grpc-status"])
+	}
+	if trailers["grpc-message"] != "backend went away" {
+		t.Errorf("Expected grpc-message from handler error, got %q", trailers["grpc-message"])
+	}
+	if trailers[codec.StreamCountTrailer] != "2" {
+		t.Errorf("Expected %s 2, got %q", codec.StreamCountTrailer, trailers[codec.StreamCountTrailer])
+	}
+}
+
+func TestStreamCountTrailer(t *testing.T) {
+	const count = 25
+	tests := []struct {
+		name string
+		opts *HandlerOptions
+	}{
+		{"unbatched", nil},
+		{"batched", &HandlerOptions{StreamBatchInterval: time.Hour, StreamBatchSize: 64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := newMockDataChannel()
+			transport := NewDataChannelTransportWithInterface(dc, tt.opts)
+			transport.RegisterStreamingHandler("/test.Service/Count", func(req *codec.RequestEnvelope, stream ServerStream) error {
+				if err := stream.SendHeader(map[string]string{"x-kind": "count"}); err != nil {
+					return err
+				}
+				stream.SetTrailer(map[string]string{codec.StreamCountTrailer: "ignored"})
+				for i := 0; i < count; i++ {
+					if err := stream.Send([]byte(strconv.Itoa(i))); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			transport.Start()
+
+			reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+				Path:    "/test.Service/Count",
+				Headers: map[string]string{"x-request-id": "count-1"},
+			})
+			if err != nil {
+				t.Fatalf("Failed to encode request: %v", err)
+			}
+			dc.simulateMessage(reqData)
+
+			msgs := waitForStreamEnd(t, dc, "count-1")
+			received := 0
+			for _, msg := range msgs {
+				if msg.Flag == codec.StreamFlagData {
+					received += len(codec.DecodeFrames(msg.Data).Frames)
+				}
+			}
+			if received != count {
+				t.Fatalf("Expected %d messages, received %d", count, received)
+			}
+
+			end := msgs[len(msgs)-1]
+			trailers := codec.ParseTrailers(codec.DecodeFrames(end.Data).Frames[0].Data)
+			if trailers[codec.StreamCountTrailer] != strconv.Itoa(count) {
+				t.Errorf("Expected %s %d, got %q", codec.StreamCountTrailer, count, trailers[codec.StreamCountTrailer])
+			}
+		})
+	}
+}
+
+func TestByteCounters(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{ChunkSize: 128})
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		for i := 0; i < 3; i++ {
+			if err := stream.Send(req.Message); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	transport.Start()
+
+	sentBytes := func() uint64 {
+		var total uint64
+		for _, data := range dc.sent() {
+			total += uint64(len(data))
+		}
+		return total
+	}
+
+	if transport.BytesSent() != 0 || transport.BytesReceived() != 0 {
+		t.Fatalf("Expected zero counters, got sent %d received %d", transport.BytesSent(), transport.BytesReceived())
+	}
+
+	var received uint64
+	// The unary response spans several chunks; stream messages fit in one
+	for i, call := range []struct {
+		path string
+		size int
+	}{{"/test.Service/Echo", 300}, {"/test.Service/Stream", 10}} {
+		path := call.path
+		requestID := "count-" + strconv.Itoa(i)
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    path,
+			Headers: map[string]string{"x-request-id": requestID},
+			Message: bytes.Repeat([]byte("x"), call.size),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+		received += uint64(len(reqData))
+
+		if path == "/test.Service/Stream" {
+			waitForStreamEnd(t, dc, requestID)
+		} else {
+			if chunks := waitForChunkedResponse(t, dc); chunks < 2 {
+				t.Fatalf("Expected a chunked response, got %d chunks", chunks)
+			}
+		}
+		// The last message is counted just after it is sent
+		deadline := time.Now().Add(time.Second)
+		for transport.BytesSent() != sentBytes() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		if got := transport.BytesReceived(); got != received {
+			t.Errorf("%s: expected %d bytes received, got %d", path, received, got)
+		}
+		if got, want := transport.BytesSent(), sentBytes(); got != want || got == 0 {
+			t.Errorf("%s: expected %d bytes sent, got %d", path, want, got)
+		}
+	}
+}
+
+// waitForChunkedResponse waits until dc has sent every chunk of a chunked
+// payload and returns the number of chunks
+func waitForChunkedResponse(t *testing.T, dc *mockDataChannel) int {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		r := codec.NewReassembler(0)
+		for i, data := range dc.sent() {
+			if !codec.IsChunk(data) {
+				continue
+			}
+			if _, complete, err := r.Add(data); err == nil && complete {
+				return i + 1
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for a chunked response")
+	return 0
+}
+
+func TestStreamKeepalive(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout:           5 * time.Second,
+		KeepaliveInterval: 20 * time.Millisecond,
+	})
+
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		// Wait for an event before sending
+		time.Sleep(100 * time.Millisecond)
+		if err := stream.Send([]byte("event")); err != nil {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+
+	keepalives := 0
+	dataSeen := false
+	for _, msg := range msgs {
+		switch msg.Flag {
+		case codec.StreamFlagKeepalive:
+			keepalives++
+			if len(msg.Data) != 0 {
+				t.Errorf("Expected empty keepalive, got %d bytes", len(msg.Data))
+			}
+			// Keepalives carry the sequence of the next message
+			want := uint32(0)
+			if dataSeen {
+				want = 1
+			}
+			if msg.Sequence != want {
+				t.Errorf("Expected keepalive sequence %d, got %d", want, msg.Sequence)
+			}
+		case codec.StreamFlagData:
+			dataSeen = true
+			if msg.Sequence != 0 {
+				t.Errorf("Expected data sequence 0, got %d", msg.Sequence)
+			}
+		case codec.StreamFlagEnd:
+			if msg.Sequence != 1 {
+				t.Errorf("Expected end sequence 1, got %d", msg.Sequence)
+			}
+		}
+	}
+	if keepalives < 4 {
+		t.Errorf("Expected keepalives while the handler was idle, got %d", keepalives)
+	}
+
+	// Keepalives stop with the handler
+	count := len(dc.sent())
+	time.Sleep(60 * time.Millisecond)
+	if got := len(dc.sent()); got != count {
+		t.Errorf("Expected no messages after stream end, got %d more", got-count)
+	}
+}
+
+func TestStreamKeepaliveDisabled(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	if len(msgs) != 1 {
+		t.Errorf("Expected only the end message, got %d messages", len(msgs))
+	}
+}
+
+func TestStreamHeaderAndTrailer(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	var lateHeaderErr error
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		if err := stream.SendHeader(map[string]string{"x-rate-limit": "10"}); err != nil {
+			return err
+		}
+		stream.SetTrailer(map[string]string{"x-total": "2"})
+		stream.SetTrailer(map[string]string{"grpc-status": "5"}) // overridden by the transport
+		if err := stream.Send([]byte("one")); err != nil {
+			return err
+		}
+		if err := stream.Send([]byte("two")); err != nil {
+			return err
+		}
+		lateHeaderErr = stream.SendHeader(map[string]string{"x-late": "true"})
+		return nil
+	})
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	msgs := waitForStreamEnd(t, dc, "stream-1")
+	if len(msgs) != 4 {
+		t.Fatalf("Expected 4 stream messages (header, 2 data, end), got %d", len(msgs))
+	}
+
+	if lateHeaderErr == nil {
+		t.Error("Expected error from SendHeader after Send")
+	}
+
+	// The header message comes before the first data message
+	if msgs[0].Flag != codec.StreamFlagHeader || msgs[0].Sequence != 0 {
+		t.Fatalf("Expected header message first, got flag %d sequence %d", msgs[0].Flag, msgs[0].Sequence)
+	}
+	headers, err := codec.DecodeStreamHeaders(msgs[0].Data)
+	if err != nil {
+		t.Fatalf("Failed to decode headers: %v", err)
+	}
+	if headers["x-rate-limit"] != "10" {
+		t.Errorf("Expected x-rate-limit header, got %v", headers)
+	}
+
+	// Then data
+	for i, want := range []string{"one", "two"} {
+		if msgs[i+1].Flag != codec.StreamFlagData {
+			t.Errorf("Message %d: expected data flag, got %d", i, msgs[i+1].Flag)
+		}
+		frames := codec.DecodeFrames(msgs[i+1].Data).Frames
+		if len(frames) != 1 || frames[0].Flags != codec.FrameData || string(frames[0].Data) != want {
+			t.Errorf("Message %d: expected data frame %q, got %+v", i, want, frames)
+		}
+	}
+
+	// Then trailers, merged with the custom values
+	frames := codec.DecodeFrames(msgs[3].Data).Frames
+	trailers := codec.ParseTrailers(frames[0].Data)
+	if trailers["x-total"] != "2" {
+		t.Errorf("Expected x-total trailer, got %v", trailers)
+	}
+	if trailers["grpc-status"] != "0" {
+		t.Errorf("Expected grpc-status 0, got %s", trailers["grpc-status"])
+	}
+}
+
+func TestStreamResumeToken(t *testing.T) {
+	resumed := make(chan string, 1)
+	handler := func(req *codec.RequestEnvelope, stream ServerStream) error {
+		start := 0
+		if token := ResumeTokenFromContext(stream.Context()); token != "" {
+			resumed <- token
+			n, err := strconv.Atoi(token)
+			if err != nil {
+				return &codec.GRPCError{Code: codec.StatusInvalidArgument, Message: "bad resume token"}
+			}
+			start = n
+		}
+		for i := start; i < 4; i++ {
+			if err := stream.Send([]byte(strconv.Itoa(i))); err != nil {
+				return err
+			}
+			if err := stream.SetResumeToken(strconv.Itoa(i + 1)); err != nil {
+				return err
+			}
+			// The first stream is interrupted after two messages
+			if start == 0 && i == 1 {
+				<-stream.Context().Done()
+				return stream.Context().Err()
+			}
+		}
+		return nil
+	}
+
+	request := func(headers map[string]string) []byte {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/Feed",
+			Headers: headers,
+			Message: []byte{},
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		return reqData
+	}
+
+	// First connection: record the latest token, then drop the transport
+	dc1 := newMockDataChannel()
+	transport1 := NewDataChannelTransportWithInterface(dc1, nil)
+	transport1.RegisterStreamingHandler("/test.Service/Feed", handler)
+	transport1.Start()
+	dc1.simulateMessage(request(map[string]string{"x-request-id": "feed-1"}))
+
+	var token string
+	deadline := time.Now().Add(time.Second)
+	for token != "2" && time.Now().Before(deadline) {
+		for _, data := range dc1.sent() {
+			msg, err := codec.DecodeStreamMessage(data)
+			if err == nil && msg.Flag == codec.StreamFlagResumeToken {
+				token = string(msg.Data)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if token != "2" {
+		t.Fatalf("Expected resume token 2 before the interruption, got %q", token)
+	}
+	transport1.Close()
+
+	// Second connection: resume with the token
+	dc2 := newMockDataChannel()
+	transport2 := NewDataChannelTransportWithInterface(dc2, nil)
+	transport2.RegisterStreamingHandler("/test.Service/Feed", handler)
+	transport2.Start()
+	dc2.simulateMessage(request(map[string]string{
+		"x-request-id":          "feed-2",
+		codec.ResumeTokenHeader: token,
+	}))
+
+	msgs := waitForStreamEnd(t, dc2, "feed-2")
+	select {
+	case got := <-resumed:
+		if got != "2" {
+			t.Errorf("Handler got resume token %q, want 2", got)
+		}
+	default:
+		t.Fatal("Handler did not get the resume token")
+	}
+
+	// Data 2, token 3, data 3, token 4, end
+	if len(msgs) != 5 {
+		t.Fatalf("Expected 5 stream messages, got %d", len(msgs))
+	}
+	for i, want := range []struct {
+		flag byte
+		data string
+	}{
+		{codec.StreamFlagData, "2"},
+		{codec.StreamFlagResumeToken, "3"},
+		{codec.StreamFlagData, "3"},
+		{codec.StreamFlagResumeToken, "4"},
+	} {
+		msg := msgs[i]
+		data := string(msg.Data)
+		if msg.Flag == codec.StreamFlagData {
+			data = string(codec.DecodeFrames(msg.Data).Frames[0].Data)
+		}
+		if msg.Flag != want.flag || data != want.data || msg.Sequence != uint32(i) {
+			t.Errorf("Message %d: got flag %d data %q sequence %d, want flag %d data %q", i, msg.Flag, data, msg.Sequence, want.flag, want.data)
+		}
+	}
+
+	// The end message carries the latest token
+	trailers := codec.ParseTrailers(codec.DecodeFrames(msgs[4].Data).Frames[0].Data)
+	if trailers[codec.ResumeTokenHeader] != "4" {
+		t.Errorf("Expected resume token trailer 4, got %v", trailers)
+	}
+	if trailers["grpc-status"] != "0" || trailers[codec.StreamCountTrailer] != "2" {
+		t.Errorf("Unexpected trailers: %v", trailers)
+	}
+}
+
+func TestMakeHandlerWithMetadata(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	handler := MakeHandlerWithMetadata(
+		func(data []byte) (string, error) {
+			return string(data), nil
+		},
+		func(resp string) ([]byte, error) {
+			return []byte(resp), nil
+		},
+		func(ctx context.Context, req string) (string, map[string]string, map[string]string, error) {
+			headers := map[string]string{"x-cache": "hit"}
+			trailers := map[string]string{"x-items": "3"}
+			if req == "override" {
+				headers["x-request-id"] = "from-handler"
+				trailers["grpc-status"] = strconv.Itoa(codec.StatusNotFound)
+			}
+			return "ok:" + req, headers, trailers, nil
+		},
+	)
+	transport.RegisterHandler("/test.Service/Method", handler)
+	transport.Start()
+
+	tests := []struct {
+		message    string
+		wantReqID  string
+		wantStatus string
+	}{
+		// Auto-filled values apply when the handler leaves them unset
+		{"plain", "req-1", "0"},
+		// Handler values win over the transport's defaults
+		{"override", "from-handler", "5"},
+	}
+
+	for i, tt := range tests {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/Method",
+			Headers: map[string]string{"x-request-id": "req-1"},
+			Message: []byte(tt.message),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+
+		sent := dc.sent()
+		if len(sent) != i+1 {
+			t.Fatalf("Expected %d responses, got %d", i+1, len(sent))
+		}
+		respEnv, err := codec.DecodeResponse(sent[i])
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if respEnv.Headers["x-cache"] != "hit" {
+			t.Errorf("%s: expected x-cache header, got %v", tt.message, respEnv.Headers)
+		}
+		if respEnv.Headers["x-request-id"] != tt.wantReqID {
+			t.Errorf("%s: expected x-request-id %q, got %q", tt.message, tt.wantReqID, respEnv.Headers["x-request-id"])
+		}
+		if respEnv.Trailers["x-items"] != "3" {
+			t.Errorf("%s: expected x-items trailer, got %v", tt.message, respEnv.Trailers)
+		}
+		if respEnv.Trailers["grpc-status"] != tt.wantStatus {
+			t.Errorf("%s: expected grpc-status %s, got %s", tt.message, tt.wantStatus, respEnv.Trailers["grpc-status"])
+		}
+		if string(respEnv.Messages[0]) != "ok:"+tt.message {
+			t.Errorf("%s: unexpected message %q", tt.message, respEnv.Messages[0])
+		}
+	}
+}
+
+func TestMakeWriterHandler(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	handler := MakeWriterHandler(func(ctx context.Context, req *codec.RequestEnvelope, w ResponseWriter) error {
+		n, err := strconv.Atoi(string(req.Message))
+		if err != nil {
+			return &codec.GRPCError{Code: codec.StatusInvalidArgument, Message: "not a number"}
+		}
+		if n < 0 {
+			w.WriteMessage([]byte("discarded"))
+			return errors.New("negative count")
+		}
+		w.SetHeader(map[string]string{"x-cache": "hit"})
+		for i := 0; i < n; i++ {
+			w.WriteMessage([]byte(fmt.Sprintf("item-%d", i)))
+		}
+		w.SetTrailer(map[string]string{"x-items": strconv.Itoa(n)})
+		return nil
+	})
+	transport.RegisterHandler("/test.Service/List", handler)
+	transport.Start()
+
+	tests := []struct {
+		message      string
+		wantMessages int
+		wantStatus   string
+	}{
+		{"3", 3, "0"},
+		{"1", 1, "0"},
+		{"0", 0, "0"},
+		// Errors discard buffered messages
+		{"x", 0, strconv.Itoa(codec.StatusInvalidArgument)},
+		{"-1", 0, strconv.Itoa(codec.StatusInternal)},
+	}
+
+	for i, tt := range tests {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/List",
+			Headers: map[string]string{"x-request-id": "req-1"},
+			Message: []byte(tt.message),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+
+		sent := dc.sent()
+		if len(sent) != i+1 {
+			t.Fatalf("Expected %d responses, got %d", i+1, len(sent))
+		}
+		respEnv, err := codec.DecodeResponse(sent[i])
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if respEnv.Trailers["grpc-status"] != tt.wantStatus {
+			t.Errorf("%s: expected grpc-status %s, got %s", tt.message, tt.wantStatus, respEnv.Trailers["grpc-status"])
+		}
+		if len(respEnv.Messages) != tt.wantMessages {
+			t.Fatalf("%s: expected %d messages, got %d", tt.message, tt.wantMessages, len(respEnv.Messages))
+		}
+		if tt.wantStatus != "0" {
+			continue
+		}
+		for j, msg := range respEnv.Messages {
+			if string(msg) != fmt.Sprintf("item-%d", j) {
+				t.Errorf("%s: message %d = %q", tt.message, j, msg)
+			}
+		}
+		if respEnv.Headers["x-cache"] != "hit" || respEnv.Headers["x-request-id"] != "req-1" {
+			t.Errorf("%s: unexpected headers %v", tt.message, respEnv.Headers)
+		}
+		if respEnv.Trailers["x-items"] != tt.message {
+			t.Errorf("%s: expected x-items trailer %s, got %v", tt.message, tt.message, respEnv.Trailers)
+		}
+	}
+}
+
+func TestMakeStreamingHandlerWithContext(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	started := make(chan string, 1)
+	done := make(chan error, 1)
+
+	handler := MakeStreamingHandlerWithContext(
+		func(data []byte) (string, error) {
+			return string(data), nil
+		},
+		func(resp string) ([]byte, error) {
+			return []byte(resp), nil
+		},
+		func(ctx context.Context, req string, stream *TypedServerStream[string]) error {
+			if ctx != stream.Context() {
+				t.Error("Expected the stream's context")
+			}
+			started <- req
+			<-ctx.Done()
+			done <- ctx.Err()
+			return ctx.Err()
+		},
+	)
+	transport.RegisterStreamingHandler("/test.Service/Stream", handler)
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "stream-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	select {
+	case req := <-started:
+		if req != "test" {
+			t.Errorf("Expected request 'test', got %q", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Streaming handler not started")
+	}
+
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-1"))
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Handler context was not cancelled")
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	var seen []string
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		seen = append(seen, RequestIDFromContext(ctx))
+		return &codec.ResponseEnvelope{}, nil
+	})
+	transport.Start()
+
+	// Client-supplied ID is used as-is
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{"x-request-id": "client-123"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	// Missing ID is generated by the server
+	reqData, err = codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Method",
+		Headers: map[string]string{},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+
+	if len(seen) != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", len(seen))
+	}
+	if seen[0] != "client-123" {
+		t.Errorf("Expected client request ID, got %q", seen[0])
+	}
+	if len(seen[1]) != 36 {
+		t.Errorf("Expected generated UUID, got %q", seen[1])
+	}
+
+	// Both IDs are echoed back
+	sent := dc.sent()
+	for i, want := range seen {
+		respEnv, err := codec.DecodeResponse(sent[i])
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if got := respEnv.Headers["x-request-id"]; got != want {
+			t.Errorf("Response %d: expected x-request-id %q, got %q", i, want, got)
+		}
+	}
+
+	if got := RequestIDFromContext(context.Background()); got != "" {
+		t.Errorf("Expected empty ID for plain context, got %q", got)
+	}
+}
+
+func TestRequestIDFunc(t *testing.T) {
+	dc := newMockDataChannel()
+	var next atomic.Int32
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout: time.Second,
+		RequestIDFunc: func() string {
+			n := next.Add(1)
+			if n == 2 {
+				return "" // falls back to a UUID
+			}
+			return fmt.Sprintf("trace-%d", n)
+		},
+	})
+
+	var seen []string
+	transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		seen = append(seen, RequestIDFromContext(ctx))
+		return &codec.ResponseEnvelope{}, nil
+	})
+	transport.Start()
+
+	for _, headers := range []map[string]string{
+		{},
+		{},
+		{"x-request-id": "client-123"},
+	} {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    "/test.Service/Method",
+			Headers: headers,
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+
+	if len(seen) != 3 {
+		t.Fatalf("Expected 3 handler calls, got %d", len(seen))
+	}
+	if seen[0] != "trace-1" {
+		t.Errorf("Expected custom request ID, got %q", seen[0])
+	}
+	if len(seen[1]) != 36 {
+		t.Errorf("Expected UUID when generator returns empty, got %q", seen[1])
+	}
+	if seen[2] != "client-123" {
+		t.Errorf("Expected client request ID, got %q", seen[2])
+	}
+	// The generator is only consulted when the header is absent
+	if n := next.Load(); n != 2 {
+		t.Errorf("Expected 2 generator calls, got %d", n)
+	}
+
+	respEnv, err := codec.DecodeResponse(dc.sent()[0])
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := respEnv.Headers["x-request-id"]; got != "trace-1" {
+		t.Errorf("Expected generated ID to be echoed, got %q", got)
+	}
+}
+
+func TestMakeJSONHandler(t *testing.T) {
+	type EchoRequest struct {
+		Message string `json:"message"`
+	}
+	type EchoResponse struct {
+		Message string `json:"message"`
+	}
+
+	var mu sync.Mutex
+	reported := map[int]error{}
+	client, transport := newPipeClient(t, &HandlerOptions{
+		OnHandlerError: func(path string, code int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported[code] = err
+		},
+	})
+	transport.RegisterHandler("/test.Service/Echo", MakeJSONHandler(func(ctx context.Context, req EchoRequest) (EchoResponse, error) {
+		if req.Message == "fail" {
+			return EchoResponse{}, &codec.GRPCError{Code: codec.StatusFailedPrecondition, Message: `bad "input"`}
+		}
+		return EchoResponse{Message: "echo:" + req.Message}, nil
+	}))
+	transport.Start()
+
+	tests := []struct {
+		name       string
+		message    string
+		wantStatus string
+		wantBody   string
+	}{
+		{"success", `{"message":"hi"}`, "0", `{"message":"echo:hi"}`},
+		{"empty request", ``, "0", `{"message":"echo:"}`},
+		{"handler error", `{"message":"fail"}`, "9", `{"error":"bad \"input\""}`},
+		{"invalid JSON", `{not json`, "3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			resp, err := client.Invoke(ctx, "/test.Service/Echo", []byte(tt.message), nil)
+			if resp == nil {
+				t.Fatalf("Invoke failed: %v", err)
+			}
+			if (err != nil) != (tt.wantStatus != "0") {
+				t.Errorf("Expected an error only for non-OK status, got %v", err)
+			}
+
+			if resp.Headers["content-type"] != codec.ContentTypeJSON {
+				t.Errorf("Expected JSON content-type, got %q", resp.Headers["content-type"])
+			}
+			if resp.Trailers["grpc-status"] != tt.wantStatus {
+				t.Errorf("Expected grpc-status %s, got %s", tt.wantStatus, resp.Trailers["grpc-status"])
+			}
+			if len(resp.Messages) != 1 || !json.Valid(resp.Messages[0]) {
+				t.Fatalf("Expected a single valid JSON body, got %q", resp.Messages)
+			}
+			if tt.wantBody != "" && string(resp.Messages[0]) != tt.wantBody {
+				t.Errorf("Expected body %s, got %s", tt.wantBody, resp.Messages[0])
+			}
+		})
+	}
+
+	// Both errors reach OnHandlerError
+	mu.Lock()
+	defer mu.Unlock()
+	for _, code := range []int{codec.StatusFailedPrecondition, codec.StatusInvalidArgument} {
+		grpcErr, ok := codec.GRPCErrorFrom(reported[code])
+		if !ok || grpcErr.Code != code {
+			t.Errorf("Expected %s to be reported, got %v", codec.GetStatusName(code), reported)
+		}
+	}
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	handler := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	}
+	streamHandler := func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return nil
+	}
+
+	transport.Start()
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/plugin.Service/Method",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+
+	const iterations = 200
+	var wg sync.WaitGroup
+
+	// Register and unregister handlers while requests arrive
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < iterations; i++ {
+			if i%2 == 0 {
+				transport.RegisterHandler("/plugin.Service/Method", handler)
+			} else {
+				transport.RegisterStreamingHandler("/plugin.Service/Method", streamHandler)
+			}
+			transport.GetRegisteredMethods()
+			transport.UnregisterHandler("/plugin.Service/Method")
+		}
+	}()
+
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				dc.simulateMessage(reqData)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Requests are answered either by a handler or with UNIMPLEMENTED
+	if got := len(dc.sent()); got == 0 {
+		t.Error("Expected responses to be sent")
+	}
+}
+
+func TestRegisterHandlerStrict(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	handler := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	}
+	streamHandler := func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return nil
+	}
+
+	if err := transport.RegisterHandlerStrict("/test.Service/Unary", handler); err != nil {
+		t.Fatalf("First registration failed: %v", err)
+	}
+	if err := transport.RegisterStreamingHandlerStrict("/test.Service/Stream", streamHandler); err != nil {
+		t.Fatalf("First streaming registration failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{"duplicate unary", transport.RegisterHandlerStrict("/test.Service/Unary", handler), ErrDuplicateHandler},
+		{"duplicate streaming", transport.RegisterStreamingHandlerStrict("/test.Service/Stream", streamHandler), ErrDuplicateHandler},
+		{"unary over streaming", transport.RegisterHandlerStrict("/test.Service/Stream", handler), ErrConflictingHandler},
+		{"streaming over unary", transport.RegisterStreamingHandlerStrict("/test.Service/Unary", streamHandler), ErrConflictingHandler},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, tt.err)
+		}
+	}
+
+	// The forgiving methods still overwrite
+	transport.RegisterHandler("/test.Service/Unary", handler)
+
+	// Unregistering frees the path for strict registration again
+	transport.UnregisterHandler("/test.Service/Stream")
+	if err := transport.RegisterHandlerStrict("/test.Service/Stream", handler); err != nil {
+		t.Errorf("Registration after unregister failed: %v", err)
+	}
+}
+
+func TestGetRegisteredMethodsDetailed(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	unary := func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	}
+	streaming := func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return nil
+	}
+
+	transport.RegisterHandler("/test.Service/Unary", unary)
+	transport.RegisterStreamingHandler("/test.Service/Stream", streaming)
+
+	methods := transport.GetRegisteredMethodsDetailed()
+	want := []MethodInfo{
+		{Path: "/test.Service/Stream", ServerStreaming: true},
+		{Path: "/test.Service/Unary"},
+	}
+	if len(methods) != len(want) {
+		t.Fatalf("Expected %d methods, got %d", len(want), len(methods))
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Errorf("Method %d: expected %+v, got %+v", i, want[i], methods[i])
+		}
+	}
+
+	// The flat list still contains both
+	if len(transport.GetRegisteredMethods()) != 2 {
+		t.Errorf("Expected 2 methods from GetRegisteredMethods")
+	}
+}
+
+func TestRegisterHandlerAlias(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	var calls []string
+	transport.RegisterHandler("/test.v2.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		calls = append(calls, req.Path)
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.RegisterStreamingHandler("/test.v2.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return nil
+	})
+
+	if err := transport.RegisterHandlerAlias("/test.Service/Method", "/test.v2.Service/Method"); err != nil {
+		t.Fatalf("RegisterHandlerAlias failed: %v", err)
+	}
+	if err := transport.RegisterHandlerAlias("/test.Service/Stream", "/test.v2.Service/Stream"); err != nil {
+		t.Fatalf("RegisterHandlerAlias failed: %v", err)
+	}
+	if err := transport.RegisterHandlerAlias("/test.Service/Missing", "/test.v2.Service/Missing"); !errors.Is(err, ErrHandlerNotFound) {
+		t.Errorf("Expected ErrHandlerNotFound, got %v", err)
+	}
+	if err := transport.RegisterHandlerAlias("/test.v2.Service/Stream", "/test.v2.Service/Method"); !errors.Is(err, ErrDuplicateHandler) {
+		t.Errorf("Expected ErrDuplicateHandler, got %v", err)
+	}
+	transport.Start()
+
+	call := func(path string) *codec.ResponseEnvelope {
+		t.Helper()
+		before := len(dc.sent())
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    path,
+			Headers: map[string]string{"x-request-id": "req-1"},
+			Message: []byte("hello"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+		resp, err := codec.DecodeResponse(dc.sent()[before])
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	// Both paths reach the same handler, which sees the path it was called on
+	for _, path := range []string{"/test.v2.Service/Method", "/test.Service/Method"} {
+		if resp := call(path); codec.GetError(*resp) != nil || string(resp.Messages[0]) != "hello" {
+			t.Errorf("%s: unexpected response %+v", path, resp)
+		}
+	}
+	if !reflect.DeepEqual(calls, []string{"/test.v2.Service/Method", "/test.Service/Method"}) {
+		t.Errorf("Unexpected handler calls: %v", calls)
+	}
+
+	// Reflection lists aliases with their target's kind
+	methods := transport.GetRegisteredMethodsDetailed()
+	want := []MethodInfo{
+		{Path: "/test.Service/Method"},
+		{Path: "/test.Service/Stream", ServerStreaming: true},
+		{Path: "/test.v2.Service/Method"},
+		{Path: "/test.v2.Service/Stream", ServerStreaming: true},
+	}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("GetRegisteredMethodsDetailed = %+v, want %+v", methods, want)
+	}
+	if n := len(transport.GetRegisteredMethods()); n != 4 {
+		t.Errorf("Expected 4 methods from GetRegisteredMethods, got %d", n)
+	}
+
+	// Unregistering the target removes its aliases
+	transport.UnregisterHandler("/test.v2.Service/Method")
+	resp := call("/test.Service/Method")
+	if grpcErr := codec.GetError(*resp); grpcErr == nil || grpcErr.Code != codec.StatusUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED for removed alias, got %v", grpcErr)
+	}
+	if n := len(transport.GetRegisteredMethods()); n != 2 {
+		t.Errorf("Expected 2 methods after unregistering, got %d", n)
+	}
+}
+
+func TestResponseCompressionNegotiation(t *testing.T) {
+	message := []byte(strings.Repeat("compressible ", 100))
+
+	tests := []struct {
+		name         string
+		accept       string
+		optOut       bool
+		wantEncoding string
+	}{
+		{name: "no accept-encoding", wantEncoding: codec.EncodingIdentity},
+		{name: "identity only", accept: "identity", wantEncoding: codec.EncodingIdentity},
+		{name: "gzip accepted", accept: "identity, gzip", wantEncoding: codec.EncodingGzip},
+		{name: "handler opts out", accept: "gzip", optOut: true, wantEncoding: codec.EncodingIdentity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := newMockDataChannel()
+			transport := NewDataChannelTransportWithInterface(dc, nil)
+
+			var negotiated string
+			transport.RegisterHandler("/test.Service/Method", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+				negotiated = EncodingFromContext(ctx)
+				headers := map[string]string{}
+				if tt.optOut {
+					headers["grpc-encoding"] = codec.EncodingIdentity
+				}
+				return &codec.ResponseEnvelope{
+					Headers:  headers,
+					Messages: [][]byte{message},
+				}, nil
+			})
+			transport.Start()
+
+			headers := map[string]string{"x-request-id": "req-1"}
+			if tt.accept != "" {
+				headers["grpc-accept-encoding"] = tt.accept
+			}
+			reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+				Path:    "/test.Service/Method",
+				Headers: headers,
+				Message: []byte("test"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to encode request: %v", err)
+			}
+			dc.simulateMessage(reqData)
+
+			wantNegotiated := tt.wantEncoding
+			if tt.optOut {
+				wantNegotiated = codec.EncodingGzip
+			}
+			if negotiated != wantNegotiated {
+				t.Errorf("EncodingFromContext = %q, want %q", negotiated, wantNegotiated)
+			}
+
+			sent := dc.sent()
+			if len(sent) != 1 {
+				t.Fatalf("Expected 1 response, got %d", len(sent))
+			}
+
+			// The data frame is compressed only when gzip was negotiated
+			_, body := codec.SplitPayload(sent[0])
+			headersLen := binary.BigEndian.Uint32(body[:4])
+			frames := codec.DecodeFrames(body[4+headersLen:]).Frames
+			wantFlags := codec.FrameData
+			if tt.wantEncoding == codec.EncodingGzip {
+				wantFlags = codec.FrameCompressed
+			}
+			if frames[0].Flags != wantFlags {
+				t.Errorf("Data frame flags = %d, want %d", frames[0].Flags, wantFlags)
+			}
+
+			resp, err := codec.DecodeResponse(sent[0])
+			if err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			gotEncoding := resp.Headers["grpc-encoding"]
+			if gotEncoding == "" {
+				gotEncoding = codec.EncodingIdentity
+			}
+			if gotEncoding != tt.wantEncoding {
+				t.Errorf("grpc-encoding = %q, want %q", gotEncoding, tt.wantEncoding)
+			}
+			if len(resp.Messages) != 1 || !bytes.Equal(resp.Messages[0], message) {
+				t.Error("Response message not preserved")
+			}
+		})
+	}
+}
+
+func TestOnHandlerError(t *testing.T) {
+	type report struct {
+		path string
+		code int
+		err  error
+	}
+	var mu sync.Mutex
+	var reports []report
+
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout: time.Second,
+		OnHandlerError: func(path string, code int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, report{path, code, err})
+		},
+	})
+
+	grpcErr := &codec.GRPCError{Code: codec.StatusNotFound, Message: "no such item"}
+	plainErr := errors.New("database unavailable")
+	streamErr := errors.New("stream broke")
+
+	transport.RegisterHandler("/test.Service/NotFound", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return nil, grpcErr
+	})
+	transport.RegisterHandler("/test.Service/Plain", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return nil, fmt.Errorf("lookup: %w", plainErr)
+	})
+	transport.RegisterHandler("/test.Service/OK", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{}, nil
+	})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		return streamErr
+	})
+	transport.Start()
+
+	for i, path := range []string{"/test.Service/NotFound", "/test.Service/Plain", "/test.Service/OK", "/test.Service/Stream"} {
+		reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+			Path:    path,
+			Headers: map[string]string{"x-request-id": fmt.Sprintf("stream-%d", i)},
+			Message: []byte("test"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		dc.simulateMessage(reqData)
+	}
+	waitForStreamEnd(t, dc, "stream-3")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 reported errors, got %d: %+v", len(reports), reports)
+	}
+
+	want := []struct {
+		path string
+		code int
+		err  error
+	}{
+		{"/test.Service/NotFound", codec.StatusNotFound, grpcErr},
+		{"/test.Service/Plain", codec.StatusInternal, plainErr},
+		{"/test.Service/Stream", codec.StatusInternal, streamErr},
+	}
+	for i, w := range want {
+		got := reports[i]
+		if got.path != w.path || got.code != w.code {
+			t.Errorf("Report %d: got %s code %d, want %s code %d", i, got.path, got.code, w.path, w.code)
+		}
+		// The original error is passed through, not the flattened status
+		if !errors.Is(got.err, w.err) {
+			t.Errorf("Report %d: got error %v, want %v", i, got.err, w.err)
+		}
+	}
+}
+
+func TestClientStreamMessageDispatch(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	started := make(chan struct{})
+	transport.RegisterStreamingHandler("/test.Service/Wait", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		close(started)
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	})
+	transport.Start()
+
+	streamMessage := func(requestID string, flag byte) []byte {
+		return codec.MarkPayload(codec.PayloadTypeStream, codec.EncodeStreamMessage(codec.StreamMessage{
+			RequestID: requestID,
+			Flag:      flag,
+			Data:      codec.EncodeFrame(codec.CreateDataFrame([]byte("x"))),
+		}))
+	}
+
+	// Data for an unknown stream is answered with a NOT_FOUND end message,
+	// not decoded as a request
+	dc.simulateMessage(streamMessage("stream-unknown", codec.StreamFlagData))
+	msgs := waitForStreamEnd(t, dc, "stream-unknown")
+	if len(msgs) != 1 {
+		t.Fatalf("Expected only an end message, got %d messages", len(msgs))
+	}
+	trailers := codec.ParseTrailers(codec.DecodeFrames(msgs[0].Data).Frames[0].Data)
+	if trailers["grpc-status"] != strconv.Itoa(codec.StatusNotFound) {
+		t.Errorf("Expected NOT_FOUND, got %v", trailers)
+	}
+
+	// Keepalives and undecodable stream messages are dropped silently
+	before := len(dc.sent())
+	dc.simulateMessage(streamMessage("stream-unknown", codec.StreamFlagKeepalive))
+	dc.simulateMessage(codec.MarkPayload(codec.PayloadTypeStream, []byte{0xff, 0xff, 0xff, 0xff}))
+	if n := len(dc.sent()) - before; n != 0 {
+		t.Errorf("Expected no response to dropped messages, got %d", n)
+	}
+
+	// Data for an active stream is dropped and the stream keeps running
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Wait",
+		Headers: map[string]string{"x-request-id": "stream-active"},
+		Message: []byte("test"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(reqData)
+	<-started
+
+	before = len(dc.sent())
+	dc.simulateMessage(streamMessage("stream-active", codec.StreamFlagData))
+	if n := len(dc.sent()) - before; n != 0 {
+		t.Errorf("Expected no response to data for an active stream, got %d", n)
+	}
+
+	dc.simulateMessage(codec.EncodeCancelMessage("stream-active"))
+	msgs = waitForStreamEnd(t, dc, "stream-active")
+	trailers = codec.ParseTrailers(codec.DecodeFrames(msgs[len(msgs)-1].Data).Frames[0].Data)
+	if trailers["grpc-status"] == strconv.Itoa(codec.StatusNotFound) {
+		t.Errorf("Active stream was answered as unknown: %v", trailers)
+	}
+}
+
+func TestActiveRequests(t *testing.T) {
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, nil)
+
+	release := make(chan struct{})
+	entered := make(chan struct{}, 2)
+	transport.RegisterStreamingHandler("/test.Service/Feed", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		entered <- struct{}{}
+		<-release
+		return nil
+	})
+	transport.RegisterHandler("/test.Service/Slow", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		entered <- struct{}{}
+		<-release
+		return &codec.ResponseEnvelope{}, nil
+	})
+	transport.Start()
+
+	if active := transport.ActiveRequests(); len(active) != 0 {
+		t.Fatalf("Expected no active requests, got %+v", active)
+	}
+
+	before := time.Now()
+	for _, req := range []codec.RequestEnvelope{
+		{Path: "/test.Service/Feed", Headers: map[string]string{"x-request-id": "feed-1"}, Message: []byte{}},
+		{Path: "/test.Service/Slow", Headers: map[string]string{"x-request-id": "slow-1"}, Message: []byte{}},
+	} {
+		reqData, err := codec.EncodeRequest(req)
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		// Unary handlers run on the delivering goroutine
+		go dc.simulateMessage(reqData)
+		<-entered
+	}
+
+	active := transport.ActiveRequests()
+	if len(active) != 2 {
+		t.Fatalf("Expected 2 active requests, got %+v", active)
+	}
+	if active[0].Path != "/test.Service/Feed" || active[0].RequestID != "feed-1" || !active[0].Streaming {
+		t.Errorf("Unexpected first request: %+v", active[0])
+	}
+	if active[1].Path != "/test.Service/Slow" || active[1].RequestID != "slow-1" || active[1].Streaming {
+		t.Errorf("Unexpected second request: %+v", active[1])
+	}
+	for _, info := range active {
+		if info.Started.Before(before) || info.Started.After(time.Now()) {
+			t.Errorf("Unexpected start time for %s: %v", info.RequestID, info.Started)
+		}
+	}
+
+	close(release)
+	waitForStreamEnd(t, dc, "feed-1")
+
+	deadline := time.Now().Add(time.Second)
+	for len(transport.ActiveRequests()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if active := transport.ActiveRequests(); len(active) != 0 {
+		t.Errorf("Expected finished requests to be removed, got %+v", active)
+	}
+}
+
+// capturingLogHandler is an slog.Handler that records what it handles
+type capturingLogHandler struct {
+	mu      sync.Mutex
+	level   slog.Level
+	records []slog.Record
+}
+
+func (h *capturingLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *capturingLogHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *capturingLogHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *capturingLogHandler) WithGroup(string) slog.Handler      { return h }
+
+// attrs returns the attributes of the i-th record, or nil if there is none
+func (h *capturingLogHandler) attrs(i int) map[string]slog.Value {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i >= len(h.records) {
+		return nil
+	}
+	attrs := make(map[string]slog.Value)
+	h.records[i].Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func TestRequestLogger(t *testing.T) {
+	debug := &capturingLogHandler{level: slog.LevelDebug}
+	dc := newMockDataChannel()
+	transport := NewDataChannelTransportWithInterface(dc, &HandlerOptions{
+		Timeout: time.Second,
+		Logger:  slog.New(debug),
+	})
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.RegisterStreamingHandler("/test.Service/Stream", func(req *codec.RequestEnvelope, stream ServerStream) error {
+		if err := stream.Send(req.Message); err != nil {
+			return err
+		}
+		return errors.New("stream broke")
+	})
+	transport.Start()
+
+	unaryReq, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Echo",
+		Headers: map[string]string{"x-request-id": "log-1"},
+		Message: []byte("secret-payload"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(unaryReq)
+
+	sent := dc.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(sent))
+	}
+	attrs := debug.attrs(0)
+	if attrs == nil {
+		t.Fatal("Expected a debug record for the unary request")
+	}
+	if attrs["path"].String() != "/test.Service/Echo" || attrs["request_id"].String() != "log-1" {
+		t.Errorf("Unexpected path or request ID: %v", attrs)
+	}
+	if attrs["request_bytes"].Int64() != int64(len(unaryReq)) || attrs["response_bytes"].Int64() != int64(len(sent[0])) {
+		t.Errorf("Expected %d request and %d response bytes, got %v", len(unaryReq), len(sent[0]), attrs)
+	}
+	if attrs["grpc_status"].Int64() != codec.StatusOK || attrs["duration"].Kind() != slog.KindDuration {
+		t.Errorf("Unexpected status or duration: %v", attrs)
+	}
+
+	streamReq, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Stream",
+		Headers: map[string]string{"x-request-id": "log-2"},
+		Message: []byte("secret-payload"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	dc.simulateMessage(streamReq)
+	waitForStreamEnd(t, dc, "log-2")
+
+	// The stream is logged after its end message is sent
+	deadline := time.Now().Add(time.Second)
+	for debug.attrs(1) == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	attrs = debug.attrs(1)
+	if attrs == nil {
+		t.Fatal("Expected a debug record for the streaming request")
+	}
+	streamBytes := 0
+	for _, data := range dc.sent()[1:] {
+		streamBytes += len(data)
+	}
+	if attrs["path"].String() != "/test.Service/Stream" || attrs["request_id"].String() != "log-2" {
+		t.Errorf("Unexpected path or request ID: %v", attrs)
+	}
+	if attrs["request_bytes"].Int64() != int64(len(streamReq)) || attrs["response_bytes"].Int64() != int64(streamBytes) {
+		t.Errorf("Expected %d request and %d response bytes, got %v", len(streamReq), streamBytes, attrs)
+	}
+	if attrs["grpc_status"].Int64() != codec.StatusInternal {
+		t.Errorf("Expected grpc_status %d, got %v", codec.StatusInternal, attrs["grpc_status"])
+	}
+
+	// Message contents are never logged
+	debug.mu.Lock()
+	for _, r := range debug.records {
+		r.Attrs(func(a slog.Attr) bool {
+			if strings.Contains(a.Value.String(), "secret") {
+				t.Errorf("Record attribute %s leaks message contents: %v", a.Key, a.Value)
+			}
+			return true
+		})
+	}
+	debug.mu.Unlock()
+
+	// Nothing is logged unless the logger is enabled for debug
+	info := &capturingLogHandler{level: slog.LevelInfo}
+	dc2 := newMockDataChannel()
+	quiet := NewDataChannelTransportWithInterface(dc2, &HandlerOptions{
+		Timeout: time.Second,
+		Logger:  slog.New(info),
+	})
+	quiet.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	quiet.Start()
+	dc2.simulateMessage(unaryReq)
+	if len(dc2.sent()) != 1 {
+		t.Fatalf("Expected 1 response, got %d", len(dc2.sent()))
+	}
+	if info.attrs(0) != nil {
+		t.Errorf("Expected no records below debug level, got %v", info.attrs(0))
+	}
+}
+
+func TestTrailerFunc(t *testing.T) {
+	client, transport := newPipeClient(t, &HandlerOptions{
+		Timeout:      time.Second,
+		TrailersOnly: true,
+		TrailerFunc: func(ctx context.Context, resp *codec.ResponseEnvelope) {
+			resp.Trailers["x-request-id-seen"] = RequestIDFromContext(ctx)
+			if resp.Trailers["grpc-status"] != strconv.Itoa(codec.StatusOK) {
+				resp.Trailers["grpc-status-details-bin"] = "ZGV0YWlscw"
+			}
+		},
+	})
+	transport.RegisterHandler("/test.Service/OK", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{Messages: [][]byte{req.Message}}, nil
+	})
+	transport.RegisterHandler("/test.Service/Fail", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return nil, &codec.GRPCError{Code: codec.StatusNotFound, Message: "missing"}
+	})
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, "/test.Service/OK", []byte("hi"), map[string]string{"x-request-id": "req-ok"})
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if resp.Trailers["x-request-id-seen"] != "req-ok" || resp.Trailers["grpc-status"] != "0" {
+		t.Errorf("Unexpected trailers: %v", resp.Trailers)
+	}
+
+	// Error responses are trailers-only here, so the added trailers must
+	// survive being merged into the headers
+	resp, err = client.Invoke(ctx, "/test.Service/Fail", nil, map[string]string{"x-request-id": "req-fail"})
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusNotFound {
+		t.Fatalf("Expected NOT_FOUND, got %v", err)
+	}
+	if resp.Trailers["x-request-id-seen"] != "req-fail" || resp.Trailers["grpc-status-details-bin"] != "ZGV0YWlscw" {
+		t.Errorf("Unexpected trailers: %v", resp.Trailers)
+	}
+}
@@ -101,6 +101,30 @@ func ExampleMakeHandler() {
 	defer trans.Close()
 }
 
+// Example: Returning a variable number of messages from one handler
+func ExampleMakeWriterHandler() {
+	handler := transport.MakeWriterHandler(func(ctx context.Context, req *codec.RequestEnvelope, w transport.ResponseWriter) error {
+		// Decide at runtime how many messages to return
+		for _, page := range []string{"page-1", "page-2", "page-3"} {
+			w.WriteMessage([]byte(page))
+		}
+		w.SetTrailer(map[string]string{"x-pages": "3"})
+		return nil
+	})
+
+	// The messages are buffered and sent as one unary response
+	resp, _ := handler(context.Background(), &codec.RequestEnvelope{Path: "/print.PrintService/Preview"})
+	for _, msg := range resp.Messages {
+		fmt.Println(string(msg))
+	}
+	fmt.Println("grpc-status:", resp.Trailers["grpc-status"])
+	// Output:
+	// page-1
+	// page-2
+	// page-3
+	// grpc-status: 0
+}
+
 // Example: Error handling
 func ExampleDataChannelTransport_errorHandling() {
 	var dc *webrtc.DataChannel
@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// PingPath is the path of the built-in ping method. It lives in an internal
+// namespace so it cannot collide with user services.
+const PingPath = "/grpcweb.internal.Ping/Ping"
+
+// RegisterPingHandler registers the ping method, which echoes its request
+// back so that Client.Ping can measure the round-trip time over the
+// DataChannel itself. It is not registered by default.
+func (t *DataChannelTransport) RegisterPingHandler() {
+	t.RegisterHandler(PingPath, pingHandler)
+}
+
+// pingHandler echoes the request message
+func pingHandler(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+	return &codec.ResponseEnvelope{
+		Headers:  map[string]string{},
+		Messages: [][]byte{req.Message},
+		Trailers: map[string]string{"grpc-status": strconv.Itoa(codec.StatusOK)},
+	}, nil
+}
+
+// Ping measures the application-level round-trip time to a transport with
+// RegisterPingHandler enabled, by sending a timestamp to PingPath and
+// waiting for it to be echoed. The transport returns UNIMPLEMENTED if the
+// ping method is not registered.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	payload := binary.BigEndian.AppendUint64(nil, uint64(start.UnixNano()))
+
+	resp, err := c.Invoke(ctx, PingPath, payload, nil)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+
+	if len(resp.Messages) != 1 || !bytes.Equal(resp.Messages[0], payload) {
+		return 0, errors.New("unexpected ping response")
+	}
+	return rtt, nil
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+func TestPing(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.RegisterPingHandler()
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rtt, err := client.Ping(ctx)
+	if err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if rtt <= 0 || rtt > 2*time.Second {
+		t.Errorf("Unexpected round-trip time %v", rtt)
+	}
+
+	// The ping method is namespaced away from user services
+	for _, method := range transport.GetRegisteredMethods() {
+		if method != PingPath {
+			t.Errorf("Unexpected registered method %s", method)
+		}
+	}
+}
+
+func TestPingNotRegistered(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	transport.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := client.Ping(ctx)
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Pipe returns two linked in-memory DataChannelInterfaces: messages sent on a
+// arrive at b's OnMessage handler and vice versa. It lets a client be tested
+// against a DataChannelTransport without WebRTC:
+//
+//	client, server := transport.Pipe()
+//	t := transport.NewDataChannelTransportWithInterface(server, nil)
+//	t.RegisterHandler("/echo.EchoService/Echo", handler)
+//	t.Start()
+//	client.OnMessage(func(msg webrtc.DataChannelMessage) { ... })
+//	client.Send(request)
+//
+// Like a DataChannel, each end delivers messages asynchronously, one at a
+// time and in the order they were sent; Send is safe for concurrent use.
+// Messages are queued until OnMessage is set. Closing either end closes
+// both: Send then fails with io.ErrClosedPipe, and each end fires OnClose
+// after delivering the messages already queued. Close the pipe to release
+// its delivery goroutines.
+func Pipe() (a, b DataChannelInterface) {
+	pa := newPipeEnd()
+	pb := newPipeEnd()
+	pa.peer = pb
+	pb.peer = pa
+
+	go pa.deliver()
+	go pb.deliver()
+
+	return pa, pb
+}
+
+// pipeEnd is one end of a Pipe
+type pipeEnd struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	peer      *pipeEnd
+	queue     [][]byte
+	closed    bool
+	onMessage func(msg webrtc.DataChannelMessage)
+	onClose   func()
+}
+
+func newPipeEnd() *pipeEnd {
+	e := &pipeEnd{}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Send queues a copy of data for delivery on the other end
+func (e *pipeEnd) Send(data []byte) error {
+	e.mu.Lock()
+	closed := e.closed
+	e.mu.Unlock()
+	if closed {
+		return io.ErrClosedPipe
+	}
+
+	msg := append([]byte(nil), data...)
+
+	p := e.peer
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return io.ErrClosedPipe
+	}
+	p.queue = append(p.queue, msg)
+	p.cond.Broadcast()
+	return nil
+}
+
+// Close closes both ends of the pipe
+func (e *pipeEnd) Close() error {
+	e.shutdown()
+	e.peer.shutdown()
+	return nil
+}
+
+func (e *pipeEnd) shutdown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.cond.Broadcast()
+}
+
+func (e *pipeEnd) OnMessage(f func(msg webrtc.DataChannelMessage)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onMessage = f
+	e.cond.Broadcast()
+}
+
+func (e *pipeEnd) OnClose(f func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onClose = f
+}
+
+// OnError is a no-op; pipes do not fail
+func (e *pipeEnd) OnError(f func(err error)) {}
+
+// deliver passes queued messages to the OnMessage handler one at a time,
+// then fires OnClose once the pipe is closed and the queue is drained
+func (e *pipeEnd) deliver() {
+	for {
+		e.mu.Lock()
+		for !e.closed && (len(e.queue) == 0 || e.onMessage == nil) {
+			e.cond.Wait()
+		}
+
+		if len(e.queue) > 0 && e.onMessage != nil {
+			msg := e.queue[0]
+			e.queue = e.queue[1:]
+			onMessage := e.onMessage
+			e.mu.Unlock()
+
+			onMessage(webrtc.DataChannelMessage{Data: msg})
+			continue
+		}
+
+		e.queue = nil
+		onClose := e.onClose
+		e.mu.Unlock()
+
+		if onClose != nil {
+			onClose()
+		}
+		return
+	}
+}
@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestPipeOrderAndConcurrency(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+
+	const senders, perSender = 4, 100
+
+	var mu sync.Mutex
+	received := make(map[int][]int)
+	done := make(chan struct{})
+	count := 0
+	b.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var sender, seq int
+		fmt.Sscanf(string(msg.Data), "%d:%d", &sender, &seq)
+		mu.Lock()
+		received[sender] = append(received[sender], seq)
+		count++
+		if count == senders*perSender {
+			close(done)
+		}
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				if err := a.Send([]byte(fmt.Sprintf("%d:%d", s, i))); err != nil {
+					t.Errorf("Send failed: %v", err)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Not all messages were delivered")
+	}
+
+	// Each sender's messages arrive in the order they were sent
+	mu.Lock()
+	defer mu.Unlock()
+	for s, seqs := range received {
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("Sender %d: message %d arrived at position %d", s, seq, i)
+			}
+		}
+	}
+}
+
+func TestPipeQueuesUntilOnMessage(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+
+	if err := a.Send([]byte("early")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	got := make(chan string, 1)
+	b.OnMessage(func(msg webrtc.DataChannelMessage) {
+		got <- string(msg.Data)
+	})
+
+	select {
+	case msg := <-got:
+		if msg != "early" {
+			t.Errorf("Expected 'early', got %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Queued message not delivered")
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	a, b := Pipe()
+
+	closedA := make(chan struct{})
+	closedB := make(chan struct{})
+	a.OnClose(func() { close(closedA) })
+	b.OnClose(func() { close(closedB) })
+
+	a.Close()
+
+	for name, ch := range map[string]chan struct{}{"a": closedA, "b": closedB} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("OnClose not called on %s", name)
+		}
+	}
+
+	if err := a.Send([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Expected io.ErrClosedPipe from a, got %v", err)
+	}
+	if err := b.Send([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Expected io.ErrClosedPipe from b, got %v", err)
+	}
+}
+
+func TestPipeTransport(t *testing.T) {
+	client, server := Pipe()
+
+	transport := NewDataChannelTransportWithInterface(server, nil)
+	transport.RegisterHandler("/test.Service/Echo", func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+			Trailers: map[string]string{"grpc-status": "0"},
+		}, nil
+	})
+	transport.Start()
+	defer transport.Close()
+
+	responses := make(chan *codec.ResponseEnvelope, 1)
+	client.OnMessage(func(msg webrtc.DataChannelMessage) {
+		resp, err := codec.DecodeResponse(msg.Data)
+		if err != nil {
+			t.Errorf("Failed to decode response: %v", err)
+			return
+		}
+		responses <- resp
+	})
+
+	reqData, err := codec.EncodeRequest(codec.RequestEnvelope{
+		Path:    "/test.Service/Echo",
+		Headers: map[string]string{"x-request-id": "req-1"},
+		Message: []byte("hello"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	if err := client.Send(codec.MarkPayload(codec.PayloadTypeEnvelope, reqData)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	select {
+	case resp := <-responses:
+		if len(resp.Messages) != 1 || string(resp.Messages[0]) != "hello" {
+			t.Errorf("Expected echo of 'hello', got %q", resp.Messages)
+		}
+		if resp.Headers["x-request-id"] != "req-1" {
+			t.Errorf("Expected x-request-id req-1, got %q", resp.Headers["x-request-id"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No response received")
+	}
+}
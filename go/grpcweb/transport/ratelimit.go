@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter decides whether a request may be dispatched.
+// It is consulted once per request before the handler runs; requests it
+// denies are answered with RESOURCE_EXHAUSTED.
+type Limiter interface {
+	// Allow reports whether a request for the method path may proceed
+	Allow(path string) bool
+}
+
+// TokenBucketLimiter is a Limiter with a separate token bucket per method path.
+// Each bucket holds up to burst tokens and refills at rate tokens per second;
+// a request takes one token.
+type TokenBucketLimiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter creates a limiter allowing rate requests per second
+// per method path, with bursts of up to burst requests
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket for path if one is available
+func (l *TokenBucketLimiter) Allow(path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[path]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[path] = b
+	}
+
+	// Refill for the time since the last request
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(2, 3)
+	now := time.Unix(0, 0)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is available immediately
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("/test.Service/Method") {
+			t.Fatalf("Request %d within burst should be allowed", i)
+		}
+	}
+	if limiter.Allow("/test.Service/Method") {
+		t.Error("Request beyond burst should be denied")
+	}
+
+	// Other methods have their own bucket
+	if !limiter.Allow("/test.Service/Other") {
+		t.Error("Request for another method should be allowed")
+	}
+
+	// Half a second at 2/s refills one token
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.Allow("/test.Service/Method") {
+		t.Error("Request after refill should be allowed")
+	}
+	if limiter.Allow("/test.Service/Method") {
+		t.Error("Only one token should have been refilled")
+	}
+
+	// Refill is capped at the burst size
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("/test.Service/Method") {
+			t.Fatalf("Request %d after long idle should be allowed", i)
+		}
+	}
+	if limiter.Allow("/test.Service/Method") {
+		t.Error("Refill should not exceed burst")
+	}
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// Retry policy defaults, used for zero fields of a RetryPolicy
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff     = 2 * time.Second
+	DefaultRetryMultiplier     = 2.0
+)
+
+// RetryPolicy describes how Client.Invoke retries a method. Attempts that
+// fail with one of RetryableCodes, or because the request could not be sent
+// (ErrSendFailed), are retried after a backoff. Retrying runs the method
+// again, so only set a policy for idempotent methods.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first
+	// (default DefaultRetryMaxAttempts)
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry
+	// (default DefaultRetryInitialBackoff)
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff (default DefaultRetryMaxBackoff)
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each retry
+	// (default DefaultRetryMultiplier)
+	Multiplier float64
+	// RetryableCodes are the gRPC status codes that are retried
+	// (default UNAVAILABLE)
+	RetryableCodes []int
+}
+
+// withDefaults returns a copy of p with zero fields set to their defaults
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryMultiplier
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = []int{codec.StatusUnavailable}
+	} else {
+		p.RetryableCodes = slices.Clone(p.RetryableCodes)
+	}
+	return p
+}
+
+// retryable reports whether an attempt failing with err may be retried
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, ErrSendFailed) {
+		return true
+	}
+	var grpcErr *codec.GRPCError
+	return errors.As(err, &grpcErr) && slices.Contains(p.RetryableCodes, grpcErr.Code)
+}
+
+// backoff returns the jittered backoff before retry n (1 for the first):
+// a random duration between half and all of the exponential backoff, so
+// that clients failing together do not retry together
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	limit := float64(p.InitialBackoff)
+	for i := 1; i < n && limit < float64(p.MaxBackoff); i++ {
+		limit *= p.Multiplier
+	}
+	half := int64(min(limit, float64(p.MaxBackoff)) / 2)
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// SetRetryPolicy makes Invoke retry calls to the method at path according
+// to policy, marking the method as idempotent. A nil policy turns retries
+// for path off again.
+func (c *Client) SetRetryPolicy(path string, policy *RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if policy == nil {
+		delete(c.retry, path)
+		return
+	}
+	p := policy.withDefaults()
+	c.retry[path] = &p
+}
+
+// retryPolicy returns the retry policy for path, or nil if it has none
+func (c *Client) retryPolicy(path string) *RetryPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.retry[path]
+}
+
+// invokeWithRetry calls invoke until it succeeds, fails with an error the
+// policy does not retry, or runs out of attempts. A backoff that would
+// outlast ctx's deadline is not waited for; the last error is returned.
+func (c *Client) invokeWithRetry(ctx context.Context, policy *RetryPolicy, invoke func() (*codec.ResponseEnvelope, error)) (*codec.ResponseEnvelope, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := invoke()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return resp, err
+		}
+
+		wait := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-c.closed:
+			timer.Stop()
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anthropics/cf-wbrtc-auth/go/grpcweb/codec"
+)
+
+// registerFlaky registers a handler at path failing with code for the first
+// failures calls, and returns the number of calls so far
+func registerFlaky(transport *DataChannelTransport, path string, code, failures int) *atomic.Int32 {
+	var calls atomic.Int32
+	transport.RegisterHandler(path, func(ctx context.Context, req *codec.RequestEnvelope) (*codec.ResponseEnvelope, error) {
+		if calls.Add(1) <= int32(failures) {
+			return nil, &codec.GRPCError{Code: code, Message: "try again"}
+		}
+		return &codec.ResponseEnvelope{
+			Headers:  map[string]string{},
+			Messages: [][]byte{req.Message},
+		}, nil
+	})
+	return &calls
+}
+
+func TestClientRetry(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	flaky := registerFlaky(transport, "/test.Service/Flaky", codec.StatusUnavailable, 2)
+	missing := registerFlaky(transport, "/test.Service/Missing", codec.StatusNotFound, 5)
+	unmarked := registerFlaky(transport, "/test.Service/Unmarked", codec.StatusUnavailable, 5)
+	transport.Start()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	client.SetRetryPolicy("/test.Service/Flaky", policy)
+	client.SetRetryPolicy("/test.Service/Missing", policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := client.Invoke(ctx, "/test.Service/Flaky", []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if len(resp.Messages) != 1 || string(resp.Messages[0]) != "hello" {
+		t.Errorf("Expected echo of 'hello', got %q", resp.Messages)
+	}
+	if n := flaky.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+
+	// Codes outside RetryableCodes fail immediately
+	_, err = client.Invoke(ctx, "/test.Service/Missing", nil, nil)
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusNotFound {
+		t.Fatalf("Expected NOT_FOUND, got %v", err)
+	}
+	if n := missing.Load(); n != 1 {
+		t.Errorf("Expected a single attempt for NOT_FOUND, got %d", n)
+	}
+
+	// Methods without a policy are not retried
+	_, err = client.Invoke(ctx, "/test.Service/Unmarked", nil, nil)
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnavailable {
+		t.Fatalf("Expected UNAVAILABLE, got %v", err)
+	}
+	if n := unmarked.Load(); n != 1 {
+		t.Errorf("Expected a single attempt without a policy, got %d", n)
+	}
+
+	// Attempts run out
+	client.SetRetryPolicy("/test.Service/Unmarked", policy)
+	_, err = client.Invoke(ctx, "/test.Service/Unmarked", nil, nil)
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnavailable {
+		t.Fatalf("Expected UNAVAILABLE after the last attempt, got %v", err)
+	}
+	if n := unmarked.Load(); n != 4 {
+		t.Errorf("Expected 3 more attempts, got %d", n-1)
+	}
+}
+
+func TestClientRetryDeadline(t *testing.T) {
+	client, transport := newPipeClient(t, nil)
+	calls := registerFlaky(transport, "/test.Service/Flaky", codec.StatusUnavailable, 5)
+	transport.Start()
+
+	client.SetRetryPolicy("/test.Service/Flaky", &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Invoke(ctx, "/test.Service/Flaky", nil, nil)
+	var grpcErr *codec.GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codec.StatusUnavailable {
+		t.Fatalf("Expected the last UNAVAILABLE error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Invoke to give up within the deadline, took %v", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected a single attempt, since the backoff outlasts the deadline, got %d", n)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}.withDefaults()
+
+	limits := []time.Duration{10, 20, 40, 50, 50}
+	for i, limit := range limits {
+		limit *= time.Millisecond
+		for range 100 {
+			if d := p.backoff(i + 1); d < limit/2 || d > limit {
+				t.Fatalf("Retry %d: expected a backoff in [%v, %v], got %v", i+1, limit/2, limit, d)
+			}
+		}
+	}
+}
@@ -252,3 +252,23 @@ appRefreshRoute.post('/refresh', async (c) => {
     appId: tokenData.appId,
   });
 });
+
+// Revoke a refresh token (no auth middleware - the refresh token is the credential)
+// The app's current API key keeps working until it is deleted or rotated.
+appRefreshRoute.post('/revoke', async (c) => {
+  const body = await c.req.json<{ refreshToken: string }>();
+  const { refreshToken } = body;
+
+  if (!refreshToken) {
+    return c.json({ error: 'Missing refreshToken' }, 400);
+  }
+
+  const tokenData = await c.env.KV.get(`refreshtoken:${refreshToken}`);
+  if (!tokenData) {
+    return c.json({ error: 'Invalid or expired refresh token' }, 401);
+  }
+
+  await c.env.KV.delete(`refreshtoken:${refreshToken}`);
+
+  return c.json({ success: true });
+});
@@ -25,8 +25,10 @@ import {
   createDataFrame,
   createTrailerFrame,
   parseTrailers,
+  parseJSONTrailers,
   FRAME_DATA,
   FRAME_TRAILER,
+  FRAME_TRAILER_JSON,
 } from './frame';
 
 // Request envelope sent from client to server
@@ -133,6 +135,7 @@ export function encodeRequest(envelope: RequestEnvelope): Uint8Array {
  * a trailer frame (grpc-status, grpc-message, etc.)
  */
 export function decodeResponse(data: Uint8Array): ResponseEnvelope {
+  data = unmarkPayload(data, PayloadType.ENVELOPE);
   const decoder = new TextDecoder('utf-8');
   const view = new DataView(data.buffer, data.byteOffset);
 
@@ -165,17 +168,27 @@ export function decodeResponse(data: Uint8Array): ResponseEnvelope {
   // Separate data frames and trailer frame
   const messages: Uint8Array[] = [];
   let trailers: Record<string, string> = {};
+  let hasTrailerFrame = false;
 
   for (const frame of frames) {
     if (frame.flags === FRAME_DATA) {
       messages.push(frame.data);
     } else if (frame.flags === FRAME_TRAILER) {
       trailers = parseTrailers(frame.data);
+      hasTrailerFrame = true;
+    } else if (frame.flags === FRAME_TRAILER_JSON) {
+      trailers = parseJSONTrailers(frame.data);
+      hasTrailerFrame = true;
     } else {
       throw new Error(`Unknown frame flags: ${frame.flags}`);
     }
   }
 
+  // Trailers-only response: the headers carry the status
+  if (!hasTrailerFrame && messages.length === 0 && 'grpc-status' in headers) {
+    trailers = { ...headers };
+  }
+
   return {
     headers,
     messages,
@@ -295,24 +308,116 @@ export function getStatusName(code: number): string {
   return entry ? entry[0] : 'UNKNOWN';
 }
 
+/**
+ * Payload type discriminators
+ *
+ * Every DataChannel payload starts with one of these bytes so the receiver
+ * can tell envelopes and stream messages apart without guessing. Legacy
+ * payloads without a discriminator start with the high byte of a 4-byte
+ * length (0x00), so both forms can be accepted.
+ */
+export const PayloadType = {
+  ENVELOPE: 0x01, // Request or response envelope
+  STREAM: 0x02, // Stream message
+  CHUNK: 0x03, // Fragment of a larger payload
+  GOODBYE: 0x04, // Reason the peer gave for closing the DataChannel
+} as const;
+
+/**
+ * Prefix an encoded envelope or stream message with its payload type
+ */
+export function markPayload(payloadType: number, data: Uint8Array): Uint8Array {
+  const buffer = new Uint8Array(1 + data.length);
+  buffer[0] = payloadType;
+  buffer.set(data, 1);
+  return buffer;
+}
+
+/**
+ * Split a DataChannel payload into its type and body.
+ * Legacy payloads without a discriminator have type 0 and are returned unchanged.
+ */
+export function splitPayload(data: Uint8Array): { payloadType: number; body: Uint8Array } {
+  if (
+    data.length > 0 &&
+    (data[0] === PayloadType.ENVELOPE || data[0] === PayloadType.STREAM ||
+      data[0] === PayloadType.CHUNK || data[0] === PayloadType.GOODBYE)
+  ) {
+    return { payloadType: data[0], body: data.subarray(1) };
+  }
+  return { payloadType: 0, body: data };
+}
+
+function unmarkPayload(data: Uint8Array, expected: number): Uint8Array {
+  const { payloadType, body } = splitPayload(data);
+  if (payloadType !== 0 && payloadType !== expected) {
+    throw new Error(`Unexpected payload type: 0x${payloadType.toString(16).padStart(2, '0')}`);
+  }
+  return body;
+}
+
+/**
+ * Goodbye sent by the server before closing the DataChannel
+ *
+ * Format: [type(1)=GOODBYE][code(4)][message (UTF-8)]
+ * The code is usually a gRPC status code (e.g. RESOURCE_EXHAUSTED).
+ */
+export interface Goodbye {
+  code: number;
+  message: string;
+}
+
+// Size of the goodbye header, including the payload type byte
+const GOODBYE_HEADER_SIZE = 5;
+
+/**
+ * Check if data is a goodbye
+ */
+export function isGoodbye(data: Uint8Array): boolean {
+  return data.length >= GOODBYE_HEADER_SIZE && data[0] === PayloadType.GOODBYE;
+}
+
+/**
+ * Decode a goodbye received from DataChannel
+ */
+export function decodeGoodbye(data: Uint8Array): Goodbye {
+  if (!isGoodbye(data)) {
+    throw new Error('Not a goodbye');
+  }
+  const view = new DataView(data.buffer, data.byteOffset);
+  return {
+    code: view.getInt32(1, false),
+    message: new TextDecoder('utf-8', { fatal: true }).decode(data.subarray(GOODBYE_HEADER_SIZE)),
+  };
+}
+
 // Stream message flags for streaming RPC over DataChannel
 export const StreamFlag = {
   DATA: 0x00, // Data message in the stream
   END: 0x01, // Final message with trailers
+  KEEPALIVE: 0x03, // Sent by the server while a stream is idle; ignored
+  HEADER: 0x04, // Response headers as a JSON object, sent at most once before any data
+  RESUME_TOKEN: 0x05, // UTF-8 token to resume the stream from after an interruption
 } as const;
 
+// Header of a streaming request resuming an interrupted stream, and trailer
+// of an end message holding the latest resume token
+export const RESUME_TOKEN_HEADER = 'x-resume-token';
+
 // Stream message structure
 export interface StreamMessage {
   requestId: string;
   flag: number;
+  sequence: number; // Position within the stream; on END, the number of messages before it
   data: Uint8Array;
 }
 
 /**
  * Decode a stream message received from DataChannel
- * Format: [requestId_len(4)][requestId(N)][flag(1)][data...]
+ * Format: [requestId_len(4)][requestId(N)][flag(1)][sequence(4)][data...]
  */
 export function decodeStreamMessage(data: Uint8Array): StreamMessage {
+  data = unmarkPayload(data, PayloadType.STREAM);
   const view = new DataView(data.buffer, data.byteOffset);
   const decoder = new TextDecoder('utf-8');
 
@@ -326,7 +431,7 @@ export function decodeStreamMessage(data: Uint8Array): StreamMessage {
   offset += 4;
 
   // Read request ID
-  if (offset + requestIdLen + 1 > data.length) {
+  if (offset + requestIdLen + 1 + 4 > data.length) {
     throw new Error('Incomplete stream message');
   }
   const requestId = decoder.decode(data.slice(offset, offset + requestIdLen));
@@ -336,12 +441,17 @@ export function decodeStreamMessage(data: Uint8Array): StreamMessage {
   const flag = data[offset];
   offset++;
 
+  // Read sequence
+  const sequence = view.getUint32(offset, false);
+  offset += 4;
+
   // Read data
   const msgData = data.slice(offset);
 
   return {
     requestId,
     flag,
+    sequence,
     data: msgData,
   };
 }
@@ -349,7 +459,10 @@ export function decodeStreamMessage(data: Uint8Array): StreamMessage {
 /**
  * Check if data is a stream message
  *
- * Stream messages have format: [requestId_len(4)][requestId(N)][flag(1)][data]
+ * Payloads with a discriminator byte are classified exactly; the checks
+ * below are a fallback for legacy payloads without one.
+ *
+ * Stream messages have format: [requestId_len(4)][requestId(N)][flag(1)][sequence(4)][data]
  * where requestId starts with "stream-" prefix
  *
  * Unary responses have format: [headers_len(4)][headers_json(N)][grpc_frames]
@@ -359,7 +472,13 @@ export function decodeStreamMessage(data: Uint8Array): StreamMessage {
  * (stream message) or "{" (unary response)
  */
 export function isStreamMessage(data: Uint8Array): boolean {
-  if (data.length < 12) { // minimum: 4 (len) + 7 (stream-) + 1 (flag)
+  // Marked payloads are classified exactly
+  const { payloadType } = splitPayload(data);
+  if (payloadType !== 0) {
+    return payloadType === PayloadType.STREAM;
+  }
+
+  if (data.length < 16) { // minimum: 4 (len) + 7 (stream-) + 1 (flag) + 4 (sequence)
     return false;
   }
 
@@ -375,11 +494,131 @@ export function isStreamMessage(data: Uint8Array): boolean {
   if (data[4] === 0x73 && data[5] === 0x74 && data[6] === 0x72 && data[7] === 0x65 &&
       data[8] === 0x61 && data[9] === 0x6D && data[10] === 0x2D) {
     // Verify flag byte is valid
-    if (4 + len + 1 <= data.length) {
+    if (4 + len + 1 + 4 <= data.length) {
       const flag = data[4 + len];
-      return flag === StreamFlag.DATA || flag === StreamFlag.END;
+      return flag === StreamFlag.DATA || flag === StreamFlag.END ||
+        flag === StreamFlag.KEEPALIVE || flag === StreamFlag.HEADER ||
+        flag === StreamFlag.RESUME_TOKEN;
     }
   }
 
   return false;
 }
+
+/**
+ * Chunking for payloads larger than the DataChannel message size limit
+ *
+ * Chunk format: [type(1)=CHUNK][messageId(4)][index(4)][total(4)][fragment]
+ * The reassembled payload is the original DataChannel payload, including
+ * its own payload type byte.
+ */
+export const CHUNK_HEADER_SIZE = 13;
+
+// Default limit for a reassembled payload, including chunk headers
+const DEFAULT_MAX_MESSAGE_SIZE = 16 * 1024 * 1024;
+
+// Limit for payloads partially received at once. Beyond it, the payload
+// that has gone longest without a chunk is dropped, so that payloads whose
+// remaining chunks never arrive cannot block later ones.
+const MAX_PENDING_MESSAGES = 64;
+
+/**
+ * Split a payload into chunks carrying at most chunkSize bytes of it each
+ */
+export function encodeChunks(messageId: number, payload: Uint8Array, chunkSize: number): Uint8Array[] {
+  const size = chunkSize > 0 ? chunkSize : payload.length;
+  const total = Math.max(1, Math.ceil(payload.length / size));
+  const chunks: Uint8Array[] = [];
+
+  for (let i = 0; i < total; i++) {
+    const fragment = payload.subarray(i * size, Math.min((i + 1) * size, payload.length));
+    const buffer = new Uint8Array(CHUNK_HEADER_SIZE + fragment.length);
+    const view = new DataView(buffer.buffer);
+    buffer[0] = PayloadType.CHUNK;
+    view.setUint32(1, messageId, false);
+    view.setUint32(5, i, false);
+    view.setUint32(9, total, false);
+    buffer.set(fragment, CHUNK_HEADER_SIZE);
+    chunks.push(buffer);
+  }
+
+  return chunks;
+}
+
+/**
+ * Check if data is a chunk of a larger payload
+ */
+export function isChunk(data: Uint8Array): boolean {
+  return data.length >= CHUNK_HEADER_SIZE && data[0] === PayloadType.CHUNK;
+}
+
+interface PartialMessage {
+  total: number;
+  buffered: number;
+  chunks: Map<number, Uint8Array>;
+}
+
+/**
+ * Collects chunks and returns payloads once all their chunks have arrived
+ */
+export class ChunkReassembler {
+  private pending = new Map<number, PartialMessage>();
+
+  constructor(private maxMessageSize: number = DEFAULT_MAX_MESSAGE_SIZE) {}
+
+  /**
+   * Add a chunk. Returns the reassembled payload once its last chunk has
+   * been added, null otherwise. Throws (dropping the payload) if the chunks
+   * are inconsistent or too large. When too many payloads are pending, the
+   * one that has gone longest without a chunk is dropped silently.
+   */
+  add(data: Uint8Array): Uint8Array | null {
+    if (!isChunk(data)) {
+      throw new Error('Not a chunk');
+    }
+
+    const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+    const messageId = view.getUint32(1, false);
+    const index = view.getUint32(5, false);
+    const total = view.getUint32(9, false);
+    if (total === 0 || index >= total) {
+      throw new Error(`Invalid chunk index ${index} of ${total}`);
+    }
+
+    let msg = this.pending.get(messageId);
+    if (!msg) {
+      if (this.pending.size >= MAX_PENDING_MESSAGES) {
+        // Maps iterate in insertion order, so the first entry is the stalest
+        this.pending.delete(this.pending.keys().next().value!);
+      }
+      msg = { total, buffered: 0, chunks: new Map() };
+    }
+    // Re-insert to mark the payload as the most recently added to
+    this.pending.delete(messageId);
+    this.pending.set(messageId, msg);
+
+    if (total !== msg.total || msg.chunks.has(index) || msg.buffered + data.length > this.maxMessageSize) {
+      this.pending.delete(messageId);
+      throw new Error(`Invalid chunk ${index} for message ${messageId}`);
+    }
+
+    // Copy, since the fragment is a view of the received buffer
+    msg.chunks.set(index, data.slice(CHUNK_HEADER_SIZE));
+    msg.buffered += data.length;
+
+    if (msg.chunks.size < msg.total) {
+      return null;
+    }
+
+    this.pending.delete(messageId);
+    const size = msg.buffered - CHUNK_HEADER_SIZE * msg.total;
+    const payload = new Uint8Array(size);
+    let offset = 0;
+    for (let i = 0; i < msg.total; i++) {
+      const fragment = msg.chunks.get(i)!;
+      payload.set(fragment, offset);
+      offset += fragment.length;
+    }
+    return payload;
+  }
+}
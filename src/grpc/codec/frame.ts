@@ -10,6 +10,8 @@
 // Frame flags
 export const FRAME_DATA = 0x00;
 export const FRAME_TRAILER = 0x01;
+// Trailer frame whose payload is a JSON object, for values with line breaks
+export const FRAME_TRAILER_JSON = 0x03;
 
 // Frame header size (1 byte flags + 4 bytes length)
 const FRAME_HEADER_SIZE = 5;
@@ -98,6 +100,31 @@ export function createDataFrame(data: Uint8Array): Frame {
   };
 }
 
+/**
+ * Encode each message as a data frame, for framing a stream of messages
+ * outside of RPCs (no request/response envelope)
+ */
+export function encodeMessages(msgs: Uint8Array[]): Uint8Array {
+  const frames = msgs.map((msg) => encodeFrame(createDataFrame(msg)));
+  const buffer = new Uint8Array(frames.reduce((size, frame) => size + frame.length, 0));
+  let offset = 0;
+  for (const frame of frames) {
+    buffer.set(frame, offset);
+    offset += frame.length;
+  }
+  return buffer;
+}
+
+/**
+ * Decode the messages of data frames written by encodeMessages.
+ * A trailing partial frame is returned as remaining; other frames are skipped.
+ */
+export function decodeMessages(buffer: Uint8Array): { msgs: Uint8Array[]; remaining: Uint8Array } {
+  const { frames, remaining } = decodeFrames(buffer);
+  const msgs = frames.filter((frame) => frame.flags === FRAME_DATA).map((frame) => frame.data);
+  return { msgs, remaining };
+}
+
 /**
  * Helper to create a trailer frame from headers
  * Trailers are encoded as HTTP/1.1 headers format:
@@ -122,7 +149,8 @@ export function createTrailerFrame(trailers: Record<string, string>): Frame {
 
 /**
  * Parse trailer frame data to headers
- * Expects HTTP/1.1 header format: "key1: value1\r\nkey2: value2\r\n"
+ * Expects HTTP/1.1 header format: "key1: value1\r\nkey2: value2\r\n".
+ * Bare "\n" line endings and a missing final line ending are accepted too.
  */
 export function parseTrailers(data: Uint8Array): Record<string, string> {
   const decoder = new TextDecoder('utf-8');
@@ -130,8 +158,8 @@ export function parseTrailers(data: Uint8Array): Record<string, string> {
 
   const trailers: Record<string, string> = {};
 
-  // Split by CRLF
-  const lines = text.split('\r\n');
+  // Split by LF; the CR of a CRLF is trimmed with the other whitespace
+  const lines = text.split('\n');
 
   for (const line of lines) {
     // Skip empty lines
@@ -153,3 +181,29 @@ export function parseTrailers(data: Uint8Array): Record<string, string> {
 
   return trailers;
 }
+
+/**
+ * Parse the data of a JSON trailer frame (FRAME_TRAILER_JSON).
+ * Keys are normalized to lowercase.
+ */
+export function parseJSONTrailers(data: Uint8Array): Record<string, string> {
+  const decoder = new TextDecoder('utf-8');
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(decoder.decode(data));
+  } catch (e) {
+    throw new Error(`Invalid JSON trailers: ${e instanceof Error ? e.message : String(e)}`);
+  }
+  if (parsed === null || typeof parsed !== 'object' || Array.isArray(parsed)) {
+    throw new Error('Invalid JSON trailers: expected an object');
+  }
+
+  const trailers: Record<string, string> = {};
+  for (const [key, value] of Object.entries(parsed as Record<string, unknown>)) {
+    if (typeof value !== 'string') {
+      throw new Error(`Invalid JSON trailers: value of ${key} is not a string`);
+    }
+    trailers[key.toLowerCase()] = value;
+  }
+  return trailers;
+}
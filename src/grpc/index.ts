@@ -27,12 +27,16 @@ export {
   // Frame codec
   FRAME_DATA,
   FRAME_TRAILER,
+  FRAME_TRAILER_JSON,
   type Frame,
   encodeFrame,
   decodeFrames,
   createDataFrame,
   createTrailerFrame,
   parseTrailers,
+  parseJSONTrailers,
+  encodeMessages,
+  decodeMessages,
 } from './codec/frame';
 
 export {
@@ -49,9 +53,22 @@ export {
   getStatusName,
   // Stream message codec
   StreamFlag,
+  RESUME_TOKEN_HEADER,
   type StreamMessage,
   decodeStreamMessage,
   isStreamMessage,
+  // Payload discriminator
+  PayloadType,
+  markPayload,
+  splitPayload,
+  isGoodbye,
+  decodeGoodbye,
+  type Goodbye,
+  // Chunking of large payloads
+  CHUNK_HEADER_SIZE,
+  encodeChunks,
+  isChunk,
+  ChunkReassembler,
 } from './codec/envelope';
 
 // Transport exports - main API for users
@@ -59,6 +76,7 @@ export {
   DataChannelTransport,
   GrpcError,
   type CallOptions,
+  type TransportOptions,
   type UnaryResponse,
   type StreamingResponse,
 } from './transport/datachannel-transport';
@@ -68,8 +86,12 @@ export {
   ReflectionClient,
   REFLECTION_METHOD_PATH,
   FILE_CONTAINING_SYMBOL_PATH,
+  LIST_METHODS_PATH,
+  type ReflectionClientOptions,
   type ServiceInfo,
+  type MethodInfo,
   type ListServicesResponse,
+  type ListMethodsResponse,
   type FileContainingSymbolRequest,
   type FileContainingSymbolResponse,
   type FieldInfo,
@@ -15,10 +15,23 @@ export const REFLECTION_METHOD_PATH =
 export const FILE_CONTAINING_SYMBOL_PATH =
   '/grpc.reflection.v1alpha.ServerReflection/FileContainingSymbol';
 
+/** Method path for the ListMethods reflection method */
+export const LIST_METHODS_PATH =
+  '/grpc.reflection.v1alpha.ServerReflection/ListMethods';
+
 /** Information about a registered service */
 export interface ServiceInfo {
   name: string;
   methods: string[];
+  /** Streaming kind of each method, in the same order as methods (if the server reports it) */
+  methodInfo?: MethodInfo[];
+}
+
+/** Streaming kind of a method from ListServices */
+export interface MethodInfo {
+  name: string;
+  serverStreaming: boolean;
+  clientStreaming: boolean;
 }
 
 /** Response from ListServices */
@@ -26,6 +39,12 @@ export interface ListServicesResponse {
   services: ServiceInfo[];
 }
 
+/** Response from ListMethods */
+export interface ListMethodsResponse {
+  /** Full method paths (e.g. "/mypackage.MyService/GetUser"), sorted */
+  methods: string[];
+}
+
 /** Request for fileContainingSymbol */
 export interface FileContainingSymbolRequest {
   symbol: string;
@@ -495,14 +514,31 @@ export function getFieldInfo(
   return message?.fields;
 }
 
+/**
+ * Paths a server registered reflection under (Go: ReflectionOptions).
+ * Omitted paths use REFLECTION_METHOD_PATH, FILE_CONTAINING_SYMBOL_PATH and
+ * LIST_METHODS_PATH.
+ */
+export interface ReflectionClientOptions {
+  listServicesPath?: string;
+  fileContainingSymbolPath?: string;
+  listMethodsPath?: string;
+}
+
 /**
  * Reflection client for querying available services
  */
 export class ReflectionClient {
   private transport: DataChannelTransport;
+  private listServicesPath: string;
+  private fileContainingSymbolPath: string;
+  private listMethodsPath: string;
 
-  constructor(transport: DataChannelTransport) {
+  constructor(transport: DataChannelTransport, options?: ReflectionClientOptions) {
     this.transport = transport;
+    this.listServicesPath = options?.listServicesPath || REFLECTION_METHOD_PATH;
+    this.fileContainingSymbolPath = options?.fileContainingSymbolPath || FILE_CONTAINING_SYMBOL_PATH;
+    this.listMethodsPath = options?.listMethodsPath || LIST_METHODS_PATH;
   }
 
   /**
@@ -513,7 +549,7 @@ export class ReflectionClient {
    */
   async listServices(options?: CallOptions): Promise<ListServicesResponse> {
     const response = await this.transport.unary<Uint8Array, ListServicesResponse>(
-      REFLECTION_METHOD_PATH,
+      this.listServicesPath,
       new Uint8Array(0), // Empty request
       (msg) => msg, // Pass through
       (data) => {
@@ -527,6 +563,29 @@ export class ReflectionClient {
     return response.message;
   }
 
+  /**
+   * List the full paths of all available methods, which can be passed to
+   * the transport as they are
+   *
+   * @param options - Call options (timeout, headers)
+   * @returns Promise resolving to the sorted list of method paths
+   */
+  async listMethods(options?: CallOptions): Promise<ListMethodsResponse> {
+    const response = await this.transport.unary<Uint8Array, ListMethodsResponse>(
+      this.listMethodsPath,
+      new Uint8Array(0), // Empty request
+      (msg) => msg, // Pass through
+      (data) => {
+        // Parse JSON response
+        const text = new TextDecoder().decode(data);
+        return JSON.parse(text) as ListMethodsResponse;
+      },
+      options
+    );
+
+    return response.message;
+  }
+
   /**
    * Get the FileDescriptor containing a specific symbol
    *
@@ -542,7 +601,7 @@ export class ReflectionClient {
     const requestBody = new TextEncoder().encode(JSON.stringify(request));
 
     const response = await this.transport.unary<Uint8Array, FileContainingSymbolResponse>(
-      FILE_CONTAINING_SYMBOL_PATH,
+      this.fileContainingSymbolPath,
       requestBody,
       (msg) => msg, // Pass through
       (data) => {
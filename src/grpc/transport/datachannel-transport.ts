@@ -9,6 +9,7 @@
  * - Timeout handling
  * - Error responses (throws GrpcError)
  * - Channel closing (rejects all pending requests)
+ * - Goodbye from the server (rejects pending requests with its reason)
  */
 
 import {
@@ -22,12 +23,24 @@ import {
   isStreamMessage,
   decodeStreamMessage,
   StreamFlag,
+  RESUME_TOKEN_HEADER,
+  PayloadType,
+  markPayload,
+  encodeChunks,
+  isChunk,
+  ChunkReassembler,
+  isGoodbye,
+  decodeGoodbye,
+  type Goodbye,
 } from '../codec/envelope';
 import { decodeFrames, parseTrailers, FRAME_DATA, FRAME_TRAILER } from '../codec/frame';
 
 export interface CallOptions {
   timeout?: number; // ms, default 30000
   headers?: Record<string, string>;
+  // Server streaming only: resume an interrupted stream from a token it sent
+  // (see StreamingResponse.resumeToken)
+  resumeToken?: string;
 }
 
 export interface UnaryResponse<T> {
@@ -59,6 +72,18 @@ interface PendingRequest {
   timeout: ReturnType<typeof setTimeout>;
 }
 
+/**
+ * Transport options
+ */
+export interface TransportOptions {
+  /**
+   * Split outgoing payloads larger than this many bytes into chunks the
+   * server reassembles (default: no chunking). Incoming chunks are always
+   * reassembled.
+   */
+  chunkSize?: number;
+}
+
 /**
  * Streaming response interface
  */
@@ -66,12 +91,17 @@ export interface StreamingResponse<T> {
   headers: Record<string, string>;
   trailers: Record<string, string>;
   messages: AsyncIterable<T>;
+  // Latest resume token the server sent, if any. Pass it as
+  // CallOptions.resumeToken to continue the stream after an interruption.
+  resumeToken: string | undefined;
 }
 
 /**
  * Internal structure for tracking pending streaming requests
  */
 interface PendingStreamRequest {
+  onHeader: (headers: Record<string, string>) => void;
+  onResumeToken: (token: string) => void;
   onMessage: (data: Uint8Array) => void;
   onEnd: (trailers: Record<string, string>) => void;
   onError: (error: Error) => void;
@@ -91,9 +121,14 @@ export class DataChannelTransport {
   private pendingStreamRequests = new Map<string, PendingStreamRequest>();
   private requestIdCounter = 0;
   private closed = false;
+  private chunkSize: number;
+  private chunkIdCounter = 0;
+  private chunks = new ChunkReassembler();
+  private goodbyeReason: Goodbye | null = null;
 
-  constructor(dataChannel: RTCDataChannel) {
+  constructor(dataChannel: RTCDataChannel, options?: TransportOptions) {
     this.dataChannel = dataChannel;
+    this.chunkSize = options?.chunkSize ?? 0;
 
     // Set binary type to arraybuffer for receiving binary data
     this.dataChannel.binaryType = 'arraybuffer';
@@ -190,10 +225,13 @@ export class DataChannelTransport {
     // Generate request ID with stream- prefix for easier identification
     this.requestIdCounter++;
     const requestId = `stream-${Date.now()}-${this.requestIdCounter}`;
-    const headers = {
+    const headers: Record<string, string> = {
       'x-request-id': requestId,
       ...(options?.headers || {}),
     };
+    if (options?.resumeToken) {
+      headers[RESUME_TOKEN_HEADER] = options.resumeToken;
+    }
 
     // Create request envelope
     const envelope: RequestEnvelope = {
@@ -210,7 +248,10 @@ export class DataChannelTransport {
     let resolveNext: ((value: IteratorResult<Resp>) => void) | null = null;
     let streamEnded = false;
     let streamError: Error | null = null;
+    let receivedCount = 0;
+    let headers: Record<string, string> = {};
     let trailers: Record<string, string> = {};
+    let resumeToken: string | undefined;
 
     // Set up timeout
     const timeout = setTimeout(() => {
@@ -224,7 +265,14 @@ export class DataChannelTransport {
 
     // Register stream handlers
     this.pendingStreamRequests.set(requestId, {
+      onHeader: (streamHeaders: Record<string, string>) => {
+        headers = streamHeaders;
+      },
+      onResumeToken: (token: string) => {
+        resumeToken = token;
+      },
       onMessage: (data: Uint8Array) => {
+        receivedCount++;
         try {
           const message = deserialize(data);
           if (resolveNext) {
@@ -242,6 +290,9 @@ export class DataChannelTransport {
         clearTimeout(timeout);
         trailers = endTrailers;
         streamEnded = true;
+        if (endTrailers[RESUME_TOKEN_HEADER] !== undefined) {
+          resumeToken = endTrailers[RESUME_TOKEN_HEADER];
+        }
 
         // Check for gRPC error in trailers
         const status = endTrailers['grpc-status'];
@@ -251,6 +302,14 @@ export class DataChannelTransport {
           streamError = new GrpcError(code, message, endTrailers);
         }
 
+        // The server reports how many messages it sent; fewer means some were lost
+        const sentCount = endTrailers['x-stream-count'];
+        if (!streamError && sentCount !== undefined && parseInt(sentCount, 10) !== receivedCount) {
+          streamError = new Error(
+            `Stream ended after ${receivedCount} of ${sentCount} messages`
+          );
+        }
+
         if (resolveNext) {
           const resolve = resolveNext;
           resolveNext = null;
@@ -277,9 +336,9 @@ export class DataChannelTransport {
     });
 
     // Send request
-    const encodedRequest = encodeRequest(envelope);
+    const encodedRequest = markPayload(PayloadType.ENVELOPE, encodeRequest(envelope));
     try {
-      this.dataChannel.send(encodedRequest as unknown as ArrayBuffer);
+      this.send(encodedRequest);
     } catch (error) {
       clearTimeout(timeout);
       this.pendingStreamRequests.delete(requestId);
@@ -310,10 +369,16 @@ export class DataChannelTransport {
     };
 
     return {
-      headers: {}, // Headers are not sent separately in our protocol
+      // Filled in when the server sends headers, before the first message
+      get headers() {
+        return headers;
+      },
       get trailers() {
         return trailers;
       },
+      get resumeToken() {
+        return resumeToken;
+      },
       messages: {
         [Symbol.asyncIterator]: () => asyncIterator,
       },
@@ -360,11 +425,10 @@ export class DataChannelTransport {
     });
 
     // Encode and send request
-    const encodedRequest = encodeRequest(envelope);
+    const encodedRequest = markPayload(PayloadType.ENVELOPE, encodeRequest(envelope));
 
     try {
-      // Cast to ArrayBuffer for RTCDataChannel.send compatibility
-      this.dataChannel.send(encodedRequest as unknown as ArrayBuffer);
+      this.send(encodedRequest);
     } catch (error) {
       // Clean up pending request on send failure
       const pending = this.pendingRequests.get(requestId);
@@ -450,9 +514,24 @@ export class DataChannelTransport {
     }
 
     // Convert ArrayBuffer to Uint8Array
-    const data = new Uint8Array(event.data as ArrayBuffer);
+    let data = new Uint8Array(event.data as ArrayBuffer);
 
     try {
+      // Large payloads arrive in chunks; handle them once complete
+      if (isChunk(data)) {
+        const payload = this.chunks.add(data);
+        if (!payload) {
+          return;
+        }
+        data = payload;
+      }
+
+      // The server is about to close the DataChannel and says why
+      if (isGoodbye(data)) {
+        this.handleGoodbye(decodeGoodbye(data));
+        return;
+      }
+
       // Check if this is a stream message
       if (isStreamMessage(data)) {
         this.handleStreamMessage(data);
@@ -506,6 +585,20 @@ export class DataChannelTransport {
     }
   }
 
+  /**
+   * Send a payload, split into chunks if it is larger than the chunk size
+   */
+  private send(payload: Uint8Array): void {
+    const parts =
+      this.chunkSize > 0 && payload.length > this.chunkSize
+        ? encodeChunks(++this.chunkIdCounter, payload, this.chunkSize)
+        : [payload];
+    for (const part of parts) {
+      // Cast to ArrayBuffer for RTCDataChannel.send compatibility
+      this.dataChannel.send(part as unknown as ArrayBuffer);
+    }
+  }
+
   /**
    * Handle incoming stream message
    */
@@ -519,7 +612,21 @@ export class DataChannelTransport {
         return;
       }
 
-      if (streamMsg.flag === StreamFlag.DATA) {
+      if (streamMsg.flag === StreamFlag.KEEPALIVE) {
+        // The server only signals that the stream is still alive
+        return;
+      }
+
+      if (streamMsg.flag === StreamFlag.HEADER) {
+        const parsed = JSON.parse(new TextDecoder().decode(streamMsg.data)) as Record<string, string>;
+        const streamHeaders: Record<string, string> = {};
+        for (const [key, value] of Object.entries(parsed)) {
+          streamHeaders[key.toLowerCase()] = value;
+        }
+        pending.onHeader(streamHeaders);
+      } else if (streamMsg.flag === StreamFlag.RESUME_TOKEN) {
+        pending.onResumeToken(new TextDecoder().decode(streamMsg.data));
+      } else if (streamMsg.flag === StreamFlag.DATA) {
         // Decode the frame to get the message data
         const { frames } = decodeFrames(streamMsg.data);
         for (const frame of frames) {
@@ -572,6 +679,29 @@ export class DataChannelTransport {
     this.closed = true;
   }
 
+  /**
+   * Handle a goodbye from the server: reject all pending requests with its
+   * code and message. The DataChannel close that follows is then ignored.
+   */
+  private handleGoodbye(goodbye: Goodbye): void {
+    this.goodbyeReason = goodbye;
+
+    const error = new GrpcError(goodbye.code, goodbye.message || 'Server closed the connection', {});
+    for (const pending of this.pendingRequests.values()) {
+      clearTimeout(pending.timeout);
+      pending.reject(error);
+    }
+    this.pendingRequests.clear();
+
+    for (const pending of this.pendingStreamRequests.values()) {
+      clearTimeout(pending.timeout);
+      pending.onError(error);
+    }
+    this.pendingStreamRequests.clear();
+
+    this.closed = true;
+  }
+
   /**
    * Handle DataChannel error event
    */
@@ -596,6 +726,14 @@ export class DataChannelTransport {
     return this.closed;
   }
 
+  /**
+   * The reason the server gave for closing the DataChannel, if it sent a
+   * goodbye (Go: DataChannelTransport.SendGoodbye)
+   */
+  get goodbye(): Goodbye | null {
+    return this.goodbyeReason;
+  }
+
   /**
    * Get the number of pending requests
    */
@@ -583,6 +583,66 @@ describe('App Management API', () => {
     });
   });
 
+  describe('POST /api/app/revoke', () => {
+    it('should delete a valid refresh token', async () => {
+      const kv = env.KV as KVNamespace;
+
+      const refreshToken = 'rt_revoke123';
+      await kv.put(
+        `refreshtoken:${refreshToken}`,
+        JSON.stringify({
+          appId: 'app-id',
+          apiKey: 'api-key',
+          userId: TEST_USER.sub,
+          createdAt: Date.now(),
+        })
+      );
+
+      const response = await SELF.fetch('http://localhost/api/app/revoke', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ refreshToken }),
+      });
+
+      expect(response.status).toBe(200);
+      const data = await response.json();
+      expect(data.success).toBe(true);
+
+      const tokenData = await kv.get(`refreshtoken:${refreshToken}`);
+      expect(tokenData).toBeNull();
+    });
+
+    it('should return 400 when refresh token is missing', async () => {
+      const response = await SELF.fetch('http://localhost/api/app/revoke', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({}),
+      });
+
+      expect(response.status).toBe(400);
+      const data = await response.json();
+      expect(data.error).toBe('Missing refreshToken');
+    });
+
+    it('should return 401 for an already revoked token', async () => {
+      const response = await SELF.fetch('http://localhost/api/app/revoke', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ refreshToken: 'rt_revoked' }),
+      });
+
+      expect(response.status).toBe(401);
+      const data = await response.json();
+      expect(data.error).toBe('Invalid or expired refresh token');
+    });
+  });
+
   describe('Integration: Multiple Apps Workflow', () => {
     it('should handle creating, listing, and deleting multiple apps', async () => {
       // Create 3 apps